@@ -0,0 +1,144 @@
+// Command ca-expiry reports certificates of Fabric CA instances which expire soon, or serves expiry metrics
+// for Prometheus with -listen.
+//
+//	ca-expiry -ca org1=org1-ca.yaml -ca org2=org2-ca.yaml -cert admin.pem -key admin-key.pem -within 720h -format md
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/hlfans/ca-sdk/pkg/client"
+	"github.com/hlfans/ca-sdk/pkg/crypto"
+	"github.com/hlfans/ca-sdk/pkg/expiry"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	var (
+		configs  []string
+		certPath = flag.String(`cert`, ``, `PEM certificate of identity allowed to list certificates`)
+		keyPath  = flag.String(`key`, ``, `PEM private key of identity`)
+		format   = flag.String(`format`, string(expiry.FormatMarkdown), `report format: json, csv or markdown`)
+		within   = flag.Duration(`within`, 30*24*time.Hour, `report certificates expiring within duration, 0 reports all`)
+		listen   = flag.String(`listen`, ``, `serve metrics at address instead of writing report`)
+		interval = flag.Duration(`interval`, 10*time.Minute, `collection interval of metrics server`)
+	)
+	flag.Func(`ca`, `CA as name=client config path, can be repeated`, func(v string) error {
+		if name, path, ok := strings.Cut(v, `=`); !ok || name == `` || path == `` {
+			return fmt.Errorf(`must be name=path`)
+		}
+		configs = append(configs, v)
+		return nil
+	})
+	flag.Parse()
+
+	if len(configs) == 0 || *certPath == `` || *keyPath == `` {
+		flag.Usage()
+		return fmt.Errorf(`-ca, -cert and -key are required`)
+	}
+	reportFormat, err := expiry.ParseFormat(*format)
+	if err != nil {
+		return err
+	}
+
+	signer, err := loadSigner(*certPath, *keyPath)
+	if err != nil {
+		return err
+	}
+	var sources []expiry.Source
+	for _, c := range configs {
+		name, path, _ := strings.Cut(c, `=`)
+		cli, err := client.NewHttp(client.WithYamlConfig(path), client.WithIdentity(signer))
+		if err != nil {
+			return fmt.Errorf(`create client of %s: %w`, name, err)
+		}
+		sources = append(sources, expiry.Source{Name: name, Client: cli})
+	}
+
+	inventory, err := expiry.New(sources, expiry.WithInterval(*interval))
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if *listen != `` {
+		return serve(ctx, inventory, *listen)
+	}
+
+	// report of collected CAs is written anyway, failed ones are listed in it and fail the command
+	refreshErr := inventory.Refresh(ctx)
+	if err = expiry.NewReport(inventory.Snapshot(), *within).Write(os.Stdout, reportFormat); err != nil {
+		return err
+	}
+	if refreshErr != nil {
+		return fmt.Errorf(`collect certificates: %w`, refreshErr)
+	}
+	return nil
+}
+
+func serve(ctx context.Context, inventory *expiry.Inventory, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle(`GET /metrics`, inventory.Handler())
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go inventory.Run(ctx)
+	go func() {
+		<-ctx.Done()
+		_ = srv.Shutdown(context.Background())
+	}()
+
+	slog.Info(`serving certificate expiry metrics`, slog.String(`addr`, addr))
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf(`serve metrics: %w`, err)
+	}
+	return nil
+}
+
+func loadSigner(certPath, keyPath string) (crypto.Signer, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, fmt.Errorf(`read certificate: %w`, err)
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil, fmt.Errorf(`certificate %s is not PEM encoded`, certPath)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf(`parse certificate: %w`, err)
+	}
+
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf(`read private key: %w`, err)
+	}
+	if block, _ = pem.Decode(keyPEM); block == nil {
+		return nil, fmt.Errorf(`private key %s is not PEM encoded`, keyPath)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if key, err = x509.ParseECPrivateKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf(`parse private key: %w`, err)
+		}
+	}
+	return crypto.NewSigner(cert, key)
+}
@@ -0,0 +1,117 @@
+// Package jose verifies JWS signatures and parses JWK public keys shared by ACME and OIDC front-ends
+package jose
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// Verify checks signature of signing input made with one of ES256, ES384 or RS256 algorithms
+func Verify(alg string, pub crypto.PublicKey, signingInput, sig []byte) error {
+	switch key := pub.(type) {
+	case *ecdsa.PublicKey:
+		var digest []byte
+		switch {
+		case alg == `ES256` && key.Curve == elliptic.P256():
+			sum := sha256.Sum256(signingInput)
+			digest = sum[:]
+		case alg == `ES384` && key.Curve == elliptic.P384():
+			sum := sha512.Sum384(signingInput)
+			digest = sum[:]
+		default:
+			return fmt.Errorf(`unsupported algorithm %s for ECDSA key`, alg)
+		}
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return fmt.Errorf(`invalid ECDSA signature length`)
+		}
+		r, s := new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return fmt.Errorf(`invalid signature`)
+		}
+	case *rsa.PublicKey:
+		if alg != `RS256` {
+			return fmt.Errorf(`unsupported algorithm %s for RSA key`, alg)
+		}
+		sum := sha256.Sum256(signingInput)
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], sig); err != nil {
+			return fmt.Errorf(`invalid signature: %w`, err)
+		}
+	default:
+		return fmt.Errorf(`unsupported key type %T`, pub)
+	}
+	return nil
+}
+
+// ParseJWK parses EC P-256, P-384 or RSA public key of at least 2048 bits
+func ParseJWK(raw []byte) (crypto.PublicKey, error) {
+	var k jwk
+	if err := json.Unmarshal(raw, &k); err != nil {
+		return nil, fmt.Errorf(`parse JWK: %w`, err)
+	}
+
+	decode := func(v string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(v)
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf(`invalid JWK parameter`)
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+
+	switch k.Kty {
+	case `EC`:
+		var curve elliptic.Curve
+		switch k.Crv {
+		case `P-256`:
+			curve = elliptic.P256()
+		case `P-384`:
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf(`unsupported curve %s`, k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		if _, err = pub.ECDH(); err != nil {
+			return nil, fmt.Errorf(`invalid EC point: %w`, err)
+		}
+		return pub, nil
+	case `RSA`:
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if n.BitLen() < 2048 || !e.IsInt64() {
+			return nil, fmt.Errorf(`RSA key is too weak`)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	}
+	return nil, fmt.Errorf(`unsupported key type %s`, k.Kty)
+}
@@ -0,0 +1,97 @@
+// Package abac implements attribute-based access control on top of attributes which Fabric CA embeds to ECerts.
+package abac
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/hlfans/ca-sdk/pkg/entity"
+)
+
+const (
+	AttrEnrollmentID = `hf.EnrollmentID`
+	AttrType         = `hf.Type`
+	AttrAffiliation  = `hf.Affiliation`
+)
+
+// AttributesOID is the ECert extension containing JSON encoded attributes
+var AttributesOID = asn1.ObjectIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 1}
+
+type (
+	// Identity is the identity described by ECert
+	Identity struct {
+		EnrollmentID string
+		Type         string
+		Affiliation  string
+		Attrs        []entity.IdentityAttribute
+	}
+
+	attributesExtension struct {
+		Attrs map[string]string `json:"attrs"`
+	}
+)
+
+// Attributes extracts attributes from ECert. Certificate without attributes extension has no attributes
+func Attributes(cert *x509.Certificate) ([]entity.IdentityAttribute, error) {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(AttributesOID) {
+			continue
+		}
+
+		var attrs attributesExtension
+		if err := json.Unmarshal(ext.Value, &attrs); err != nil {
+			return nil, fmt.Errorf(`unmarshal attributes extension: %w`, err)
+		}
+
+		out := make([]entity.IdentityAttribute, 0, len(attrs.Attrs))
+		for name, value := range attrs.Attrs {
+			out = append(out, entity.IdentityAttribute{Name: name, Value: value, ECert: true})
+		}
+		sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+		return out, nil
+	}
+	return nil, nil
+}
+
+// FromCertificate extracts identity from ECert. Enrollment ID falls back to certificate common name
+func FromCertificate(cert *x509.Certificate) (*Identity, error) {
+	attrs, err := Attributes(cert)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{Attrs: attrs}
+	identity.EnrollmentID, _ = identity.Attr(AttrEnrollmentID)
+	identity.Type, _ = identity.Attr(AttrType)
+	identity.Affiliation, _ = identity.Attr(AttrAffiliation)
+	if identity.EnrollmentID == `` {
+		identity.EnrollmentID = cert.Subject.CommonName
+	}
+	return identity, nil
+}
+
+// Attr returns value of attribute
+func (i *Identity) Attr(name string) (string, bool) {
+	for _, a := range i.Attrs {
+		if a.Name == name {
+			return a.Value, true
+		}
+	}
+	return ``, false
+}
+
+// value returns value of attribute or identity field
+func (i *Identity) value(name string) (string, bool) {
+	switch name {
+	case AttrEnrollmentID:
+		return i.EnrollmentID, i.EnrollmentID != ``
+	case AttrType:
+		return i.Type, i.Type != ``
+	case AttrAffiliation:
+		return i.Affiliation, i.Affiliation != ``
+	}
+	return i.Attr(name)
+}
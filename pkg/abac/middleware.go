@@ -0,0 +1,121 @@
+package abac
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+
+	"github.com/hlfans/ca-sdk/pkg/auth"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+var errNoCertificate = errors.New(`client certificate not found`)
+
+type identityKey struct{}
+
+// IdentityFromContext returns identity authorized by middleware
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(*Identity)
+	return identity, ok
+}
+
+// authorize extracts identity from certificate and checks it against policy
+func authorize(ctx context.Context, policy *Policy, cert *x509.Certificate) (context.Context, error) {
+	if cert == nil {
+		return nil, errNoCertificate
+	}
+	identity, err := FromCertificate(cert)
+	if err != nil {
+		return nil, err
+	}
+	if err = policy.Authorize(identity); err != nil {
+		return nil, err
+	}
+	return context.WithValue(ctx, identityKey{}, identity), nil
+}
+
+// verifiedCertificate returns leaf of the first chain verified by TLS. Unverified peer certificates are ignored,
+// with tls.RequestClientCert or tls.RequireAnyClientCert they may be self-signed with any attributes
+func verifiedCertificate(state *tls.ConnectionState) *x509.Certificate {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return state.VerifiedChains[0][0]
+}
+
+// Middleware authorizes HTTP requests by policy. Certificate is taken from auth.Verifier middleware,
+// if it precedes this one, or from TLS client certificate verified by server
+// (tls.RequireAndVerifyClientCert or tls.VerifyClientCertIfGiven)
+func Middleware(policy *Policy, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cert, ok := auth.CertificateFromContext(r.Context())
+		if !ok {
+			cert = verifiedCertificate(r.TLS)
+		}
+
+		ctx, err := authorize(r.Context(), policy, cert)
+		switch {
+		case errors.Is(err, ErrAccessDenied):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		default:
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}
+	})
+}
+
+// UnaryServerInterceptor authorizes gRPC calls by policy using TLS client certificate verified by server
+func UnaryServerInterceptor(policy *Policy) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authorizeGRPC(ctx, policy)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor authorizes gRPC streams by policy using TLS client certificate verified by server
+func StreamServerInterceptor(policy *Policy) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authorizeGRPC(ss.Context(), policy)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func authorizeGRPC(ctx context.Context, policy *Policy) (context.Context, error) {
+	var cert *x509.Certificate
+	if p, ok := peer.FromContext(ctx); ok {
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			cert = verifiedCertificate(&tlsInfo.State)
+		}
+	}
+
+	authorized, err := authorize(ctx, policy, cert)
+	switch {
+	case errors.Is(err, ErrAccessDenied):
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return authorized, nil
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
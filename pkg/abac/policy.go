@@ -0,0 +1,326 @@
+package abac
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ErrAccessDenied is returned when identity doesn't satisfy policy
+var ErrAccessDenied = errors.New(`access denied`)
+
+// Policy is compiled authorization expression. Expression supports:
+//
+//	attr == "value", attr != "value"   comparison of attribute value
+//	attr in ["a", "b"]                  attribute value is one of listed
+//	attr has "value"                    comma separated attribute value contains item, e.g. hf.Registrar.Roles
+//	attr                                attribute value is "true", e.g. hf.Revoker
+//	!, &&, || and parentheses
+//
+// Missing attributes have empty value. Example: `hf.Type == "admin" && role in ["auditor", "operator"]`
+type Policy struct {
+	expr string
+	root node
+}
+
+// MustCompile is like Compile but panics on invalid expression
+func MustCompile(expr string) *Policy {
+	p, err := Compile(expr)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+func Compile(expr string) (*Policy, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, fmt.Errorf(`policy %q: %w`, expr, err)
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.or()
+	if err == nil && !p.done() {
+		err = fmt.Errorf(`unexpected %q`, p.peek().text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf(`policy %q: %w`, expr, err)
+	}
+	return &Policy{expr: expr, root: root}, nil
+}
+
+// Allowed reports whether identity satisfies policy
+func (p *Policy) Allowed(identity *Identity) bool {
+	return identity != nil && p.root.eval(identity)
+}
+
+// Authorize returns ErrAccessDenied if identity doesn't satisfy policy
+func (p *Policy) Authorize(identity *Identity) error {
+	if !p.Allowed(identity) {
+		return fmt.Errorf(`%w: policy %s`, ErrAccessDenied, p.expr)
+	}
+	return nil
+}
+
+func (p *Policy) String() string {
+	return p.expr
+}
+
+type node interface {
+	eval(identity *Identity) bool
+}
+
+type (
+	orNode  struct{ left, right node }
+	andNode struct{ left, right node }
+	notNode struct{ inner node }
+	// operand is attribute name or string literal
+	operand struct {
+		literal bool
+		value   string
+	}
+	compareNode struct {
+		left, right operand
+		equal       bool
+	}
+	inNode struct {
+		attr   operand
+		values []string
+	}
+	hasNode struct {
+		attr  operand
+		value string
+	}
+	truthyNode struct{ attr operand }
+)
+
+func (n orNode) eval(i *Identity) bool  { return n.left.eval(i) || n.right.eval(i) }
+func (n andNode) eval(i *Identity) bool { return n.left.eval(i) && n.right.eval(i) }
+func (n notNode) eval(i *Identity) bool { return !n.inner.eval(i) }
+
+func (o operand) resolve(i *Identity) string {
+	if o.literal {
+		return o.value
+	}
+	v, _ := i.value(o.value)
+	return v
+}
+
+func (n compareNode) eval(i *Identity) bool {
+	return (n.left.resolve(i) == n.right.resolve(i)) == n.equal
+}
+
+func (n inNode) eval(i *Identity) bool {
+	v := n.attr.resolve(i)
+	for _, candidate := range n.values {
+		if v == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+func (n hasNode) eval(i *Identity) bool {
+	for _, item := range strings.Split(n.attr.resolve(i), `,`) {
+		if item = strings.TrimSpace(item); item == n.value || item == `*` {
+			return true
+		}
+	}
+	return false
+}
+
+func (n truthyNode) eval(i *Identity) bool {
+	return n.attr.resolve(i) == `true`
+}
+
+type tokenKind int
+
+const (
+	tokenIdent tokenKind = iota
+	tokenString
+	tokenOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func tokenize(expr string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(expr); {
+		c := rune(expr[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(expr) && expr[j] != '"'; j++ {
+				if expr[j] == '\\' && j+1 < len(expr) {
+					j++
+				}
+				b.WriteByte(expr[j])
+			}
+			if j >= len(expr) {
+				return nil, fmt.Errorf(`unterminated string at %d`, i)
+			}
+			tokens = append(tokens, token{kind: tokenString, text: b.String()})
+			i = j + 1
+		case strings.HasPrefix(expr[i:], `&&`), strings.HasPrefix(expr[i:], `||`),
+			strings.HasPrefix(expr[i:], `==`), strings.HasPrefix(expr[i:], `!=`):
+			tokens = append(tokens, token{kind: tokenOp, text: expr[i : i+2]})
+			i += 2
+		case strings.ContainsRune(`!()[],`, c):
+			tokens = append(tokens, token{kind: tokenOp, text: string(c)})
+			i++
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(expr) && (unicode.IsLetter(rune(expr[j])) || unicode.IsDigit(rune(expr[j])) || strings.ContainsRune(`_.-`, rune(expr[j]))) {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: expr[i:j]})
+			i = j
+		default:
+			return nil, fmt.Errorf(`unexpected character %q at %d`, c, i)
+		}
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) done() bool { return p.pos >= len(p.tokens) }
+
+func (p *parser) peek() token {
+	if p.done() {
+		return token{kind: tokenOp}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) accept(kind tokenKind, text string) bool {
+	if t := p.peek(); !p.done() && t.kind == kind && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(kind tokenKind, text string) error {
+	if !p.accept(kind, text) {
+		if p.done() {
+			return fmt.Errorf(`expected %q, got end of expression`, text)
+		}
+		return fmt.Errorf(`expected %q, got %q`, text, p.peek().text)
+	}
+	return nil
+}
+
+func (p *parser) or() (node, error) {
+	left, err := p.and()
+	for err == nil && p.accept(tokenOp, `||`) {
+		var right node
+		if right, err = p.and(); err == nil {
+			left = orNode{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *parser) and() (node, error) {
+	left, err := p.unary()
+	for err == nil && p.accept(tokenOp, `&&`) {
+		var right node
+		if right, err = p.unary(); err == nil {
+			left = andNode{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *parser) unary() (node, error) {
+	if p.accept(tokenOp, `!`) {
+		inner, err := p.unary()
+		return notNode{inner}, err
+	}
+	if p.accept(tokenOp, `(`) {
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return inner, p.expect(tokenOp, `)`)
+	}
+	return p.comparison()
+}
+
+func (p *parser) operand() (operand, error) {
+	if p.done() {
+		return operand{}, fmt.Errorf(`unexpected end of expression`)
+	}
+	t := p.tokens[p.pos]
+	switch t.kind {
+	case tokenIdent:
+		p.pos++
+		return operand{value: t.text}, nil
+	case tokenString:
+		p.pos++
+		return operand{literal: true, value: t.text}, nil
+	}
+	return operand{}, fmt.Errorf(`unexpected %q`, t.text)
+}
+
+func (p *parser) comparison() (node, error) {
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case p.accept(tokenOp, `==`), p.accept(tokenOp, `!=`):
+		equal := p.tokens[p.pos-1].text == `==`
+		right, err := p.operand()
+		return compareNode{left: left, right: right, equal: equal}, err
+	case p.accept(tokenIdent, `in`):
+		values, err := p.list()
+		return inNode{attr: left, values: values}, err
+	case p.accept(tokenIdent, `has`):
+		value, err := p.operand()
+		if err == nil && !value.literal {
+			err = fmt.Errorf(`has expects string, got %s`, value.value)
+		}
+		return hasNode{attr: left, value: value.value}, err
+	}
+
+	if left.literal {
+		return nil, fmt.Errorf(`string %q is not a condition`, left.value)
+	}
+	return truthyNode{attr: left}, nil
+}
+
+func (p *parser) list() ([]string, error) {
+	if err := p.expect(tokenOp, `[`); err != nil {
+		return nil, err
+	}
+	var values []string
+	for !p.accept(tokenOp, `]`) {
+		if len(values) > 0 {
+			if err := p.expect(tokenOp, `,`); err != nil {
+				return nil, err
+			}
+		}
+		v, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		if !v.literal {
+			return nil, fmt.Errorf(`list expects strings, got %s`, v.value)
+		}
+		values = append(values, v.value)
+	}
+	return values, nil
+}
@@ -0,0 +1,589 @@
+package acmeserver
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hlfans/ca-sdk/internal/jose"
+	"golang.org/x/crypto/acme"
+)
+
+const (
+	errPrefix = `urn:ietf:params:acme:error:`
+
+	errAccountDoesNotExist     = `accountDoesNotExist`
+	errBadCSR                  = `badCSR`
+	errBadNonce                = `badNonce`
+	errBadSignatureAlgorithm   = `badSignatureAlgorithm`
+	errConnection              = `connection`
+	errExternalAccountRequired = `externalAccountRequired`
+	errIncorrectResponse       = `incorrectResponse`
+	errMalformed               = `malformed`
+	errOrderNotReady           = `orderNotReady`
+	errRejectedIdentifier      = `rejectedIdentifier`
+	errServerInternal          = `serverInternal`
+	errUnauthorized            = `unauthorized`
+
+	maxBodySize = 64 << 10
+)
+
+type problem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+	Status int    `json:"status"`
+}
+
+func newProblem(status int, typ, detail string) *problem {
+	return &problem{Type: errPrefix + typ, Detail: detail, Status: status}
+}
+
+// signedRequest is verified JWS request
+type signedRequest struct {
+	url     string
+	payload []byte
+	account *account
+	key     crypto.PublicKey
+}
+
+// postAsGet reports whether request has empty payload, RFC 8555 6.3
+func (r *signedRequest) postAsGet() bool {
+	return len(r.payload) == 0
+}
+
+// Handler returns HTTP handler of ACME resources. Directory is served at /directory
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(`GET /directory`, s.handleDirectory)
+	mux.HandleFunc(`HEAD /new-nonce`, s.handleNonce)
+	mux.HandleFunc(`GET /new-nonce`, s.handleNonce)
+	mux.HandleFunc(`POST /new-account`, s.handleNewAccount)
+	mux.HandleFunc(`POST /account/{id}`, s.signed(s.handleAccount))
+	mux.HandleFunc(`POST /new-order`, s.signed(s.handleNewOrder))
+	mux.HandleFunc(`POST /order/{id}`, s.signed(s.handleOrder))
+	mux.HandleFunc(`POST /authz/{id}`, s.signed(s.handleAuthz))
+	mux.HandleFunc(`POST /challenge/{id}`, s.signed(s.handleChallenge))
+	mux.HandleFunc(`POST /finalize/{id}`, s.signed(s.handleFinalize))
+	mux.HandleFunc(`POST /cert/{id}`, s.signed(s.handleCert))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(`Replay-Nonce`, s.newNonce())
+		w.Header().Set(`Cache-Control`, `no-store`)
+		w.Header().Set(`Link`, fmt.Sprintf(`<%s/directory>;rel="index"`, baseURL(r)))
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleDirectory(w http.ResponseWriter, r *http.Request) {
+	base := baseURL(r)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		`newNonce`:   base + `/new-nonce`,
+		`newAccount`: base + `/new-account`,
+		`newOrder`:   base + `/new-order`,
+		`meta`:       map[string]interface{}{`externalAccountRequired`: s.eabRequired},
+	})
+}
+
+func (s *Server) handleNonce(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Server) handleNewAccount(w http.ResponseWriter, r *http.Request) {
+	req, prob := s.authenticate(r, true)
+	if prob != nil {
+		writeProblem(w, prob)
+		return
+	}
+
+	var payload struct {
+		Contact                []string        `json:"contact"`
+		OnlyReturnExisting     bool            `json:"onlyReturnExisting"`
+		ExternalAccountBinding json.RawMessage `json:"externalAccountBinding"`
+	}
+	if err := json.Unmarshal(req.payload, &payload); err != nil {
+		writeProblem(w, newProblem(http.StatusBadRequest, errMalformed, err.Error()))
+		return
+	}
+	thumbprint, err := acme.JWKThumbprint(req.key)
+	if err != nil {
+		writeProblem(w, newProblem(http.StatusBadRequest, errMalformed, err.Error()))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id, ok := s.accountByKey[thumbprint]; ok {
+		w.Header().Set(`Location`, baseURL(r)+`/account/`+id)
+		writeJSON(w, http.StatusOK, accountJSON(s.accounts[id]))
+		return
+	}
+	if payload.OnlyReturnExisting {
+		writeProblem(w, newProblem(http.StatusBadRequest, errAccountDoesNotExist, `no account for this key`))
+		return
+	}
+
+	acc := &account{id: randomID(), key: req.key, thumbprint: thumbprint, contact: payload.Contact}
+	if len(payload.ExternalAccountBinding) > 0 {
+		if acc.eab, prob = s.bindExternalAccount(payload.ExternalAccountBinding, req.url, thumbprint); prob != nil {
+			writeProblem(w, prob)
+			return
+		}
+	} else if s.eabRequired {
+		writeProblem(w, newProblem(http.StatusBadRequest, errExternalAccountRequired, `external account binding is required`))
+		return
+	}
+
+	s.accounts[acc.id] = acc
+	s.accountByKey[thumbprint] = acc.id
+	w.Header().Set(`Location`, baseURL(r)+`/account/`+acc.id)
+	writeJSON(w, http.StatusCreated, accountJSON(acc))
+}
+
+// bindExternalAccount verifies external account binding JWS, RFC 8555 7.3.4
+func (s *Server) bindExternalAccount(raw []byte, url, thumbprint string) (*externalAccount, *problem) {
+	msg, header, payload, err := parseJWS(raw)
+	if err != nil {
+		return nil, newProblem(http.StatusBadRequest, errMalformed, `external account binding: `+err.Error())
+	}
+	eab, ok := s.externalAccounts[header.KID]
+	if !ok || header.Alg != `HS256` || header.URL != url || header.Nonce != `` {
+		return nil, newProblem(http.StatusUnauthorized, errUnauthorized, `unknown or malformed external account binding`)
+	}
+	if err = msg.verifyMAC(eab.key); err != nil {
+		return nil, newProblem(http.StatusUnauthorized, errUnauthorized, `external account binding: `+err.Error())
+	}
+	bound, err := jose.ParseJWK(payload)
+	if err != nil {
+		return nil, newProblem(http.StatusBadRequest, errMalformed, `external account binding: `+err.Error())
+	}
+	if boundThumbprint, err := acme.JWKThumbprint(bound); err != nil || boundThumbprint != thumbprint {
+		return nil, newProblem(http.StatusUnauthorized, errUnauthorized, `external account binding is for another key`)
+	}
+	return eab, nil
+}
+
+func (s *Server) handleAccount(w http.ResponseWriter, r *http.Request, req *signedRequest) {
+	if r.PathValue(`id`) != req.account.id {
+		writeProblem(w, newProblem(http.StatusForbidden, errUnauthorized, `account belongs to another key`))
+		return
+	}
+	w.Header().Set(`Location`, req.url)
+	writeJSON(w, http.StatusOK, accountJSON(req.account))
+}
+
+func (s *Server) handleNewOrder(w http.ResponseWriter, r *http.Request, req *signedRequest) {
+	var payload struct {
+		Identifiers []identifier `json:"identifiers"`
+	}
+	if err := json.Unmarshal(req.payload, &payload); err != nil || len(payload.Identifiers) == 0 {
+		writeProblem(w, newProblem(http.StatusBadRequest, errMalformed, `order must have identifiers`))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o := &order{id: randomID(), accountID: req.account.id, status: statusPending, expires: time.Now().Add(defaultOrderLifetime)}
+	seen := map[string]bool{}
+	for _, id := range payload.Identifiers {
+		id.Value = strings.ToLower(strings.TrimSuffix(id.Value, `.`))
+		if id.Type != `dns` || !validDomain(strings.TrimPrefix(id.Value, `*.`)) {
+			writeProblem(w, newProblem(http.StatusBadRequest, errRejectedIdentifier, fmt.Sprintf(`identifier %q`, id.Value)))
+			return
+		}
+		preauthorized := req.account.preauthorized(id)
+		if strings.HasPrefix(id.Value, `*.`) && !preauthorized {
+			writeProblem(w, newProblem(http.StatusBadRequest, errRejectedIdentifier,
+				`wildcard identifiers need external account authorization`))
+			return
+		}
+		if seen[id.Value] {
+			continue
+		}
+		seen[id.Value] = true
+		o.identifiers = append(o.identifiers, id)
+
+		authz := &authorization{id: randomID(), accountID: req.account.id, orderID: o.id, status: statusPending,
+			expires: o.expires, identifier: id}
+		if preauthorized {
+			authz.status = statusValid
+		} else {
+			chal := &challenge{id: randomID(), authzID: authz.id, status: statusPending, token: randomToken()}
+			authz.challengeID = chal.id
+			s.challenges[chal.id] = chal
+		}
+		s.authzs[authz.id] = authz
+		o.authzIDs = append(o.authzIDs, authz.id)
+	}
+	s.updateOrder(o)
+	s.orders[o.id] = o
+
+	w.Header().Set(`Location`, baseURL(r)+`/order/`+o.id)
+	writeJSON(w, http.StatusCreated, s.orderJSON(r, o))
+}
+
+func (s *Server) handleOrder(w http.ResponseWriter, r *http.Request, req *signedRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[r.PathValue(`id`)]
+	if !ok || o.accountID != req.account.id {
+		writeProblem(w, newProblem(http.StatusNotFound, errMalformed, `order not found`))
+		return
+	}
+	w.Header().Set(`Location`, req.url)
+	writeJSON(w, http.StatusOK, s.orderJSON(r, o))
+}
+
+func (s *Server) handleAuthz(w http.ResponseWriter, r *http.Request, req *signedRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	authz, ok := s.authzs[r.PathValue(`id`)]
+	if !ok || authz.accountID != req.account.id {
+		writeProblem(w, newProblem(http.StatusNotFound, errMalformed, `authorization not found`))
+		return
+	}
+	writeJSON(w, http.StatusOK, s.authzJSON(r, authz))
+}
+
+func (s *Server) handleChallenge(w http.ResponseWriter, r *http.Request, req *signedRequest) {
+	s.mu.Lock()
+	chal, ok := s.challenges[r.PathValue(`id`)]
+	if !ok || s.authzs[chal.authzID].accountID != req.account.id {
+		s.mu.Unlock()
+		writeProblem(w, newProblem(http.StatusNotFound, errMalformed, `challenge not found`))
+		return
+	}
+	authz := s.authzs[chal.authzID]
+	start := !req.postAsGet() && chal.status == statusPending
+	if start {
+		chal.status = statusProcessing
+	}
+	s.mu.Unlock()
+
+	if start {
+		prob := s.validate(r.Context(), authz.identifier.Value, chal.token, req.account.thumbprint)
+
+		s.mu.Lock()
+		if prob == nil {
+			chal.status, chal.validated, authz.status = statusValid, time.Now(), statusValid
+		} else {
+			chal.status, chal.problem, authz.status = statusInvalid, prob, statusInvalid
+		}
+		s.updateOrder(s.orders[authz.orderID])
+		s.mu.Unlock()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Add(`Link`, fmt.Sprintf(`<%s/authz/%s>;rel="up"`, baseURL(r), authz.id))
+	writeJSON(w, http.StatusOK, s.challengeJSON(r, chal))
+}
+
+func (s *Server) handleFinalize(w http.ResponseWriter, r *http.Request, req *signedRequest) {
+	var payload struct {
+		CSR string `json:"csr"`
+	}
+	if err := json.Unmarshal(req.payload, &payload); err != nil {
+		writeProblem(w, newProblem(http.StatusBadRequest, errMalformed, err.Error()))
+		return
+	}
+	der, err := base64.RawURLEncoding.DecodeString(payload.CSR)
+	if err != nil {
+		writeProblem(w, newProblem(http.StatusBadRequest, errBadCSR, `decode CSR: `+err.Error()))
+		return
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err == nil {
+		err = csr.CheckSignature()
+	}
+	if err != nil {
+		writeProblem(w, newProblem(http.StatusBadRequest, errBadCSR, err.Error()))
+		return
+	}
+
+	s.mu.Lock()
+	o, ok := s.orders[r.PathValue(`id`)]
+	if !ok || o.accountID != req.account.id {
+		s.mu.Unlock()
+		writeProblem(w, newProblem(http.StatusNotFound, errMalformed, `order not found`))
+		return
+	}
+	if o.status != statusReady {
+		s.mu.Unlock()
+		writeProblem(w, newProblem(http.StatusForbidden, errOrderNotReady, `order is `+o.status))
+		return
+	}
+	if prob := checkCSRNames(csr, o.identifiers); prob != nil {
+		s.mu.Unlock()
+		writeProblem(w, prob)
+		return
+	}
+	o.status = statusProcessing
+	s.mu.Unlock()
+
+	chain, err := s.issue(r.Context(), csr)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), `issue ACME certificate`, slog.String(`order`, o.id), slog.Any(`error`, err))
+		o.status, o.problem = statusInvalid, newProblem(http.StatusInternalServerError, errServerInternal, `certificate issuance failed`)
+	} else {
+		o.status, o.certID = statusValid, randomID()
+		s.certs[o.certID] = chain
+	}
+	w.Header().Set(`Location`, baseURL(r)+`/order/`+o.id)
+	writeJSON(w, http.StatusOK, s.orderJSON(r, o))
+}
+
+func (s *Server) handleCert(w http.ResponseWriter, r *http.Request, req *signedRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := r.PathValue(`id`)
+	for _, o := range s.orders {
+		if o.certID == id && o.accountID == req.account.id {
+			w.Header().Set(`Content-Type`, `application/pem-certificate-chain`)
+			_, _ = w.Write(s.certs[id])
+			return
+		}
+	}
+	writeProblem(w, newProblem(http.StatusNotFound, errMalformed, `certificate not found`))
+}
+
+// signed verifies JWS of request signed with account key
+func (s *Server) signed(next func(w http.ResponseWriter, r *http.Request, req *signedRequest)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, prob := s.authenticate(r, false)
+		if prob != nil {
+			writeProblem(w, prob)
+			return
+		}
+		next(w, r, req)
+	}
+}
+
+// authenticate checks JWS of request. New accounts present JWK, existing ones use account URL as kid
+func (s *Server) authenticate(r *http.Request, newAccount bool) (*signedRequest, *problem) {
+	if ct := r.Header.Get(`Content-Type`); ct != `application/jose+json` {
+		return nil, newProblem(http.StatusUnsupportedMediaType, errMalformed, `content type must be application/jose+json`)
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		return nil, newProblem(http.StatusBadRequest, errMalformed, err.Error())
+	}
+	msg, header, payload, err := parseJWS(body)
+	if err != nil {
+		return nil, newProblem(http.StatusBadRequest, errMalformed, err.Error())
+	}
+
+	req := &signedRequest{url: baseURL(r) + r.URL.Path, payload: payload}
+	if header.URL != req.url {
+		return nil, newProblem(http.StatusUnauthorized, errUnauthorized, `JWS url doesn't match request`)
+	}
+	if !s.useNonce(header.Nonce) {
+		return nil, newProblem(http.StatusBadRequest, errBadNonce, `invalid or reused nonce`)
+	}
+
+	switch {
+	case newAccount && len(header.JWK) > 0 && header.KID == ``:
+		if req.key, err = jose.ParseJWK(header.JWK); err != nil {
+			return nil, newProblem(http.StatusBadRequest, errMalformed, err.Error())
+		}
+	case !newAccount && header.KID != `` && len(header.JWK) == 0:
+		accountURL := baseURL(r) + `/account/`
+		s.mu.Lock()
+		req.account = s.accounts[strings.TrimPrefix(header.KID, accountURL)]
+		s.mu.Unlock()
+		if !strings.HasPrefix(header.KID, accountURL) || req.account == nil {
+			return nil, newProblem(http.StatusBadRequest, errAccountDoesNotExist, `unknown account`)
+		}
+		req.key = req.account.key
+	default:
+		return nil, newProblem(http.StatusBadRequest, errMalformed, `JWS must contain either jwk or kid`)
+	}
+
+	if err = msg.verify(header.Alg, req.key); err != nil {
+		return nil, newProblem(http.StatusBadRequest, errBadSignatureAlgorithm, err.Error())
+	}
+	return req, nil
+}
+
+func (s *Server) newNonce() string {
+	nonce := randomToken()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.nonces) >= maxNonces {
+		// drop arbitrary half, clients retry on badNonce
+		for n := range s.nonces {
+			if delete(s.nonces, n); len(s.nonces) < maxNonces/2 {
+				break
+			}
+		}
+	}
+	s.nonces[nonce] = struct{}{}
+	return nonce
+}
+
+func (s *Server) useNonce(nonce string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.nonces[nonce]; !ok {
+		return false
+	}
+	delete(s.nonces, nonce)
+	return true
+}
+
+// validDomain reports whether name is fully qualified domain name of LDH labels, RFC 5890 2.3.1.
+// IP literals, single labels and localhost are rejected, they would make http-01 validation
+// fetch internal addresses
+func validDomain(name string) bool {
+	if len(name) > 253 || net.ParseIP(name) != nil || name == `localhost` || strings.HasSuffix(name, `.localhost`) {
+		return false
+	}
+	labels := strings.Split(name, `.`)
+	if len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	// top level domain is never all-numeric, so dotted numbers aren't taken for names
+	tld := labels[len(labels)-1]
+	return strings.Trim(tld, `0123456789`) != ``
+}
+
+// checkCSRNames requires CSR to request exactly order identifiers. Common name must be one of them,
+// it is enrollment id of identity the certificate is issued for
+func checkCSRNames(csr *x509.CertificateRequest, identifiers []identifier) *problem {
+	if !containsIdentifier(identifiers, csr.Subject.CommonName) {
+		return newProblem(http.StatusBadRequest, errBadCSR, `CSR common name must be one of order identifiers`)
+	}
+	names := map[string]bool{}
+	for _, n := range csr.DNSNames {
+		names[strings.ToLower(n)] = true
+	}
+	if csr.Subject.CommonName != `` {
+		names[strings.ToLower(csr.Subject.CommonName)] = true
+	}
+	if len(csr.IPAddresses) > 0 || len(csr.EmailAddresses) > 0 || len(csr.URIs) > 0 || len(names) != len(identifiers) {
+		return newProblem(http.StatusBadRequest, errBadCSR, `CSR names don't match order identifiers`)
+	}
+	for _, id := range identifiers {
+		if !names[id.Value] {
+			return newProblem(http.StatusBadRequest, errBadCSR, fmt.Sprintf(`CSR doesn't contain %s`, id.Value))
+		}
+	}
+	return nil
+}
+
+func containsIdentifier(identifiers []identifier, name string) bool {
+	for _, id := range identifiers {
+		if id.Value == name {
+			return true
+		}
+	}
+	return false
+}
+
+func accountJSON(acc *account) map[string]interface{} {
+	return map[string]interface{}{`status`: statusValid, `contact`: acc.contact}
+}
+
+// orderJSON renders order, must be called with s.mu held
+func (s *Server) orderJSON(r *http.Request, o *order) map[string]interface{} {
+	base := baseURL(r)
+	authzs := make([]string, len(o.authzIDs))
+	for i, id := range o.authzIDs {
+		authzs[i] = base + `/authz/` + id
+	}
+	ids := append([]identifier(nil), o.identifiers...)
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Value < ids[j].Value })
+
+	out := map[string]interface{}{
+		`status`:         o.status,
+		`expires`:        o.expires.UTC().Format(time.RFC3339),
+		`identifiers`:    ids,
+		`authorizations`: authzs,
+		`finalize`:       base + `/finalize/` + o.id,
+	}
+	if o.certID != `` {
+		out[`certificate`] = base + `/cert/` + o.certID
+	}
+	if o.problem != nil {
+		out[`error`] = o.problem
+	}
+	return out
+}
+
+// authzJSON renders authorization, must be called with s.mu held
+func (s *Server) authzJSON(r *http.Request, authz *authorization) map[string]interface{} {
+	challenges := []interface{}{}
+	if chal, ok := s.challenges[authz.challengeID]; ok {
+		challenges = append(challenges, s.challengeJSON(r, chal))
+	}
+	return map[string]interface{}{
+		`status`:     authz.status,
+		`expires`:    authz.expires.UTC().Format(time.RFC3339),
+		`identifier`: authz.identifier,
+		`challenges`: challenges,
+		`wildcard`:   strings.HasPrefix(authz.identifier.Value, `*.`),
+	}
+}
+
+func (s *Server) challengeJSON(r *http.Request, chal *challenge) map[string]interface{} {
+	out := map[string]interface{}{
+		`type`:   challengeHTTP01,
+		`url`:    baseURL(r) + `/challenge/` + chal.id,
+		`token`:  chal.token,
+		`status`: chal.status,
+	}
+	if !chal.validated.IsZero() {
+		out[`validated`] = chal.validated.UTC().Format(time.RFC3339)
+	}
+	if chal.problem != nil {
+		out[`error`] = chal.problem
+	}
+	return out
+}
+
+func baseURL(r *http.Request) string {
+	scheme := `http`
+	if r.TLS != nil {
+		scheme = `https`
+	}
+	return scheme + `://` + r.Host
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set(`Content-Type`, `application/json`)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeProblem(w http.ResponseWriter, prob *problem) {
+	w.Header().Set(`Content-Type`, `application/problem+json`)
+	w.WriteHeader(prob.Status)
+	_ = json.NewEncoder(w).Encode(prob)
+}
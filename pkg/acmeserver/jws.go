@@ -0,0 +1,70 @@
+package acmeserver
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hlfans/ca-sdk/internal/jose"
+)
+
+// jwsMessage is flattened JWS JSON serialization, RFC 8555 6.2
+type jwsMessage struct {
+	Protected string `json:"protected"`
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+type jwsHeader struct {
+	Alg   string          `json:"alg"`
+	Nonce string          `json:"nonce"`
+	URL   string          `json:"url"`
+	JWK   json.RawMessage `json:"jwk"`
+	KID   string          `json:"kid"`
+}
+
+func parseJWS(body []byte) (*jwsMessage, *jwsHeader, []byte, error) {
+	var msg jwsMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, nil, nil, fmt.Errorf(`parse JWS: %w`, err)
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(msg.Protected)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf(`decode protected header: %w`, err)
+	}
+	var header jwsHeader
+	if err = json.Unmarshal(rawHeader, &header); err != nil {
+		return nil, nil, nil, fmt.Errorf(`parse protected header: %w`, err)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(msg.Payload)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf(`decode payload: %w`, err)
+	}
+	return &msg, &header, payload, nil
+}
+
+// verify checks JWS signature made with one of ES256, ES384 or RS256 algorithms
+func (m *jwsMessage) verify(alg string, pub crypto.PublicKey) error {
+	sig, err := base64.RawURLEncoding.DecodeString(m.Signature)
+	if err != nil {
+		return fmt.Errorf(`decode signature: %w`, err)
+	}
+	return jose.Verify(alg, pub, []byte(m.Protected+`.`+m.Payload), sig)
+}
+
+// verifyMAC checks HS256 signature of external account binding
+func (m *jwsMessage) verifyMAC(key []byte) error {
+	sig, err := base64.RawURLEncoding.DecodeString(m.Signature)
+	if err != nil {
+		return fmt.Errorf(`decode signature: %w`, err)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(m.Protected + `.` + m.Payload))
+	if !hmac.Equal(mac.Sum(nil), sig) {
+		return fmt.Errorf(`invalid MAC`)
+	}
+	return nil
+}
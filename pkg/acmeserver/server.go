@@ -0,0 +1,367 @@
+// Package acmeserver implements ACME (RFC 8555) server which issues certificates from Fabric CA.
+// Identifiers are validated with http-01 challenge or pre-authorized by external account binding,
+// finalized orders are enrolled with the tls profile for identity named by common name of CSR, which
+// is registered on behalf of registrar.
+// State is kept in memory.
+package acmeserver
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hlfans/ca-sdk/pkg/client"
+	"github.com/hlfans/ca-sdk/pkg/request"
+)
+
+const (
+	statusPending    = `pending`
+	statusReady      = `ready`
+	statusProcessing = `processing`
+	statusValid      = `valid`
+	statusInvalid    = `invalid`
+
+	challengeHTTP01 = `http-01`
+
+	defaultOrderLifetime = 24 * time.Hour
+	maxNonces            = 10000
+)
+
+type Opt func(s *Server) error
+
+// WithExternalAccount adds pre-shared external account binding key. Accounts bound with it get identifiers
+// matching domains authorized without challenges. Domain `*.example.com` matches all subdomains of example.com
+func WithExternalAccount(keyID string, hmacKey []byte, domains ...string) Opt {
+	return func(s *Server) error {
+		if keyID == `` || len(hmacKey) == 0 {
+			return fmt.Errorf(`external account key id and key are required`)
+		}
+		s.externalAccounts[keyID] = &externalAccount{key: hmacKey, domains: domains}
+		return nil
+	}
+}
+
+// WithExternalAccountRequired rejects accounts without external account binding
+func WithExternalAccountRequired() Opt {
+	return func(s *Server) error {
+		s.eabRequired = true
+		return nil
+	}
+}
+
+// WithProfile sets Fabric CA enrollment profile. Default is tls
+func WithProfile(profile client.EnrollProfile) Opt {
+	return func(s *Server) error {
+		s.profile = profile
+		return nil
+	}
+}
+
+// WithRegistration sets type and affiliation of identities registered for domains. Identity is named
+// by domain, because CA requires common name of CSR to be enrollment id. Default is client type without affiliation
+func WithRegistration(identityType request.IdentityType, affiliation string) Opt {
+	return func(s *Server) error {
+		s.identityType, s.affiliation = identityType, affiliation
+		return nil
+	}
+}
+
+// WithSecretKey sets key from which enrollment secrets of domain identities are derived. The key must be stable
+// across restarts and replicas of server, otherwise certificates of domains issued before can't be issued again.
+// Default is random key
+func WithSecretKey(key []byte) Opt {
+	return func(s *Server) error {
+		if len(key) < 32 {
+			return fmt.Errorf(`secret key must be at least 32 bytes`)
+		}
+		s.secretKey = key
+		return nil
+	}
+}
+
+// WithHTTP01Port sets port where http-01 challenge responses are fetched. Default is 80
+func WithHTTP01Port(port int) Opt {
+	return func(s *Server) error {
+		s.http01Port = port
+		return nil
+	}
+}
+
+// WithHTTPClient sets client used for http-01 validation
+func WithHTTPClient(httpClient *http.Client) Opt {
+	return func(s *Server) error {
+		s.httpClient = httpClient
+		return nil
+	}
+}
+
+func WithLogger(logger *slog.Logger) Opt {
+	return func(s *Server) error {
+		s.logger = logger
+		return nil
+	}
+}
+
+type externalAccount struct {
+	key     []byte
+	domains []string
+}
+
+type account struct {
+	id         string
+	key        crypto.PublicKey
+	thumbprint string
+	contact    []string
+	eab        *externalAccount
+}
+
+type identifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type order struct {
+	id          string
+	accountID   string
+	status      string
+	expires     time.Time
+	identifiers []identifier
+	authzIDs    []string
+	certID      string
+	problem     *problem
+}
+
+type authorization struct {
+	id          string
+	accountID   string
+	orderID     string
+	status      string
+	expires     time.Time
+	identifier  identifier
+	challengeID string
+}
+
+type challenge struct {
+	id        string
+	authzID   string
+	status    string
+	token     string
+	validated time.Time
+	problem   *problem
+}
+
+// Server is ACME server issuing certificates from Fabric CA
+type Server struct {
+	registrar        client.Client
+	profile          client.EnrollProfile
+	identityType     request.IdentityType
+	affiliation      string
+	secretKey        []byte
+	externalAccounts map[string]*externalAccount
+	eabRequired      bool
+	http01Port       int
+	httpClient       *http.Client
+	logger           *slog.Logger
+	chainPEM         []byte
+
+	mu           sync.Mutex
+	nonces       map[string]struct{}
+	accounts     map[string]*account
+	accountByKey map[string]string
+	orders       map[string]*order
+	authzs       map[string]*authorization
+	challenges   map[string]*challenge
+	certs        map[string][]byte
+}
+
+// New creates ACME server. Registrar must be allowed to get and register identities of configured type and affiliation
+func New(ctx context.Context, registrar client.Client, opts ...Opt) (*Server, error) {
+	s := &Server{
+		registrar:        registrar,
+		profile:          client.EnrollProfileTls,
+		identityType:     request.IdentityTypeClient,
+		externalAccounts: map[string]*externalAccount{},
+		http01Port:       80,
+		httpClient:       &http.Client{Timeout: 10 * time.Second},
+		logger:           slog.Default(),
+		nonces:           map[string]struct{}{},
+		accounts:         map[string]*account{},
+		accountByKey:     map[string]string{},
+		orders:           map[string]*order{},
+		authzs:           map[string]*authorization{},
+		challenges:       map[string]*challenge{},
+		certs:            map[string][]byte{},
+	}
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, fmt.Errorf(`apply ACME option: %w`, err)
+		}
+	}
+
+	if s.secretKey == nil {
+		s.secretKey = make([]byte, 32)
+		if _, err := rand.Read(s.secretKey); err != nil {
+			return nil, fmt.Errorf(`generate secret key: %w`, err)
+		}
+	}
+
+	info, err := registrar.CAInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf(`get CA info: %w`, err)
+	}
+	if s.chainPEM, err = base64.StdEncoding.DecodeString(info.CAChain); err != nil {
+		return nil, fmt.Errorf(`decode CA chain: %w`, err)
+	}
+	return s, nil
+}
+
+// validate fetches http-01 key authorization, must be called without s.mu held
+func (s *Server) validate(ctx context.Context, domain, token, thumbprint string) *problem {
+	url := (&neturl.URL{
+		Scheme: `http`,
+		Host:   net.JoinHostPort(domain, strconv.Itoa(s.http01Port)),
+		Path:   `/.well-known/acme-challenge/` + token,
+	}).String()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return newProblem(http.StatusBadRequest, errConnection, err.Error())
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return newProblem(http.StatusBadRequest, errConnection, fmt.Sprintf(`fetch %s: %s`, url, err))
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if err != nil {
+		return newProblem(http.StatusBadRequest, errConnection, fmt.Sprintf(`read %s: %s`, url, err))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return newProblem(http.StatusBadRequest, errUnauthorized, fmt.Sprintf(`%s responded with %d`, url, resp.StatusCode))
+	}
+	if expected := token + `.` + thumbprint; strings.TrimSpace(string(body)) != expected {
+		return newProblem(http.StatusBadRequest, errIncorrectResponse, `key authorization mismatch`)
+	}
+	return nil
+}
+
+// issue enrolls CSR for identity named by its common name, identity is registered on first issuance
+// for domain. Must be called without s.mu held
+func (s *Server) issue(ctx context.Context, csr *x509.CertificateRequest) ([]byte, error) {
+	name := csr.Subject.CommonName
+	if err := s.ensureRegistered(ctx, name); err != nil {
+		return nil, err
+	}
+
+	cert, _, err := s.registrar.Enroll(ctx, name, s.secret(name), csr, client.WithEnrollProfile(s.profile))
+	switch {
+	case errors.Is(err, client.ErrAuthenticationFailure):
+		return nil, fmt.Errorf(`enroll %s: identity isn't registered with secret key of ACME server: %w`, name, err)
+	case err != nil:
+		return nil, fmt.Errorf(`enroll %s: %w`, name, err)
+	}
+	return append(pem.EncodeToMemory(&pem.Block{Type: `CERTIFICATE`, Bytes: cert.Raw}), s.chainPEM...), nil
+}
+
+// ensureRegistered registers identity of domain if CA doesn't know it. Existing identity is reused only
+// if it has configured type and affiliation, so identities registered for other purposes aren't enrolled
+func (s *Server) ensureRegistered(ctx context.Context, name string) error {
+	identity, err := s.registrar.IdentityGet(ctx, name)
+	switch {
+	case err == nil:
+		if identity.Type != string(s.identityType) || identity.Affiliation != s.affiliation {
+			return fmt.Errorf(`identity %s of type %q and affiliation %q isn't registered by ACME server`,
+				name, identity.Type, identity.Affiliation)
+		}
+		return nil
+	case !errors.Is(err, client.ErrIdentityNotFound):
+		return fmt.Errorf(`get identity %s: %w`, name, err)
+	}
+
+	_, err = s.registrar.Register(ctx, request.Registration{
+		Name:           name,
+		Type:           string(s.identityType),
+		Secret:         s.secret(name),
+		MaxEnrollments: -1,
+		Affiliation:    s.affiliation,
+	})
+	// concurrent order of the same domain registers it as well
+	if err != nil && !errors.Is(err, client.ErrAlreadyRegistered) {
+		return fmt.Errorf(`register %s: %w`, name, err)
+	}
+	return nil
+}
+
+// secret derives enrollment secret of identity from server key
+func (s *Server) secret(name string) string {
+	mac := hmac.New(sha256.New, s.secretKey)
+	mac.Write([]byte(name))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// preauthorized reports whether external account of acc allows identifier without challenge
+func (acc *account) preauthorized(id identifier) bool {
+	if acc.eab == nil {
+		return false
+	}
+	for _, d := range acc.eab.domains {
+		if d == id.Value || strings.HasPrefix(d, `*.`) && strings.HasSuffix(id.Value, d[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// updateOrder recomputes status of pending order from its authorizations, must be called with s.mu held
+func (s *Server) updateOrder(o *order) {
+	if o.status != statusPending {
+		return
+	}
+	ready := true
+	for _, id := range o.authzIDs {
+		switch s.authzs[id].status {
+		case statusInvalid:
+			o.status = statusInvalid
+			return
+		case statusValid:
+		default:
+			ready = false
+		}
+	}
+	if ready {
+		o.status = statusReady
+	}
+}
+
+func randomID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func randomToken() string {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
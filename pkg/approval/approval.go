@@ -0,0 +1,247 @@
+// Package approval queues sensitive CA operations until they are approved by quorum of distinct identities.
+// Requests are signed by proposer, approvals and cancellations are signed by their authors, and every
+// signature is verified again before execution.
+package approval
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hlfans/ca-sdk/pkg/abac"
+	"github.com/hlfans/ca-sdk/pkg/client"
+	cacrypto "github.com/hlfans/ca-sdk/pkg/crypto"
+	"github.com/hlfans/ca-sdk/pkg/request"
+)
+
+var (
+	ErrNotFound = errors.New(`approval request not found`)
+	// ErrNotPending is returned for requests which are executed, cancelled or expired
+	ErrNotPending = errors.New(`approval request is not pending`)
+	// ErrQuorumNotReached is returned by Execute if request has not enough valid approvals
+	ErrQuorumNotReached = errors.New(`approval quorum not reached`)
+	// ErrInvalidSignature is returned for signatures, which don't match request or certificate
+	ErrInvalidSignature = errors.New(`invalid approval signature`)
+	// ErrUnauthorized is returned for signers with invalid certificate or not allowed by policy
+	ErrUnauthorized = errors.New(`signer is not authorized`)
+	// ErrDuplicateApprover is returned if proposer approves own request or approver approves twice
+	ErrDuplicateApprover = errors.New(`duplicate approver`)
+)
+
+// Status of request
+type Status string
+
+const (
+	StatusPending   Status = `pending`
+	StatusExecuting Status = `executing`
+	StatusExecuted  Status = `executed`
+	StatusFailed    Status = `failed`
+	StatusCancelled Status = `cancelled`
+	StatusExpired   Status = `expired`
+)
+
+const (
+	rolePropose = `propose`
+	roleApprove = `approve`
+	roleCancel  = `cancel`
+)
+
+// Action is sensitive Client operation with its arguments
+type Action struct {
+	Operation  client.Operation           `json:"operation"`
+	Revocation *request.RevocationRequest `json:"revocation,omitempty"`
+	// Affiliation and Force are arguments of affiliation deletion
+	Affiliation string `json:"affiliation,omitempty"`
+	Force       bool   `json:"force,omitempty"`
+}
+
+// RevokeAction revokes identity or certificate
+func RevokeAction(req request.RevocationRequest) Action {
+	return Action{Operation: client.OperationRevoke, Revocation: &req}
+}
+
+// AffiliationDeleteAction deletes affiliation, with force its identities and sub-affiliations are deleted too
+func AffiliationDeleteAction(name string, force bool) Action {
+	return Action{Operation: client.OperationAffiliationDelete, Affiliation: name, Force: force}
+}
+
+func (a Action) validate() error {
+	switch a.Operation {
+	case client.OperationRevoke:
+		if a.Revocation == nil || a.Revocation.Name == `` && (a.Revocation.Serial == `` || a.Revocation.AKI == ``) {
+			return fmt.Errorf(`revocation requires either name or serial and aki`)
+		}
+	case client.OperationAffiliationDelete:
+		if a.Affiliation == `` {
+			return fmt.Errorf(`affiliation deletion requires name`)
+		}
+	default:
+		return fmt.Errorf(`operation %s can't be approved`, a.Operation)
+	}
+	return nil
+}
+
+func (a Action) String() string {
+	switch a.Operation {
+	case client.OperationRevoke:
+		if a.Revocation.Name != `` {
+			return fmt.Sprintf(`revoke identity %s`, a.Revocation.Name)
+		}
+		return fmt.Sprintf(`revoke certificate serial %s aki %s`, a.Revocation.Serial, a.Revocation.AKI)
+	case client.OperationAffiliationDelete:
+		if a.Force {
+			return fmt.Sprintf(`force delete affiliation %s`, a.Affiliation)
+		}
+		return fmt.Sprintf(`delete affiliation %s`, a.Affiliation)
+	}
+	return string(a.Operation)
+}
+
+// Proposal is signed content of request
+type Proposal struct {
+	ID         string    `json:"id"`
+	Action     Action    `json:"action"`
+	Comment    string    `json:"comment,omitempty"`
+	ProposedAt time.Time `json:"proposed_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// Signature is signature of proposal by identity
+type Signature struct {
+	EnrollmentID string `json:"enrollment_id"`
+	// Certificate is PEM encoded certificate of signer
+	Certificate string    `json:"certificate"`
+	Signature   []byte    `json:"signature"`
+	SignedAt    time.Time `json:"signed_at"`
+}
+
+// Result is outcome of execution
+type Result struct {
+	Executor   string    `json:"executor,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at,omitzero"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Request is proposal with collected signatures
+type Request struct {
+	Proposal
+	Proposer     Signature
+	Approvals    []Signature
+	Cancellation *Signature
+	Result       *Result
+	Status       Status
+}
+
+// signedPayload is content signed by role. Approvals and cancellations also sign proposer signature,
+// so they can't be moved to another request with the same proposal
+type signedPayload struct {
+	Role              string    `json:"role"`
+	Proposal          Proposal  `json:"proposal"`
+	ProposerSignature []byte    `json:"proposer_signature,omitempty"`
+	SignedAt          time.Time `json:"signed_at"`
+}
+
+func payload(role string, proposal Proposal, proposerSignature []byte, signedAt time.Time) ([]byte, error) {
+	b, err := json.Marshal(signedPayload{Role: role, Proposal: proposal, ProposerSignature: proposerSignature,
+		SignedAt: signedAt.UTC()})
+	if err != nil {
+		return nil, fmt.Errorf(`marshal signed payload: %w`, err)
+	}
+	return b, nil
+}
+
+// SignApproval signs approval of request, so it can be added to queue with AddApproval by other process
+func SignApproval(req *Request, signer cacrypto.Signer) (Signature, error) {
+	return sign(signer, roleApprove, req.Proposal, req.Proposer.Signature, time.Now())
+}
+
+func sign(signer cacrypto.Signer, role string, proposal Proposal, proposerSignature []byte, at time.Time) (Signature, error) {
+	cert, err := parseCertificate(string(signer.Certificate()))
+	if err != nil {
+		return Signature{}, err
+	}
+	identity, err := abac.FromCertificate(cert)
+	if err != nil {
+		return Signature{}, fmt.Errorf(`read identity of signer: %w`, err)
+	}
+
+	at = at.UTC()
+	msg, err := payload(role, proposal, proposerSignature, at)
+	if err != nil {
+		return Signature{}, err
+	}
+	digest, opts := msg, crypto.SignerOpts(crypto.Hash(0))
+	if _, ok := signer.Public().(ed25519.PublicKey); !ok {
+		sum := sha256.Sum256(msg)
+		digest, opts = sum[:], crypto.SHA256
+	}
+	sig, err := signer.Sign(rand.Reader, digest, opts)
+	if err != nil {
+		return Signature{}, fmt.Errorf(`sign %s: %w`, role, err)
+	}
+	return Signature{
+		EnrollmentID: identity.EnrollmentID,
+		Certificate:  string(signer.Certificate()),
+		Signature:    sig,
+		SignedAt:     at,
+	}, nil
+}
+
+// verifySignature checks signature and returns certificate and identity of signer
+func verifySignature(sig Signature, role string, proposal Proposal, proposerSignature []byte) (
+	*x509.Certificate, *abac.Identity, error) {
+	cert, err := parseCertificate(sig.Certificate)
+	if err != nil {
+		return nil, nil, fmt.Errorf(`%w: %s`, ErrInvalidSignature, err)
+	}
+	identity, err := abac.FromCertificate(cert)
+	if err != nil {
+		return nil, nil, fmt.Errorf(`%w: %s`, ErrInvalidSignature, err)
+	}
+	if identity.EnrollmentID != sig.EnrollmentID {
+		return nil, nil, fmt.Errorf(`%w: certificate belongs to %s, not %s`,
+			ErrInvalidSignature, identity.EnrollmentID, sig.EnrollmentID)
+	}
+
+	msg, err := payload(role, proposal, proposerSignature, sig.SignedAt)
+	if err != nil {
+		return nil, nil, err
+	}
+	var algorithm x509.SignatureAlgorithm
+	switch cert.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		algorithm = x509.ECDSAWithSHA256
+	case *rsa.PublicKey:
+		algorithm = x509.SHA256WithRSA
+	case ed25519.PublicKey:
+		algorithm = x509.PureEd25519
+	default:
+		return nil, nil, fmt.Errorf(`%w: unsupported key %T`, ErrInvalidSignature, cert.PublicKey)
+	}
+	if err = cert.CheckSignature(algorithm, msg, sig.Signature); err != nil {
+		return nil, nil, fmt.Errorf(`%w: %s of %s: %s`, ErrInvalidSignature, role, sig.EnrollmentID, err)
+	}
+	return cert, identity, nil
+}
+
+func parseCertificate(certPEM string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil {
+		return nil, fmt.Errorf(`certificate is not PEM encoded`)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf(`parse certificate: %w`, err)
+	}
+	return cert, nil
+}
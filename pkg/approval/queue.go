@@ -0,0 +1,568 @@
+package approval
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hlfans/ca-sdk/pkg/abac"
+	"github.com/hlfans/ca-sdk/pkg/client"
+	cacrypto "github.com/hlfans/ca-sdk/pkg/crypto"
+	"github.com/hlfans/ca-sdk/pkg/verify"
+)
+
+const (
+	defaultQuorum = 1
+	defaultTTL    = 24 * time.Hour
+
+	fileRequest   = `request.json`
+	fileCancel    = `cancel.json`
+	fileExecution = `execution.json`
+	prefixApprove = `approval-`
+)
+
+type Opt func(q *Queue) error
+
+// WithQuorum sets number of distinct approvers other than proposer. Default is 1, so every operation
+// is performed by two persons
+func WithQuorum(n int) Opt {
+	return func(q *Queue) error {
+		if n < 1 {
+			return fmt.Errorf(`quorum must be positive`)
+		}
+		q.quorum = n
+		return nil
+	}
+}
+
+// WithTTL sets how long request waits for approvals. Default is 24h
+func WithTTL(ttl time.Duration) Opt {
+	return func(q *Queue) error {
+		if ttl <= 0 {
+			return fmt.Errorf(`ttl must be positive`)
+		}
+		q.ttl = ttl
+		return nil
+	}
+}
+
+// WithVerifier sets verifier of signer certificates. By default verifier is built from CA chain and CRL of client
+func WithVerifier(v *verify.Verifier) Opt {
+	return func(q *Queue) error {
+		q.verifier = v
+		return nil
+	}
+}
+
+// WithProposerPolicy allows proposing only to identities satisfying policy. By default any valid identity proposes
+func WithProposerPolicy(policy *abac.Policy) Opt {
+	return func(q *Queue) error {
+		q.proposers = policy
+		return nil
+	}
+}
+
+// WithApproverPolicy counts approvals only of identities satisfying policy. By default any valid identity approves
+func WithApproverPolicy(policy *abac.Policy) Opt {
+	return func(q *Queue) error {
+		q.approvers = policy
+		return nil
+	}
+}
+
+func WithLogger(logger *slog.Logger) Opt {
+	return func(q *Queue) error {
+		q.logger = logger
+		return nil
+	}
+}
+
+// WithClock overrides current time
+func WithClock(now func() time.Time) Opt {
+	return func(q *Queue) error {
+		q.now = now
+		return nil
+	}
+}
+
+// Queue keeps requests in directory, one subdirectory per request. Every signature is stored in its own file,
+// which is created exclusively, so processes sharing directory don't overwrite each other and request
+// is executed once
+type Queue struct {
+	dir       string
+	cli       client.Client
+	verifier  *verify.Verifier
+	quorum    int
+	ttl       time.Duration
+	proposers *abac.Policy
+	approvers *abac.Policy
+	logger    *slog.Logger
+	now       func() time.Time
+}
+
+// New creates queue in dir. Approved operations are executed by cli
+func New(ctx context.Context, cli client.Client, dir string, opts ...Opt) (*Queue, error) {
+	q := &Queue{
+		dir:    dir,
+		cli:    cli,
+		quorum: defaultQuorum,
+		ttl:    defaultTTL,
+		logger: slog.Default(),
+		now:    time.Now,
+	}
+	for _, opt := range opts {
+		if err := opt(q); err != nil {
+			return nil, fmt.Errorf(`apply approval queue option: %w`, err)
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf(`create approval queue directory: %w`, err)
+	}
+	if q.verifier == nil {
+		var err error
+		if q.verifier, err = verify.New(ctx, cli); err != nil {
+			return nil, fmt.Errorf(`create certificate verifier: %w`, err)
+		}
+	}
+	return q, nil
+}
+
+// Propose queues action signed by proposer
+func (q *Queue) Propose(ctx context.Context, proposer cacrypto.Signer, action Action, comment string) (*Request, error) {
+	if err := action.validate(); err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf(`generate request id: %w`, err)
+	}
+	now := q.now().UTC()
+	proposal := Proposal{
+		ID:         hex.EncodeToString(id),
+		Action:     action,
+		Comment:    comment,
+		ProposedAt: now,
+		ExpiresAt:  now.Add(q.ttl),
+	}
+
+	sig, err := sign(proposer, rolePropose, proposal, nil, now)
+	if err != nil {
+		return nil, err
+	}
+	if err = q.authorize(ctx, sig, rolePropose, proposal, nil, q.proposers); err != nil {
+		return nil, err
+	}
+
+	if err = os.Mkdir(filepath.Join(q.dir, proposal.ID), 0o700); err != nil {
+		return nil, fmt.Errorf(`create request directory: %w`, err)
+	}
+	stored := storedRequest{Proposal: proposal, Proposer: sig}
+	if err = createExclusive(filepath.Join(q.dir, proposal.ID, fileRequest), stored); err != nil {
+		return nil, err
+	}
+	q.logger.InfoContext(ctx, `approval requested`, slog.String(`id`, proposal.ID),
+		slog.String(`action`, action.String()), slog.String(`proposer`, sig.EnrollmentID))
+	return q.Get(proposal.ID)
+}
+
+// Approve signs approval of request by approver
+func (q *Queue) Approve(ctx context.Context, id string, approver cacrypto.Signer) (*Request, error) {
+	req, err := q.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := SignApproval(req, approver)
+	if err != nil {
+		return nil, err
+	}
+	return q.AddApproval(ctx, id, sig)
+}
+
+// AddApproval adds approval signed by SignApproval
+func (q *Queue) AddApproval(ctx context.Context, id string, sig Signature) (*Request, error) {
+	req, err := q.pending(id)
+	if err != nil {
+		return nil, err
+	}
+	if err = q.authorize(ctx, sig, roleApprove, req.Proposal, req.Proposer.Signature, q.approvers); err != nil {
+		return nil, err
+	}
+	if sig.EnrollmentID == req.Proposer.EnrollmentID {
+		return nil, fmt.Errorf(`%w: %s proposed request`, ErrDuplicateApprover, sig.EnrollmentID)
+	}
+	key, err := signerKey(sig)
+	if err != nil {
+		return nil, err
+	}
+	for _, other := range append([]Signature{req.Proposer}, req.Approvals...) {
+		otherKey, err := signerKey(other)
+		if err != nil {
+			return nil, err
+		}
+		if key == otherKey {
+			return nil, fmt.Errorf(`%w: key of %s is used by %s`, ErrDuplicateApprover, sig.EnrollmentID, other.EnrollmentID)
+		}
+	}
+
+	err = createExclusive(filepath.Join(q.dir, id, approvalFile(sig.EnrollmentID)), sig)
+	if errors.Is(err, os.ErrExist) {
+		return nil, fmt.Errorf(`%w: %s already approved request`, ErrDuplicateApprover, sig.EnrollmentID)
+	} else if err != nil {
+		return nil, err
+	}
+	q.logger.InfoContext(ctx, `approval added`, slog.String(`id`, id), slog.String(`approver`, sig.EnrollmentID))
+	return q.Get(id)
+}
+
+// Cancel cancels pending request. Proposer and identities allowed to approve can cancel
+func (q *Queue) Cancel(ctx context.Context, id string, signer cacrypto.Signer) (*Request, error) {
+	req, err := q.pending(id)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := sign(signer, roleCancel, req.Proposal, req.Proposer.Signature, q.now())
+	if err != nil {
+		return nil, err
+	}
+	policy := q.approvers
+	if sig.EnrollmentID == req.Proposer.EnrollmentID {
+		policy = nil
+	}
+	if err = q.authorize(ctx, sig, roleCancel, req.Proposal, req.Proposer.Signature, policy); err != nil {
+		return nil, err
+	}
+
+	err = createExclusive(filepath.Join(q.dir, id, fileCancel), sig)
+	if errors.Is(err, os.ErrExist) {
+		return nil, fmt.Errorf(`%w: request %s is already cancelled`, ErrNotPending, id)
+	} else if err != nil {
+		return nil, err
+	}
+	q.logger.InfoContext(ctx, `approval request cancelled`, slog.String(`id`, id),
+		slog.String(`by`, sig.EnrollmentID))
+	return q.Get(id)
+}
+
+// Execute verifies proposer and approvals again and performs action once quorum is reached.
+// Approvals of identities, whose certificates became invalid or revoked, are not counted.
+// Failed operation isn't retried, it must be proposed again
+func (q *Queue) Execute(ctx context.Context, id string) (*Request, error) {
+	req, err := q.pending(id)
+	if err != nil {
+		return nil, err
+	}
+	if err = q.authorize(ctx, req.Proposer, rolePropose, req.Proposal, nil, q.proposers); err != nil {
+		return nil, fmt.Errorf(`verify proposer: %w`, err)
+	}
+
+	proposerKey, err := signerKey(req.Proposer)
+	if err != nil {
+		return nil, err
+	}
+
+	var approvers []string
+	// approvals are counted once per identity and once per key, so copies of approval
+	// and identities sharing key, including proposer, don't make quorum
+	seenIDs, seenKeys := map[string]bool{}, map[[sha256.Size]byte]bool{proposerKey: true}
+	for _, sig := range req.Approvals {
+		if sig.EnrollmentID == req.Proposer.EnrollmentID || seenIDs[sig.EnrollmentID] {
+			continue
+		}
+		if err = q.authorize(ctx, sig, roleApprove, req.Proposal, req.Proposer.Signature, q.approvers); err != nil {
+			q.logger.WarnContext(ctx, `approval is not counted`, slog.String(`id`, id), slog.Any(`error`, err))
+			continue
+		}
+		key, err := signerKey(sig)
+		if err != nil {
+			return nil, err
+		}
+		if seenKeys[key] {
+			q.logger.WarnContext(ctx, `approval is not counted`, slog.String(`id`, id),
+				slog.String(`approver`, sig.EnrollmentID), slog.String(`reason`, `key already signed request`))
+			continue
+		}
+		seenIDs[sig.EnrollmentID], seenKeys[key] = true, true
+		approvers = append(approvers, sig.EnrollmentID)
+	}
+	if len(approvers) < q.quorum {
+		return nil, fmt.Errorf(`%w: %d of %d valid approvals`, ErrQuorumNotReached, len(approvers), q.quorum)
+	}
+
+	path := filepath.Join(q.dir, id, fileExecution)
+	result := &Result{StartedAt: q.now().UTC()}
+	if err = createExclusive(path, result); errors.Is(err, os.ErrExist) {
+		return nil, fmt.Errorf(`%w: request %s is already executed`, ErrNotPending, id)
+	} else if err != nil {
+		return nil, err
+	}
+
+	execErr := q.execute(ctx, req.Action)
+	result.FinishedAt = q.now().UTC()
+	if execErr != nil {
+		result.Error = execErr.Error()
+	}
+	if err = replace(path, result); err != nil {
+		return nil, errors.Join(execErr, err)
+	}
+	q.logger.InfoContext(ctx, `approved request executed`, slog.String(`id`, id),
+		slog.String(`action`, req.Action.String()), slog.Any(`approvers`, approvers), slog.Any(`error`, execErr))
+
+	if req, err = q.Get(id); err != nil {
+		return nil, err
+	}
+	if execErr != nil {
+		return req, fmt.Errorf(`execute %s: %w`, req.Action, execErr)
+	}
+	return req, nil
+}
+
+func (q *Queue) execute(ctx context.Context, action Action) error {
+	switch action.Operation {
+	case client.OperationRevoke:
+		_, err := q.cli.Revoke(ctx, *action.Revocation)
+		return err
+	case client.OperationAffiliationDelete:
+		var opts []client.AffiliationOpt
+		if action.Force {
+			opts = append(opts, client.WithForce())
+		}
+		_, _, err := q.cli.AffiliationDelete(ctx, action.Affiliation, opts...)
+		return err
+	}
+	return fmt.Errorf(`operation %s can't be approved`, action.Operation)
+}
+
+// authorize verifies signature, certificate of signer and policy
+func (q *Queue) authorize(ctx context.Context, sig Signature, role string, proposal Proposal,
+	proposerSignature []byte, policy *abac.Policy) error {
+	cert, identity, err := verifySignature(sig, role, proposal, proposerSignature)
+	if err != nil {
+		return err
+	}
+	result, err := q.verifier.Verify(ctx, cert)
+	if err != nil {
+		return fmt.Errorf(`verify certificate of %s: %w`, sig.EnrollmentID, err)
+	}
+	if !result.Valid() {
+		return fmt.Errorf(`%w: certificate of %s is %s: %s`, ErrUnauthorized, sig.EnrollmentID, result.Status, result.Err)
+	}
+	if policy != nil {
+		if err = policy.Authorize(identity); err != nil {
+			return fmt.Errorf(`%w: %s: %s`, ErrUnauthorized, sig.EnrollmentID, err)
+		}
+	}
+	return nil
+}
+
+// Get returns request with its signatures
+func (q *Queue) Get(id string) (*Request, error) {
+	dir, err := q.requestDir(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var stored storedRequest
+	if err = readJSON(filepath.Join(dir, fileRequest), &stored); errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf(`%w: %s`, ErrNotFound, id)
+	} else if err != nil {
+		return nil, err
+	}
+	req := &Request{Proposal: stored.Proposal, Proposer: stored.Proposer, Status: StatusPending}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf(`read request directory: %w`, err)
+	}
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), prefixApprove) || !strings.HasSuffix(e.Name(), `.json`) {
+			continue
+		}
+		var sig Signature
+		if err = readJSON(filepath.Join(dir, e.Name()), &sig); err != nil {
+			return nil, err
+		}
+		// approval is stored only under name derived from its signer, anything else is planted
+		if e.Name() != approvalFile(sig.EnrollmentID) {
+			q.logger.Warn(`approval file doesn't match signer, skipped`, slog.String(`id`, id),
+				slog.String(`file`, e.Name()), slog.String(`approver`, sig.EnrollmentID))
+			continue
+		}
+		req.Approvals = append(req.Approvals, sig)
+	}
+	sort.Slice(req.Approvals, func(i, j int) bool { return req.Approvals[i].SignedAt.Before(req.Approvals[j].SignedAt) })
+
+	var cancel Signature
+	if err = readJSON(filepath.Join(dir, fileCancel), &cancel); err == nil {
+		req.Cancellation = &cancel
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	var result Result
+	if err = readJSON(filepath.Join(dir, fileExecution), &result); err == nil {
+		req.Result = &result
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	switch {
+	case req.Result != nil && req.Result.FinishedAt.IsZero():
+		req.Status = StatusExecuting
+	case req.Result != nil && req.Result.Error != ``:
+		req.Status = StatusFailed
+	case req.Result != nil:
+		req.Status = StatusExecuted
+	case req.Cancellation != nil:
+		req.Status = StatusCancelled
+	case !q.now().Before(req.ExpiresAt):
+		req.Status = StatusExpired
+	}
+	return req, nil
+}
+
+// List returns requests with given statuses, all requests if statuses are empty, the oldest first
+func (q *Queue) List(statuses ...Status) ([]*Request, error) {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return nil, fmt.Errorf(`read approval queue directory: %w`, err)
+	}
+	var out []*Request
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		req, err := q.Get(e.Name())
+		if errors.Is(err, ErrNotFound) {
+			// request directory is being created
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if len(statuses) == 0 || containsStatus(statuses, req.Status) {
+			out = append(out, req)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ProposedAt.Before(out[j].ProposedAt) })
+	return out, nil
+}
+
+func (q *Queue) pending(id string) (*Request, error) {
+	req, err := q.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if req.Status != StatusPending {
+		return nil, fmt.Errorf(`%w: request %s is %s`, ErrNotPending, id, req.Status)
+	}
+	return req, nil
+}
+
+func (q *Queue) requestDir(id string) (string, error) {
+	if _, err := hex.DecodeString(id); err != nil || id == `` {
+		return ``, fmt.Errorf(`%w: invalid id %q`, ErrNotFound, id)
+	}
+	return filepath.Join(q.dir, id), nil
+}
+
+// storedRequest is content of request file
+type storedRequest struct {
+	Proposal Proposal  `json:"proposal"`
+	Proposer Signature `json:"proposer"`
+}
+
+// signerKey identifies key of signer, so identities enrolled with the same key are recognized
+func signerKey(sig Signature) ([sha256.Size]byte, error) {
+	cert, err := parseCertificate(sig.Certificate)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(cert.RawSubjectPublicKeyInfo), nil
+}
+
+// approvalFile names approval file by hash of enrollment id, which may contain any characters
+func approvalFile(enrollmentID string) string {
+	sum := sha256.Sum256([]byte(enrollmentID))
+	return prefixApprove + hex.EncodeToString(sum[:8]) + `.json`
+}
+
+func containsStatus(statuses []Status, status Status) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func readJSON(path string, v interface{}) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(content, v); err != nil {
+		return fmt.Errorf(`parse %s: %w`, path, err)
+	}
+	return nil
+}
+
+// createExclusive writes file completely and links it to path, os.ErrExist is returned if path exists
+func createExclusive(path string, v interface{}) error {
+	tmp, err := writeTemp(path, v)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp) }()
+	if err = os.Link(tmp, path); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return err
+		}
+		return fmt.Errorf(`create %s: %w`, filepath.Base(path), err)
+	}
+	return nil
+}
+
+// replace writes file completely and renames it to path
+func replace(path string, v interface{}) error {
+	tmp, err := writeTemp(path, v)
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf(`replace %s: %w`, filepath.Base(path), err)
+	}
+	return nil
+}
+
+func writeTemp(path string, v interface{}) (string, error) {
+	content, err := json.MarshalIndent(v, ``, `  `)
+	if err != nil {
+		return ``, fmt.Errorf(`marshal %s: %w`, filepath.Base(path), err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), `.`+filepath.Base(path)+`-*`)
+	if err != nil {
+		return ``, fmt.Errorf(`create %s: %w`, filepath.Base(path), err)
+	}
+	if _, err = tmp.Write(content); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return ``, fmt.Errorf(`write %s: %w`, filepath.Base(path), err)
+	}
+	return tmp.Name(), nil
+}
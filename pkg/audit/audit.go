@@ -0,0 +1,141 @@
+// Package audit keeps tamper-evident log of administrative CA operations. Entries are chained by hashes
+// of previous entries and signed, so verifier detects modified, removed and reordered entries.
+package audit
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hlfans/ca-sdk/pkg/client"
+)
+
+// Entry is single record of log
+type Entry struct {
+	// Seq is sequence number of entry, starting from 1
+	Seq       uint64           `json:"seq"`
+	Time      time.Time        `json:"time"`
+	Operation client.Operation `json:"operation"`
+	Method    string           `json:"method"`
+	URL       string           `json:"url"`
+	Caller    string           `json:"caller,omitempty"`
+	Request   json.RawMessage  `json:"request,omitempty"`
+	Status    int              `json:"status,omitempty"`
+	Codes     []int            `json:"codes,omitempty"`
+	Error     string           `json:"error,omitempty"`
+	// PrevHash is Hash of previous entry, empty for the first entry
+	PrevHash string `json:"prev_hash,omitempty"`
+	// Hash is hex SHA-256 of entry without Hash and Signature
+	Hash string `json:"hash"`
+	// Signature is signature of Hash bytes
+	Signature []byte `json:"signature"`
+}
+
+// digest returns SHA-256 of entry without hash and signature
+func (e *Entry) digest() ([]byte, error) {
+	unsigned := *e
+	unsigned.Hash, unsigned.Signature = ``, nil
+	b, err := json.Marshal(unsigned)
+	if err != nil {
+		return nil, fmt.Errorf(`marshal entry: %w`, err)
+	}
+	sum := sha256.Sum256(b)
+	return sum[:], nil
+}
+
+// Sink stores entries
+type Sink interface {
+	Append(ctx context.Context, entry *Entry) error
+}
+
+// Resumer is implemented by sinks, which return the last stored entry, so chain continues after restart.
+// Nil entry is returned for empty sink
+type Resumer interface {
+	Last() (*Entry, error)
+}
+
+// Log signs operations of client and appends them to sink. Log implements client.AuditHook:
+//
+//	cli, err := client.NewHttp(..., client.WithAuditHook(log))
+type Log struct {
+	signer crypto.Signer
+	sink   Sink
+
+	mu   sync.Mutex
+	last *Entry
+}
+
+// New creates log. If sink implements Resumer, chain continues from its last entry
+func New(signer crypto.Signer, sink Sink) (*Log, error) {
+	if _, err := signatureHash(signer.Public()); err != nil {
+		return nil, err
+	}
+
+	l := &Log{signer: signer, sink: sink}
+	if r, ok := sink.(Resumer); ok {
+		var err error
+		if l.last, err = r.Last(); err != nil {
+			return nil, fmt.Errorf(`read last audit entry: %w`, err)
+		}
+	}
+	return l, nil
+}
+
+// Audit appends event to log
+func (l *Log) Audit(ctx context.Context, event client.AuditEvent) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry := &Entry{
+		Seq:       1,
+		Time:      event.Time.UTC(),
+		Operation: event.Operation,
+		Method:    event.Method,
+		URL:       event.URL,
+		Caller:    event.Caller,
+		Request:   event.Request,
+		Status:    event.Status,
+		Codes:     event.Codes,
+		Error:     event.Error,
+	}
+	if l.last != nil {
+		entry.Seq, entry.PrevHash = l.last.Seq+1, l.last.Hash
+	}
+
+	digest, err := entry.digest()
+	if err != nil {
+		return err
+	}
+	entry.Hash = hex.EncodeToString(digest)
+	opts, _ := signatureHash(l.signer.Public())
+	if entry.Signature, err = l.signer.Sign(rand.Reader, digest, opts); err != nil {
+		return fmt.Errorf(`sign audit entry: %w`, err)
+	}
+
+	if err = l.sink.Append(ctx, entry); err != nil {
+		return fmt.Errorf(`append audit entry: %w`, err)
+	}
+	l.last = entry
+	return nil
+}
+
+// signatureHash returns signer options for public key: digest is signed with ECDSA and RSA, Ed25519 signs it
+// as message
+func signatureHash(pub crypto.PublicKey) (crypto.SignerOpts, error) {
+	switch pub.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey:
+		return crypto.SHA256, nil
+	case ed25519.PublicKey:
+		return crypto.Hash(0), nil
+	}
+	return nil, fmt.Errorf(`unsupported audit key %T`, pub)
+}
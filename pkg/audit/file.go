@@ -0,0 +1,78 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// FileSink appends entries to JSON lines file
+type FileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileSink opens or creates JSON lines file. Entries are synced to disk before Append returns
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf(`open audit log: %w`, err)
+	}
+	return &FileSink{file: f}, nil
+}
+
+func (s *FileSink) Append(_ context.Context, entry *Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf(`marshal entry: %w`, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err = s.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf(`write audit log: %w`, err)
+	}
+	if err = s.file.Sync(); err != nil {
+		return fmt.Errorf(`sync audit log: %w`, err)
+	}
+	return nil
+}
+
+// Last returns the last entry of file
+func (s *FileSink) Last() (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf(`read audit log: %w`, err)
+	}
+	var last []byte
+	scanner := bufio.NewScanner(s.file)
+	scanner.Buffer(make([]byte, 64*1024), maxLine)
+	for scanner.Scan() {
+		if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+			last = append(last[:0], line...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf(`read audit log: %w`, err)
+	}
+	if last == nil {
+		return nil, nil
+	}
+
+	entry := new(Entry)
+	if err := json.Unmarshal(last, entry); err != nil {
+		return nil, fmt.Errorf(`parse last audit entry: %w`, err)
+	}
+	return entry, nil
+}
+
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,131 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const maxLine = 16 * 1024 * 1024
+
+var (
+	// ErrGap means entries are missing: sequence number isn't the next one
+	ErrGap = errors.New(`gap in audit log`)
+	// ErrBrokenChain means entry doesn't reference hash of previous entry
+	ErrBrokenChain = errors.New(`broken audit log chain`)
+	// ErrModified means entry doesn't match its hash
+	ErrModified = errors.New(`modified audit entry`)
+	// ErrSignature means signature of entry is invalid
+	ErrSignature = errors.New(`invalid audit entry signature`)
+)
+
+// VerificationError is the first problem found in log
+type VerificationError struct {
+	// Line is line number in log, starting from 1
+	Line int
+	Seq  uint64
+	Err  error
+}
+
+func (e *VerificationError) Error() string {
+	return fmt.Sprintf(`line %d, entry %d: %s`, e.Line, e.Seq, e.Err)
+}
+
+func (e *VerificationError) Unwrap() error {
+	return e.Err
+}
+
+type VerifyOpt func(v *verifier) error
+
+// WithAnchor sets the last entry preceding verified log, for example of rotated file.
+// By default log must start with the first entry
+func WithAnchor(seq uint64, hash string) VerifyOpt {
+	return func(v *verifier) error {
+		v.seq, v.hash = seq, hash
+		return nil
+	}
+}
+
+type verifier struct {
+	seq  uint64
+	hash string
+}
+
+// Verify checks entries of JSON lines log signed by key of pub and returns the last entry.
+// Truncation after the last entry can't be detected by log itself, compare returned entry with
+// independently stored head, for example sequence number exported to monitoring
+func Verify(r io.Reader, pub crypto.PublicKey, opts ...VerifyOpt) (*Entry, error) {
+	if _, err := signatureHash(pub); err != nil {
+		return nil, err
+	}
+	v := new(verifier)
+	for _, opt := range opts {
+		if err := opt(v); err != nil {
+			return nil, fmt.Errorf(`apply verify option: %w`, err)
+		}
+	}
+
+	var last *Entry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLine)
+	for line := 1; scanner.Scan(); line++ {
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+
+		entry := new(Entry)
+		if err := json.Unmarshal(raw, entry); err != nil {
+			return last, &VerificationError{Line: line, Seq: v.seq + 1, Err: fmt.Errorf(`%w: %s`, ErrModified, err)}
+		}
+		if err := v.check(entry, pub); err != nil {
+			return last, &VerificationError{Line: line, Seq: entry.Seq, Err: err}
+		}
+		v.seq, v.hash, last = entry.Seq, entry.Hash, entry
+	}
+	if err := scanner.Err(); err != nil {
+		return last, fmt.Errorf(`read audit log: %w`, err)
+	}
+	return last, nil
+}
+
+func (v *verifier) check(entry *Entry, pub crypto.PublicKey) error {
+	if entry.Seq != v.seq+1 {
+		return fmt.Errorf(`%w: expected entry %d`, ErrGap, v.seq+1)
+	}
+	if entry.PrevHash != v.hash {
+		return ErrBrokenChain
+	}
+
+	digest, err := entry.digest()
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(digest) != entry.Hash {
+		return ErrModified
+	}
+	if !verifySignature(pub, digest, entry.Signature) {
+		return ErrSignature
+	}
+	return nil
+}
+
+func verifySignature(pub crypto.PublicKey, digest, signature []byte) bool {
+	switch key := pub.(type) {
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(key, digest, signature)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, signature) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, digest, signature)
+	}
+	return false
+}
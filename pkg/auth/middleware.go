@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/hlfans/ca-sdk/pkg/client"
+	"github.com/hlfans/ca-sdk/pkg/response"
+)
+
+const defaultMaxBodySize = 10 << 20
+
+type certificateKey struct{}
+
+// CertificateFromContext returns certificate of verified token owner
+func CertificateFromContext(ctx context.Context) (*x509.Certificate, bool) {
+	cert, ok := ctx.Value(certificateKey{}).(*x509.Certificate)
+	return cert, ok
+}
+
+// Middleware verifies Authorization header of every request. Verified certificate is available for next handler
+// with CertificateFromContext. Rejected requests get Fabric CA style error response
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get(`Authorization`)
+		if token == `` {
+			WriteError(w, http.StatusUnauthorized, client.CodeNoAuthHeader, `No authorization header`)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, defaultMaxBodySize+1))
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, client.CodeReadingRequestBody, `Failed reading request body`)
+			return
+		}
+		if len(body) > defaultMaxBodySize {
+			WriteError(w, http.StatusRequestEntityTooLarge, client.CodeBadRequestBody, `Request body is too large`)
+			return
+		}
+		_ = r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		cert, err := v.VerifyToken(r.Method, r.URL.Path, body, token)
+		if err != nil {
+			WriteError(w, http.StatusUnauthorized, client.CodeBadRequestToken, `Invalid authorization token: `+err.Error())
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), certificateKey{}, cert)))
+	})
+}
+
+// WriteError writes Fabric CA style error response with single error
+func WriteError(w http.ResponseWriter, status, code int, message string) {
+	w.Header().Set(`Content-Type`, `application/json`)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(response.Response{
+		Success:  false,
+		Result:   json.RawMessage(`null`),
+		Errors:   []response.Message{{Code: code, Message: message}},
+		Messages: []response.Message{},
+	})
+}
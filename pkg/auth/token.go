@@ -0,0 +1,160 @@
+// Package auth verifies Fabric CA authorization tokens on server side, so internal services can accept
+// the same `base64(cert).base64(signature)` tokens which CA clients produce.
+package auth
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hlfans/ca-sdk/pkg/crypto"
+)
+
+var (
+	ErrMalformedToken       = errors.New(`malformed authorization token`)
+	ErrInvalidSignature     = errors.New(`invalid authorization token signature`)
+	ErrUntrustedCertificate = errors.New(`untrusted authorization token certificate`)
+)
+
+type VerifierOpt func(v *Verifier) error
+
+// WithRoots sets trusted root certificates
+func WithRoots(roots *x509.CertPool) VerifierOpt {
+	return func(v *Verifier) error {
+		v.roots = roots
+		return nil
+	}
+}
+
+// WithIntermediates sets intermediate certificates used for building chains
+func WithIntermediates(intermediates *x509.CertPool) VerifierOpt {
+	return func(v *Verifier) error {
+		v.intermediates = intermediates
+		return nil
+	}
+}
+
+// WithCAChain adds PEM encoded CA chain, for example decoded CAInfo.CAChain. Self-signed certificates
+// become roots, others become intermediates
+func WithCAChain(chainPEM []byte) VerifierOpt {
+	return func(v *Verifier) error {
+		found := false
+		for rest := chainPEM; ; {
+			var block *pem.Block
+			if block, rest = pem.Decode(rest); block == nil {
+				break
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return fmt.Errorf(`parse CA certificate: %w`, err)
+			}
+			if bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil {
+				v.roots.AddCert(cert)
+			} else {
+				v.intermediates.AddCert(cert)
+			}
+			found = true
+		}
+		if !found {
+			return fmt.Errorf(`no certificates found in CA chain`)
+		}
+		return nil
+	}
+}
+
+// WithClock overrides current time used for certificate validity checks
+func WithClock(now func() time.Time) VerifierOpt {
+	return func(v *Verifier) error {
+		v.now = now
+		return nil
+	}
+}
+
+// Verifier checks authorization tokens against trust pool
+type Verifier struct {
+	suite         crypto.Suite
+	roots         *x509.CertPool
+	intermediates *x509.CertPool
+	now           func() time.Time
+}
+
+// NewVerifier creates verifier. Suite must use the same hash as token producer, SHA2-256 for Fabric CA clients
+func NewVerifier(suite crypto.Suite, opts ...VerifierOpt) (*Verifier, error) {
+	if suite == nil {
+		return nil, fmt.Errorf(`crypto suite is empty`)
+	}
+
+	v := &Verifier{suite: suite, roots: x509.NewCertPool(), intermediates: x509.NewCertPool(), now: time.Now}
+	for _, opt := range opts {
+		if err := opt(v); err != nil {
+			return nil, fmt.Errorf(`apply verifier option: %w`, err)
+		}
+	}
+	return v, nil
+}
+
+// VerifyToken verifies token of request with method, URL path and body and returns certificate of token owner
+func (v *Verifier) VerifyToken(method, path string, body []byte, token string) (*x509.Certificate, error) {
+	certEncoded, sigEncoded, ok := strings.Cut(token, `.`)
+	if !ok || strings.Contains(sigEncoded, `.`) {
+		return nil, ErrMalformedToken
+	}
+
+	certPEM, err := base64.StdEncoding.DecodeString(certEncoded)
+	if err != nil {
+		return nil, fmt.Errorf(`%w: decode certificate: %s`, ErrMalformedToken, err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(sigEncoded)
+	if err != nil {
+		return nil, fmt.Errorf(`%w: decode signature: %s`, ErrMalformedToken, err)
+	}
+
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil, fmt.Errorf(`%w: certificate is not PEM encoded`, ErrMalformedToken)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf(`%w: parse certificate: %s`, ErrMalformedToken, err)
+	}
+
+	payload := Payload(method, path, body, certEncoded)
+	if err = v.suite.Verify(cert.PublicKey, []byte(payload), signature); err != nil {
+		return nil, fmt.Errorf(`%w: %s`, ErrInvalidSignature, err)
+	}
+
+	if _, err = cert.Verify(x509.VerifyOptions{
+		Roots:         v.roots,
+		Intermediates: v.intermediates,
+		CurrentTime:   v.now(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return nil, fmt.Errorf(`%w: %s`, ErrUntrustedCertificate, err)
+	}
+
+	return cert, nil
+}
+
+// VerifyToken verifies token with crypto suite against roots without creating Verifier
+func VerifyToken(suite crypto.Suite, roots *x509.CertPool, method, path string, body []byte, token string) (*x509.Certificate, error) {
+	v, err := NewVerifier(suite, WithRoots(roots))
+	if err != nil {
+		return nil, err
+	}
+	return v.VerifyToken(method, path, body, token)
+}
+
+// Payload builds signed part of token the same way as Fabric CA client does
+func Payload(method, path string, body []byte, certEncoded string) string {
+	return strings.Join([]string{
+		method,
+		base64.URLEncoding.EncodeToString([]byte(path)),
+		base64.StdEncoding.EncodeToString(body),
+		certEncoded,
+	}, `.`)
+}
@@ -0,0 +1,303 @@
+// Package bootstrap implements organization onboarding on top of client.Client: it enrolls the CA bootstrap
+// admin, creates affiliations, registers and enrolls peers, orderers and users and writes their MSP and TLS
+// directories in the layout used by fabric-samples. Every step is skipped if its result already exists, so
+// bootstrap can be safely re-run.
+package bootstrap
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"net/http"
+	"path/filepath"
+
+	"github.com/hlfans/ca-sdk/pkg/client"
+	"github.com/hlfans/ca-sdk/pkg/config"
+	"github.com/hlfans/ca-sdk/pkg/crypto"
+	"github.com/hlfans/ca-sdk/pkg/entity"
+	"github.com/hlfans/ca-sdk/pkg/request"
+)
+
+const (
+	registrarDir = `registrar`
+	peersDir     = `peers`
+	orderersDir  = `orderers`
+	usersDir     = `users`
+)
+
+type Opt func(b *Bootstrapper) error
+
+// WithHTTPClient allows to use custom HTTP client for all CA requests
+func WithHTTPClient(client *http.Client) Opt {
+	return func(b *Bootstrapper) error {
+		b.httpClient = client
+		return nil
+	}
+}
+
+type Bootstrapper struct {
+	config     *config.CAConfig
+	httpClient *http.Client
+}
+
+// Result describes which steps were performed and which were skipped because their results already existed
+type Result struct {
+	CreatedAffiliations []string
+	Registered          []string
+	Enrolled            []string
+	Skipped             []string
+}
+
+func New(conf *config.CAConfig, opts ...Opt) (*Bootstrapper, error) {
+	if conf == nil {
+		return nil, fmt.Errorf(`config is empty`)
+	}
+
+	b := &Bootstrapper{config: conf}
+	for _, opt := range opts {
+		if err := opt(b); err != nil {
+			return nil, fmt.Errorf(`apply bootstrap option: %w`, err)
+		}
+	}
+	return b, nil
+}
+
+// Bootstrap onboards organization described by spec and writes its crypto material to dir:
+//
+//	dir/msp                       organization MSP
+//	dir/registrar/msp             bootstrap admin MSP
+//	dir/peers/<host>/{msp,tls}    peer MSP and TLS
+//	dir/orderers/<host>/{msp,tls} orderer MSP and TLS
+//	dir/users/<name>@<domain>/msp user MSP
+func (b *Bootstrapper) Bootstrap(ctx context.Context, spec OrgSpec, dir string) (*Result, error) {
+	if err := spec.validate(); err != nil {
+		return nil, fmt.Errorf(`invalid org spec: %w`, err)
+	}
+
+	anonymous, err := b.newClient(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := anonymous.CAInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf(`get CA info: %w`, err)
+	}
+	chain, err := parseCAChain(info.CAChain)
+	if err != nil {
+		return nil, err
+	}
+	if err = writeOrgMSP(dir, chain); err != nil {
+		return nil, fmt.Errorf(`write org MSP: %w`, err)
+	}
+
+	run := &run{spec: &spec, chain: chain, result: &Result{}}
+
+	adminCert, adminKey, err := run.enrollMSP(ctx, anonymous, filepath.Join(dir, registrarDir), spec.Admin.Name, spec.Admin.Secret)
+	if err != nil {
+		return nil, fmt.Errorf(`enroll bootstrap admin: %w`, err)
+	}
+
+	adminSigner, err := crypto.NewSigner(adminCert, adminKey)
+	if err != nil {
+		return nil, fmt.Errorf(`create admin signer: %w`, err)
+	}
+	if run.registrar, err = b.newClient(adminSigner); err != nil {
+		return nil, err
+	}
+
+	if err = run.createAffiliations(ctx); err != nil {
+		return run.result, err
+	}
+	if err = run.loadIdentities(ctx); err != nil {
+		return run.result, err
+	}
+
+	for _, peer := range spec.Peers {
+		if err = run.node(ctx, filepath.Join(dir, peersDir), identityTypePeer, peer); err != nil {
+			return run.result, fmt.Errorf(`peer %s: %w`, peer.Name, err)
+		}
+	}
+	for _, orderer := range spec.Orderers {
+		if err = run.node(ctx, filepath.Join(dir, orderersDir), identityTypeOrderer, orderer); err != nil {
+			return run.result, fmt.Errorf(`orderer %s: %w`, orderer.Name, err)
+		}
+	}
+	for _, user := range spec.Users {
+		if err = run.user(ctx, filepath.Join(dir, usersDir), user); err != nil {
+			return run.result, fmt.Errorf(`user %s: %w`, user.Name, err)
+		}
+	}
+
+	return run.result, nil
+}
+
+func (b *Bootstrapper) newClient(signer crypto.Signer) (client.Client, error) {
+	opts := []client.HttpOpt{client.WithRawConfig(b.config)}
+	if b.httpClient != nil {
+		opts = append(opts, client.WithHTTPClient(b.httpClient))
+	}
+	if signer != nil {
+		opts = append(opts, client.WithIdentity(signer))
+	}
+
+	cli, err := client.NewHttp(opts...)
+	if err != nil {
+		return nil, fmt.Errorf(`create CA client: %w`, err)
+	}
+	return cli, nil
+}
+
+// run holds state of single Bootstrap call
+type run struct {
+	spec       *OrgSpec
+	chain      *caChain
+	registrar  client.Client
+	identities map[string]struct{}
+	result     *Result
+}
+
+func (r *run) createAffiliations(ctx context.Context) error {
+	_, affiliations, err := r.registrar.AffiliationList(ctx)
+	if err != nil {
+		return fmt.Errorf(`list affiliations: %w`, err)
+	}
+
+	existing := make(map[string]struct{})
+	collectAffiliations(affiliations, existing)
+
+	required := append([]string{}, r.spec.Affiliations...)
+	if r.spec.Affiliation != `` {
+		required = append(required, r.spec.Affiliation)
+	}
+
+	for _, name := range required {
+		if _, ok := existing[name]; ok {
+			continue
+		}
+		if err = r.registrar.AffiliationCreate(ctx, name, client.WithForce()); err != nil {
+			return fmt.Errorf(`create affiliation %s: %w`, name, err)
+		}
+		existing[name] = struct{}{}
+		r.result.CreatedAffiliations = append(r.result.CreatedAffiliations, name)
+	}
+	return nil
+}
+
+func collectAffiliations(affiliations []entity.Affiliation, names map[string]struct{}) {
+	for _, a := range affiliations {
+		names[a.Name] = struct{}{}
+		collectAffiliations(a.Affiliations, names)
+	}
+}
+
+func (r *run) loadIdentities(ctx context.Context) error {
+	identities, err := r.registrar.IdentityList(ctx)
+	if err != nil {
+		return fmt.Errorf(`list identities: %w`, err)
+	}
+
+	r.identities = make(map[string]struct{}, len(identities))
+	for _, identity := range identities {
+		r.identities[identity.Id] = struct{}{}
+	}
+	return nil
+}
+
+func (r *run) register(ctx context.Context, name, secret, identityType string, attrs []request.Attribute) error {
+	if _, ok := r.identities[name]; ok {
+		r.result.Skipped = append(r.result.Skipped, `register `+name)
+		return nil
+	}
+
+	if _, err := r.registrar.Register(ctx, request.Registration{
+		Name:        name,
+		Type:        identityType,
+		Secret:      secret,
+		Affiliation: r.spec.Affiliation,
+		Attrs:       attrs,
+		CAName:      r.spec.CAName,
+	}); err != nil {
+		return fmt.Errorf(`register: %w`, err)
+	}
+
+	r.identities[name] = struct{}{}
+	r.result.Registered = append(r.result.Registered, name)
+	return nil
+}
+
+func (r *run) node(ctx context.Context, parent, identityType string, node NodeSpec) error {
+	secret := secretOrDefault(node.Name, node.Secret)
+	if err := r.register(ctx, node.Name, secret, identityType, nil); err != nil {
+		return err
+	}
+
+	host := r.spec.hostName(node.Name)
+	dir := filepath.Join(parent, host)
+
+	if _, _, err := r.enrollMSP(ctx, r.registrar, dir, node.Name, secret); err != nil {
+		return err
+	}
+
+	if cert, _, err := loadTLS(dir); err != nil {
+		return fmt.Errorf(`load TLS: %w`, err)
+	} else if cert != nil {
+		r.result.Skipped = append(r.result.Skipped, `enroll TLS `+node.Name)
+		return nil
+	}
+
+	// CA requires common name to be enrollment id, host names go to SANs
+	csr := &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: node.Name},
+		DNSNames: append([]string{host, `localhost`}, node.Hosts...),
+	}
+	cert, key, err := r.registrar.Enroll(ctx, node.Name, secret, csr, client.WithEnrollProfile(client.EnrollProfileTls))
+	if err != nil {
+		return fmt.Errorf(`enroll TLS: %w`, err)
+	}
+	if err = writeTLS(dir, r.chain, cert, key); err != nil {
+		return fmt.Errorf(`write TLS: %w`, err)
+	}
+	r.result.Enrolled = append(r.result.Enrolled, `TLS `+node.Name)
+	return nil
+}
+
+func (r *run) user(ctx context.Context, parent string, user UserSpec) error {
+	secret := secretOrDefault(user.Name, user.Secret)
+	identityType := identityTypeClient
+	if user.Admin {
+		identityType = identityTypeAdmin
+	}
+
+	if err := r.register(ctx, user.Name, secret, identityType, user.Attrs); err != nil {
+		return err
+	}
+
+	dirName := user.Name
+	if r.spec.Domain != `` {
+		dirName += `@` + r.spec.Domain
+	}
+	_, _, err := r.enrollMSP(ctx, r.registrar, filepath.Join(parent, dirName), user.Name, secret)
+	return err
+}
+
+// enrollMSP enrolls ECert and writes MSP to dir or loads previously written MSP
+func (r *run) enrollMSP(ctx context.Context, cli client.Client, dir, name, secret string) (*x509.Certificate, interface{}, error) {
+	if cert, key, err := loadMSP(dir); err != nil {
+		return nil, nil, fmt.Errorf(`load MSP: %w`, err)
+	} else if cert != nil {
+		r.result.Skipped = append(r.result.Skipped, `enroll `+name)
+		return cert, key, nil
+	}
+
+	cert, key, err := cli.Enroll(ctx, name, secret, &x509.CertificateRequest{Subject: pkix.Name{CommonName: name}})
+	if err != nil {
+		return nil, nil, fmt.Errorf(`enroll: %w`, err)
+	}
+	if err = writeMSP(dir, r.chain, cert, key); err != nil {
+		return nil, nil, fmt.Errorf(`write MSP: %w`, err)
+	}
+	r.result.Enrolled = append(r.result.Enrolled, name)
+	return cert, key, nil
+}
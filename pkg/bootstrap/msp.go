@@ -0,0 +1,197 @@
+package bootstrap
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	mspDir = `msp`
+	tlsDir = `tls`
+
+	mspCACertsFile      = `cacerts/ca.pem`
+	mspIntermediateFile = `intermediatecerts/ca.pem`
+	mspTLSCACertsFile   = `tlscacerts/ca.pem`
+	mspSignCertFile     = `signcerts/cert.pem`
+	mspKeyFile          = `keystore/priv_sk`
+	mspConfigFile       = `config.yaml`
+
+	tlsCACertFile = `ca.crt`
+	tlsCertFile   = `server.crt`
+	tlsKeyFile    = `server.key`
+
+	nodeOUConfig = `NodeOUs:
+  Enable: true
+  ClientOUIdentifier:
+    Certificate: cacerts/ca.pem
+    OrganizationalUnitIdentifier: client
+  PeerOUIdentifier:
+    Certificate: cacerts/ca.pem
+    OrganizationalUnitIdentifier: peer
+  AdminOUIdentifier:
+    Certificate: cacerts/ca.pem
+    OrganizationalUnitIdentifier: admin
+  OrdererOUIdentifier:
+    Certificate: cacerts/ca.pem
+    OrganizationalUnitIdentifier: orderer
+`
+)
+
+// caChain holds PEM encoded root and intermediate certificates of CA
+type caChain struct {
+	roots         []byte
+	intermediates []byte
+}
+
+// parseCAChain splits base64 encoded PEM chain from CAInfo to root and intermediate certificates
+func parseCAChain(encoded string) (*caChain, error) {
+	chainPEM, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf(`decode CA chain: %w`, err)
+	}
+
+	var (
+		chain = &caChain{}
+		roots = new(bytes.Buffer)
+		inter = new(bytes.Buffer)
+	)
+	for rest := chainPEM; ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf(`parse CA certificate: %w`, err)
+		}
+		if bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil {
+			_ = pem.Encode(roots, block)
+		} else {
+			_ = pem.Encode(inter, block)
+		}
+	}
+
+	if roots.Len() == 0 {
+		return nil, fmt.Errorf(`root certificate not found in CA chain`)
+	}
+	chain.roots, chain.intermediates = roots.Bytes(), inter.Bytes()
+	return chain, nil
+}
+
+// writeOrgMSP writes organization level MSP containing only CA certificates and NodeOUs config
+func writeOrgMSP(dir string, chain *caChain) error {
+	files := map[string][]byte{
+		mspCACertsFile:    chain.roots,
+		mspTLSCACertsFile: chain.roots,
+		mspConfigFile:     []byte(nodeOUConfig),
+	}
+	if len(chain.intermediates) > 0 {
+		files[mspIntermediateFile] = chain.intermediates
+	}
+	return writeFiles(filepath.Join(dir, mspDir), files, 0644)
+}
+
+// writeMSP writes local MSP of identity
+func writeMSP(dir string, chain *caChain, cert *x509.Certificate, key interface{}) error {
+	keyPEM, err := marshalKey(key)
+	if err != nil {
+		return err
+	}
+	if err = writeFiles(filepath.Join(dir, mspDir), map[string][]byte{mspKeyFile: keyPEM}, 0600); err != nil {
+		return err
+	}
+	if err = writeOrgMSP(dir, chain); err != nil {
+		return err
+	}
+	return writeFiles(filepath.Join(dir, mspDir), map[string][]byte{mspSignCertFile: marshalCert(cert)}, 0644)
+}
+
+// writeTLS writes TLS directory in layout used by peers and orderers
+func writeTLS(dir string, chain *caChain, cert *x509.Certificate, key interface{}) error {
+	keyPEM, err := marshalKey(key)
+	if err != nil {
+		return err
+	}
+	if err = writeFiles(filepath.Join(dir, tlsDir), map[string][]byte{tlsKeyFile: keyPEM}, 0600); err != nil {
+		return err
+	}
+	return writeFiles(filepath.Join(dir, tlsDir), map[string][]byte{
+		tlsCACertFile: append(append([]byte{}, chain.roots...), chain.intermediates...),
+		tlsCertFile:   marshalCert(cert),
+	}, 0644)
+}
+
+// loadMSP reads certificate and private key from previously written MSP. It returns nil values if MSP is absent
+func loadMSP(dir string) (*x509.Certificate, interface{}, error) {
+	return loadPair(filepath.Join(dir, mspDir, mspSignCertFile), filepath.Join(dir, mspDir, mspKeyFile))
+}
+
+func loadTLS(dir string) (*x509.Certificate, interface{}, error) {
+	return loadPair(filepath.Join(dir, tlsDir, tlsCertFile), filepath.Join(dir, tlsDir, tlsKeyFile))
+}
+
+func loadPair(certPath, keyPath string) (*x509.Certificate, interface{}, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, fmt.Errorf(`read certificate: %w`, err)
+	}
+
+	keyPEM, err := os.ReadFile(keyPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, fmt.Errorf(`read private key: %w`, err)
+	}
+
+	certBlock, _ := pem.Decode(certPEM)
+	if certBlock == nil {
+		return nil, nil, fmt.Errorf(`failed to decode certificate %s`, certPath)
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf(`parse certificate: %w`, err)
+	}
+
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil {
+		return nil, nil, fmt.Errorf(`failed to decode private key %s`, keyPath)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf(`parse private key: %w`, err)
+	}
+	return cert, key, nil
+}
+
+func marshalCert(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: `CERTIFICATE`, Bytes: cert.Raw})
+}
+
+func marshalKey(key interface{}) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf(`marshal private key: %w`, err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: `PRIVATE KEY`, Bytes: der}), nil
+}
+
+func writeFiles(dir string, files map[string][]byte, perm os.FileMode) error {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf(`create directory: %w`, err)
+		}
+		if err := os.WriteFile(path, content, perm); err != nil {
+			return fmt.Errorf(`write %s: %w`, path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package bootstrap
+
+import (
+	"fmt"
+
+	"github.com/hlfans/ca-sdk/pkg/request"
+)
+
+const (
+	identityTypePeer    = `peer`
+	identityTypeOrderer = `orderer`
+	identityTypeClient  = `client`
+	identityTypeAdmin   = `admin`
+)
+
+type (
+	// OrgSpec describes organization that must be bootstrapped on Fabric CA
+	OrgSpec struct {
+		// Domain is used for building node host names and directories, for example org1.example.com
+		Domain string `yaml:"domain"`
+		// Admin is the CA bootstrap identity (registrar) used for all registrations
+		Admin Credentials `yaml:"admin"`
+		// Affiliations are created before registration, for example org1.department1
+		Affiliations []string `yaml:"affiliations"`
+		// Affiliation is assigned to every registered identity. Empty value means root affiliation
+		Affiliation string     `yaml:"affiliation"`
+		Peers       []NodeSpec `yaml:"peers"`
+		Orderers    []NodeSpec `yaml:"orderers"`
+		Users       []UserSpec `yaml:"users"`
+		// CAName is the name of the CA instance. If empty default CA instance will be used.
+		CAName string `yaml:"caname"`
+	}
+
+	Credentials struct {
+		Name   string `yaml:"name"`
+		Secret string `yaml:"secret"`
+	}
+
+	// NodeSpec describes peer or orderer node. Node gets ECert and TLS certificate
+	NodeSpec struct {
+		// Name is enrollment id of node, for example peer0
+		Name string `yaml:"name"`
+		// Secret is the enrollment secret. If empty `<name>pw` is used
+		Secret string `yaml:"secret"`
+		// Hosts are added to TLS certificate in addition to <name>.<domain> and localhost
+		Hosts []string `yaml:"hosts"`
+	}
+
+	// UserSpec describes user of organization. User gets only ECert
+	UserSpec struct {
+		Name   string `yaml:"name"`
+		Secret string `yaml:"secret"`
+		// Admin registers user with `admin` type instead of `client`
+		Admin bool                `yaml:"admin"`
+		Attrs []request.Attribute `yaml:"attrs"`
+	}
+)
+
+func (s *OrgSpec) validate() error {
+	if s.Admin.Name == `` || s.Admin.Secret == `` {
+		return fmt.Errorf(`admin credentials are required`)
+	}
+
+	seen := make(map[string]struct{})
+	check := func(name string) error {
+		if name == `` {
+			return fmt.Errorf(`identity name is empty`)
+		}
+		if _, ok := seen[name]; ok {
+			return fmt.Errorf(`identity %s is defined twice`, name)
+		}
+		seen[name] = struct{}{}
+		return nil
+	}
+
+	for _, n := range s.Peers {
+		if err := check(n.Name); err != nil {
+			return fmt.Errorf(`peer: %w`, err)
+		}
+	}
+	for _, n := range s.Orderers {
+		if err := check(n.Name); err != nil {
+			return fmt.Errorf(`orderer: %w`, err)
+		}
+	}
+	for _, u := range s.Users {
+		if err := check(u.Name); err != nil {
+			return fmt.Errorf(`user: %w`, err)
+		}
+	}
+	return nil
+}
+
+// hostName returns full host name of node, for example peer0.org1.example.com
+func (s *OrgSpec) hostName(node string) string {
+	if s.Domain == `` {
+		return node
+	}
+	return node + `.` + s.Domain
+}
+
+func secretOrDefault(name, secret string) string {
+	if secret == `` {
+		return name + `pw`
+	}
+	return secret
+}
@@ -0,0 +1,398 @@
+// Package bulk registers and enrolls many identities with bounded concurrency and rate limit. Progress is
+// checkpointed to file, so interrupted run can be resumed, and issued credentials are written to wallet.
+// Identities and certificates are revoked in batches after preview of affected certificates.
+package bulk
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/hlfans/ca-sdk/pkg/client"
+	"github.com/hlfans/ca-sdk/pkg/config"
+	"github.com/hlfans/ca-sdk/pkg/csr"
+	"github.com/hlfans/ca-sdk/pkg/request"
+	"github.com/hlfans/ca-sdk/pkg/wallet"
+)
+
+const defaultConcurrency = 4
+
+// Stage is step of item processing
+type Stage string
+
+const (
+	StageRegister Stage = `register`
+	StageEnroll   Stage = `enroll`
+	StageWallet   Stage = `wallet`
+)
+
+// Status is outcome of item
+type Status string
+
+const (
+	StatusSucceeded Status = `succeeded`
+	// StatusSkipped items were completed by previous run according to checkpoint
+	StatusSkipped Status = `skipped`
+	StatusFailed  Status = `failed`
+)
+
+// ItemError is error of item processing. Client errors are unwrapped, so errors.Is(err, client.ErrAlreadyRegistered)
+// and similar checks work
+type ItemError struct {
+	Name  string
+	Stage Stage
+	Err   error
+}
+
+func (e *ItemError) Error() string {
+	return fmt.Sprintf(`%s %s: %s`, e.Stage, e.Name, e.Err)
+}
+
+func (e *ItemError) Unwrap() error {
+	return e.Err
+}
+
+// Result is outcome of single item
+type Result struct {
+	Index  int
+	Name   string
+	Status Status
+	// Registered is false if identity was registered before run
+	Registered  bool
+	Certificate *x509.Certificate
+	// Err is *ItemError for failed items
+	Err error
+}
+
+// Progress is reported after every finished item
+type Progress struct {
+	Total     int
+	Succeeded int
+	Skipped   int
+	Failed    int
+}
+
+// Done returns number of finished items
+func (p Progress) Done() int {
+	return p.Succeeded + p.Skipped + p.Failed
+}
+
+// Report holds results in order of items
+type Report struct {
+	Results []Result
+	Progress
+}
+
+// FailedResults returns results of failed items
+func (r *Report) FailedResults() []Result {
+	var out []Result
+	for _, res := range r.Results {
+		if res.Status == StatusFailed {
+			out = append(out, res)
+		}
+	}
+	return out
+}
+
+type Opt func(e *Engine) error
+
+// WithConcurrency sets number of items processed in parallel. Default is 4
+func WithConcurrency(n int) Opt {
+	return func(e *Engine) error {
+		if n < 1 {
+			return fmt.Errorf(`concurrency must be positive`)
+		}
+		e.concurrency = n
+		return nil
+	}
+}
+
+// WithRateLimit limits CA requests (register and enroll are counted separately) per second
+func WithRateLimit(perSecond float64) Opt {
+	return func(e *Engine) error {
+		if perSecond <= 0 {
+			return fmt.Errorf(`rate limit must be positive`)
+		}
+		e.limiter = &limiter{interval: time.Duration(float64(time.Second) / perSecond)}
+		return nil
+	}
+}
+
+// WithCheckpoint sets file where finished stages are recorded. Run with existing checkpoint skips finished items
+func WithCheckpoint(path string) Opt {
+	return func(e *Engine) error {
+		e.checkpointPath = path
+		return nil
+	}
+}
+
+// WithWallet writes enrolled identities to wallet under item label
+func WithWallet(w wallet.Wallet, mspID string) Opt {
+	return func(e *Engine) error {
+		e.wallet, e.mspID = w, mspID
+		return nil
+	}
+}
+
+// WithProgress sets callback called after every finished item. Calls are serialized
+func WithProgress(fn func(Progress)) Opt {
+	return func(e *Engine) error {
+		e.progress = fn
+		return nil
+	}
+}
+
+// WithDefaults sets identity type and affiliation of items which don't define them
+func WithDefaults(identityType request.IdentityType, affiliation string) Opt {
+	return func(e *Engine) error {
+		e.defaultType, e.defaultAffiliation = identityType, affiliation
+		return nil
+	}
+}
+
+// WithCSR sets CSR subject names and key request of all items, hosts of items are added to configured hosts
+func WithCSR(conf config.CSRConfig) Opt {
+	return func(e *Engine) error {
+		e.csr = conf
+		return nil
+	}
+}
+
+func WithLogger(logger *slog.Logger) Opt {
+	return func(e *Engine) error {
+		e.logger = logger
+		return nil
+	}
+}
+
+// Engine runs bulk registration and enrollment
+type Engine struct {
+	registrar          client.Client
+	concurrency        int
+	limiter            *limiter
+	checkpointPath     string
+	wallet             wallet.Wallet
+	mspID              string
+	progress           func(Progress)
+	defaultType        request.IdentityType
+	defaultAffiliation string
+	csr                config.CSRConfig
+	logger             *slog.Logger
+}
+
+// New creates engine. Registrar registers identities and is used for enrollment with secrets of items
+func New(registrar client.Client, opts ...Opt) (*Engine, error) {
+	e := &Engine{
+		registrar:   registrar,
+		concurrency: defaultConcurrency,
+		defaultType: request.IdentityTypeClient,
+		logger:      slog.Default(),
+	}
+	for _, opt := range opts {
+		if err := opt(e); err != nil {
+			return nil, fmt.Errorf(`apply bulk option: %w`, err)
+		}
+	}
+	return e, nil
+}
+
+// Run processes items. Failures of items are reported in results, error is returned only if run can't proceed,
+// for example checkpoint can't be opened or ctx is canceled. On cancellation report holds finished items
+func (e *Engine) Run(ctx context.Context, items []Item) (*Report, error) {
+	if err := validate(items); err != nil {
+		return nil, err
+	}
+
+	var cp *checkpoint
+	if e.checkpointPath != `` {
+		var err error
+		if cp, err = openCheckpoint(e.checkpointPath); err != nil {
+			return nil, err
+		}
+		defer func() { _ = cp.close() }()
+	}
+
+	report := &Report{Results: make([]Result, len(items)), Progress: Progress{Total: len(items)}}
+	var mu sync.Mutex
+	finish := func(res Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		report.Results[res.Index] = res
+		switch res.Status {
+		case StatusSucceeded:
+			report.Succeeded++
+		case StatusSkipped:
+			report.Skipped++
+		case StatusFailed:
+			report.Failed++
+			e.logger.WarnContext(ctx, `bulk item failed`, slog.Any(`error`, res.Err))
+		}
+		if e.progress != nil {
+			e.progress(report.Progress)
+		}
+	}
+
+	if err := e.forEach(ctx, len(items), func(i int) { finish(e.process(ctx, cp, i, items[i])) }); err != nil {
+		return report, fmt.Errorf(`bulk run interrupted after %d of %d items: %w`, report.Done(), report.Total, err)
+	}
+	return report, nil
+}
+
+// forEach calls fn for indexes 0..n-1 by concurrency workers. It stops feeding indexes when ctx is canceled
+// and returns ctx error after started calls are finished
+func (e *Engine) forEach(ctx context.Context, n int, fn func(i int)) error {
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < e.concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+
+feed:
+	for i := 0; i < n; i++ {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(indexes)
+	wg.Wait()
+	return ctx.Err()
+}
+
+func (e *Engine) process(ctx context.Context, cp *checkpoint, index int, item Item) Result {
+	res := Result{Index: index, Name: item.Name}
+	fail := func(stage Stage, err error) Result {
+		res.Status, res.Err = StatusFailed, &ItemError{Name: item.Name, Stage: stage, Err: err}
+		return res
+	}
+
+	entry, ok := cp.get(item.Name)
+	if ok && entry.Stage == stageEnrolled {
+		res.Status = StatusSkipped
+		return res
+	}
+
+	secret := item.Secret
+	if ok && entry.Stage == stageRegistered {
+		if entry.Secret != `` {
+			secret = entry.Secret
+		}
+	} else {
+		if err := e.limiter.wait(ctx); err != nil {
+			return fail(StageRegister, err)
+		}
+		generated, err := e.registrar.Register(ctx, e.registration(item))
+		switch {
+		case errors.Is(err, client.ErrAlreadyRegistered) && item.Secret != ``:
+			// registered by interrupted run without checkpoint or beforehand, enrollment proves the secret
+		case err != nil:
+			return fail(StageRegister, err)
+		default:
+			res.Registered = true
+			entry := checkpointEntry{Name: item.Name, Stage: stageRegistered}
+			if item.Secret == `` {
+				secret, entry.Secret = generated, generated
+			}
+			if err = cp.record(entry); err != nil {
+				return fail(StageRegister, err)
+			}
+		}
+	}
+
+	if err := e.limiter.wait(ctx); err != nil {
+		return fail(StageEnroll, err)
+	}
+	conf := e.csr
+	conf.Hosts = append(append([]string{}, conf.Hosts...), item.Hosts...)
+	builder, err := csr.NewBuilder(conf)
+	if err != nil {
+		return fail(StageEnroll, err)
+	}
+	req, key, err := builder.Build(item.Name)
+	if err != nil {
+		return fail(StageEnroll, err)
+	}
+	cert, _, err := e.registrar.Enroll(ctx, item.Name, secret, req,
+		client.WithEnrollPrivateKey(key), client.WithEnrollProfile(client.EnrollProfile(item.Profile)))
+	if err != nil {
+		return fail(StageEnroll, err)
+	}
+	res.Certificate = cert
+
+	if e.wallet != nil {
+		identity, err := wallet.NewIdentity(e.mspID, cert, key)
+		if err == nil {
+			err = e.wallet.Put(item.label(), identity)
+		}
+		if err != nil {
+			return fail(StageWallet, err)
+		}
+	}
+	if err = cp.record(checkpointEntry{Name: item.Name, Stage: stageEnrolled}); err != nil {
+		return fail(StageEnroll, err)
+	}
+
+	res.Status = StatusSucceeded
+	return res
+}
+
+func (e *Engine) registration(item Item) request.Registration {
+	reg := request.Registration{
+		Name:           item.Name,
+		Type:           item.Type,
+		Secret:         item.Secret,
+		MaxEnrollments: item.MaxEnrollments,
+		Affiliation:    item.Affiliation,
+		Attrs:          item.Attrs,
+	}
+	if reg.Type == `` {
+		reg.Type = string(e.defaultType)
+	}
+	if reg.Affiliation == `` {
+		reg.Affiliation = e.defaultAffiliation
+	}
+	return reg
+}
+
+// limiter spaces requests evenly, nil limiter doesn't limit
+type limiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+func (l *limiter) wait(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	at := l.next
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
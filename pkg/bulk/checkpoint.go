@@ -0,0 +1,101 @@
+package bulk
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+const (
+	stageRegistered = `registered`
+	stageEnrolled   = `enrolled`
+)
+
+// checkpointEntry records finished stage of item. Secret is kept only if it was generated by CA,
+// otherwise interrupted item can't be enrolled after resume
+type checkpointEntry struct {
+	Name   string `json:"name"`
+	Stage  string `json:"stage"`
+	Secret string `json:"secret,omitempty"`
+}
+
+// checkpoint is append-only JSON lines file of finished stages
+type checkpoint struct {
+	mu      sync.Mutex
+	file    *os.File
+	entries map[string]checkpointEntry
+}
+
+func openCheckpoint(path string) (*checkpoint, error) {
+	cp := &checkpoint{entries: map[string]checkpointEntry{}}
+
+	content, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf(`open checkpoint: %w`, err)
+	}
+	// the last line may be torn by crash: it's cut off, so next entry starts on its own line
+	// and stage of torn entry is repeated
+	complete := bytes.LastIndexByte(content, '\n') + 1
+	for _, line := range bytes.Split(content[:complete], []byte{'\n'}) {
+		var entry checkpointEntry
+		if len(line) == 0 || json.Unmarshal(line, &entry) != nil {
+			continue
+		}
+		cp.entries[entry.Name] = entry
+	}
+
+	if cp.file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600); err != nil {
+		return nil, fmt.Errorf(`open checkpoint: %w`, err)
+	}
+	if complete < len(content) {
+		if err = cp.file.Truncate(int64(complete)); err != nil {
+			_ = cp.file.Close()
+			return nil, fmt.Errorf(`truncate torn checkpoint: %w`, err)
+		}
+	}
+	return cp, nil
+}
+
+func (cp *checkpoint) get(name string) (checkpointEntry, bool) {
+	if cp == nil {
+		return checkpointEntry{}, false
+	}
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	entry, ok := cp.entries[name]
+	return entry, ok
+}
+
+// record appends entry and syncs file, so recorded stage survives crash
+func (cp *checkpoint) record(entry checkpointEntry) error {
+	if cp == nil {
+		return nil
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if _, err = cp.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf(`write checkpoint: %w`, err)
+	}
+	if err = cp.file.Sync(); err != nil {
+		return fmt.Errorf(`sync checkpoint: %w`, err)
+	}
+	cp.entries[entry.Name] = entry
+	return nil
+}
+
+func (cp *checkpoint) close() error {
+	if cp == nil {
+		return nil
+	}
+	return cp.file.Close()
+}
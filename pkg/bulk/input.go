@@ -0,0 +1,221 @@
+package bulk
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hlfans/ca-sdk/pkg/request"
+	"gopkg.in/yaml.v3"
+)
+
+// Item is single identity to register and enroll
+type Item struct {
+	// Name is enrollment id, it is also wallet label unless Label is set
+	Name string `json:"name" yaml:"name"`
+	// Secret is enrollment secret. If empty CA generates it
+	Secret         string              `json:"secret,omitempty" yaml:"secret"`
+	Type           string              `json:"type,omitempty" yaml:"type"`
+	Affiliation    string              `json:"affiliation,omitempty" yaml:"affiliation"`
+	MaxEnrollments int                 `json:"max_enrollments,omitempty" yaml:"max_enrollments"`
+	Attrs          []request.Attribute `json:"attrs,omitempty" yaml:"attrs"`
+	// Profile is enrollment profile, for example tls
+	Profile string `json:"profile,omitempty" yaml:"profile"`
+	// Hosts are added to CSR as subject alternative names
+	Hosts []string `json:"hosts,omitempty" yaml:"hosts"`
+	Label string   `json:"label,omitempty" yaml:"label"`
+}
+
+func (i Item) label() string {
+	if i.Label != `` {
+		return i.Label
+	}
+	return i.Name
+}
+
+// ReadFile reads items from file with .csv, .json, .jsonl, .yaml or .yml extension
+func ReadFile(path string) ([]Item, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf(`open items: %w`, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case `.csv`:
+		return ReadCSV(f)
+	case `.json`, `.jsonl`:
+		return ReadJSON(f)
+	case `.yaml`, `.yml`:
+		return ReadYAML(f)
+	}
+	return nil, fmt.Errorf(`unsupported items file %s`, path)
+}
+
+// ReadCSV reads items from CSV with header row. Columns are name, secret, type, affiliation, max_enrollments,
+// profile, label, hosts, attrs and ecert_attrs, only name is required. Hosts are separated by `;`,
+// attributes are `name=value` pairs separated by `;`, ecert_attrs are added to ECert
+func ReadCSV(r io.Reader) ([]Item, error) {
+	var items []Item
+	err := readCSV(r, []string{`name`}, func(line int, get func(string) string) error {
+		var err error
+		item := Item{
+			Name: get(`name`), Secret: get(`secret`), Type: get(`type`), Affiliation: get(`affiliation`),
+			Profile: get(`profile`), Label: get(`label`), Hosts: splitList(get(`hosts`)),
+		}
+		if v := get(`max_enrollments`); v != `` {
+			if item.MaxEnrollments, err = strconv.Atoi(v); err != nil {
+				return fmt.Errorf(`max_enrollments: %w`, err)
+			}
+		}
+		for column, ecert := range map[string]bool{`attrs`: false, `ecert_attrs`: true} {
+			for _, pair := range splitList(get(column)) {
+				name, value, ok := strings.Cut(pair, `=`)
+				if !ok {
+					return fmt.Errorf(`attribute %q must be name=value`, pair)
+				}
+				item.Attrs = append(item.Attrs, request.Attribute{Name: strings.TrimSpace(name), Value: value, ECert: ecert})
+			}
+		}
+		items = append(items, item)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, validate(items)
+}
+
+// readCSV calls fn for every row of CSV with header row, get returns trimmed value of column by lowercase name
+func readCSV(r io.Reader, required []string, fn func(line int, get func(column string) string) error) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf(`read CSV header: %w`, err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, column := range required {
+		if _, ok := columns[column]; !ok {
+			return fmt.Errorf(`CSV header must contain %s column`, column)
+		}
+	}
+
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf(`read CSV: %w`, err)
+		}
+		get := func(column string) string {
+			if i, ok := columns[column]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ``
+		}
+		if err = fn(line, get); err != nil {
+			return fmt.Errorf(`line %d: %w`, line, err)
+		}
+	}
+}
+
+// ReadJSON reads items from JSON array or from stream of JSON objects, for example JSON lines
+func ReadJSON(r io.Reader) ([]Item, error) {
+	items, err := readJSON[Item](r)
+	if err != nil {
+		return nil, err
+	}
+	return items, validate(items)
+}
+
+// ReadYAML reads items from YAML list
+func ReadYAML(r io.Reader) ([]Item, error) {
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+
+	var items []Item
+	if err := dec.Decode(&items); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf(`read YAML: %w`, err)
+	}
+	return items, validate(items)
+}
+
+// readJSON reads values from JSON array or from stream of JSON objects
+func readJSON[T any](r io.Reader) ([]T, error) {
+	dec := json.NewDecoder(r)
+
+	var values []T
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf(`read JSON: %w`, err)
+		}
+
+		var (
+			batch []T
+			err   error
+		)
+		if strings.HasPrefix(strings.TrimSpace(string(raw)), `[`) {
+			err = strictUnmarshal(raw, &batch)
+		} else {
+			var value T
+			err = strictUnmarshal(raw, &value)
+			batch = []T{value}
+		}
+		if err != nil {
+			return nil, fmt.Errorf(`parse entry %d: %w`, len(values)+1, err)
+		}
+		values = append(values, batch...)
+	}
+	return values, nil
+}
+
+func strictUnmarshal(raw []byte, v interface{}) error {
+	dec := json.NewDecoder(strings.NewReader(string(raw)))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// validate requires unique names and labels, so checkpoint and wallet entries are unambiguous
+func validate(items []Item) error {
+	names := make(map[string]bool, len(items))
+	labels := make(map[string]bool, len(items))
+	for i, item := range items {
+		if item.Name == `` {
+			return fmt.Errorf(`item %d: name is empty`, i+1)
+		}
+		if names[item.Name] {
+			return fmt.Errorf(`item %d: identity %s is defined twice`, i+1, item.Name)
+		}
+		if labels[item.label()] {
+			return fmt.Errorf(`item %d: label %s is defined twice`, i+1, item.label())
+		}
+		names[item.Name], labels[item.label()] = true, true
+	}
+	return nil
+}
+
+func splitList(v string) []string {
+	var out []string
+	for _, item := range strings.Split(v, `;`) {
+		if item = strings.TrimSpace(item); item != `` {
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -0,0 +1,340 @@
+package bulk
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hlfans/ca-sdk/pkg/client"
+	"github.com/hlfans/ca-sdk/pkg/request"
+)
+
+const (
+	StagePreview Stage = `preview`
+	StageRevoke  Stage = `revoke`
+)
+
+// PlannedRevocation is target resolved to certificates which will be revoked
+type PlannedRevocation struct {
+	Index  int
+	Target RevocationTarget
+	// Certificates are not revoked certificates of target. Identity without certificates is revoked anyway
+	Certificates []*x509.Certificate
+	// Err is *ItemError of unresolved target, such targets are not revoked
+	Err error
+}
+
+// RevocationPlan is result of preview, it shows exactly which certificates will be revoked
+type RevocationPlan struct {
+	Targets []PlannedRevocation
+}
+
+// Certificates returns number of certificates to be revoked
+func (p *RevocationPlan) Certificates() int {
+	var n int
+	for _, t := range p.Targets {
+		if t.Err == nil {
+			n += len(t.Certificates)
+		}
+	}
+	return n
+}
+
+// Unresolved returns targets which failed preview
+func (p *RevocationPlan) Unresolved() []PlannedRevocation {
+	var out []PlannedRevocation
+	for _, t := range p.Targets {
+		if t.Err != nil {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// WriteText writes plan as table for confirmation by operator
+func (p *RevocationPlan) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "TARGET\tSERIAL\tAKI\tSUBJECT\tNOT AFTER")
+	for _, t := range p.Targets {
+		switch {
+		case t.Err != nil:
+			_, _ = fmt.Fprintf(tw, "%s\t-\t-\tERROR: %s\t-\n", t.Target, t.Err)
+		case len(t.Certificates) == 0:
+			_, _ = fmt.Fprintf(tw, "%s\t-\t-\tno active certificates, identity only\t-\n", t.Target)
+		}
+		for _, cert := range t.Certificates {
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", t.Target, serialHex(cert.SerialNumber),
+				hex.EncodeToString(cert.AuthorityKeyId), cert.Subject.CommonName, cert.NotAfter.UTC().Format(time.RFC3339))
+		}
+	}
+	_, _ = fmt.Fprintf(tw, "%d targets, %d certificates, %d unresolved\n",
+		len(p.Targets), p.Certificates(), len(p.Unresolved()))
+	return tw.Flush()
+}
+
+// Preview resolves targets with CertificateList. Identity targets are resolved by enrollment id, serial and AKI
+// targets are matched against single list of not revoked certificates
+func (e *Engine) Preview(ctx context.Context, targets []RevocationTarget) (*RevocationPlan, error) {
+	if err := validateTargets(targets); err != nil {
+		return nil, err
+	}
+
+	plan := &RevocationPlan{Targets: make([]PlannedRevocation, len(targets))}
+	for i, target := range targets {
+		plan.Targets[i] = PlannedRevocation{Index: i, Target: target}
+	}
+	fail := func(t *PlannedRevocation, err error) {
+		t.Err = &ItemError{Name: t.Target.String(), Stage: StagePreview, Err: err}
+	}
+
+	var (
+		active   map[string]*x509.Certificate
+		listErr  error
+		listOnce sync.Once
+	)
+	activeCerts := func() (map[string]*x509.Certificate, error) {
+		listOnce.Do(func() {
+			if listErr = e.limiter.wait(ctx); listErr != nil {
+				return
+			}
+			var certs []*x509.Certificate
+			if certs, listErr = e.registrar.CertificateList(ctx, client.WithNotRevoked()); listErr != nil {
+				return
+			}
+			active = make(map[string]*x509.Certificate, len(certs))
+			for _, cert := range certs {
+				active[certKey(serialHex(cert.SerialNumber), hex.EncodeToString(cert.AuthorityKeyId))] = cert
+			}
+		})
+		return active, listErr
+	}
+
+	err := e.forEach(ctx, len(targets), func(i int) {
+		t := &plan.Targets[i]
+		if t.Target.Name == `` {
+			certs, err := activeCerts()
+			if err != nil {
+				fail(t, err)
+			} else if cert, ok := certs[certKey(t.Target.Serial, t.Target.AKI)]; ok {
+				t.Certificates = []*x509.Certificate{cert}
+			} else {
+				fail(t, fmt.Errorf(`%w: not found or already revoked`, client.ErrCertificateNotFound))
+			}
+			return
+		}
+
+		if err := e.limiter.wait(ctx); err != nil {
+			fail(t, err)
+			return
+		}
+		certs, err := e.registrar.CertificateList(ctx, client.WithEnrollId(t.Target.Name), client.WithNotRevoked())
+		if err != nil {
+			fail(t, err)
+			return
+		}
+		t.Certificates = certs
+	})
+	if err != nil {
+		return nil, fmt.Errorf(`revocation preview interrupted: %w`, err)
+	}
+	return plan, nil
+}
+
+// RevocationResult is outcome of single target
+type RevocationResult struct {
+	Index  int
+	Target RevocationTarget
+	Reason string
+	Status Status
+	// Certificates are revoked certificates according to plan
+	Certificates []*x509.Certificate
+	// Err is *ItemError for failed targets, including unresolved by preview
+	Err error
+}
+
+// RevocationReport is audit report of revocation run
+type RevocationReport struct {
+	Reason     string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Results    []RevocationResult
+	// CRL is generated once after all targets are revoked
+	CRL *x509.RevocationList
+	Progress
+}
+
+// Revoke revokes resolved targets of plan with reason, unless target defines own reason, and generates CRL
+// once at the end. Failures of targets are reported in results. Error is returned with report
+// if ctx is canceled or CRL can't be generated
+func (e *Engine) Revoke(ctx context.Context, plan *RevocationPlan, reason string) (*RevocationReport, error) {
+	if err := validateReason(reason); err != nil {
+		return nil, err
+	}
+
+	report := &RevocationReport{
+		Reason:    reason,
+		StartedAt: time.Now(),
+		Results:   make([]RevocationResult, len(plan.Targets)),
+		Progress:  Progress{Total: len(plan.Targets)},
+	}
+	var mu sync.Mutex
+	finish := func(res RevocationResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		report.Results[res.Index] = res
+		switch res.Status {
+		case StatusSucceeded:
+			report.Succeeded++
+			e.logger.InfoContext(ctx, `revoked`, slog.String(`target`, res.Target.String()),
+				slog.String(`reason`, res.Reason), slog.Int(`certificates`, len(res.Certificates)))
+		case StatusFailed:
+			report.Failed++
+			e.logger.WarnContext(ctx, `revocation failed`, slog.Any(`error`, res.Err))
+		}
+		if e.progress != nil {
+			e.progress(report.Progress)
+		}
+	}
+
+	err := e.forEach(ctx, len(plan.Targets), func(i int) {
+		finish(e.revoke(ctx, plan.Targets[i], reason))
+	})
+	report.FinishedAt = time.Now()
+	if err != nil {
+		return report, fmt.Errorf(`revocation interrupted after %d of %d targets: %w`, report.Done(), report.Total, err)
+	}
+
+	if report.Succeeded > 0 {
+		if err = e.limiter.wait(ctx); err == nil {
+			report.CRL, err = e.registrar.GenCRL(ctx, request.GenCRLRequest{})
+		}
+		report.FinishedAt = time.Now()
+		if err != nil {
+			return report, fmt.Errorf(`generate CRL: %w`, err)
+		}
+	}
+	return report, nil
+}
+
+func (e *Engine) revoke(ctx context.Context, planned PlannedRevocation, reason string) RevocationResult {
+	res := RevocationResult{Index: planned.Index, Target: planned.Target, Reason: reason, Certificates: planned.Certificates}
+	if planned.Target.Reason != `` {
+		res.Reason = planned.Target.Reason
+	}
+	if planned.Err != nil {
+		res.Status, res.Err = StatusFailed, planned.Err
+		return res
+	}
+
+	req := request.RevocationRequest{Name: planned.Target.Name, Reason: res.Reason}
+	if req.Name == `` {
+		cert := planned.Certificates[0]
+		req.Serial, req.AKI = serialHex(cert.SerialNumber), hex.EncodeToString(cert.AuthorityKeyId)
+	}
+
+	err := e.limiter.wait(ctx)
+	if err == nil {
+		_, err = e.registrar.Revoke(ctx, req)
+	}
+	if err != nil {
+		res.Status, res.Err = StatusFailed, &ItemError{Name: planned.Target.String(), Stage: StageRevoke, Err: err}
+		return res
+	}
+	res.Status = StatusSucceeded
+	return res
+}
+
+// AuditRecord is row of audit report, one per revoked certificate or per target without certificates
+type AuditRecord struct {
+	Target   string    `json:"target"`
+	Reason   string    `json:"reason,omitempty"`
+	Status   Status    `json:"status"`
+	Serial   string    `json:"serial,omitempty"`
+	AKI      string    `json:"aki,omitempty"`
+	Subject  string    `json:"subject,omitempty"`
+	NotAfter time.Time `json:"not_after,omitzero"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Records returns audit records in order of targets
+func (r *RevocationReport) Records() []AuditRecord {
+	var records []AuditRecord
+	for _, res := range r.Results {
+		record := AuditRecord{Target: res.Target.String(), Reason: res.Reason, Status: res.Status}
+		if res.Err != nil {
+			record.Error = res.Err.Error()
+		}
+		if len(res.Certificates) == 0 {
+			records = append(records, record)
+		}
+		for _, cert := range res.Certificates {
+			record.Serial, record.AKI = serialHex(cert.SerialNumber), hex.EncodeToString(cert.AuthorityKeyId)
+			record.Subject, record.NotAfter = cert.Subject.CommonName, cert.NotAfter.UTC()
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// WriteJSON writes audit report as JSON document
+func (r *RevocationReport) WriteJSON(w io.Writer) error {
+	doc := struct {
+		Reason     string        `json:"reason,omitempty"`
+		StartedAt  time.Time     `json:"started_at"`
+		FinishedAt time.Time     `json:"finished_at"`
+		Total      int           `json:"total"`
+		Succeeded  int           `json:"succeeded"`
+		Failed     int           `json:"failed"`
+		CRLNumber  string        `json:"crl_number,omitempty"`
+		Records    []AuditRecord `json:"records"`
+	}{
+		Reason: r.Reason, StartedAt: r.StartedAt.UTC(), FinishedAt: r.FinishedAt.UTC(),
+		Total: r.Total, Succeeded: r.Succeeded, Failed: r.Failed, Records: r.Records(),
+	}
+	if r.CRL != nil && r.CRL.Number != nil {
+		doc.CRLNumber = r.CRL.Number.String()
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent(``, `  `)
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf(`write audit report: %w`, err)
+	}
+	return nil
+}
+
+// WriteCSV writes audit records as CSV with header row
+func (r *RevocationReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{`target`, `reason`, `status`, `serial`, `aki`, `subject`, `not_after`, `error`})
+	for _, record := range r.Records() {
+		var notAfter string
+		if !record.NotAfter.IsZero() {
+			notAfter = record.NotAfter.Format(time.RFC3339)
+		}
+		_ = cw.Write([]string{record.Target, record.Reason, string(record.Status), record.Serial, record.AKI,
+			record.Subject, notAfter, record.Error})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf(`write audit report: %w`, err)
+	}
+	return nil
+}
+
+func serialHex(serial *big.Int) string {
+	return fmt.Sprintf(`%x`, serial)
+}
+
+func certKey(serial, aki string) string {
+	return normalizeHex(serial) + `/` + normalizeHex(aki)
+}
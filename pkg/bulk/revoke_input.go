@@ -0,0 +1,115 @@
+package bulk
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// revocationReasons are reasons accepted by Fabric CA
+var revocationReasons = map[string]bool{
+	`unspecified`: true, `keycompromise`: true, `cacompromise`: true, `affiliationchange`: true,
+	`superseded`: true, `cessationofoperation`: true, `certificatehold`: true, `removefromcrl`: true,
+	`privilegewithdrawn`: true, `aacompromise`: true,
+}
+
+// RevocationTarget is identity, whose certificates are revoked and identity itself is disabled,
+// or single certificate defined by serial and AKI in hex
+type RevocationTarget struct {
+	Name   string `json:"name,omitempty" yaml:"name"`
+	Serial string `json:"serial,omitempty" yaml:"serial"`
+	AKI    string `json:"aki,omitempty" yaml:"aki"`
+	// Reason overrides reason of run
+	Reason string `json:"reason,omitempty" yaml:"reason"`
+}
+
+func (t RevocationTarget) String() string {
+	if t.Name != `` {
+		return t.Name
+	}
+	return fmt.Sprintf(`serial %s aki %s`, t.Serial, t.AKI)
+}
+
+// ReadRevocationFile reads targets from file with .csv, .json or .jsonl extension
+func ReadRevocationFile(path string) ([]RevocationTarget, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf(`open revocation targets: %w`, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case `.csv`:
+		return ReadRevocationCSV(f)
+	case `.json`, `.jsonl`:
+		return ReadRevocationJSON(f)
+	}
+	return nil, fmt.Errorf(`unsupported revocation targets file %s`, path)
+}
+
+// ReadRevocationCSV reads targets from CSV with header row. Columns are name, serial, aki and reason,
+// every row must define either name or serial and aki
+func ReadRevocationCSV(r io.Reader) ([]RevocationTarget, error) {
+	var targets []RevocationTarget
+	err := readCSV(r, nil, func(_ int, get func(string) string) error {
+		targets = append(targets, RevocationTarget{
+			Name: get(`name`), Serial: get(`serial`), AKI: get(`aki`), Reason: get(`reason`),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return targets, validateTargets(targets)
+}
+
+// ReadRevocationJSON reads targets from JSON array or from stream of JSON objects
+func ReadRevocationJSON(r io.Reader) ([]RevocationTarget, error) {
+	targets, err := readJSON[RevocationTarget](r)
+	if err != nil {
+		return nil, err
+	}
+	return targets, validateTargets(targets)
+}
+
+func validateTargets(targets []RevocationTarget) error {
+	seen := make(map[string]bool, len(targets))
+	for i, target := range targets {
+		if target.Name != `` && (target.Serial != `` || target.AKI != ``) {
+			return fmt.Errorf(`target %d: either name or serial and aki must be specified, not both`, i+1)
+		}
+		if target.Name == `` && (target.Serial == `` || target.AKI == ``) {
+			return fmt.Errorf(`target %d: either name or serial and aki must be specified`, i+1)
+		}
+		if err := validateReason(target.Reason); err != nil {
+			return fmt.Errorf(`target %d: %w`, i+1, err)
+		}
+		key := target.Name
+		if key == `` {
+			key = certKey(target.Serial, target.AKI)
+		}
+		if seen[key] {
+			return fmt.Errorf(`target %d: %s is defined twice`, i+1, target)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+func validateReason(reason string) error {
+	if reason != `` && !revocationReasons[strings.ToLower(reason)] {
+		return fmt.Errorf(`unknown revocation reason %s`, reason)
+	}
+	return nil
+}
+
+// normalizeHex makes serials and AKIs comparable: lowercase without colons and leading zeros
+func normalizeHex(v string) string {
+	v = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(v), `:`, ``))
+	if trimmed := strings.TrimLeft(v, `0`); trimmed != `` {
+		return trimmed
+	}
+	return v
+}
@@ -15,9 +15,16 @@ type Client interface {
 	CAInfo(ctx context.Context) (*response.CAInfo, error)
 
 	Register(ctx context.Context, req request.Registration) (string, error)
+	// Enroll enrolls identity with secret. If req is already signed CSR (req.Raw is set), it is sent as is
+	// and returned private key is nil. If req is nil or empty, it is built from csr section of config
 	Enroll(ctx context.Context, name, secret string, req *x509.CertificateRequest, opts ...EnrollOpt) (
 		*x509.Certificate, interface{}, error)
+	// Reenroll issues new certificate for client identity, empty req is built from csr section of config
+	Reenroll(ctx context.Context, req *x509.CertificateRequest, opts ...EnrollOpt) (*x509.Certificate, interface{}, error)
+	// Revoke revokes certificate or all certificates of identity. CRL is returned only if req.GenCRL is set
 	Revoke(ctx context.Context, req request.RevocationRequest) (*pkix.CertificateList, error)
+	// GenCRL generates CRL of revoked and not expired certificates
+	GenCRL(ctx context.Context, req request.GenCRLRequest) (*x509.RevocationList, error)
 	IdentityList(ctx context.Context) ([]entity.Identity, error)
 	IdentityGet(ctx context.Context, enrollId string) (*entity.Identity, error)
 	CertificateList(ctx context.Context, opts ...CertificateListOpt) ([]*x509.Certificate, error)
@@ -26,3 +33,21 @@ type Client interface {
 	AffiliationCreate(ctx context.Context, name string, opts ...AffiliationOpt) error
 	AffiliationDelete(ctx context.Context, name string, opts ...AffiliationOpt) ([]entity.Identity, []entity.Affiliation, error)
 }
+
+// Operation names Client method which produced CA request
+type Operation string
+
+const (
+	OperationCAInfo            Operation = `CAInfo`
+	OperationRegister          Operation = `Register`
+	OperationEnroll            Operation = `Enroll`
+	OperationReenroll          Operation = `Reenroll`
+	OperationRevoke            Operation = `Revoke`
+	OperationGenCRL            Operation = `GenCRL`
+	OperationIdentityList      Operation = `IdentityList`
+	OperationIdentityGet       Operation = `IdentityGet`
+	OperationCertificateList   Operation = `CertificateList`
+	OperationAffiliationList   Operation = `AffiliationList`
+	OperationAffiliationCreate Operation = `AffiliationCreate`
+	OperationAffiliationDelete Operation = `AffiliationDelete`
+)
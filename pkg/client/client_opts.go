@@ -11,6 +11,8 @@ const (
 	EnrollProfileDefault EnrollProfile = ""
 	// EnrollProfileTls asks Fabric CA for certificate used for TLS communication
 	EnrollProfileTls EnrollProfile = "tls"
+	// EnrollProfileCA asks Fabric CA for intermediate CA certificate. Identity must have hf.IntermediateCA attribute
+	EnrollProfileCA EnrollProfile = "ca"
 )
 
 type EnrollOpts struct {
@@ -45,6 +47,38 @@ func WithEnrollId(enrollId string) CertificateListOpt {
 	}
 }
 
+// WithRevoked lists only revoked certificates
+func WithRevoked() CertificateListOpt {
+	return func(values *url.Values) error {
+		values.Set(`revoked`, `true`)
+		return nil
+	}
+}
+
+// WithNotRevoked lists only certificates which are not revoked
+func WithNotRevoked() CertificateListOpt {
+	return func(values *url.Values) error {
+		values.Set(`notrevoked`, `true`)
+		return nil
+	}
+}
+
+// WithExpired lists only expired certificates
+func WithExpired() CertificateListOpt {
+	return func(values *url.Values) error {
+		values.Set(`expired`, `true`)
+		return nil
+	}
+}
+
+// WithNotExpired lists only certificates which are not expired
+func WithNotExpired() CertificateListOpt {
+	return func(values *url.Values) error {
+		values.Set(`notexpired`, `true`)
+		return nil
+	}
+}
+
 type AffiliationOpt func(values *url.Values) error
 
 func WithForce() AffiliationOpt {
@@ -1,22 +1,20 @@
 package client
 
 import (
-	"context"
 	"crypto/rand"
 	"crypto/sha256"
-	"crypto/x509/pkix"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/hlfans/ca-sdk/pkg/config"
 	"github.com/hlfans/ca-sdk/pkg/crypto"
-	"github.com/hlfans/ca-sdk/pkg/entity"
-	"github.com/hlfans/ca-sdk/pkg/request"
 	"github.com/hlfans/ca-sdk/pkg/response"
 	"gopkg.in/yaml.v3"
 )
@@ -72,26 +70,13 @@ type httpClient struct {
 	config *config.CAConfig
 	client *http.Client
 	signer crypto.Signer
-}
-
-func (c *httpClient) Register(ctx context.Context, req request.Registration) (string, error) {
-	//TODO implement me
-	panic("implement me")
-}
-
-func (c *httpClient) Revoke(ctx context.Context, req request.RevocationRequest) (*pkix.CertificateList, error) {
-	//TODO implement me
-	panic("implement me")
-}
-
-func (c *httpClient) IdentityList(ctx context.Context) ([]entity.Identity, error) {
-	//TODO implement me
-	panic("implement me")
-}
-
-func (c *httpClient) IdentityGet(ctx context.Context, enrollId string) (*entity.Identity, error) {
-	//TODO implement me
-	panic("implement me")
+	retry  *RetryPolicy
+	pool   *EndpointPool
+	logger *slog.Logger
+	// wireDump enables logging of redacted requests and responses
+	wireDump  bool
+	telemetry *telemetry
+	audit     AuditHook
 }
 
 func NewHttp(opts ...HttpOpt) (Client, error) {
@@ -113,6 +98,12 @@ func NewHttp(opts ...HttpOpt) (Client, error) {
 		cli.client = http.DefaultClient
 	}
 
+	if cli.pool == nil && len(cli.config.Endpoints) > 0 {
+		if cli.pool, err = NewEndpointPool(cli.config, cli.client); err != nil {
+			return nil, fmt.Errorf(`create endpoint pool: %w`, err)
+		}
+	}
+
 	return &cli, nil
 }
 
@@ -142,6 +133,29 @@ func (c *httpClient) setAuthToken(req *http.Request, body []byte) error {
 	return nil
 }
 
+// do sends request produced by operation to CA
+func (c *httpClient) do(req *http.Request, op Operation) (*http.Response, error) {
+	req, finish := c.telemetry.start(req, op)
+	audit := c.auditRequest(req, op)
+	resp, err := c.doWithRetry(req, op)
+	audit(resp, err)
+	finish(resp, err)
+	return resp, err
+}
+
+// send performs single attempt of request
+func (c *httpClient) send(req *http.Request, op Operation) (*http.Response, error) {
+	report := c.route(req)
+	c.dumpRequest(req, op)
+
+	started := time.Now()
+	resp, err := c.client.Do(req)
+	report(resp, err)
+
+	c.logResponse(req, op, resp, err, time.Since(started))
+	return resp, err
+}
+
 func (c *httpClient) processResponse(resp *http.Response, out interface{}, expectedHTTPStatuses ...int) error {
 	defer func() { _ = resp.Body.Close() }()
 	body, err := io.ReadAll(resp.Body)
@@ -149,17 +163,22 @@ func (c *httpClient) processResponse(resp *http.Response, out interface{}, expec
 		return fmt.Errorf("read response body: %w", err)
 	}
 
+	var caResp response.Response
+
 	if !c.expectedHTTPStatus(resp.StatusCode, expectedHTTPStatuses...) {
+		// Fabric CA responds with errors in regular envelope, proxies and load balancers don't
+		if json.Unmarshal(body, &caResp) == nil && len(caResp.Errors) > 0 {
+			return ResponseError{Status: resp.StatusCode, Errors: caResp.Errors, Messages: caResp.Messages}
+		}
 		return ErrUnexpectedHTTPStatus{Status: resp.StatusCode, Body: body}
 	}
 
-	var caResp response.Response
 	if err = json.Unmarshal(body, &caResp); err != nil {
 		return fmt.Errorf("unmarshal JSON response: %w", err)
 	}
 
 	if !caResp.Success {
-		return ResponseError{Errors: caResp.Errors}
+		return ResponseError{Status: resp.StatusCode, Errors: caResp.Errors, Messages: caResp.Messages}
 	}
 
 	if err = json.Unmarshal(caResp.Result, out); err != nil {
@@ -37,7 +37,7 @@ func (c *httpClient) AffiliationList(ctx context.Context, rootAffiliation ...str
 		return nil, nil, fmt.Errorf("failed to set auth token: %w", err)
 	}
 
-	resp, err := c.client.Do(req.WithContext(ctx))
+	resp, err := c.do(req.WithContext(ctx), OperationAffiliationList)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to do request: %w", err)
 	}
@@ -84,7 +84,7 @@ func (c *httpClient) AffiliationCreate(ctx context.Context, name string, opts ..
 		return fmt.Errorf("failed to set auth token: %w", err)
 	}
 
-	resp, err := c.client.Do(req.WithContext(ctx))
+	resp, err := c.do(req.WithContext(ctx), OperationAffiliationCreate)
 	if err != nil {
 		return fmt.Errorf("failed to do request: %w", err)
 	}
@@ -127,7 +127,7 @@ func (c *httpClient) AffiliationDelete(ctx context.Context, name string, opts ..
 		return nil, nil, fmt.Errorf("failed to set auth token: %w", err)
 	}
 
-	resp, err := c.client.Do(req.WithContext(ctx))
+	resp, err := c.do(req.WithContext(ctx), OperationAffiliationDelete)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to do request: %w", err)
 	}
@@ -0,0 +1,124 @@
+package client
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// AuditedOperations are operations which change state of CA. Only they are passed to audit hook
+var AuditedOperations = map[Operation]bool{
+	OperationRegister:          true,
+	OperationEnroll:            true,
+	OperationReenroll:          true,
+	OperationRevoke:            true,
+	OperationAffiliationCreate: true,
+	OperationAffiliationDelete: true,
+}
+
+// AuditEvent describes administrative operation performed through client
+type AuditEvent struct {
+	Time      time.Time
+	Operation Operation
+	Method    string
+	// URL includes query, for example force flag of affiliation deletion
+	URL string
+	// Caller is enrollment id of client identity, for enrollment it is enrolled identity
+	Caller string
+	// Request is request body with registration secrets and private keys redacted
+	Request json.RawMessage
+	// Status is HTTP status of CA response, zero if request failed before response
+	Status int
+	// Codes are CA error codes of rejected request
+	Codes []int
+	// Error is transport error
+	Error string
+}
+
+// AuditHook receives events of audited operations after CA responded. Events are delivered in order of completion
+type AuditHook interface {
+	Audit(ctx context.Context, event AuditEvent) error
+}
+
+// AuditHookFunc is function adapter of AuditHook
+type AuditHookFunc func(ctx context.Context, event AuditEvent) error
+
+func (f AuditHookFunc) Audit(ctx context.Context, event AuditEvent) error {
+	return f(ctx, event)
+}
+
+// WithAuditHook passes every audited operation to hook. Operation has already been performed by CA when hook
+// is called, so hook errors don't fail operation, they are logged with level error
+func WithAuditHook(hook AuditHook) HttpOpt {
+	return func(c *httpClient) error {
+		c.audit = hook
+		return nil
+	}
+}
+
+// auditRequest captures request before it's sent, returned function passes outcome to audit hook
+func (c *httpClient) auditRequest(req *http.Request, op Operation) func(resp *http.Response, err error) {
+	if c.audit == nil || !AuditedOperations[op] {
+		return func(*http.Response, error) {}
+	}
+
+	event := AuditEvent{
+		Time:      time.Now().UTC(),
+		Operation: op,
+		Method:    req.Method,
+		URL:       req.URL.String(),
+		Caller:    c.callerID(req),
+	}
+	if req.GetBody != nil {
+		if r, err := req.GetBody(); err == nil {
+			body, _ := io.ReadAll(r)
+			if len(body) > 0 && json.Valid(body) {
+				event.Request = redactBody(body)
+			}
+		}
+	}
+
+	return func(resp *http.Response, err error) {
+		if err != nil {
+			event.Error = err.Error()
+		} else {
+			event.Status = resp.StatusCode
+			if resp.StatusCode >= http.StatusBadRequest {
+				event.Codes = errorCodes(peekBody(resp))
+			}
+		}
+
+		if err = c.audit.Audit(req.Context(), event); err != nil {
+			logger := c.logger
+			if logger == nil {
+				logger = slog.Default()
+			}
+			logger.ErrorContext(req.Context(), `audit CA operation`,
+				slog.String(`operation`, string(op)), slog.Any(`error`, err))
+		}
+	}
+}
+
+// callerID returns enrollment id of identity authenticating request
+func (c *httpClient) callerID(req *http.Request) string {
+	if name, _, ok := req.BasicAuth(); ok {
+		return name
+	}
+	if c.signer == nil {
+		return ``
+	}
+	block, _ := pem.Decode(c.signer.Certificate())
+	if block == nil {
+		return ``
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return ``
+	}
+	return cert.Subject.CommonName
+}
@@ -43,7 +43,7 @@ func (c *httpClient) CertificateList(ctx context.Context, opts ...CertificateLis
 
 	req = req.WithContext(ctx)
 
-	resp, err := c.client.Do(req)
+	resp, err := c.do(req, OperationCertificateList)
 	if err != nil {
 		return nil, fmt.Errorf("process request: %w", err)
 	}
@@ -10,15 +10,75 @@ import (
 	"encoding/pem"
 	"fmt"
 	"net/http"
+	"reflect"
 
 	"github.com/cloudflare/cfssl/signer"
 	"github.com/hlfans/ca-sdk/pkg/crypto"
+	csrbuilder "github.com/hlfans/ca-sdk/pkg/csr"
 	"github.com/hlfans/ca-sdk/pkg/response"
 )
 
-const enrollEndpoint = `/api/v1/enroll`
+const (
+	enrollEndpoint   = `/api/v1/enroll`
+	reenrollEndpoint = `/api/v1/reenroll`
+)
 
 func (c *httpClient) Enroll(ctx context.Context, name, secret string, req *x509.CertificateRequest, opts ...EnrollOpt) (*x509.Certificate, interface{}, error) {
+	reqBytes, options, err := c.signRequest(name, req, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, c.config.Host+enrollEndpoint, bytes.NewBuffer(reqBytes))
+	if err != nil {
+		return nil, nil, fmt.Errorf(`failed to create http request: %w`, err)
+	}
+	httpReq.SetBasicAuth(name, secret)
+
+	cert, err := c.enroll(httpReq.WithContext(ctx), OperationEnroll)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, options.PrivateKey, nil
+}
+
+func (c *httpClient) Reenroll(ctx context.Context, req *x509.CertificateRequest, opts ...EnrollOpt) (*x509.Certificate, interface{}, error) {
+	if c.signer == nil {
+		return nil, nil, fmt.Errorf(`identity is required for reenrollment`)
+	}
+
+	block, _ := pem.Decode(c.signer.Certificate())
+	if block == nil {
+		return nil, nil, fmt.Errorf(`failed to decode identity certificate`)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf(`failed to parse identity certificate: %w`, err)
+	}
+
+	reqBytes, options, err := c.signRequest(cert.Subject.CommonName, req, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, c.config.Host+reenrollEndpoint, bytes.NewBuffer(reqBytes))
+	if err != nil {
+		return nil, nil, fmt.Errorf(`failed to create http request: %w`, err)
+	}
+	if err = c.setAuthToken(httpReq, reqBytes); err != nil {
+		return nil, nil, fmt.Errorf(`failed to set auth token: %w`, err)
+	}
+
+	cert, err = c.enroll(httpReq.WithContext(ctx), OperationReenroll)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, options.PrivateKey, nil
+}
+
+// signRequest creates CSR and marshals sign request. CSR which is already signed (req.Raw is set) is sent as is,
+// no private key is generated for it. Empty req is built from csr section of config for enrollmentID
+func (c *httpClient) signRequest(enrollmentID string, req *x509.CertificateRequest, opts []EnrollOpt) ([]byte, *EnrollOpts, error) {
 	var err error
 
 	options := &EnrollOpts{}
@@ -28,24 +88,41 @@ func (c *httpClient) Enroll(ctx context.Context, name, secret string, req *x509.
 		}
 	}
 
-	if options.PrivateKey == nil {
-		if options.PrivateKey, err = crypto.NewPrivateKey(); err != nil {
-			return nil, nil, fmt.Errorf(`failed to generate private key: %w`, err)
-		}
-	}
-
 	if options.Profile == "" {
 		options.Profile = EnrollProfileDefault
 	}
 
-	// Add default signature algorithm if not defined
-	if req.SignatureAlgorithm == x509.UnknownSignatureAlgorithm {
-		req.SignatureAlgorithm = x509.ECDSAWithSHA256
+	if req == nil || reflect.ValueOf(*req).IsZero() {
+		builder, err := csrbuilder.NewBuilder(c.config.CSR)
+		if err != nil {
+			return nil, nil, fmt.Errorf(`failed to create CSR builder: %w`, err)
+		}
+		if req, err = builder.Template(enrollmentID); err != nil {
+			return nil, nil, fmt.Errorf(`failed to build CSR template: %w`, err)
+		}
+		if options.PrivateKey == nil {
+			if options.PrivateKey, err = builder.Suite().NewPrivateKey(); err != nil {
+				return nil, nil, fmt.Errorf(`failed to generate private key: %w`, err)
+			}
+		}
 	}
 
-	csr, err := x509.CreateCertificateRequest(rand.Reader, req, options.PrivateKey)
-	if err != nil {
-		return nil, nil, fmt.Errorf(`failed to create CSR: %w`, err)
+	csr := req.Raw
+	if len(csr) == 0 {
+		if options.PrivateKey == nil {
+			if options.PrivateKey, err = crypto.NewPrivateKey(); err != nil {
+				return nil, nil, fmt.Errorf(`failed to generate private key: %w`, err)
+			}
+		}
+
+		// Add default signature algorithm if not defined
+		if req.SignatureAlgorithm == x509.UnknownSignatureAlgorithm {
+			req.SignatureAlgorithm = x509.ECDSAWithSHA256
+		}
+
+		if csr, err = x509.CreateCertificateRequest(rand.Reader, req, options.PrivateKey); err != nil {
+			return nil, nil, fmt.Errorf(`failed to create CSR: %w`, err)
+		}
 	}
 
 	pemCsr := pem.EncodeToMemory(&pem.Block{Type: `CERTIFICATE REQUEST`, Bytes: csr})
@@ -54,38 +131,35 @@ func (c *httpClient) Enroll(ctx context.Context, name, secret string, req *x509.
 	if err != nil {
 		return nil, nil, fmt.Errorf(`failed to marshal request: %w`, err)
 	}
+	return reqBytes, options, nil
+}
 
-	httpReq, err := http.NewRequest(http.MethodPost, c.config.Host+enrollEndpoint, bytes.NewBuffer(reqBytes))
-	if err != nil {
-		return nil, nil, fmt.Errorf(`failed to create http request: %w`, err)
-	}
-	httpReq.SetBasicAuth(name, secret)
-
-	resp, err := c.client.Do(httpReq.WithContext(ctx))
+func (c *httpClient) enroll(httpReq *http.Request, op Operation) (*x509.Certificate, error) {
+	resp, err := c.do(httpReq, op)
 	if err != nil {
-		return nil, nil, fmt.Errorf(`http request failed: %w`, err)
+		return nil, fmt.Errorf(`http request failed: %w`, err)
 	}
 
 	var enrollResp response.Enrollment
 
 	if err = c.processResponse(resp, &enrollResp, http.StatusCreated); err != nil {
-		return nil, nil, fmt.Errorf(`process response failed: %w`, err)
+		return nil, fmt.Errorf(`process response failed: %w`, err)
 	}
 
 	certDecoded, err := base64.StdEncoding.DecodeString(enrollResp.Cert)
 	if err != nil {
-		return nil, nil, fmt.Errorf(`decode certificate failed: %w`, err)
+		return nil, fmt.Errorf(`decode certificate failed: %w`, err)
 	}
 
 	certBlock, _ := pem.Decode(certDecoded)
 	if certBlock == nil {
-		return nil, nil, fmt.Errorf(`failed to decode certificate`)
+		return nil, fmt.Errorf(`failed to decode certificate`)
 	}
 
 	cert, err := x509.ParseCertificate(certBlock.Bytes)
 	if err != nil {
-		return nil, nil, fmt.Errorf(`failed to parse certificate: %w`, err)
+		return nil, fmt.Errorf(`failed to parse certificate: %w`, err)
 	}
 
-	return cert, options.PrivateKey, nil
+	return cert, nil
 }
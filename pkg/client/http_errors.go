@@ -1,13 +1,101 @@
 package client
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
 	"strings"
 
 	"github.com/hlfans/ca-sdk/pkg/response"
 )
 
+// Fabric CA error codes, see lib/caerrors of fabric-ca
+const (
+	CodeUnknown               = 0
+	CodeMethodNotAllowed      = 1
+	CodeNoAuthHeader          = 2
+	CodeReadingRequestBody    = 3
+	CodeEmptyRequestBody      = 4
+	CodeBadRequestBody        = 5
+	CodeBadRequestToken       = 6
+	CodeCANotFound            = 7
+	CodeAuthenticationFailure = 20
+	CodeGettingUser           = 63
+	CodeAuthorizationFailure  = 71
+)
+
+// Sentinel errors are matched by errors.Is against ResponseError using CA error codes and messages
+var (
+	ErrAuthenticationFailure  = errors.New(`authentication failure`)
+	ErrAuthorizationFailure   = errors.New(`authorization failure`)
+	ErrBadRequest             = errors.New(`bad request`)
+	ErrCANotFound             = errors.New(`CA not found`)
+	ErrIdentityNotFound       = errors.New(`identity not found`)
+	ErrAlreadyRegistered      = errors.New(`identity already registered`)
+	ErrMaxEnrollmentsReached  = errors.New(`maximum enrollments reached`)
+	ErrUnauthorizedRegistrar  = errors.New(`registrar is not authorized`)
+	ErrAffiliationNotFound    = errors.New(`affiliation not found`)
+	ErrAffiliationExists      = errors.New(`affiliation already exists`)
+	ErrAffiliationHasChildren = errors.New(`affiliation has children`)
+	ErrCertificateNotFound    = errors.New(`certificate not found`)
+	ErrRevoked                = errors.New(`certificate or identity revoked`)
+)
+
+// messageRule matches CA error message containing all substrings
+type messageRule struct {
+	substrings []string
+	err        error
+}
+
+// messageRules are checked in order, the first matching rule wins. Fabric CA reuses generic codes for many failures,
+// so the message is the only reliable source of the failure reason
+var messageRules = []messageRule{
+	{[]string{`maximum enrollment`}, ErrMaxEnrollmentsReached},
+	{[]string{`already registered`}, ErrAlreadyRegistered},
+	{[]string{`child affiliation`}, ErrAffiliationHasChildren},
+	{[]string{`affiliation`, `'force'`}, ErrAffiliationHasChildren},
+	{[]string{`not a registrar`}, ErrUnauthorizedRegistrar},
+	{[]string{`not authorized to register`}, ErrUnauthorizedRegistrar},
+	{[]string{`may not register`}, ErrUnauthorizedRegistrar},
+	{[]string{`does not have authority`}, ErrUnauthorizedRegistrar},
+	{[]string{`affiliation`, `already exists`}, ErrAffiliationExists},
+	{[]string{`affiliation`, `not found`}, ErrAffiliationNotFound},
+	{[]string{`affiliation`, `does not exist`}, ErrAffiliationNotFound},
+	{[]string{`certificate not found`}, ErrCertificateNotFound},
+	{[]string{`no certificates`}, ErrCertificateNotFound},
+	{[]string{`failed to get user`}, ErrIdentityNotFound},
+	{[]string{`identity not found`}, ErrIdentityNotFound},
+	{[]string{`no rows in result set`}, ErrIdentityNotFound},
+	{[]string{`ca '`, `does not exist`}, ErrCANotFound},
+	{[]string{`revoked`}, ErrRevoked},
+	{[]string{`authentication failure`}, ErrAuthenticationFailure},
+	{[]string{`authorization failure`}, ErrAuthorizationFailure},
+}
+
+var codeErrors = map[int]error{
+	CodeNoAuthHeader:          ErrAuthenticationFailure,
+	CodeBadRequestBody:        ErrBadRequest,
+	CodeEmptyRequestBody:      ErrBadRequest,
+	CodeBadRequestToken:       ErrAuthenticationFailure,
+	CodeCANotFound:            ErrCANotFound,
+	CodeAuthenticationFailure: ErrAuthenticationFailure,
+	CodeGettingUser:           ErrIdentityNotFound,
+	CodeAuthorizationFailure:  ErrAuthorizationFailure,
+}
+
+// retryableStatuses are HTTP statuses which mean CA is temporary unable to process request
+var retryableStatuses = map[int]bool{
+	http.StatusTooManyRequests:    true,
+	http.StatusBadGateway:         true,
+	http.StatusServiceUnavailable: true,
+	http.StatusGatewayTimeout:     true,
+}
+
+// ResponseError is returned when CA responds with unsuccessful result
 type ResponseError struct {
+	Status   int
 	Errors   []response.Message
 	Messages []response.Message
 }
@@ -19,17 +107,93 @@ func (err ResponseError) Error() string {
 func (err ResponseError) joinErrors() string {
 	mes := make([]string, len(err.Errors))
 	for i, m := range err.Errors {
-		mes[i] = m.Message
+		mes[i] = fmt.Sprintf(`code %d: %s`, m.Code, m.Message)
 	}
 
 	return strings.Join(mes, `,`)
 }
 
+// Is reports whether any of CA errors matches sentinel error
+func (err ResponseError) Is(target error) bool {
+	for _, m := range err.Errors {
+		if classify(m) == target {
+			return true
+		}
+	}
+	return false
+}
+
+// HasCode reports whether CA responded with error code
+func (err ResponseError) HasCode(code int) bool {
+	for _, m := range err.Errors {
+		if m.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// classify maps CA error message to sentinel error
+func classify(m response.Message) error {
+	text := strings.ToLower(m.Message)
+	for _, rule := range messageRules {
+		if containsAll(text, rule.substrings) {
+			return rule.err
+		}
+	}
+	return codeErrors[m.Code]
+}
+
+func containsAll(s string, substrings []string) bool {
+	for _, sub := range substrings {
+		if !strings.Contains(s, sub) {
+			return false
+		}
+	}
+	return true
+}
+
+// ErrUnexpectedHTTPStatus is returned when CA responds with unexpected HTTP status and body without CA errors
 type ErrUnexpectedHTTPStatus struct {
 	Status int
 	Body   []byte
 }
 
+const maxErrorBodyLength = 256
+
 func (err ErrUnexpectedHTTPStatus) Error() string {
-	return fmt.Sprintf("unexpected HTTP status code: %d with body %s", err.Status, string(err.Body))
+	body := string(err.Body)
+	if len(body) > maxErrorBodyLength {
+		body = body[:maxErrorBodyLength] + `...`
+	}
+	return fmt.Sprintf("unexpected HTTP status code: %d with body %s", err.Status, body)
+}
+
+// IsRetryable reports whether failed request may succeed if repeated: CA or proxy is overloaded or unavailable,
+// or connection failed. Errors returned by CA for the request itself are permanent.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var respErr ResponseError
+	if errors.As(err, &respErr) {
+		return retryableStatuses[respErr.Status]
+	}
+	var statusErr ErrUnexpectedHTTPStatus
+	if errors.As(err, &statusErr) {
+		return retryableStatuses[statusErr.Status]
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr)
+}
+
+// IsPermanent reports whether failed request will fail again if repeated without changes
+func IsPermanent(err error) bool {
+	return err != nil && !IsRetryable(err)
 }
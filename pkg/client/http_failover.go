@@ -0,0 +1,282 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hlfans/ca-sdk/pkg/config"
+)
+
+const (
+	SelectionRoundRobin = `round_robin`
+	SelectionPriority   = `priority`
+
+	defaultMaxFailures         = 3
+	defaultEjectDuration       = 30 * time.Second
+	defaultHealthCheckInterval = 10 * time.Second
+)
+
+// EndpointPool routes requests between replicas of the same CA. Endpoints are ejected passively after
+// consecutive failures and actively by health checks started with Run.
+type EndpointPool struct {
+	mu        sync.Mutex
+	endpoints []*endpoint
+	next      int
+	conf      config.FailoverConfig
+	client    *http.Client
+	now       func() time.Time
+}
+
+type endpoint struct {
+	base         *url.URL
+	healthURL    string
+	priority     int
+	failures     int
+	ejectedUntil time.Time
+}
+
+// EndpointStatus is a snapshot of endpoint state
+type EndpointStatus struct {
+	Host         string
+	Healthy      bool
+	Failures     int
+	EjectedUntil time.Time
+}
+
+type stickyKey struct{}
+
+type stickySession struct {
+	mu       sync.Mutex
+	endpoint *endpoint
+}
+
+// WithStickyEndpoint returns context which routes all requests made with it to the same endpoint while it stays
+// healthy. It is useful for request sequences like Register followed by Enroll.
+func WithStickyEndpoint(ctx context.Context) context.Context {
+	return context.WithValue(ctx, stickyKey{}, &stickySession{})
+}
+
+// WithEndpointPool allows sharing pool (and its health checks) between clients
+func WithEndpointPool(pool *EndpointPool) HttpOpt {
+	return func(c *httpClient) error {
+		c.pool = pool
+		return nil
+	}
+}
+
+// NewEndpointPool creates pool from CAConfig endpoints. client is used for active health checks
+func NewEndpointPool(conf *config.CAConfig, client *http.Client) (*EndpointPool, error) {
+	if len(conf.Endpoints) == 0 {
+		return nil, fmt.Errorf(`no endpoints defined`)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	pool := &EndpointPool{conf: conf.Failover, client: client, now: time.Now}
+	switch pool.conf.Selection {
+	case ``:
+		pool.conf.Selection = SelectionRoundRobin
+	case SelectionRoundRobin, SelectionPriority:
+	default:
+		return nil, fmt.Errorf(`unknown endpoint selection: %s`, pool.conf.Selection)
+	}
+	if pool.conf.MaxFailures <= 0 {
+		pool.conf.MaxFailures = defaultMaxFailures
+	}
+	if pool.conf.EjectDuration <= 0 {
+		pool.conf.EjectDuration = defaultEjectDuration
+	}
+	if pool.conf.HealthCheckInterval <= 0 {
+		pool.conf.HealthCheckInterval = defaultHealthCheckInterval
+	}
+
+	for _, e := range conf.Endpoints {
+		base, err := url.Parse(e.Host)
+		if err != nil || base.Scheme == `` || base.Host == `` {
+			return nil, fmt.Errorf(`invalid endpoint host %q`, e.Host)
+		}
+		healthURL := e.HealthURL
+		if healthURL == `` {
+			healthURL = strings.TrimSuffix(e.Host, `/`) + `/api/v1/cainfo`
+		}
+		pool.endpoints = append(pool.endpoints, &endpoint{base: base, healthURL: healthURL, priority: e.Priority})
+	}
+
+	// stable sort keeps configuration order inside the same priority
+	sort.SliceStable(pool.endpoints, func(i, j int) bool { return pool.endpoints[i].priority < pool.endpoints[j].priority })
+	return pool, nil
+}
+
+// Run performs active health checks until context is done
+func (p *EndpointPool) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.conf.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		p.CheckHealth(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckHealth checks every endpoint once. Healthy endpoints are restored, unhealthy ones are ejected
+func (p *EndpointPool) CheckHealth(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, e := range p.endpoints {
+		wg.Add(1)
+		go func(e *endpoint) {
+			defer wg.Done()
+			healthy := p.probe(ctx, e.healthURL)
+
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			if healthy {
+				e.failures, e.ejectedUntil = 0, time.Time{}
+			} else {
+				e.failures = max(e.failures, p.conf.MaxFailures)
+				e.ejectedUntil = p.now().Add(p.conf.EjectDuration)
+			}
+		}(e)
+	}
+	wg.Wait()
+}
+
+func (p *EndpointPool) probe(ctx context.Context, healthURL string) bool {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, healthURL, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return false
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+// Status returns snapshot of all endpoints
+func (p *EndpointPool) Status() []EndpointStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	statuses := make([]EndpointStatus, len(p.endpoints))
+	for i, e := range p.endpoints {
+		statuses[i] = EndpointStatus{
+			Host:         e.base.String(),
+			Healthy:      e.available(now),
+			Failures:     e.failures,
+			EjectedUntil: e.ejectedUntil,
+		}
+	}
+	return statuses
+}
+
+func (e *endpoint) available(now time.Time) bool {
+	return !now.Before(e.ejectedUntil)
+}
+
+// pick selects endpoint for the next request
+func (p *EndpointPool) pick(ctx context.Context) *endpoint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+
+	session, _ := ctx.Value(stickyKey{}).(*stickySession)
+	if session != nil {
+		session.mu.Lock()
+		defer session.mu.Unlock()
+		if session.endpoint != nil && session.endpoint.available(now) {
+			return session.endpoint
+		}
+	}
+
+	var candidates []*endpoint
+	for _, e := range p.endpoints {
+		if !e.available(now) {
+			continue
+		}
+		if p.conf.Selection == SelectionPriority && len(candidates) > 0 && e.priority > candidates[0].priority {
+			break
+		}
+		candidates = append(candidates, e)
+	}
+
+	var picked *endpoint
+	if len(candidates) == 0 {
+		// all endpoints are ejected, the one which recovers first is the best guess
+		picked = p.endpoints[0]
+		for _, e := range p.endpoints[1:] {
+			if e.ejectedUntil.Before(picked.ejectedUntil) {
+				picked = e
+			}
+		}
+	} else {
+		picked = candidates[p.next%len(candidates)]
+		p.next++
+	}
+
+	if session != nil {
+		session.endpoint = picked
+	}
+	return picked
+}
+
+// report updates endpoint state by request outcome. Only transport errors and gateway statuses are failures,
+// Fabric CA responds to invalid requests with 500 as well
+func (p *EndpointPool) report(e *endpoint, resp *http.Response, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err == nil && !endpointFailureStatus(resp.StatusCode) {
+		e.failures = 0
+		return
+	}
+	if e.failures++; e.failures >= p.conf.MaxFailures {
+		e.ejectedUntil = p.now().Add(p.conf.EjectDuration)
+	}
+}
+
+func endpointFailureStatus(status int) bool {
+	switch status {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// route rewrites request URL to endpoint selected by pool, if any, and returns function reporting request outcome
+func (c *httpClient) route(req *http.Request) func(*http.Response, error) {
+	if c.pool == nil {
+		return func(*http.Response, error) {}
+	}
+
+	e := c.pool.pick(req.Context())
+	req.URL.Scheme, req.URL.Host = e.base.Scheme, e.base.Host
+	// base path of endpoint, like ingress prefix, precedes API path
+	if prefix := strings.TrimSuffix(e.base.Path, `/`); prefix != `` {
+		req.URL.Path = prefix + req.URL.Path
+		if req.URL.RawPath != `` {
+			req.URL.RawPath = strings.TrimSuffix(e.base.EscapedPath(), `/`) + req.URL.RawPath
+		}
+	}
+	req.Host = ``
+
+	return func(resp *http.Response, err error) {
+		if req.Context().Err() == nil {
+			c.pool.report(e, resp, err)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/hlfans/ca-sdk/pkg/entity"
+	"github.com/hlfans/ca-sdk/pkg/response"
+)
+
+const (
+	endpointIdentityList = "%s/api/v1/identities"
+	endpointIdentityGet  = "%s/api/v1/identities/%s"
+)
+
+func (c *httpClient) IdentityList(ctx context.Context) ([]entity.Identity, error) {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf(endpointIdentityList, c.config.Host), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if err = c.setAuthToken(req, nil); err != nil {
+		return nil, fmt.Errorf("failed to set auth token: %w", err)
+	}
+
+	resp, err := c.do(req.WithContext(ctx), OperationIdentityList)
+	if err != nil {
+		return nil, fmt.Errorf("failed to do request: %w", err)
+	}
+
+	var identityListResponse response.IdentityList
+
+	if err = c.processResponse(resp, &identityListResponse, http.StatusOK); err != nil {
+		return nil, err
+	}
+
+	return identityListResponse.Identities, nil
+}
+
+func (c *httpClient) IdentityGet(ctx context.Context, enrollId string) (*entity.Identity, error) {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf(endpointIdentityGet, c.config.Host, url.PathEscape(enrollId)), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if err = c.setAuthToken(req, nil); err != nil {
+		return nil, fmt.Errorf("failed to set auth token: %w", err)
+	}
+
+	resp, err := c.do(req.WithContext(ctx), OperationIdentityGet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to do request: %w", err)
+	}
+
+	var identity entity.Identity
+
+	if err = c.processResponse(resp, &identity, http.StatusOK); err != nil {
+		return nil, err
+	}
+
+	return &identity, nil
+}
@@ -14,7 +14,7 @@ func (c *httpClient) CAInfo(ctx context.Context) (*response.CAInfo, error) {
 		return nil, fmt.Errorf("create http request: %w", err)
 	}
 
-	resp, err := c.client.Do(req.WithContext(ctx))
+	resp, err := c.do(req.WithContext(ctx), OperationCAInfo)
 	if err != nil {
 		return nil, fmt.Errorf("process http request: %w", err)
 	}
@@ -0,0 +1,151 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hlfans/ca-sdk/pkg/response"
+)
+
+const redacted = `<redacted>`
+
+var (
+	redactSecretRe     = regexp.MustCompile(`("secret"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+	redactPrivateKeyRe = regexp.MustCompile(`-----BEGIN ([A-Z ]*)PRIVATE KEY-----[\s\S]*?-----END ([A-Z ]*)PRIVATE KEY-----`)
+)
+
+// WithLogger enables logging of every CA request: operation, method, endpoint, status, latency and CA error codes
+func WithLogger(logger *slog.Logger) HttpOpt {
+	return func(c *httpClient) error {
+		c.logger = logger
+		return nil
+	}
+}
+
+// WithWireDump enables debug logging of requests and responses. Credentials, authorization tokens,
+// registration secrets and private keys are redacted
+func WithWireDump() HttpOpt {
+	return func(c *httpClient) error {
+		c.wireDump = true
+		return nil
+	}
+}
+
+// redactBody removes registration secrets and PEM encoded private keys
+func redactBody(body []byte) []byte {
+	body = redactSecretRe.ReplaceAll(body, []byte(`$1"`+redacted+`"`))
+	return redactPrivateKeyRe.ReplaceAll(body, []byte(`-----BEGIN ${1}PRIVATE KEY-----`+redacted+`-----END ${2}PRIVATE KEY-----`))
+}
+
+// redactHeader returns copy of header without credentials
+func redactHeader(header http.Header) http.Header {
+	out := header.Clone()
+	if v := out.Get(`Authorization`); v != `` {
+		if scheme, _, ok := strings.Cut(v, ` `); ok {
+			out.Set(`Authorization`, scheme+` `+redacted)
+		} else {
+			out.Set(`Authorization`, redacted)
+		}
+	}
+	return out
+}
+
+func (c *httpClient) dumpRequest(req *http.Request, op Operation) {
+	if c.logger == nil || !c.wireDump || !c.logger.Enabled(req.Context(), slog.LevelDebug) {
+		return
+	}
+
+	var body []byte
+	if req.GetBody != nil {
+		if r, err := req.GetBody(); err == nil {
+			body, _ = io.ReadAll(r)
+		}
+	}
+
+	c.logger.LogAttrs(req.Context(), slog.LevelDebug, `CA request dump`,
+		slog.String(`operation`, string(op)),
+		slog.String(`method`, req.Method),
+		slog.String(`url`, req.URL.String()),
+		slog.Any(`header`, redactHeader(req.Header)),
+		slog.String(`body`, string(redactBody(body))),
+	)
+}
+
+// logResponse logs request outcome. Response body is read and replaced so it can be inspected for CA error codes
+func (c *httpClient) logResponse(req *http.Request, op Operation, resp *http.Response, err error, latency time.Duration) {
+	if c.logger == nil {
+		return
+	}
+	ctx := req.Context()
+
+	attrs := []slog.Attr{
+		slog.String(`operation`, string(op)),
+		slog.String(`method`, req.Method),
+		slog.String(`endpoint`, req.URL.Scheme+`://`+req.URL.Host+req.URL.Path),
+		slog.Duration(`latency`, latency),
+	}
+
+	if err != nil {
+		c.logger.LogAttrs(ctx, slog.LevelError, `CA request failed`, append(attrs, slog.String(`error`, err.Error()))...)
+		return
+	}
+
+	attrs = append(attrs, slog.Int(`status`, resp.StatusCode))
+
+	var body []byte
+	if resp.StatusCode >= http.StatusBadRequest || (c.wireDump && c.logger.Enabled(ctx, slog.LevelDebug)) {
+		body = peekBody(resp)
+	}
+
+	level, msg := slog.LevelInfo, `CA request completed`
+	if resp.StatusCode >= http.StatusBadRequest {
+		level, msg = slog.LevelWarn, `CA request rejected`
+		if codes := errorCodes(body); len(codes) > 0 {
+			attrs = append(attrs, slog.Any(`ca_codes`, codes))
+		}
+	}
+	c.logger.LogAttrs(ctx, level, msg, attrs...)
+
+	if c.wireDump {
+		c.dumpResponse(ctx, op, resp, body)
+	}
+}
+
+func (c *httpClient) dumpResponse(ctx context.Context, op Operation, resp *http.Response, body []byte) {
+	if !c.logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	c.logger.LogAttrs(ctx, slog.LevelDebug, `CA response dump`,
+		slog.String(`operation`, string(op)),
+		slog.Int(`status`, resp.StatusCode),
+		slog.Any(`header`, redactHeader(resp.Header)),
+		slog.String(`body`, string(redactBody(body))),
+	)
+}
+
+// peekBody reads response body and replaces it, so it can be read again
+func peekBody(resp *http.Response) []byte {
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return body
+}
+
+func errorCodes(body []byte) []int {
+	var caResp response.Response
+	if json.Unmarshal(body, &caResp) != nil {
+		return nil
+	}
+	codes := make([]int, len(caResp.Errors))
+	for i, m := range caResp.Errors {
+		codes[i] = m.Code
+	}
+	return codes
+}
@@ -0,0 +1,47 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/hlfans/ca-sdk/pkg/request"
+	"github.com/hlfans/ca-sdk/pkg/response"
+)
+
+const endpointRegister = "%s/api/v1/register"
+
+func (c *httpClient) Register(ctx context.Context, req request.Registration) (string, error) {
+	if err := req.Validate(); err != nil {
+		return ``, err
+	}
+
+	reqBytes, err := json.Marshal(req)
+	if err != nil {
+		return ``, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, fmt.Sprintf(endpointRegister, c.config.Host), bytes.NewBuffer(reqBytes))
+	if err != nil {
+		return ``, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if err = c.setAuthToken(httpReq, reqBytes); err != nil {
+		return ``, fmt.Errorf("failed to set auth token: %w", err)
+	}
+
+	resp, err := c.do(httpReq.WithContext(ctx), OperationRegister)
+	if err != nil {
+		return ``, fmt.Errorf("failed to do request: %w", err)
+	}
+
+	var registrationResponse response.Registration
+
+	if err = c.processResponse(resp, &registrationResponse, http.StatusOK, http.StatusCreated); err != nil {
+		return ``, err
+	}
+
+	return registrationResponse.Secret, nil
+}
@@ -0,0 +1,196 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// RetryPolicy describes how failed CA requests are repeated.
+//
+// Idempotent operations (all read-only ones by default) are retried on any transport error and on RetryableStatuses.
+// Other operations (Register, Enroll, Revoke, affiliation changes) are retried only if connection failed before
+// request was written, so CA never processes them twice.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts including the first one. Values below 2 disable retries
+	MaxAttempts int
+	// InitialBackoff is the delay before the second attempt
+	InitialBackoff time.Duration
+	// MaxBackoff limits delay between attempts, including delay requested by Retry-After header
+	MaxBackoff time.Duration
+	// Multiplier is applied to backoff after every attempt
+	Multiplier float64
+	// Jitter is the fraction of backoff (0..1) which is randomly subtracted to spread retries of many clients
+	Jitter float64
+	// RetryableStatuses are HTTP statuses that make idempotent operations to be retried
+	RetryableStatuses []int
+	// Idempotent overrides default safety of operations
+	Idempotent map[Operation]bool
+}
+
+var (
+	// DefaultRetryPolicy retries idempotent requests up to 4 times within about 3 seconds
+	DefaultRetryPolicy = RetryPolicy{
+		MaxAttempts:       4,
+		InitialBackoff:    200 * time.Millisecond,
+		MaxBackoff:        2 * time.Second,
+		Multiplier:        2,
+		Jitter:            0.2,
+		RetryableStatuses: []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	}
+
+	idempotentOperations = map[Operation]bool{
+		OperationCAInfo:          true,
+		OperationIdentityList:    true,
+		OperationIdentityGet:     true,
+		OperationCertificateList: true,
+		OperationAffiliationList: true,
+		OperationGenCRL:          true,
+	}
+)
+
+// WithRetry enables retries of failed requests
+func WithRetry(policy RetryPolicy) HttpOpt {
+	return func(c *httpClient) error {
+		if policy.Jitter < 0 || policy.Jitter > 1 {
+			return fmt.Errorf(`retry jitter must be in range [0, 1]`)
+		}
+		if policy.Multiplier < 1 {
+			policy.Multiplier = 1
+		}
+		c.retry = &policy
+		return nil
+	}
+}
+
+func (p *RetryPolicy) idempotent(op Operation) bool {
+	if v, ok := p.Idempotent[op]; ok {
+		return v
+	}
+	return idempotentOperations[op]
+}
+
+func (p *RetryPolicy) retryableStatus(status int) bool {
+	for _, s := range p.RetryableStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns delay before attempt following attempt number n (starting from 1)
+func (p *RetryPolicy) backoff(n int) time.Duration {
+	d := float64(p.InitialBackoff)
+	for i := 1; i < n; i++ {
+		d *= p.Multiplier
+	}
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	return time.Duration(d - d*p.Jitter*rand.Float64())
+}
+
+// retryAfter parses Retry-After header, which is either delay in seconds or HTTP date
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	v := resp.Header.Get(`Retry-After`)
+	if v == `` {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+// doWithRetry sends request to CA applying retry policy of client
+func (c *httpClient) doWithRetry(req *http.Request, op Operation) (*http.Response, error) {
+	if c.retry == nil || c.retry.MaxAttempts < 2 {
+		return c.send(req, op)
+	}
+
+	ctx := req.Context()
+	idempotent := c.retry.idempotent(op)
+
+	for attempt := 1; ; attempt++ {
+		var written atomic.Bool
+		attemptReq, err := rewind(httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+			WroteHeaders: func() { written.Store(true) },
+		}), req)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := c.send(attemptReq, op)
+
+		var (
+			retry bool
+			wait  = c.retry.backoff(attempt)
+		)
+		switch {
+		case err != nil:
+			retry = ctx.Err() == nil && (idempotent || !written.Load())
+		case idempotent && c.retry.retryableStatus(resp.StatusCode):
+			retry = true
+			if d, ok := retryAfter(resp); ok {
+				wait = d
+				if c.retry.MaxBackoff > 0 && wait > c.retry.MaxBackoff {
+					wait = c.retry.MaxBackoff
+				}
+			}
+		}
+
+		if !retry || attempt >= c.retry.MaxAttempts || !fitsDeadline(ctx, wait) {
+			return resp, err
+		}
+
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			if err == nil {
+				err = fmt.Errorf(`status %d`, resp.StatusCode)
+			}
+			return nil, errors.Join(ctx.Err(), err)
+		case <-timer.C:
+		}
+	}
+}
+
+// fitsDeadline reports whether context will still be alive after waiting d
+func fitsDeadline(ctx context.Context, d time.Duration) bool {
+	deadline, ok := ctx.Deadline()
+	return !ok || time.Until(deadline) > d
+}
+
+// rewind returns copy of request with fresh body, so request can be sent again
+func rewind(ctx context.Context, req *http.Request) (*http.Request, error) {
+	clone := req.Clone(ctx)
+	if req.Body == nil || req.Body == http.NoBody {
+		return clone, nil
+	}
+	if req.GetBody == nil {
+		return nil, fmt.Errorf(`request body can't be rewound for retry`)
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, fmt.Errorf(`rewind request body: %w`, err)
+	}
+	clone.Body = body
+	return clone, nil
+}
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+
+	"github.com/hlfans/ca-sdk/pkg/request"
+	"github.com/hlfans/ca-sdk/pkg/response"
+)
+
+const (
+	endpointRevoke = "%s/api/v1/revoke"
+	endpointGenCRL = "%s/api/v1/gencrl"
+)
+
+func (c *httpClient) Revoke(ctx context.Context, req request.RevocationRequest) (*pkix.CertificateList, error) {
+	if req.Name == `` && (req.Serial == `` || req.AKI == ``) {
+		return nil, fmt.Errorf(`either name or serial and aki must be specified`)
+	}
+
+	var revokeResponse response.Revoke
+	if err := c.post(ctx, endpointRevoke, OperationRevoke, req, &revokeResponse); err != nil {
+		return nil, err
+	}
+
+	if len(revokeResponse.CRL) == 0 {
+		return nil, nil
+	}
+	der, err := crlDER(revokeResponse.CRL)
+	if err != nil {
+		return nil, err
+	}
+
+	crl := new(pkix.CertificateList)
+	if rest, err := asn1.Unmarshal(der, crl); err != nil {
+		return nil, fmt.Errorf(`parse CRL: %w`, err)
+	} else if len(rest) > 0 {
+		return nil, fmt.Errorf(`parse CRL: trailing data`)
+	}
+	return crl, nil
+}
+
+func (c *httpClient) GenCRL(ctx context.Context, req request.GenCRLRequest) (*x509.RevocationList, error) {
+	var genCRLResponse response.GenCRL
+	if err := c.post(ctx, endpointGenCRL, OperationGenCRL, req, &genCRLResponse); err != nil {
+		return nil, err
+	}
+
+	der, err := crlDER(genCRLResponse.CRL)
+	if err != nil {
+		return nil, err
+	}
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		return nil, fmt.Errorf(`parse CRL: %w`, err)
+	}
+	return crl, nil
+}
+
+// post sends authenticated JSON request and processes response
+func (c *httpClient) post(ctx context.Context, endpoint string, op Operation, req, out interface{}) error {
+	reqBytes, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, fmt.Sprintf(endpoint, c.config.Host), bytes.NewBuffer(reqBytes))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if err = c.setAuthToken(httpReq, reqBytes); err != nil {
+		return fmt.Errorf("failed to set auth token: %w", err)
+	}
+
+	resp, err := c.do(httpReq.WithContext(ctx), op)
+	if err != nil {
+		return fmt.Errorf("failed to do request: %w", err)
+	}
+
+	return c.processResponse(resp, out, http.StatusOK)
+}
+
+// crlDER returns DER of CRL, Fabric CA returns PEM encoded CRL
+func crlDER(crl []byte) ([]byte, error) {
+	if block, _ := pem.Decode(crl); block != nil {
+		return block.Bytes, nil
+	} else if len(crl) == 0 {
+		return nil, fmt.Errorf(`CA returned empty CRL`)
+	}
+	return crl, nil
+}
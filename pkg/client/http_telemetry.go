@@ -0,0 +1,208 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = `github.com/hlfans/ca-sdk/pkg/client`
+
+const (
+	attrOperation    = attribute.Key(`fabric_ca.operation`)
+	attrEndpoint     = attribute.Key(`fabric_ca.endpoint`)
+	attrCAName       = attribute.Key(`fabric_ca.caname`)
+	attrEnrollIdHash = attribute.Key(`fabric_ca.enrollment_id.hash`)
+	attrErrorCode    = attribute.Key(`fabric_ca.error.code`)
+	attrErrorCodes   = attribute.Key(`fabric_ca.error.codes`)
+	attrErrorType    = attribute.Key(`error.type`)
+	attrStatusCode   = attribute.Key(`http.response.status_code`)
+	attrMethod       = attribute.Key(`http.request.method`)
+
+	errorTypeTransport = `transport`
+)
+
+// telemetry holds OpenTelemetry instruments of client. Nil telemetry is valid and does nothing
+type telemetry struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+
+	requests metric.Int64Counter
+	errors   metric.Int64Counter
+	duration metric.Float64Histogram
+}
+
+// WithTracerProvider enables span per Client call and W3C trace context propagation to CA
+func WithTracerProvider(provider trace.TracerProvider) HttpOpt {
+	return func(c *httpClient) error {
+		c.ensureTelemetry().tracer = provider.Tracer(instrumentationName)
+		return nil
+	}
+}
+
+// WithMeterProvider enables request, error and latency metrics of Client calls
+func WithMeterProvider(provider metric.MeterProvider) HttpOpt {
+	return func(c *httpClient) error {
+		t := c.ensureTelemetry()
+		meter := provider.Meter(instrumentationName)
+
+		var err error
+		if t.requests, err = meter.Int64Counter(`fabric_ca.client.requests`,
+			metric.WithDescription(`Number of CA requests`)); err != nil {
+			return fmt.Errorf(`create requests counter: %w`, err)
+		}
+		if t.errors, err = meter.Int64Counter(`fabric_ca.client.errors`,
+			metric.WithDescription(`Number of failed CA requests by CA error code`)); err != nil {
+			return fmt.Errorf(`create errors counter: %w`, err)
+		}
+		if t.duration, err = meter.Float64Histogram(`fabric_ca.client.duration`,
+			metric.WithDescription(`Duration of CA requests including retries`), metric.WithUnit(`s`)); err != nil {
+			return fmt.Errorf(`create duration histogram: %w`, err)
+		}
+		return nil
+	}
+}
+
+// WithPropagator overrides W3C trace context propagator
+func WithPropagator(propagator propagation.TextMapPropagator) HttpOpt {
+	return func(c *httpClient) error {
+		c.ensureTelemetry().propagator = propagator
+		return nil
+	}
+}
+
+func (c *httpClient) ensureTelemetry() *telemetry {
+	if c.telemetry == nil {
+		c.telemetry = &telemetry{propagator: propagation.TraceContext{}}
+	}
+	return c.telemetry
+}
+
+// start starts span of operation and returns request carrying span context
+// with function which must be called with operation outcome
+func (t *telemetry) start(req *http.Request, op Operation) (*http.Request, func(*http.Response, error)) {
+	if t == nil {
+		return req, func(*http.Response, error) {}
+	}
+
+	started := time.Now()
+	attrs := []attribute.KeyValue{attrOperation.String(string(op))}
+	endpoint := req.URL.Path
+
+	if t.tracer == nil {
+		return req, func(resp *http.Response, err error) {
+			t.record(req, attrs, resp, err, time.Since(started))
+		}
+	}
+
+	enrollId, caName := describeRequest(req)
+	spanAttrs := append(attrs, attrMethod.String(req.Method), attrEndpoint.String(endpoint))
+	if enrollId != `` {
+		spanAttrs = append(spanAttrs, attrEnrollIdHash.String(hashEnrollId(enrollId)))
+	}
+	if caName != `` {
+		spanAttrs = append(spanAttrs, attrCAName.String(caName))
+	}
+
+	ctx, span := t.tracer.Start(req.Context(), `fabric-ca `+string(op),
+		trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(spanAttrs...))
+	req = req.WithContext(ctx)
+	t.propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	return req, func(resp *http.Response, err error) {
+		defer span.End()
+		codes := t.record(req, attrs, resp, err, time.Since(started))
+
+		switch {
+		case err != nil:
+			span.RecordError(err)
+			span.SetStatus(otelcodes.Error, err.Error())
+		case resp.StatusCode >= http.StatusBadRequest:
+			span.SetAttributes(attrStatusCode.Int(resp.StatusCode), attrErrorCodes.IntSlice(codes))
+			span.SetStatus(otelcodes.Error, http.StatusText(resp.StatusCode))
+		default:
+			span.SetAttributes(attrStatusCode.Int(resp.StatusCode))
+		}
+	}
+}
+
+// record updates metrics and returns CA error codes of failed response
+func (t *telemetry) record(req *http.Request, attrs []attribute.KeyValue, resp *http.Response, err error, d time.Duration) []int {
+	var codes []int
+	if err == nil && resp.StatusCode >= http.StatusBadRequest {
+		codes = errorCodes(peekBody(resp))
+	}
+	if t.requests == nil {
+		return codes
+	}
+
+	ctx := req.Context()
+	set := metric.WithAttributeSet(attribute.NewSet(attrs...))
+	t.duration.Record(ctx, d.Seconds(), set)
+
+	switch {
+	case err != nil:
+		t.requests.Add(ctx, 1, metric.WithAttributes(append(attrs, attrStatusCode.Int(0))...))
+		t.errors.Add(ctx, 1, metric.WithAttributes(append(attrs, attrErrorType.String(errorTypeTransport))...))
+	default:
+		t.requests.Add(ctx, 1, metric.WithAttributes(append(attrs, attrStatusCode.Int(resp.StatusCode))...))
+		if resp.StatusCode < http.StatusBadRequest {
+			break
+		}
+		if len(codes) == 0 {
+			t.errors.Add(ctx, 1, metric.WithAttributes(append(attrs, attrErrorType.String(strconv.Itoa(resp.StatusCode)))...))
+		}
+		for _, code := range codes {
+			t.errors.Add(ctx, 1, metric.WithAttributes(append(attrs, attrErrorCode.Int(code))...))
+		}
+	}
+	return codes
+}
+
+// describeRequest extracts enrollment id and CA name from request without consuming it
+func describeRequest(req *http.Request) (enrollId, caName string) {
+	if user, _, ok := req.BasicAuth(); ok {
+		enrollId = user
+	}
+	caName = req.URL.Query().Get(`ca`)
+
+	if req.GetBody != nil {
+		if r, err := req.GetBody(); err == nil {
+			var body struct {
+				Id     string `json:"id"`
+				CAName string `json:"caname"`
+			}
+			if raw, err := io.ReadAll(r); err == nil && json.Unmarshal(raw, &body) == nil {
+				if body.Id != `` {
+					enrollId = body.Id
+				}
+				if body.CAName != `` {
+					caName = body.CAName
+				}
+			}
+		}
+	}
+
+	if enrollId == `` && path.Dir(req.URL.Path) == `/api/v1/identities` {
+		enrollId = path.Base(req.URL.Path)
+	}
+	return enrollId, caName
+}
+
+// hashEnrollId hides enrollment id, which may contain personal data, while keeping it correlatable
+func hashEnrollId(enrollId string) string {
+	sum := sha256.Sum256([]byte(enrollId))
+	return hex.EncodeToString(sum[:8])
+}
@@ -1,6 +1,39 @@
 package config
 
+import "time"
+
 type CAConfig struct {
 	Host string    `yaml:"host"`
 	Tls  TlsConfig `yaml:"tls"`
+
+	// Endpoints are replicas of the same CA. If defined, they take precedence over Host
+	Endpoints []EndpointConfig `yaml:"endpoints"`
+	Failover  FailoverConfig   `yaml:"failover"`
+
+	// Operations is the operations service of CA, which is served separately from REST API
+	Operations OperationsConfig `yaml:"operations"`
+
+	// CSR describes certificate requests of enrolled identities, like csr section of fabric-ca-client config
+	CSR CSRConfig `yaml:"csr"`
+}
+
+type EndpointConfig struct {
+	// Host is the base URL of replica, for example https://ca1.org1.example.com:7054
+	Host string `yaml:"host"`
+	// Priority is used by `priority` selection, endpoints with lower value are preferred
+	Priority int `yaml:"priority"`
+	// HealthURL is checked by active health checks, for example operations service /healthz.
+	// If empty /api/v1/cainfo of Host is used
+	HealthURL string `yaml:"health_url"`
+}
+
+type FailoverConfig struct {
+	// Selection is either `round_robin` (default) or `priority`
+	Selection string `yaml:"selection"`
+	// MaxFailures is the number of consecutive failures after which endpoint is ejected. Default is 3
+	MaxFailures int `yaml:"max_failures"`
+	// EjectDuration is the time during which ejected endpoint is not used. Default is 30s
+	EjectDuration time.Duration `yaml:"eject_duration"`
+	// HealthCheckInterval is the period of active health checks. Default is 10s
+	HealthCheckInterval time.Duration `yaml:"health_check_interval"`
 }
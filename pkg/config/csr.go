@@ -0,0 +1,33 @@
+package config
+
+// CSRConfig is the csr section of fabric-ca-client config
+type CSRConfig struct {
+	// CN is the subject common name. If empty enrollment id is used
+	CN    string    `yaml:"cn"`
+	Names []CSRName `yaml:"names"`
+	// Hosts are subject alternative names: IP addresses, URIs, email addresses and DNS names
+	Hosts      []string     `yaml:"hosts"`
+	KeyRequest KeyRequest   `yaml:"keyrequest"`
+	CA         *CSRCAConfig `yaml:"ca"`
+}
+
+type CSRName struct {
+	C  string `yaml:"C"`
+	ST string `yaml:"ST"`
+	L  string `yaml:"L"`
+	O  string `yaml:"O"`
+	OU string `yaml:"OU"`
+}
+
+type KeyRequest struct {
+	// Algo is the key algorithm, only `ecdsa` is supported. Default is ecdsa
+	Algo string `yaml:"algo"`
+	// Size is the key size in bits: 256, 384 or 521. Default is 256
+	Size int `yaml:"size"`
+}
+
+// CSRCAConfig requests CA certificate, it is used on intermediate CA enrollment
+type CSRCAConfig struct {
+	PathLength  int  `yaml:"pathlength"`
+	PathLenZero bool `yaml:"pathlenzero"`
+}
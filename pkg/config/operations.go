@@ -0,0 +1,7 @@
+package config
+
+type OperationsConfig struct {
+	// Host is the base URL of operations service, for example https://ca.org1.example.com:9443
+	Host string    `yaml:"host"`
+	Tls  TlsConfig `yaml:"tls"`
+}
@@ -1,5 +1,12 @@
 package config
 
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
 type TlsConfig struct {
 	Enabled    bool `yaml:"enabled"`
 	SkipVerify bool `yaml:"skip_verify"`
@@ -16,3 +23,43 @@ type TlsConfig struct {
 	CACert     []byte `yaml:"ca_cert"`
 	CACertPath string `yaml:"ca_cert_path"`
 }
+
+// ClientConfig builds TLS configuration for connecting to CA or operations service
+func (c TlsConfig) ClientConfig() (*tls.Config, error) {
+	conf := &tls.Config{InsecureSkipVerify: c.SkipVerify, MinVersion: tls.VersionTLS12}
+
+	caCert, err := readPEM(c.CACert, c.CACertPath)
+	if err != nil {
+		return nil, fmt.Errorf(`read CA certificate: %w`, err)
+	}
+	if caCert != nil {
+		conf.RootCAs = x509.NewCertPool()
+		if !conf.RootCAs.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf(`no CA certificates found`)
+		}
+	}
+
+	cert, err := readPEM(c.Cert, c.CertPath)
+	if err != nil {
+		return nil, fmt.Errorf(`read client certificate: %w`, err)
+	}
+	key, err := readPEM(c.Key, c.KeyPath)
+	if err != nil {
+		return nil, fmt.Errorf(`read client key: %w`, err)
+	}
+	if cert != nil || key != nil {
+		pair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf(`load client key pair: %w`, err)
+		}
+		conf.Certificates = []tls.Certificate{pair}
+	}
+	return conf, nil
+}
+
+func readPEM(content []byte, path string) ([]byte, error) {
+	if len(content) > 0 || path == `` {
+		return content, nil
+	}
+	return os.ReadFile(path)
+}
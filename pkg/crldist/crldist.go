@@ -0,0 +1,292 @@
+// Package crldist periodically generates CRLs of Fabric CA instances and serves them over HTTP.
+// Every generation is kept in history with the delta to the previous one, changes are pushed to subscribers
+package crldist
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hlfans/ca-sdk/pkg/client"
+	"github.com/hlfans/ca-sdk/pkg/request"
+)
+
+const (
+	defaultInterval = 10 * time.Minute
+	defaultHistory  = 16
+)
+
+type Opt func(s *Server) error
+
+// WithInterval sets how often CRLs are generated by Run. Default is 10m
+func WithInterval(interval time.Duration) Opt {
+	return func(s *Server) error {
+		if interval <= 0 {
+			return fmt.Errorf(`interval must be positive`)
+		}
+		s.interval = interval
+		return nil
+	}
+}
+
+// WithHistory sets number of generations kept per CA. Default is 16
+func WithHistory(size int) Opt {
+	return func(s *Server) error {
+		if size < 1 {
+			return fmt.Errorf(`history size must be positive`)
+		}
+		s.historySize = size
+		return nil
+	}
+}
+
+func WithLogger(logger *slog.Logger) Opt {
+	return func(s *Server) error {
+		s.logger = logger
+		return nil
+	}
+}
+
+// WithClock overrides current time
+func WithClock(now func() time.Time) Opt {
+	return func(s *Server) error {
+		s.now = now
+		return nil
+	}
+}
+
+// Delta is the difference between consecutive generations
+type Delta struct {
+	// Added are entries of newly revoked certificates
+	Added []x509.RevocationListEntry
+	// Removed are serials which left CRL, usually because certificates expired
+	Removed []*big.Int
+}
+
+func (d Delta) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0
+}
+
+// Generation is CRL generated by single GenCRL call
+type Generation struct {
+	// Seq is the sequence number of generation for CA, starting from 1
+	Seq       uint64
+	CRL       *x509.RevocationList
+	ETag      string
+	FetchedAt time.Time
+	// Delta is the difference to previous generation, for the first one all entries are added
+	Delta Delta
+
+	serials map[string]x509.RevocationListEntry
+}
+
+// Event notifies subscribers about changed CRL
+type Event struct {
+	CAName     string
+	Generation *Generation
+}
+
+// Server keeps CRL history of CA instances
+type Server struct {
+	cli         client.Client
+	caNames     []string
+	interval    time.Duration
+	historySize int
+	logger      *slog.Logger
+	now         func() time.Time
+
+	mu          sync.RWMutex
+	history     map[string][]*Generation
+	subscribers map[chan Event]struct{}
+}
+
+// New creates server for CA instances with caNames. If caNames are empty, name from CAInfo is used.
+// Client identity must have hf.GenCRL attribute
+func New(ctx context.Context, cli client.Client, caNames []string, opts ...Opt) (*Server, error) {
+	s := &Server{
+		cli:         cli,
+		caNames:     caNames,
+		interval:    defaultInterval,
+		historySize: defaultHistory,
+		logger:      slog.Default(),
+		now:         time.Now,
+		history:     map[string][]*Generation{},
+		subscribers: map[chan Event]struct{}{},
+	}
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, fmt.Errorf(`apply crl server option: %w`, err)
+		}
+	}
+
+	if len(s.caNames) == 0 {
+		info, err := cli.CAInfo(ctx)
+		if err != nil {
+			return nil, fmt.Errorf(`get CA info: %w`, err)
+		}
+		s.caNames = []string{info.CAName}
+	}
+	return s, nil
+}
+
+// Run generates CRLs until ctx is done
+func (s *Server) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Refresh(ctx); err != nil {
+			s.logger.ErrorContext(ctx, `refresh CRLs`, slog.Any(`error`, err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh generates CRL of every CA once. Subscribers are notified about generations with non-empty delta
+func (s *Server) Refresh(ctx context.Context) error {
+	var errs []error
+	for _, caName := range s.caNames {
+		crl, err := s.cli.GenCRL(ctx, request.GenCRLRequest{CAName: caName})
+		if err != nil {
+			errs = append(errs, fmt.Errorf(`generate CRL of %q: %w`, caName, err))
+			continue
+		}
+		if gen, changed := s.add(caName, crl); changed && !gen.Delta.Empty() {
+			s.publish(Event{CAName: caName, Generation: gen})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Latest returns the last generation of CA
+func (s *Server) Latest(caName string) (*Generation, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	history := s.history[caName]
+	if len(history) == 0 {
+		return nil, false
+	}
+	return history[len(history)-1], true
+}
+
+// History returns kept generations of CA, the oldest first
+func (s *Server) History(caName string) []*Generation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]*Generation(nil), s.history[caName]...)
+}
+
+// DeltaSince returns difference between generation seq and the latest one.
+// False is returned if generation seq isn't kept anymore
+func (s *Server) DeltaSince(caName string, seq uint64) (Delta, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, gen := range s.history[caName] {
+		if gen.Seq == seq {
+			history := s.history[caName]
+			return diff(gen.serials, history[len(history)-1].serials), true
+		}
+	}
+	return Delta{}, false
+}
+
+// Subscribe returns channel of CRL change events. Events are dropped if subscriber doesn't read them in time,
+// so buffer should be large enough. Returned function unsubscribes and closes channel
+func (s *Server) Subscribe(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+	s.mu.Lock()
+	s.subscribers[ch] = struct{}{}
+	s.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			s.mu.Lock()
+			delete(s.subscribers, ch)
+			s.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// add appends generation for CRL. If revoked certificates are unchanged, the last generation is kept
+// with fetched CRL and time only, so steady refreshes don't push changes out of history
+func (s *Server) add(caName string, crl *x509.RevocationList) (*Generation, bool) {
+	sum := sha256.Sum256(crl.Raw)
+	gen := &Generation{
+		CRL:       crl,
+		ETag:      `"` + hex.EncodeToString(sum[:16]) + `"`,
+		FetchedAt: s.now(),
+		serials:   make(map[string]x509.RevocationListEntry, len(crl.RevokedCertificateEntries)),
+	}
+	for _, e := range crl.RevokedCertificateEntries {
+		gen.serials[string(e.SerialNumber.Bytes())] = e
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	history := s.history[caName]
+	var prev map[string]x509.RevocationListEntry
+	if len(history) > 0 {
+		prev = history[len(history)-1].serials
+		gen.Seq = history[len(history)-1].Seq + 1
+	} else {
+		gen.Seq = 1
+	}
+	gen.Delta = diff(prev, gen.serials)
+	if len(history) > 0 && gen.Delta.Empty() {
+		last := history[len(history)-1]
+		gen.Seq, gen.Delta, gen.serials = last.Seq, last.Delta, last.serials
+		history[len(history)-1] = gen
+		return gen, false
+	}
+
+	history = append(history, gen)
+	if len(history) > s.historySize {
+		history = history[len(history)-s.historySize:]
+	}
+	s.history[caName] = history
+	return gen, true
+}
+
+func (s *Server) publish(event Event) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for ch := range s.subscribers {
+		select {
+		case ch <- event:
+		default:
+			s.logger.Warn(`CRL event dropped, subscriber is too slow`, slog.String(`caname`, event.CAName),
+				slog.Uint64(`seq`, event.Generation.Seq))
+		}
+	}
+}
+
+func diff(prev, next map[string]x509.RevocationListEntry) Delta {
+	var d Delta
+	for serial, e := range next {
+		if _, ok := prev[serial]; !ok {
+			d.Added = append(d.Added, e)
+		}
+	}
+	for serial, e := range prev {
+		if _, ok := next[serial]; !ok {
+			d.Removed = append(d.Removed, e.SerialNumber)
+		}
+	}
+	sort.Slice(d.Added, func(i, j int) bool { return d.Added[i].SerialNumber.Cmp(d.Added[j].SerialNumber) < 0 })
+	sort.Slice(d.Removed, func(i, j int) bool { return d.Removed[i].Cmp(d.Removed[j]) < 0 })
+	return d
+}
@@ -0,0 +1,147 @@
+package crldist
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	contentTypeDER  = `application/pkix-crl`
+	contentTypePEM  = `application/x-pem-file`
+	contentTypeJSON = `application/json`
+)
+
+type entryJSON struct {
+	Serial         string    `json:"serial"`
+	RevocationTime time.Time `json:"revocation_time"`
+	Reason         int       `json:"reason"`
+}
+
+type deltaJSON struct {
+	Added   []entryJSON `json:"added"`
+	Removed []string    `json:"removed"`
+}
+
+type generationJSON struct {
+	Seq        uint64    `json:"seq"`
+	ETag       string    `json:"etag"`
+	ThisUpdate time.Time `json:"this_update"`
+	NextUpdate time.Time `json:"next_update"`
+	FetchedAt  time.Time `json:"fetched_at"`
+	Revoked    int       `json:"revoked"`
+	Delta      deltaJSON `json:"delta"`
+}
+
+// Handler returns HTTP handler serving:
+//
+//	GET /{caname}/crl.der          latest CRL, DER encoded
+//	GET /{caname}/crl.pem          latest CRL, PEM encoded
+//	GET /{caname}/history          kept generations with deltas
+//	GET /{caname}/delta?since=seq  difference between generation seq and the latest one
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(`GET /{caname}/crl.der`, s.handleCRL(false))
+	mux.HandleFunc(`GET /{caname}/crl.pem`, s.handleCRL(true))
+	mux.HandleFunc(`GET /{caname}/history`, s.handleHistory)
+	mux.HandleFunc(`GET /{caname}/delta`, s.handleDelta)
+	return mux
+}
+
+func (s *Server) handleCRL(asPEM bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		gen, ok := s.Latest(r.PathValue(`caname`))
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		etag := gen.ETag
+		if asPEM {
+			// representations differ, so must their validators
+			etag = etag[:len(etag)-1] + `-pem"`
+		}
+		w.Header().Set(`ETag`, etag)
+		w.Header().Set(`Last-Modified`, gen.CRL.ThisUpdate.UTC().Format(http.TimeFormat))
+		w.Header().Set(`Cache-Control`, s.cacheControl(gen))
+		if match := r.Header.Get(`If-None-Match`); match == etag || match == `*` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		if asPEM {
+			w.Header().Set(`Content-Type`, contentTypePEM)
+			_ = pem.Encode(w, &pem.Block{Type: `X509 CRL`, Bytes: gen.CRL.Raw})
+			return
+		}
+		w.Header().Set(`Content-Type`, contentTypeDER)
+		_, _ = w.Write(gen.CRL.Raw)
+	}
+}
+
+// cacheControl allows caching until the next generation, but not after CRL NextUpdate
+func (s *Server) cacheControl(gen *Generation) string {
+	maxAge := gen.FetchedAt.Add(s.interval).Sub(s.now())
+	if !gen.CRL.NextUpdate.IsZero() {
+		maxAge = min(maxAge, gen.CRL.NextUpdate.Sub(s.now()))
+	}
+	if maxAge <= 0 {
+		return `no-cache`
+	}
+	return fmt.Sprintf(`public, max-age=%d`, int(maxAge/time.Second))
+}
+
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	history := s.History(r.PathValue(`caname`))
+	if len(history) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	out := make([]generationJSON, len(history))
+	for i, gen := range history {
+		out[i] = generationJSON{
+			Seq:        gen.Seq,
+			ETag:       gen.ETag,
+			ThisUpdate: gen.CRL.ThisUpdate,
+			NextUpdate: gen.CRL.NextUpdate,
+			FetchedAt:  gen.FetchedAt,
+			Revoked:    len(gen.CRL.RevokedCertificateEntries),
+			Delta:      toDeltaJSON(gen.Delta),
+		}
+	}
+	writeJSON(w, out)
+}
+
+func (s *Server) handleDelta(w http.ResponseWriter, r *http.Request) {
+	since, err := strconv.ParseUint(r.URL.Query().Get(`since`), 10, 64)
+	if err != nil {
+		http.Error(w, `since must be generation sequence number`, http.StatusBadRequest)
+		return
+	}
+	delta, ok := s.DeltaSince(r.PathValue(`caname`), since)
+	if !ok {
+		http.Error(w, fmt.Sprintf(`generation %d is not kept, fetch full CRL`, since), http.StatusGone)
+		return
+	}
+	writeJSON(w, toDeltaJSON(delta))
+}
+
+func toDeltaJSON(d Delta) deltaJSON {
+	out := deltaJSON{Added: make([]entryJSON, len(d.Added)), Removed: make([]string, len(d.Removed))}
+	for i, e := range d.Added {
+		out.Added[i] = entryJSON{Serial: fmt.Sprintf(`%x`, e.SerialNumber), RevocationTime: e.RevocationTime, Reason: e.ReasonCode}
+	}
+	for i, serial := range d.Removed {
+		out.Removed[i] = fmt.Sprintf(`%x`, serial)
+	}
+	return out
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set(`Content-Type`, contentTypeJSON)
+	_ = json.NewEncoder(w).Encode(v)
+}
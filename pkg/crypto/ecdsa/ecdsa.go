@@ -24,6 +24,7 @@ const (
 
 	hashSHA2256 = `SHA2-256`
 	hashSHA2384 = `SHA2-384`
+	hashSHA2512 = `SHA2-512`
 	hashSHA3256 = `SHA3-256`
 	hashSHA3384 = `SHA3-384`
 
@@ -50,6 +51,7 @@ var (
 	errInvalidPrivateKey = fmt.Errorf(`invalid private key, expected ECDSA`)
 	errInvalidPublicKey  = fmt.Errorf(`invalid public key, expected ECDSA`)
 	errInvalidSignature  = fmt.Errorf(`invalid ECDSA signature`)
+	errHighSSignature    = fmt.Errorf(`invalid ECDSA signature, S must be lower than half order of curve`)
 )
 
 func New(opts map[string]string) (*Suite, error) {
@@ -116,6 +118,13 @@ func (c *Suite) Verify(publicKey interface{}, msg, sig []byte) error {
 		if _, err := asn1.Unmarshal(sig, &signature); err != nil {
 			return fmt.Errorf(`asn1.Unmarshal: %w`, err)
 		}
+		if signature.R == nil || signature.S == nil || signature.R.Sign() <= 0 || signature.S.Sign() <= 0 {
+			return errInvalidSignature
+		}
+		// signatures with high S are malleable, Fabric accepts only low S form
+		if halfOrder, ok := ecCurveHalfOrders[key.Curve]; !ok || signature.S.Cmp(halfOrder) == 1 {
+			return errHighSSignature
+		}
 		if !ecdsa.Verify(key, c.Hash(msg), signature.R, signature.S) {
 			return errInvalidSignature
 		}
@@ -159,6 +168,8 @@ func getHasher(hashType string) (func() hash.Hash, error) {
 		return sha256.New, nil
 	case hashSHA2384:
 		return sha512.New384, nil
+	case hashSHA2512:
+		return sha512.New, nil
 	case hashSHA3256:
 		return sha3.New256, nil
 	case hashSHA3384:
@@ -178,3 +189,10 @@ func getSignatureAlgorithm(algorithm string) (x509.SignatureAlgorithm, error) {
 	}
 	return x509.UnknownSignatureAlgorithm, errUnknownSignatureAlgorithm
 }
+
+func preventMalleability(k *ecdsa.PrivateKey, S *big.Int) {
+	halfOrder := ecCurveHalfOrders[k.Curve]
+	if S.Cmp(halfOrder) == 1 {
+		S.Sub(k.Params().N, S)
+	}
+}
@@ -0,0 +1,168 @@
+// Package csr builds certificate requests from csr section of config like fabric-ca-client does
+package csr
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+
+	"github.com/hlfans/ca-sdk/pkg/config"
+	"github.com/hlfans/ca-sdk/pkg/crypto"
+	"github.com/hlfans/ca-sdk/pkg/crypto/ecdsa"
+)
+
+const (
+	algoECDSA = `ecdsa`
+)
+
+// OIDBasicConstraints is the basic constraints extension, which CSR of CA certificate must contain
+var OIDBasicConstraints = asn1.ObjectIdentifier{2, 5, 29, 19}
+
+var (
+	ErrUnsupportedKeyRequest = fmt.Errorf(`unsupported key request`)
+)
+
+type Opt func(b *Builder) error
+
+// WithSuite overrides suite derived from keyrequest
+func WithSuite(suite crypto.Suite) Opt {
+	return func(b *Builder) error {
+		b.suite = suite
+		return nil
+	}
+}
+
+// Builder creates certificate request templates and private keys matching them
+type Builder struct {
+	conf  config.CSRConfig
+	suite crypto.Suite
+}
+
+func NewBuilder(conf config.CSRConfig, opts ...Opt) (*Builder, error) {
+	b := &Builder{conf: conf}
+	for _, opt := range opts {
+		if err := opt(b); err != nil {
+			return nil, fmt.Errorf(`apply csr option: %w`, err)
+		}
+	}
+
+	if b.suite == nil {
+		var err error
+		if b.suite, err = suiteFor(conf.KeyRequest); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// Suite returns suite used for key generation
+func (b *Builder) Suite() crypto.Suite {
+	return b.suite
+}
+
+// Template returns certificate request template. enrollmentID is used as common name if cn isn't configured
+func (b *Builder) Template(enrollmentID string) (*x509.CertificateRequest, error) {
+	req := &x509.CertificateRequest{
+		Subject:            pkix.Name{CommonName: b.conf.CN},
+		SignatureAlgorithm: b.suite.GetSignatureAlgorithm(),
+	}
+	if req.Subject.CommonName == `` {
+		req.Subject.CommonName = enrollmentID
+	}
+
+	for _, n := range b.conf.Names {
+		appendIf(&req.Subject.Country, n.C)
+		appendIf(&req.Subject.Province, n.ST)
+		appendIf(&req.Subject.Locality, n.L)
+		appendIf(&req.Subject.Organization, n.O)
+		appendIf(&req.Subject.OrganizationalUnit, n.OU)
+	}
+
+	for _, host := range b.conf.Hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			req.IPAddresses = append(req.IPAddresses, ip)
+		} else if email, err := mail.ParseAddress(host); err == nil && email.Address == host {
+			req.EmailAddresses = append(req.EmailAddresses, host)
+		} else if uri, err := url.Parse(host); err == nil && uri.Scheme != `` && uri.Host != `` {
+			req.URIs = append(req.URIs, uri)
+		} else {
+			req.DNSNames = append(req.DNSNames, host)
+		}
+	}
+
+	if b.conf.CA != nil {
+		ext, err := BasicConstraints(b.conf.CA.PathLength, b.conf.CA.PathLenZero)
+		if err != nil {
+			return nil, err
+		}
+		req.ExtraExtensions = append(req.ExtraExtensions, ext)
+	}
+	return req, nil
+}
+
+// Build returns certificate request template and private key generated by suite
+func (b *Builder) Build(enrollmentID string) (*x509.CertificateRequest, interface{}, error) {
+	req, err := b.Template(enrollmentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := b.suite.NewPrivateKey()
+	if err != nil {
+		return nil, nil, fmt.Errorf(`generate private key: %w`, err)
+	}
+	return req, key, nil
+}
+
+// BasicConstraints returns CA basic constraints extension. Like cfssl, zero pathLen means unlimited path length
+// unless pathLenZero is set
+func BasicConstraints(pathLen int, pathLenZero bool) (pkix.Extension, error) {
+	if pathLen < 0 {
+		return pkix.Extension{}, fmt.Errorf(`path length must not be negative`)
+	}
+	if pathLen == 0 && !pathLenZero {
+		pathLen = -1
+	}
+
+	value, err := asn1.Marshal(struct {
+		IsCA       bool `asn1:"optional"`
+		MaxPathLen int  `asn1:"optional,default:-1"`
+	}{IsCA: true, MaxPathLen: pathLen})
+	if err != nil {
+		return pkix.Extension{}, fmt.Errorf(`marshal basic constraints: %w`, err)
+	}
+	return pkix.Extension{Id: OIDBasicConstraints, Critical: true, Value: value}, nil
+}
+
+func suiteFor(keyRequest config.KeyRequest) (crypto.Suite, error) {
+	if keyRequest.Algo != `` && keyRequest.Algo != algoECDSA {
+		return nil, fmt.Errorf(`%w: algorithm %s`, ErrUnsupportedKeyRequest, keyRequest.Algo)
+	}
+
+	var opts map[string]string
+	switch keyRequest.Size {
+	case 0, 256:
+		opts = ecdsa.DefaultOpts
+	case 384:
+		opts = map[string]string{`curve`: `P384`, `signatureAlgorithm`: `SHA384`, `hash`: `SHA2-384`}
+	case 521:
+		opts = map[string]string{`curve`: `P512`, `signatureAlgorithm`: `SHA512`, `hash`: `SHA2-512`}
+	default:
+		return nil, fmt.Errorf(`%w: ecdsa key size %d`, ErrUnsupportedKeyRequest, keyRequest.Size)
+	}
+
+	suite, err := ecdsa.New(opts)
+	if err != nil {
+		return nil, fmt.Errorf(`create ecdsa suite: %w`, err)
+	}
+	return suite, nil
+}
+
+func appendIf(values *[]string, value string) {
+	if value != `` {
+		*values = append(*values, value)
+	}
+}
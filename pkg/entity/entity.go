@@ -6,6 +6,7 @@ type (
 		Type           string              `json:"type"`
 		MaxEnrollments int                 `json:"max_enrollments"`
 		Name           string              `json:"name"`
+		Affiliation    string              `json:"affiliation,omitempty"`
 		Attrs          []IdentityAttribute `json:"attrs"`
 	}
 
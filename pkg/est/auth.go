@@ -0,0 +1,83 @@
+package est
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/hlfans/ca-sdk/pkg/client"
+	"github.com/hlfans/ca-sdk/pkg/verify"
+)
+
+var (
+	// ErrNoCredentials is returned by authenticator when request has no credentials it handles
+	ErrNoCredentials = errors.New(`no credentials`)
+	ErrUnauthorized  = errors.New(`unauthorized`)
+)
+
+// Credentials are used by EST server to act for authenticated caller at Fabric CA
+type Credentials struct {
+	EnrollmentID string
+	// Secret is used for Enroll
+	Secret string
+	// Client acts as caller identity, it is used for Reenroll. If nil, reenrollment is done with Enroll and Secret
+	Client client.Client
+	// Certificate is the TLS client certificate of caller if it authenticated with it
+	Certificate *x509.Certificate
+}
+
+// Authenticator returns credentials of request or ErrNoCredentials if request doesn't carry credentials it handles
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Credentials, error)
+}
+
+type AuthenticatorFunc func(r *http.Request) (*Credentials, error)
+
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (*Credentials, error) {
+	return f(r)
+}
+
+// BasicAuth passes HTTP Basic username and password as Fabric CA enrollment id and secret, CA checks them on Enroll
+func BasicAuth() Authenticator {
+	return AuthenticatorFunc(func(r *http.Request) (*Credentials, error) {
+		name, secret, ok := r.BasicAuth()
+		if !ok {
+			return nil, ErrNoCredentials
+		}
+		return &Credentials{EnrollmentID: name, Secret: secret}, nil
+	})
+}
+
+// CredentialLookup resolves credentials of identity authenticated with certificate, for example
+// reads secret from a vault or creates client acting as this identity
+type CredentialLookup func(ctx context.Context, cert *x509.Certificate) (*Credentials, error)
+
+// TLSClientAuth authenticates callers by TLS client certificate verified with verifier. Common name is used
+// as enrollment id, lookup may be nil when only the identity is needed
+func TLSClientAuth(verifier *verify.Verifier, lookup CredentialLookup) Authenticator {
+	return AuthenticatorFunc(func(r *http.Request) (*Credentials, error) {
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+			return nil, ErrNoCredentials
+		}
+		cert := r.TLS.PeerCertificates[0]
+
+		result, err := verifier.Verify(r.Context(), cert, r.TLS.PeerCertificates[1:]...)
+		if err != nil {
+			return nil, fmt.Errorf(`verify client certificate: %w`, err)
+		}
+		if !result.Valid() {
+			return nil, fmt.Errorf(`%w: client certificate is %s`, ErrUnauthorized, result.Status)
+		}
+
+		creds := &Credentials{EnrollmentID: cert.Subject.CommonName}
+		if lookup != nil {
+			if creds, err = lookup(r.Context(), cert); err != nil {
+				return nil, fmt.Errorf(`%w: %s`, ErrUnauthorized, err)
+			}
+		}
+		creds.Certificate = cert
+		return creds, nil
+	})
+}
@@ -0,0 +1,172 @@
+// Package est implements Enrollment over Secure Transport (RFC 7030) front-end for Fabric CA.
+// EST requests are authenticated, mapped to Enroll or Reenroll and answered with PKCS#7 certs-only bundles
+package est
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/hlfans/ca-sdk/pkg/client"
+)
+
+const (
+	// PathPrefix is the well-known path of EST operations
+	PathPrefix = `/.well-known/est`
+)
+
+type Opt func(s *Server) error
+
+// WithAuthenticators sets authenticators tried in order. Default is BasicAuth
+func WithAuthenticators(authenticators ...Authenticator) Opt {
+	return func(s *Server) error {
+		s.authenticators = authenticators
+		return nil
+	}
+}
+
+// WithProfile sets Fabric CA profile used for requests without label. Default is the default profile of CA
+func WithProfile(profile client.EnrollProfile) Opt {
+	return func(s *Server) error {
+		s.profiles[``] = profile
+		return nil
+	}
+}
+
+// WithLabel serves additional CA label (RFC 7030 3.2.2), requests with the label are enrolled with profile
+func WithLabel(label string, profile client.EnrollProfile) Opt {
+	return func(s *Server) error {
+		if label == `` {
+			return fmt.Errorf(`label is empty`)
+		}
+		s.profiles[label] = profile
+		return nil
+	}
+}
+
+// WithCSRAttrs sets OIDs returned by csrattrs, for example key type and signature algorithm expected by CA
+func WithCSRAttrs(oids ...asn1.ObjectIdentifier) Opt {
+	return func(s *Server) error {
+		s.csrAttrs = oids
+		return nil
+	}
+}
+
+func WithLogger(logger *slog.Logger) Opt {
+	return func(s *Server) error {
+		s.logger = logger
+		return nil
+	}
+}
+
+// Server brokers EST requests to Fabric CA
+type Server struct {
+	cli            client.Client
+	authenticators []Authenticator
+	profiles       map[string]client.EnrollProfile
+	csrAttrs       []asn1.ObjectIdentifier
+	logger         *slog.Logger
+	caCerts        []byte
+}
+
+// New creates EST server. cli is used for Enroll and CAInfo, it doesn't need identity
+func New(ctx context.Context, cli client.Client, opts ...Opt) (*Server, error) {
+	s := &Server{
+		cli:            cli,
+		authenticators: []Authenticator{BasicAuth()},
+		profiles:       map[string]client.EnrollProfile{``: client.EnrollProfileDefault},
+		logger:         slog.Default(),
+	}
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, fmt.Errorf(`apply EST option: %w`, err)
+		}
+	}
+
+	info, err := cli.CAInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf(`get CA info: %w`, err)
+	}
+	chain, err := parseChain(info.CAChain)
+	if err != nil {
+		return nil, err
+	}
+	if s.caCerts, err = certsOnly(chain); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// enroll issues certificate for csr. Reenrollment uses identity client of caller if available
+func (s *Server) enroll(ctx context.Context, creds *Credentials, csr *x509.CertificateRequest, profile client.EnrollProfile,
+	reenroll bool) (*x509.Certificate, error) {
+	if reenroll && creds.Certificate != nil && csr.Subject.CommonName != creds.Certificate.Subject.CommonName {
+		return nil, fmt.Errorf(`%w: reenrollment subject %q differs from current certificate %q`,
+			errBadRequest, csr.Subject.CommonName, creds.Certificate.Subject.CommonName)
+	}
+
+	if reenroll && creds.Client != nil {
+		cert, _, err := creds.Client.Reenroll(ctx, csr, client.WithEnrollProfile(profile))
+		return cert, err
+	}
+	if creds.Secret == `` {
+		return nil, fmt.Errorf(`%w: enrollment secret of %s is not available`, ErrUnauthorized, creds.EnrollmentID)
+	}
+	cert, _, err := s.cli.Enroll(ctx, creds.EnrollmentID, creds.Secret, csr, client.WithEnrollProfile(profile))
+	return cert, err
+}
+
+var errBadRequest = errors.New(`bad request`)
+
+func parseCSR(body []byte) (*x509.CertificateRequest, error) {
+	der, err := base64.StdEncoding.DecodeString(string(stripSpace(body)))
+	if err != nil {
+		return nil, fmt.Errorf(`%w: decode CSR: %s`, errBadRequest, err)
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, fmt.Errorf(`%w: parse CSR: %s`, errBadRequest, err)
+	}
+	if err = csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf(`%w: CSR signature: %s`, errBadRequest, err)
+	}
+	return csr, nil
+}
+
+func parseChain(encoded string) ([]*x509.Certificate, error) {
+	chainPEM, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf(`decode CA chain: %w`, err)
+	}
+	var chain []*x509.Certificate
+	for rest := chainPEM; ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf(`parse CA certificate: %w`, err)
+		}
+		chain = append(chain, cert)
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf(`CA chain is empty`)
+	}
+	return chain, nil
+}
+
+func stripSpace(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	for _, c := range b {
+		if c != ' ' && c != '\n' && c != '\r' && c != '\t' {
+			out = append(out, c)
+		}
+	}
+	return out
+}
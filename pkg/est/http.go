@@ -0,0 +1,139 @@
+package est
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/hlfans/ca-sdk/pkg/client"
+)
+
+const (
+	contentTypePKCS7    = `application/pkcs7-mime; smime-type=certs-only`
+	contentTypeCSRAttrs = `application/csrattrs`
+
+	maxCSRSize = 64 << 10
+)
+
+// Handler returns HTTP handler of EST operations under PathPrefix, optionally prefixed with CA label:
+// cacerts, simpleenroll, simplereenroll and csrattrs. It must be served over TLS
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	for _, prefix := range []string{PathPrefix, PathPrefix + `/{label}`} {
+		mux.HandleFunc(`GET `+prefix+`/cacerts`, s.handleCACerts)
+		mux.HandleFunc(`GET `+prefix+`/csrattrs`, s.handleCSRAttrs)
+		mux.HandleFunc(`POST `+prefix+`/simpleenroll`, s.handleEnroll(false))
+		mux.HandleFunc(`POST `+prefix+`/simplereenroll`, s.handleEnroll(true))
+	}
+	return mux
+}
+
+func (s *Server) handleCACerts(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.profile(r); !ok {
+		http.NotFound(w, r)
+		return
+	}
+	writeBase64(w, contentTypePKCS7, s.caCerts)
+}
+
+func (s *Server) handleCSRAttrs(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.profile(r); !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if len(s.csrAttrs) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	der, err := asn1.Marshal(s.csrAttrs)
+	if err != nil {
+		http.Error(w, `encode CSR attributes`, http.StatusInternalServerError)
+		return
+	}
+	writeBase64(w, contentTypeCSRAttrs, der)
+}
+
+func (s *Server) handleEnroll(reenroll bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		profile, ok := s.profile(r)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		creds, err := s.authenticate(r)
+		if err != nil {
+			s.writeError(w, r, err)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxCSRSize))
+		if err != nil {
+			http.Error(w, `read request`, http.StatusBadRequest)
+			return
+		}
+		csr, err := parseCSR(body)
+		if err != nil {
+			s.writeError(w, r, err)
+			return
+		}
+
+		cert, err := s.enroll(r.Context(), creds, csr, profile, reenroll)
+		if err != nil {
+			s.writeError(w, r, err)
+			return
+		}
+
+		bundle, err := certsOnly([]*x509.Certificate{cert})
+		if err != nil {
+			s.writeError(w, r, err)
+			return
+		}
+		writeBase64(w, contentTypePKCS7, bundle)
+	}
+}
+
+func (s *Server) profile(r *http.Request) (client.EnrollProfile, bool) {
+	profile, ok := s.profiles[r.PathValue(`label`)]
+	return profile, ok
+}
+
+func (s *Server) authenticate(r *http.Request) (*Credentials, error) {
+	for _, a := range s.authenticators {
+		creds, err := a.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return creds, err
+	}
+	return nil, ErrUnauthorized
+}
+
+func (s *Server) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var respErr client.ResponseError
+	status := http.StatusBadGateway
+	switch {
+	case errors.Is(err, ErrUnauthorized), errors.Is(err, client.ErrAuthenticationFailure):
+		// RFC 7030 3.2.3, client may retry with HTTP Basic credentials
+		w.Header().Set(`WWW-Authenticate`, `Basic realm="estrealm"`)
+		status = http.StatusUnauthorized
+	case errors.Is(err, client.ErrAuthorizationFailure):
+		status = http.StatusForbidden
+	case errors.Is(err, errBadRequest), errors.As(err, &respErr) && respErr.Status == http.StatusBadRequest:
+		status = http.StatusBadRequest
+	}
+	if status >= http.StatusInternalServerError {
+		s.logger.ErrorContext(r.Context(), `EST request failed`, slog.String(`path`, r.URL.Path), slog.Any(`error`, err))
+	}
+	http.Error(w, err.Error(), status)
+}
+
+func writeBase64(w http.ResponseWriter, contentType string, der []byte) {
+	w.Header().Set(`Content-Type`, contentType)
+	w.Header().Set(`Content-Transfer-Encoding`, `base64`)
+	_, _ = io.WriteString(w, base64.StdEncoding.EncodeToString(der))
+}
@@ -0,0 +1,279 @@
+// Package expiry periodically collects not revoked and not expired certificates of Fabric CA instances,
+// exposes their expiry as Prometheus gauges and renders expiry reports
+package expiry
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hlfans/ca-sdk/pkg/abac"
+	"github.com/hlfans/ca-sdk/pkg/client"
+)
+
+const defaultInterval = 10 * time.Minute
+
+// DefaultBuckets are thresholds of expiring certificates counts
+var DefaultBuckets = []time.Duration{7 * 24 * time.Hour, 30 * 24 * time.Hour, 90 * 24 * time.Hour}
+
+// Source is CA instance, Name is used as ca label
+type Source struct {
+	Name   string
+	Client client.Client
+}
+
+type Opt func(i *Inventory) error
+
+// WithInterval sets how often certificates are collected by Run. Default is 10m
+func WithInterval(interval time.Duration) Opt {
+	return func(i *Inventory) error {
+		if interval <= 0 {
+			return fmt.Errorf(`interval must be positive`)
+		}
+		i.interval = interval
+		return nil
+	}
+}
+
+// WithBuckets sets thresholds of expiring certificates counts. Default is DefaultBuckets
+func WithBuckets(buckets ...time.Duration) Opt {
+	return func(i *Inventory) error {
+		for _, b := range buckets {
+			if b <= 0 {
+				return fmt.Errorf(`bucket must be positive`)
+			}
+		}
+		i.buckets = append([]time.Duration(nil), buckets...)
+		sort.Slice(i.buckets, func(a, b int) bool { return i.buckets[a] < i.buckets[b] })
+		return nil
+	}
+}
+
+// WithProfile overrides detection of enrollment profile, which isn't recorded in certificate.
+// By default CA certificates are `ca`, certificates with server auth usage are `tls`, others are `default`
+func WithProfile(profile func(cert *x509.Certificate) string) Opt {
+	return func(i *Inventory) error {
+		i.profile = profile
+		return nil
+	}
+}
+
+func WithLogger(logger *slog.Logger) Opt {
+	return func(i *Inventory) error {
+		i.logger = logger
+		return nil
+	}
+}
+
+// WithClock overrides current time
+func WithClock(now func() time.Time) Opt {
+	return func(i *Inventory) error {
+		i.now = now
+		return nil
+	}
+}
+
+// Certificate is active certificate of inventory
+type Certificate struct {
+	CA           string    `json:"ca"`
+	EnrollmentID string    `json:"enrollment_id"`
+	Type         string    `json:"type,omitempty"`
+	Affiliation  string    `json:"affiliation,omitempty"`
+	Profile      string    `json:"profile"`
+	Serial       string    `json:"serial"`
+	NotAfter     time.Time `json:"not_after"`
+
+	Certificate *x509.Certificate `json:"-"`
+}
+
+// caState is the last collection of CA
+type caState struct {
+	certificates []Certificate
+	// up is false if the last collection failed, certificates of previous collection are kept then
+	up          bool
+	lastSuccess time.Time
+}
+
+// Snapshot is inventory at the time of the last collection
+type Snapshot struct {
+	At time.Time
+	// Certificates are sorted by expiry, the soonest first
+	Certificates []Certificate
+	// Errors are errors of the last collection by CA name
+	Errors map[string]error
+}
+
+// Expiring returns certificates which expire within duration after snapshot time
+func (s *Snapshot) Expiring(within time.Duration) []Certificate {
+	var out []Certificate
+	for _, c := range s.Certificates {
+		if c.NotAfter.Sub(s.At) <= within {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Inventory collects certificates of CA instances
+type Inventory struct {
+	sources  []Source
+	interval time.Duration
+	buckets  []time.Duration
+	profile  func(cert *x509.Certificate) string
+	logger   *slog.Logger
+	now      func() time.Time
+
+	mu          sync.RWMutex
+	states      map[string]*caState
+	errors      map[string]error
+	collectedAt time.Time
+}
+
+// New creates inventory of sources. Client identities must be allowed to list certificates
+func New(sources []Source, opts ...Opt) (*Inventory, error) {
+	inv := &Inventory{
+		sources:  sources,
+		interval: defaultInterval,
+		buckets:  DefaultBuckets,
+		profile:  DefaultProfile,
+		logger:   slog.Default(),
+		now:      time.Now,
+		states:   map[string]*caState{},
+		errors:   map[string]error{},
+	}
+	for _, opt := range opts {
+		if err := opt(inv); err != nil {
+			return nil, fmt.Errorf(`apply expiry inventory option: %w`, err)
+		}
+	}
+
+	if len(sources) == 0 {
+		return nil, fmt.Errorf(`at least one source is required`)
+	}
+	names := map[string]bool{}
+	for _, s := range sources {
+		if s.Name == `` || s.Client == nil {
+			return nil, fmt.Errorf(`source must have name and client`)
+		}
+		if names[s.Name] {
+			return nil, fmt.Errorf(`source %s is defined twice`, s.Name)
+		}
+		names[s.Name] = true
+	}
+	return inv, nil
+}
+
+// Run collects certificates until ctx is done
+func (i *Inventory) Run(ctx context.Context) {
+	ticker := time.NewTicker(i.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := i.Refresh(ctx); err != nil {
+			i.logger.ErrorContext(ctx, `refresh certificate inventory`, slog.Any(`error`, err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh collects certificates of every CA once. Fabric CA returns all matching certificates in single
+// response. If CA fails, certificates of its previous collection are kept and CA is reported as down
+func (i *Inventory) Refresh(ctx context.Context) error {
+	var errs []error
+	for _, source := range i.sources {
+		certs, err := source.Client.CertificateList(ctx, client.WithNotRevoked(), client.WithNotExpired())
+		now := i.now()
+
+		i.mu.Lock()
+		state, ok := i.states[source.Name]
+		if !ok {
+			state = &caState{}
+			i.states[source.Name] = state
+		}
+		if err != nil {
+			state.up = false
+			i.errors[source.Name] = err
+			errs = append(errs, fmt.Errorf(`list certificates of %s: %w`, source.Name, err))
+		} else {
+			state.up, state.lastSuccess = true, now
+			state.certificates = i.inventory(source.Name, certs, now)
+			delete(i.errors, source.Name)
+		}
+		i.collectedAt = now
+		i.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// Snapshot returns certificates of the last collection of every CA
+func (i *Inventory) Snapshot() *Snapshot {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	snap := &Snapshot{At: i.collectedAt, Errors: make(map[string]error, len(i.errors))}
+	for _, state := range i.states {
+		snap.Certificates = append(snap.Certificates, state.certificates...)
+	}
+	for name, err := range i.errors {
+		snap.Errors[name] = err
+	}
+	sortCertificates(snap.Certificates)
+	return snap
+}
+
+func (i *Inventory) inventory(caName string, certs []*x509.Certificate, now time.Time) []Certificate {
+	out := make([]Certificate, 0, len(certs))
+	for _, cert := range certs {
+		// CA may return certificates which expired between query and response
+		if !now.Before(cert.NotAfter) {
+			continue
+		}
+		c := Certificate{
+			CA:           caName,
+			EnrollmentID: cert.Subject.CommonName,
+			Profile:      i.profile(cert),
+			Serial:       fmt.Sprintf(`%x`, cert.SerialNumber),
+			NotAfter:     cert.NotAfter,
+			Certificate:  cert,
+		}
+		if identity, err := abac.FromCertificate(cert); err == nil {
+			c.EnrollmentID, c.Type, c.Affiliation = identity.EnrollmentID, identity.Type, identity.Affiliation
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// DefaultProfile detects enrollment profile by certificate usage
+func DefaultProfile(cert *x509.Certificate) string {
+	if cert.IsCA {
+		return `ca`
+	}
+	for _, usage := range cert.ExtKeyUsage {
+		if usage == x509.ExtKeyUsageServerAuth {
+			return `tls`
+		}
+	}
+	return `default`
+}
+
+func sortCertificates(certs []Certificate) {
+	sort.Slice(certs, func(a, b int) bool {
+		if !certs[a].NotAfter.Equal(certs[b].NotAfter) {
+			return certs[a].NotAfter.Before(certs[b].NotAfter)
+		}
+		if certs[a].CA != certs[b].CA {
+			return certs[a].CA < certs[b].CA
+		}
+		return certs[a].Serial < certs[b].Serial
+	})
+}
@@ -0,0 +1,181 @@
+package expiry
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	metricExpirySeconds = `fabric_ca_certificate_expiry_seconds`
+	metricCertificates  = `fabric_ca_certificates`
+	metricExpiring      = `fabric_ca_certificates_expiring`
+	metricUp            = `fabric_ca_certificate_inventory_up`
+	metricLastSuccess   = `fabric_ca_certificate_inventory_last_success_timestamp_seconds`
+
+	contentTypeMetrics = `text/plain; version=0.0.4; charset=utf-8`
+)
+
+type identityKey struct {
+	ca, enrollmentID, affiliation, profile string
+}
+
+type groupKey struct {
+	ca, affiliation, profile string
+}
+
+// Handler returns HTTP handler serving metrics in Prometheus text format
+func (i *Inventory) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set(`Content-Type`, contentTypeMetrics)
+		_ = i.WriteMetrics(w)
+	})
+}
+
+// WriteMetrics writes gauges in Prometheus text format:
+//
+//	fabric_ca_certificate_expiry_seconds       seconds until expiry of the latest certificate of enrollment id
+//	                                           and profile, so renewed identities aren't reported by superseded certificates
+//	fabric_ca_certificates                     active certificates by CA, affiliation and profile
+//	fabric_ca_certificates_expiring            identities, which latest certificate expires within bucket,
+//	                                           buckets are cumulative
+//	fabric_ca_certificate_inventory_up         1 if the last collection of CA succeeded
+//	fabric_ca_certificate_inventory_last_success_timestamp_seconds
+func (i *Inventory) WriteMetrics(w io.Writer) error {
+	now := i.now()
+
+	i.mu.RLock()
+	latest := map[identityKey]time.Time{}
+	counts := map[groupKey]int{}
+	expiring := map[groupKey][]int{}
+	up := map[string]bool{}
+	lastSuccess := map[string]time.Time{}
+	for name, state := range i.states {
+		up[name], lastSuccess[name] = state.up, state.lastSuccess
+		for _, c := range state.certificates {
+			id := identityKey{ca: c.CA, enrollmentID: c.EnrollmentID, affiliation: c.Affiliation, profile: c.Profile}
+			if c.NotAfter.After(latest[id]) {
+				latest[id] = c.NotAfter
+			}
+
+			counts[groupKey{ca: c.CA, affiliation: c.Affiliation, profile: c.Profile}]++
+		}
+	}
+	i.mu.RUnlock()
+
+	// like expiry seconds, only the latest certificate of identity is bucketed
+	for id, notAfter := range latest {
+		group := groupKey{ca: id.ca, affiliation: id.affiliation, profile: id.profile}
+		if expiring[group] == nil {
+			expiring[group] = make([]int, len(i.buckets))
+		}
+		for b, bucket := range i.buckets {
+			if notAfter.Sub(now) <= bucket {
+				expiring[group][b]++
+			}
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+
+	writeHeader(bw, metricExpirySeconds,
+		`Seconds until expiry of the latest active certificate of enrollment id and profile`)
+	ids := make([]identityKey, 0, len(latest))
+	for id := range latest {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(a, b int) bool {
+		x, y := ids[a], ids[b]
+		return strings.Join([]string{x.ca, x.enrollmentID, x.affiliation, x.profile}, "\x00") <
+			strings.Join([]string{y.ca, y.enrollmentID, y.affiliation, y.profile}, "\x00")
+	})
+	for _, id := range ids {
+		writeSample(bw, metricExpirySeconds, latest[id].Sub(now).Seconds(),
+			`ca`, id.ca, `enrollment_id`, id.enrollmentID, `affiliation`, id.affiliation, `profile`, id.profile)
+	}
+
+	groups := make([]groupKey, 0, len(counts))
+	for g := range counts {
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(a, b int) bool {
+		x, y := groups[a], groups[b]
+		return strings.Join([]string{x.ca, x.affiliation, x.profile}, "\x00") <
+			strings.Join([]string{y.ca, y.affiliation, y.profile}, "\x00")
+	})
+
+	writeHeader(bw, metricCertificates, `Active certificates`)
+	for _, g := range groups {
+		writeSample(bw, metricCertificates, float64(counts[g]),
+			`ca`, g.ca, `affiliation`, g.affiliation, `profile`, g.profile)
+	}
+
+	writeHeader(bw, metricExpiring, `Identities which latest active certificate expires within bucket`)
+	for _, g := range groups {
+		for b, bucket := range i.buckets {
+			writeSample(bw, metricExpiring, float64(expiring[g][b]),
+				`ca`, g.ca, `affiliation`, g.affiliation, `profile`, g.profile, `within`, formatBucket(bucket))
+		}
+	}
+
+	names := make([]string, 0, len(up))
+	for name := range up {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	writeHeader(bw, metricUp, `Whether the last certificate collection of CA succeeded`)
+	for _, name := range names {
+		var v float64
+		if up[name] {
+			v = 1
+		}
+		writeSample(bw, metricUp, v, `ca`, name)
+	}
+
+	writeHeader(bw, metricLastSuccess, `Time of the last successful certificate collection of CA`)
+	for _, name := range names {
+		if !lastSuccess[name].IsZero() {
+			writeSample(bw, metricLastSuccess, float64(lastSuccess[name].Unix()), `ca`, name)
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf(`write metrics: %w`, err)
+	}
+	return nil
+}
+
+func writeHeader(w *bufio.Writer, name, help string) {
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+}
+
+// writeSample writes sample with labels given as name, value pairs
+func writeSample(w *bufio.Writer, name string, value float64, labels ...string) {
+	_, _ = w.WriteString(name)
+	_ = w.WriteByte('{')
+	for l := 0; l+1 < len(labels); l += 2 {
+		if l > 0 {
+			_ = w.WriteByte(',')
+		}
+		_, _ = fmt.Fprintf(w, `%s="%s"`, labels[l], escapeLabel(labels[l+1]))
+	}
+	_, _ = fmt.Fprintf(w, "} %s\n", strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// formatBucket formats whole days as `30d`
+func formatBucket(d time.Duration) string {
+	if d%(24*time.Hour) == 0 {
+		return fmt.Sprintf(`%dd`, d/(24*time.Hour))
+	}
+	return d.String()
+}
@@ -0,0 +1,147 @@
+package expiry
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format is format of expiry report
+type Format string
+
+const (
+	FormatJSON     Format = `json`
+	FormatCSV      Format = `csv`
+	FormatMarkdown Format = `markdown`
+)
+
+// ParseFormat parses report format, `md` is alias of markdown
+func ParseFormat(v string) (Format, error) {
+	switch f := Format(strings.ToLower(v)); f {
+	case FormatJSON, FormatCSV, FormatMarkdown:
+		return f, nil
+	case `md`:
+		return FormatMarkdown, nil
+	}
+	return ``, fmt.Errorf(`unknown report format %s`, v)
+}
+
+// ReportEntry is row of expiry report
+type ReportEntry struct {
+	Certificate
+	// DaysLeft is number of whole days until expiry
+	DaysLeft int `json:"days_left"`
+}
+
+// Report lists certificates expiring within duration after snapshot time
+type Report struct {
+	GeneratedAt time.Time         `json:"generated_at"`
+	Within      string            `json:"within"`
+	Entries     []ReportEntry     `json:"entries"`
+	Errors      map[string]string `json:"errors,omitempty"`
+}
+
+// NewReport creates report of certificates expiring within duration, zero duration includes all certificates
+func NewReport(snap *Snapshot, within time.Duration) *Report {
+	certs := snap.Certificates
+	report := &Report{GeneratedAt: snap.At, Within: `all`, Entries: []ReportEntry{}}
+	if within > 0 {
+		certs, report.Within = snap.Expiring(within), formatBucket(within)
+	}
+	for _, c := range certs {
+		report.Entries = append(report.Entries, ReportEntry{
+			Certificate: c, DaysLeft: int(c.NotAfter.Sub(snap.At) / (24 * time.Hour)),
+		})
+	}
+	for name, err := range snap.Errors {
+		if report.Errors == nil {
+			report.Errors = map[string]string{}
+		}
+		report.Errors[name] = err.Error()
+	}
+	return report
+}
+
+// Write writes report in format
+func (r *Report) Write(w io.Writer, format Format) error {
+	var err error
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent(``, `  `)
+		err = enc.Encode(r)
+	case FormatCSV:
+		err = r.writeCSV(w)
+	case FormatMarkdown:
+		err = r.writeMarkdown(w)
+	default:
+		return fmt.Errorf(`unknown report format %s`, format)
+	}
+	if err != nil {
+		return fmt.Errorf(`write expiry report: %w`, err)
+	}
+	return nil
+}
+
+var reportColumns = []string{`ca`, `enrollment_id`, `type`, `affiliation`, `profile`, `serial`, `not_after`, `days_left`}
+
+func (e ReportEntry) values() []string {
+	return []string{e.CA, e.EnrollmentID, e.Type, e.Affiliation, e.Profile, e.Serial,
+		e.NotAfter.UTC().Format(time.RFC3339), strconv.Itoa(e.DaysLeft)}
+}
+
+func (r *Report) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write(reportColumns)
+	for _, e := range r.Entries {
+		_ = cw.Write(e.values())
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (r *Report) writeMarkdown(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Certificate expiry report\n\nGenerated at %s, certificates expiring within %s: %d\n\n",
+		r.GeneratedAt.UTC().Format(time.RFC3339), r.Within, len(r.Entries))
+
+	b.WriteString(`|`)
+	for _, c := range reportColumns {
+		b.WriteString(` ` + c + ` |`)
+	}
+	b.WriteString("\n|")
+	for range reportColumns {
+		b.WriteString(` --- |`)
+	}
+	b.WriteString("\n")
+	for _, e := range r.Entries {
+		b.WriteString(`|`)
+		for _, v := range e.values() {
+			b.WriteString(` ` + strings.ReplaceAll(v, `|`, `\|`) + ` |`)
+		}
+		b.WriteString("\n")
+	}
+
+	if len(r.Errors) > 0 {
+		b.WriteString("\n## Errors\n\n")
+		for _, name := range sortedKeys(r.Errors) {
+			fmt.Fprintf(&b, "- %s: %s\n", name, r.Errors[name])
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
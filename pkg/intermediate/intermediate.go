@@ -0,0 +1,232 @@
+// Package intermediate enrolls intermediate CA certificate from parent Fabric CA using the `ca` profile and writes
+// it in the layout fabric-ca-server uses for its home directory.
+package intermediate
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/hlfans/ca-sdk/pkg/client"
+	"github.com/hlfans/ca-sdk/pkg/csr"
+)
+
+const (
+	certFile    = `ca-cert.pem`
+	chainFile   = `ca-chain.pem`
+	keystoreDir = `msp/keystore`
+	keySuffix   = `_sk`
+)
+
+type Opt func(o *opts) error
+
+type opts struct {
+	commonName string
+	pathLen    int
+	hosts      []string
+	privateKey interface{}
+}
+
+// WithPathLength sets maximum number of intermediate CAs below enrolled one. Default is 0
+func WithPathLength(pathLen int) Opt {
+	return func(o *opts) error {
+		if pathLen < 0 {
+			return fmt.Errorf(`path length must not be negative`)
+		}
+		o.pathLen = pathLen
+		return nil
+	}
+}
+
+// WithCommonName sets subject common name of CA certificate. Default is the enrollment id
+func WithCommonName(cn string) Opt {
+	return func(o *opts) error {
+		o.commonName = cn
+		return nil
+	}
+}
+
+// WithHosts adds DNS names of intermediate CA to its certificate
+func WithHosts(hosts ...string) Opt {
+	return func(o *opts) error {
+		o.hosts = hosts
+		return nil
+	}
+}
+
+// WithPrivateKey allows to use previously created private key
+func WithPrivateKey(key interface{}) Opt {
+	return func(o *opts) error {
+		o.privateKey = key
+		return nil
+	}
+}
+
+// Bundle is the intermediate CA certificate with its key and chain up to root
+type Bundle struct {
+	Cert *x509.Certificate
+	Key  interface{}
+	// Chain starts with Cert and ends with root certificate
+	Chain []*x509.Certificate
+}
+
+// Enroll enrolls CA certificate for identity with hf.IntermediateCA attribute. cli must be the client of parent CA
+func Enroll(ctx context.Context, cli client.Client, name, secret string, options ...Opt) (*Bundle, error) {
+	o := &opts{commonName: name}
+	for _, opt := range options {
+		if err := opt(o); err != nil {
+			return nil, fmt.Errorf(`apply intermediate option: %w`, err)
+		}
+	}
+
+	constraints, err := csr.BasicConstraints(o.pathLen, true)
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.CertificateRequest{
+		Subject:         pkix.Name{CommonName: o.commonName},
+		DNSNames:        o.hosts,
+		ExtraExtensions: []pkix.Extension{constraints},
+	}
+
+	enrollOpts := []client.EnrollOpt{client.WithEnrollProfile(client.EnrollProfileCA)}
+	if o.privateKey != nil {
+		enrollOpts = append(enrollOpts, client.WithEnrollPrivateKey(o.privateKey))
+	}
+
+	cert, key, err := cli.Enroll(ctx, name, secret, template, enrollOpts...)
+	if err != nil {
+		return nil, fmt.Errorf(`enroll CA certificate: %w`, err)
+	}
+
+	if !cert.BasicConstraintsValid || !cert.IsCA || cert.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return nil, fmt.Errorf(`issued certificate is not a CA certificate, check hf.IntermediateCA attribute of %s `+
+			`and the ca profile of parent CA`, name)
+	}
+	if cert.MaxPathLen > o.pathLen || (cert.MaxPathLen == -1 && !cert.MaxPathLenZero) {
+		return nil, fmt.Errorf(`issued certificate path length %d exceeds requested %d`, cert.MaxPathLen, o.pathLen)
+	}
+
+	info, err := cli.CAInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf(`get parent CA info: %w`, err)
+	}
+	parents, err := parseChain(info.CAChain)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := &Bundle{Cert: cert, Key: key, Chain: append([]*x509.Certificate{cert}, parents...)}
+	if err = bundle.Verify(); err != nil {
+		return nil, err
+	}
+	return bundle, nil
+}
+
+// Verify checks that certificate chains to root of bundle chain
+func (b *Bundle) Verify() error {
+	roots, intermediates := x509.NewCertPool(), x509.NewCertPool()
+	for _, c := range b.Chain[1:] {
+		if bytes.Equal(c.RawIssuer, c.RawSubject) {
+			roots.AddCert(c)
+		} else {
+			intermediates.AddCert(c)
+		}
+	}
+	if _, err := b.Cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return fmt.Errorf(`verify CA certificate against parent chain: %w`, err)
+	}
+	return nil
+}
+
+// Write stores bundle to fabric-ca-server home directory:
+//
+//	home/ca-cert.pem                  intermediate CA certificate (ca.certfile)
+//	home/ca-chain.pem                 intermediate CA certificate followed by parent chain (ca.chainfile)
+//	home/msp/keystore/<ski>_sk        private key (ca.keyfile), named by SKI as BCCSP software keystore does
+func (b *Bundle) Write(home string) error {
+	der, err := x509.MarshalPKCS8PrivateKey(b.Key)
+	if err != nil {
+		return fmt.Errorf(`marshal private key: %w`, err)
+	}
+	ski, err := keyIdentifier(b.Key)
+	if err != nil {
+		return err
+	}
+
+	chain := new(bytes.Buffer)
+	for _, c := range b.Chain {
+		_ = pem.Encode(chain, &pem.Block{Type: `CERTIFICATE`, Bytes: c.Raw})
+	}
+
+	if err = os.MkdirAll(filepath.Join(home, keystoreDir), 0755); err != nil {
+		return fmt.Errorf(`create keystore: %w`, err)
+	}
+	for path, content := range map[string][]byte{
+		filepath.Join(home, keystoreDir, ski+keySuffix): pem.EncodeToMemory(&pem.Block{Type: `PRIVATE KEY`, Bytes: der}),
+		filepath.Join(home, certFile):                   pem.EncodeToMemory(&pem.Block{Type: `CERTIFICATE`, Bytes: b.Cert.Raw}),
+		filepath.Join(home, chainFile):                  chain.Bytes(),
+	} {
+		perm := os.FileMode(0644)
+		if filepath.Base(filepath.Dir(path)) == filepath.Base(keystoreDir) {
+			perm = 0600
+		}
+		if err = os.WriteFile(path, content, perm); err != nil {
+			return fmt.Errorf(`write %s: %w`, path, err)
+		}
+	}
+	return nil
+}
+
+// keyIdentifier computes SKI like BCCSP does: SHA-256 of uncompressed public key point
+func keyIdentifier(key interface{}) (string, error) {
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return ``, fmt.Errorf(`invalid key type; expected ecdsa, got %T`, key)
+	}
+	pub, err := ecKey.PublicKey.ECDH()
+	if err != nil {
+		return ``, fmt.Errorf(`convert public key: %w`, err)
+	}
+	sum := sha256.Sum256(pub.Bytes())
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// parseChain parses base64 encoded PEM chain from CAInfo
+func parseChain(encoded string) ([]*x509.Certificate, error) {
+	chainPEM, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf(`decode CA chain: %w`, err)
+	}
+
+	var chain []*x509.Certificate
+	for rest := chainPEM; ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf(`parse CA certificate: %w`, err)
+		}
+		chain = append(chain, cert)
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf(`CA chain is empty`)
+	}
+	return chain, nil
+}
@@ -0,0 +1,78 @@
+package ocspresponder
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	contentTypeRequest  = `application/ocsp-request`
+	contentTypeResponse = `application/ocsp-response`
+
+	maxRequestSize = 10 << 10
+)
+
+// ServeHTTP serves GET requests with base64 encoded OCSP request in path and POST requests with DER body.
+// Mount responder with http.StripPrefix when it doesn't serve root path
+func (r *Responder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var (
+		raw []byte
+		err error
+	)
+	switch req.Method {
+	case http.MethodGet:
+		raw, err = decodeGetRequest(req.URL)
+	case http.MethodPost:
+		if ct := req.Header.Get(`Content-Type`); ct != contentTypeRequest {
+			http.Error(w, fmt.Sprintf(`unsupported content type %q`, ct), http.StatusUnsupportedMediaType)
+			return
+		}
+		raw, err = io.ReadAll(io.LimitReader(req.Body, maxRequestSize))
+	default:
+		w.Header().Set(`Allow`, `GET, POST`)
+		http.Error(w, `method not allowed`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	var resp []byte
+	if err != nil {
+		resp = ocsp.MalformedRequestErrorResponse
+	} else if ocspReq, err := ocsp.ParseRequest(raw); err != nil {
+		resp = ocsp.MalformedRequestErrorResponse
+	} else if resp, err = r.Respond(ocspReq); errors.Is(err, ErrNotReady) {
+		resp = ocsp.TryLaterErrorResponse
+	} else if err != nil {
+		r.logger.ErrorContext(req.Context(), `respond OCSP request`, slog.Any(`error`, err))
+		resp = ocsp.InternalErrorErrorResponse
+	} else if req.Method == http.MethodGet {
+		// only successful GET responses are cacheable, RFC 5019
+		r.mu.RLock()
+		thisUpdate, nextUpdate := r.updatedAt, r.updatedAt.Add(r.validity)
+		r.mu.RUnlock()
+		w.Header().Set(`Last-Modified`, thisUpdate.UTC().Format(http.TimeFormat))
+		w.Header().Set(`Expires`, nextUpdate.UTC().Format(http.TimeFormat))
+		if maxAge := int(nextUpdate.Sub(r.now()) / time.Second); maxAge > 0 {
+			w.Header().Set(`Cache-Control`, fmt.Sprintf(`max-age=%d, public, no-transform, must-revalidate`, maxAge))
+		}
+	}
+
+	w.Header().Set(`Content-Type`, contentTypeResponse)
+	_, _ = w.Write(resp)
+}
+
+func decodeGetRequest(u *url.URL) ([]byte, error) {
+	encoded := strings.TrimPrefix(u.EscapedPath(), `/`)
+	if unescaped, err := url.PathUnescape(encoded); err == nil {
+		encoded = unescaped
+	}
+	return base64.StdEncoding.DecodeString(encoded)
+}
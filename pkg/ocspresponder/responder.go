@@ -0,0 +1,323 @@
+// Package ocspresponder serves OCSP (RFC 6960) for certificates of Fabric CA, which itself publishes only CRLs.
+// Revocation state is loaded from CertificateList and GenCRL and refreshed periodically.
+package ocspresponder
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/hlfans/ca-sdk/pkg/client"
+	cacrypto "github.com/hlfans/ca-sdk/pkg/crypto"
+	"github.com/hlfans/ca-sdk/pkg/request"
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	// ProfileOCSP is the enrollment profile of delegated responder certificate. Fabric CA has no such profile
+	// by default, it must be added to signing.profiles of server config with `ocsp signing` usage
+	ProfileOCSP client.EnrollProfile = `ocsp`
+
+	defaultRefreshInterval = 5 * time.Minute
+)
+
+var (
+	ErrNotReady = errors.New(`OCSP responder has no revocation state yet`)
+)
+
+type Opt func(r *Responder) error
+
+// WithRefreshInterval sets how often revocation state is reloaded by Run. Default is 5m
+func WithRefreshInterval(interval time.Duration) Opt {
+	return func(r *Responder) error {
+		if interval <= 0 {
+			return fmt.Errorf(`refresh interval must be positive`)
+		}
+		r.interval = interval
+		return nil
+	}
+}
+
+// WithValidity sets how long responses are valid, it is the difference between NextUpdate and ThisUpdate.
+// Default is twice the refresh interval
+func WithValidity(validity time.Duration) Opt {
+	return func(r *Responder) error {
+		r.validity = validity
+		return nil
+	}
+}
+
+// WithCAName sets name of CA, which CRL is generated
+func WithCAName(caName string) Opt {
+	return func(r *Responder) error {
+		r.caName = caName
+		return nil
+	}
+}
+
+func WithLogger(logger *slog.Logger) Opt {
+	return func(r *Responder) error {
+		r.logger = logger
+		return nil
+	}
+}
+
+// WithClock overrides current time
+func WithClock(now func() time.Time) Opt {
+	return func(r *Responder) error {
+		r.now = now
+		return nil
+	}
+}
+
+type status struct {
+	revokedAt time.Time
+	reason    int
+}
+
+// Responder answers OCSP requests for certificates issued by CA
+type Responder struct {
+	cli      client.Client
+	signer   crypto.Signer
+	cert     *x509.Certificate
+	issuer   *x509.Certificate
+	caName   string
+	interval time.Duration
+	validity time.Duration
+	logger   *slog.Logger
+	now      func() time.Time
+
+	mu        sync.RWMutex
+	issued    map[string]bool
+	revoked   map[string]status
+	updatedAt time.Time
+}
+
+// EnrollResponder enrolls delegated responder identity with ProfileOCSP and checks that certificate
+// can sign OCSP responses
+func EnrollResponder(ctx context.Context, cli client.Client, name, secret string) (cacrypto.Signer, error) {
+	cert, key, err := cli.Enroll(ctx, name, secret, &x509.CertificateRequest{Subject: pkix.Name{CommonName: name}},
+		client.WithEnrollProfile(ProfileOCSP))
+	if err != nil {
+		return nil, fmt.Errorf(`enroll OCSP responder: %w`, err)
+	}
+	if err = checkResponderCert(cert); err != nil {
+		return nil, err
+	}
+	return cacrypto.NewSigner(cert, key)
+}
+
+// New creates responder. Signer is the delegated responder identity, its certificate must be issued by the CA
+// and have OCSP signing extended key usage. cli must be allowed to list certificates and generate CRL
+func New(ctx context.Context, cli client.Client, signer cacrypto.Signer, opts ...Opt) (*Responder, error) {
+	block, _ := pem.Decode(signer.Certificate())
+	if block == nil {
+		return nil, fmt.Errorf(`responder certificate is not PEM encoded`)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf(`parse responder certificate: %w`, err)
+	}
+	if err = checkResponderCert(cert); err != nil {
+		return nil, err
+	}
+
+	r := &Responder{cli: cli, signer: signer, cert: cert, interval: defaultRefreshInterval, logger: slog.Default(),
+		now: time.Now}
+	for _, opt := range opts {
+		if err = opt(r); err != nil {
+			return nil, fmt.Errorf(`apply responder option: %w`, err)
+		}
+	}
+	if r.validity == 0 {
+		r.validity = 2 * r.interval
+	}
+
+	info, err := cli.CAInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf(`get CA info: %w`, err)
+	}
+	if r.caName == `` {
+		r.caName = info.CAName
+	}
+	if r.issuer, err = findIssuer(info.CAChain, cert); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Run refreshes revocation state until ctx is done
+func (r *Responder) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.Refresh(ctx); err != nil {
+			r.logger.ErrorContext(ctx, `refresh OCSP revocation state`, slog.Any(`error`, err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh loads issued and revoked certificates from CertificateList and revocation times and reasons from CRL.
+// Revoked certificates which already left CRL because of expiration get CRL ThisUpdate as revocation time
+func (r *Responder) Refresh(ctx context.Context) error {
+	all, err := r.cli.CertificateList(ctx)
+	if err != nil {
+		return fmt.Errorf(`list issued certificates: %w`, err)
+	}
+	certs, err := r.cli.CertificateList(ctx, client.WithRevoked())
+	if err != nil {
+		return fmt.Errorf(`list revoked certificates: %w`, err)
+	}
+	crl, err := r.cli.GenCRL(ctx, request.GenCRLRequest{CAName: r.caName})
+	if err != nil {
+		return fmt.Errorf(`generate CRL: %w`, err)
+	}
+	if err = crl.CheckSignatureFrom(r.issuer); err != nil {
+		return fmt.Errorf(`check CRL signature: %w`, err)
+	}
+
+	issued := make(map[string]bool, len(all))
+	for _, c := range all {
+		if bytes.Equal(c.RawIssuer, r.issuer.RawSubject) {
+			issued[string(c.SerialNumber.Bytes())] = true
+		}
+	}
+	revoked := make(map[string]status, len(certs))
+	for _, c := range certs {
+		if bytes.Equal(c.RawIssuer, r.issuer.RawSubject) {
+			revoked[string(c.SerialNumber.Bytes())] = status{revokedAt: crl.ThisUpdate, reason: ocsp.Unspecified}
+		}
+	}
+	for _, e := range crl.RevokedCertificateEntries {
+		revoked[string(e.SerialNumber.Bytes())] = status{revokedAt: e.RevocationTime, reason: e.ReasonCode}
+	}
+	// certificates may be issued and revoked between calls
+	for serial := range revoked {
+		issued[serial] = true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.issued, r.revoked, r.updatedAt = issued, revoked, r.now()
+	return nil
+}
+
+// Respond returns signed DER encoded response for request. Requests for other issuers get `unauthorized` response,
+// serials never issued by CA, or issued after the last refresh, get `unknown` status, RFC 6960 2.2
+func (r *Responder) Respond(req *ocsp.Request) ([]byte, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.revoked == nil {
+		return nil, ErrNotReady
+	}
+	if !r.issuedBy(req) {
+		return ocsp.UnauthorizedErrorResponse, nil
+	}
+
+	template := ocsp.Response{
+		Status:       r.status(req.SerialNumber),
+		SerialNumber: req.SerialNumber,
+		ThisUpdate:   r.updatedAt,
+		NextUpdate:   r.updatedAt.Add(r.validity),
+		Certificate:  r.cert,
+		IssuerHash:   req.HashAlgorithm,
+	}
+	if s, ok := r.revoked[string(req.SerialNumber.Bytes())]; ok {
+		template.RevokedAt, template.RevocationReason = s.revokedAt, s.reason
+	}
+
+	resp, err := ocsp.CreateResponse(r.issuer, r.cert, template, r.signer)
+	if err != nil {
+		return nil, fmt.Errorf(`create OCSP response: %w`, err)
+	}
+	return resp, nil
+}
+
+// Status returns revocation status of serial number: ocsp.Good, ocsp.Revoked or ocsp.Unknown
+func (r *Responder) Status(serial *big.Int) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.status(serial)
+}
+
+// status must be called with r.mu held
+func (r *Responder) status(serial *big.Int) int {
+	if _, ok := r.revoked[string(serial.Bytes())]; ok {
+		return ocsp.Revoked
+	}
+	if !r.issued[string(serial.Bytes())] {
+		return ocsp.Unknown
+	}
+	return ocsp.Good
+}
+
+func (r *Responder) issuedBy(req *ocsp.Request) bool {
+	if !req.HashAlgorithm.Available() {
+		return false
+	}
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(r.issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return false
+	}
+
+	h := req.HashAlgorithm.New()
+	h.Write(r.issuer.RawSubject)
+	nameHash := h.Sum(nil)
+	h.Reset()
+	h.Write(spki.PublicKey.RightAlign())
+	keyHash := h.Sum(nil)
+
+	return bytes.Equal(nameHash, req.IssuerNameHash) && bytes.Equal(keyHash, req.IssuerKeyHash)
+}
+
+func checkResponderCert(cert *x509.Certificate) error {
+	for _, usage := range cert.ExtKeyUsage {
+		if usage == x509.ExtKeyUsageOCSPSigning {
+			return nil
+		}
+	}
+	return fmt.Errorf(`responder certificate has no OCSP signing extended key usage, check %s profile of CA`, ProfileOCSP)
+}
+
+// findIssuer returns certificate of CA chain which issued responder certificate
+func findIssuer(chainB64 string, cert *x509.Certificate) (*x509.Certificate, error) {
+	chainPEM, err := base64.StdEncoding.DecodeString(chainB64)
+	if err != nil {
+		return nil, fmt.Errorf(`decode CA chain: %w`, err)
+	}
+	for rest := chainPEM; ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		ca, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf(`parse CA certificate: %w`, err)
+		}
+		if cert.CheckSignatureFrom(ca) == nil {
+			return ca, nil
+		}
+	}
+	return nil, fmt.Errorf(`responder certificate is not issued by CA`)
+}
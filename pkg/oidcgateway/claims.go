@@ -0,0 +1,141 @@
+package oidcgateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hlfans/ca-sdk/pkg/request"
+)
+
+// Claims are claims of verified ID token. Nested claims are addressed with dot separated path,
+// for example `realm_access.roles`
+type Claims map[string]interface{}
+
+// Lookup returns claim by path
+func (c Claims) Lookup(path string) (interface{}, bool) {
+	var v interface{} = map[string]interface{}(c)
+	for _, name := range strings.Split(path, `.`) {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[name]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// String returns scalar claim as string, empty if claim is missing or isn't scalar
+func (c Claims) String(path string) string {
+	v, _ := c.Lookup(path)
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number, bool:
+		return fmt.Sprint(v)
+	}
+	return ``
+}
+
+// Strings returns claim which is either string or array of strings
+func (c Claims) Strings(path string) []string {
+	v, _ := c.Lookup(path)
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// Time returns NumericDate claim
+func (c Claims) Time(path string) (time.Time, bool) {
+	v, _ := c.Lookup(path)
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(f), 0), true
+}
+
+// Identity is Fabric CA identity of token owner
+type Identity struct {
+	Name        string
+	Type        request.IdentityType
+	Affiliation string
+	Attrs       []request.Attribute
+}
+
+// Mapper maps claims of verified token to identity. Error rejects the token owner
+type Mapper func(claims Claims) (*Identity, error)
+
+// ClaimMapping is declarative Mapper configuration
+type ClaimMapping struct {
+	// NameClaim is claim used as enrollment id, default is sub
+	NameClaim string
+	// NamePrefix is prepended to enrollment id, for example to separate identities of several issuers
+	NamePrefix string
+	// Type of identity, default is client
+	Type request.IdentityType
+	// Affiliation of identity, AffiliationClaim overrides it when claim is present
+	Affiliation      string
+	AffiliationClaim string
+	// Attrs maps Fabric attribute names to claims. Attributes are added to ECert, array claims are comma joined
+	Attrs map[string]string
+	// Required are claims which must have listed values, for example email_verified: true
+	Required map[string]string
+}
+
+// Mapper returns mapper built from configuration
+func (m ClaimMapping) Mapper() Mapper {
+	return func(claims Claims) (*Identity, error) {
+		for claim, value := range m.Required {
+			if actual := claims.String(claim); actual != value {
+				return nil, fmt.Errorf(`claim %s is %q, expected %q`, claim, actual, value)
+			}
+		}
+
+		nameClaim := m.NameClaim
+		if nameClaim == `` {
+			nameClaim = `sub`
+		}
+		name := claims.String(nameClaim)
+		if name == `` {
+			return nil, fmt.Errorf(`claim %s is empty`, nameClaim)
+		}
+
+		identity := &Identity{Name: m.NamePrefix + name, Type: m.Type, Affiliation: m.Affiliation}
+		if identity.Type == `` {
+			identity.Type = request.IdentityTypeClient
+		}
+		if m.AffiliationClaim != `` {
+			if affiliation := claims.String(m.AffiliationClaim); affiliation != `` {
+				identity.Affiliation = affiliation
+			}
+		}
+		for attr, claim := range m.Attrs {
+			if values := claims.Strings(claim); len(values) > 0 {
+				identity.Attrs = append(identity.Attrs, request.Attribute{Name: attr, Value: strings.Join(values, `,`), ECert: true})
+			} else if value := claims.String(claim); value != `` {
+				identity.Attrs = append(identity.Attrs, request.Attribute{Name: attr, Value: value, ECert: true})
+			}
+		}
+		sort.Slice(identity.Attrs, func(i, j int) bool { return identity.Attrs[i].Name < identity.Attrs[j].Name })
+		return identity, nil
+	}
+}
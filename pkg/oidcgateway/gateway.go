@@ -0,0 +1,192 @@
+// Package oidcgateway implements self-service enrollment for owners of OIDC ID tokens. Token claims are mapped
+// to Fabric CA identity, which is registered on first request and enrolled with CSR of the caller,
+// so enrollment secrets are never distributed to users.
+package oidcgateway
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/hlfans/ca-sdk/pkg/client"
+	"github.com/hlfans/ca-sdk/pkg/request"
+)
+
+var (
+	// ErrForbidden is returned when token owner can't be enrolled, for example mapping rejected claims
+	// or identity was registered without gateway
+	ErrForbidden = errors.New(`enrollment is forbidden`)
+
+	errBadRequest = errors.New(`bad request`)
+)
+
+type Opt func(g *Gateway) error
+
+// WithMapper sets claims to identity mapper. Default is ClaimMapping{}.Mapper(), sub claim becomes client identity
+func WithMapper(mapper Mapper) Opt {
+	return func(g *Gateway) error {
+		g.mapper = mapper
+		return nil
+	}
+}
+
+// WithSecretKey sets key from which enrollment secrets of identities are derived. The key must be stable
+// across restarts and replicas of gateway, otherwise identities registered before can't be enrolled again.
+// Default is random key
+func WithSecretKey(key []byte) Opt {
+	return func(g *Gateway) error {
+		if len(key) < 32 {
+			return fmt.Errorf(`secret key must be at least 32 bytes`)
+		}
+		g.secretKey = key
+		return nil
+	}
+}
+
+// WithProfile sets Fabric CA enrollment profile. Default is the default profile of CA
+func WithProfile(profile client.EnrollProfile) Opt {
+	return func(g *Gateway) error {
+		g.profile = profile
+		return nil
+	}
+}
+
+// WithMaxEnrollments sets max enrollments of registered identities, 0 means default of CA
+func WithMaxEnrollments(n int) Opt {
+	return func(g *Gateway) error {
+		g.maxEnrollments = n
+		return nil
+	}
+}
+
+func WithLogger(logger *slog.Logger) Opt {
+	return func(g *Gateway) error {
+		g.logger = logger
+		return nil
+	}
+}
+
+// Enrollment is result of self-service enrollment
+type Enrollment struct {
+	Identity    *Identity
+	Certificate *x509.Certificate
+	// Registered is true if identity was registered by this request
+	Registered bool
+}
+
+// Gateway enrolls owners of ID tokens
+type Gateway struct {
+	registrar      client.Client
+	verifier       *TokenVerifier
+	mapper         Mapper
+	secretKey      []byte
+	profile        client.EnrollProfile
+	maxEnrollments int
+	logger         *slog.Logger
+}
+
+// New creates gateway. Registrar must be allowed to register identities of types and affiliations produced by mapper
+func New(registrar client.Client, verifier *TokenVerifier, opts ...Opt) (*Gateway, error) {
+	g := &Gateway{
+		registrar: registrar,
+		verifier:  verifier,
+		mapper:    ClaimMapping{}.Mapper(),
+		profile:   client.EnrollProfileDefault,
+		logger:    slog.Default(),
+	}
+	for _, opt := range opts {
+		if err := opt(g); err != nil {
+			return nil, fmt.Errorf(`apply gateway option: %w`, err)
+		}
+	}
+	if g.secretKey == nil {
+		g.secretKey = make([]byte, 32)
+		if _, err := rand.Read(g.secretKey); err != nil {
+			return nil, fmt.Errorf(`generate secret key: %w`, err)
+		}
+	}
+	return g, nil
+}
+
+// Enroll verifies token, registers identity of token owner if it is missing and enrolls csr.
+// Common name of csr must be equal to enrollment id of identity
+func (g *Gateway) Enroll(ctx context.Context, token string, csr *x509.CertificateRequest) (*Enrollment, error) {
+	claims, err := g.verifier.Verify(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := g.mapper(claims)
+	if err != nil {
+		return nil, fmt.Errorf(`%w: %s`, ErrForbidden, err)
+	}
+	for _, a := range identity.Attrs {
+		// hf.* attributes grant CA privileges, they are never taken from tokens
+		if strings.HasPrefix(a.Name, `hf.`) {
+			return nil, fmt.Errorf(`%w: attribute %s can't be mapped from claims`, ErrForbidden, a.Name)
+		}
+	}
+	if csr.Subject.CommonName != identity.Name {
+		return nil, fmt.Errorf(`%w: CSR common name %q must be %q`, errBadRequest, csr.Subject.CommonName, identity.Name)
+	}
+
+	registered, err := g.ensureRegistered(ctx, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, _, err := g.registrar.Enroll(ctx, identity.Name, g.secret(identity.Name), csr, client.WithEnrollProfile(g.profile))
+	switch {
+	case errors.Is(err, client.ErrAuthenticationFailure), errors.Is(err, client.ErrMaxEnrollmentsReached):
+		// identity registered without gateway has secret unknown to it, revoked one is rejected the same way
+		return nil, fmt.Errorf(`%w: identity %s can't be enrolled by gateway: %s`, ErrForbidden, identity.Name, err)
+	case err != nil:
+		return nil, fmt.Errorf(`enroll %s: %w`, identity.Name, err)
+	}
+
+	g.logger.InfoContext(ctx, `self-service enrollment`, slog.String(`identity`, identity.Name),
+		slog.String(`subject`, claims.String(`sub`)), slog.Bool(`registered`, registered),
+		slog.String(`serial`, cert.SerialNumber.String()))
+	return &Enrollment{Identity: identity, Certificate: cert, Registered: registered}, nil
+}
+
+// ensureRegistered registers identity if CA doesn't know it and reports whether identity was registered
+func (g *Gateway) ensureRegistered(ctx context.Context, identity *Identity) (bool, error) {
+	_, err := g.registrar.IdentityGet(ctx, identity.Name)
+	switch {
+	case err == nil:
+		return false, nil
+	case !errors.Is(err, client.ErrIdentityNotFound):
+		return false, fmt.Errorf(`get identity %s: %w`, identity.Name, err)
+	}
+
+	_, err = g.registrar.Register(ctx, request.Registration{
+		Name:           identity.Name,
+		Type:           string(identity.Type),
+		Secret:         g.secret(identity.Name),
+		MaxEnrollments: g.maxEnrollments,
+		Affiliation:    identity.Affiliation,
+		Attrs:          identity.Attrs,
+	})
+	switch {
+	case errors.Is(err, client.ErrAlreadyRegistered):
+		// concurrent request of the same user
+		return false, nil
+	case err != nil:
+		return false, fmt.Errorf(`register %s: %w`, identity.Name, err)
+	}
+	return true, nil
+}
+
+// secret derives enrollment secret of identity from gateway key
+func (g *Gateway) secret(name string) string {
+	mac := hmac.New(sha256.New, g.secretKey)
+	mac.Write([]byte(name))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,102 @@
+package oidcgateway
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+const maxRequestSize = 64 << 10
+
+type enrollRequest struct {
+	// CSR is PEM encoded certificate request
+	CSR string `json:"csr"`
+}
+
+type enrollResponse struct {
+	EnrollmentID string `json:"enrollment_id"`
+	Registered   bool   `json:"registered"`
+	// Certificate is PEM encoded certificate
+	Certificate string `json:"certificate"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Handler returns HTTP handler of POST /enroll. ID token is passed as bearer token of Authorization header,
+// request and response are JSON with PEM encoded CSR and certificate
+func (g *Gateway) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(`POST /enroll`, g.handleEnroll)
+	return mux
+}
+
+func (g *Gateway) handleEnroll(w http.ResponseWriter, r *http.Request) {
+	scheme, token, _ := strings.Cut(r.Header.Get(`Authorization`), ` `)
+	if !strings.EqualFold(scheme, `Bearer`) || token == `` {
+		g.writeError(w, r, ErrInvalidToken)
+		return
+	}
+
+	var req enrollRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxRequestSize)).Decode(&req); err != nil {
+		g.writeError(w, r, fmt.Errorf(`%w: %s`, errBadRequest, err))
+		return
+	}
+	block, _ := pem.Decode([]byte(req.CSR))
+	if block == nil || block.Type != `CERTIFICATE REQUEST` {
+		g.writeError(w, r, fmt.Errorf(`%w: csr must be PEM encoded certificate request`, errBadRequest))
+		return
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err == nil {
+		err = csr.CheckSignature()
+	}
+	if err != nil {
+		g.writeError(w, r, fmt.Errorf(`%w: %s`, errBadRequest, err))
+		return
+	}
+
+	enrollment, err := g.Enroll(r.Context(), token, csr)
+	if err != nil {
+		g.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, enrollResponse{
+		EnrollmentID: enrollment.Identity.Name,
+		Registered:   enrollment.Registered,
+		Certificate:  string(pem.EncodeToMemory(&pem.Block{Type: `CERTIFICATE`, Bytes: enrollment.Certificate.Raw})),
+	})
+}
+
+func (g *Gateway) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusBadGateway
+	switch {
+	case errors.Is(err, ErrInvalidToken):
+		w.Header().Set(`WWW-Authenticate`, `Bearer error="invalid_token"`)
+		status = http.StatusUnauthorized
+	case errors.Is(err, ErrForbidden):
+		status = http.StatusForbidden
+	case errors.Is(err, errBadRequest):
+		status = http.StatusBadRequest
+	}
+	if status >= http.StatusInternalServerError {
+		g.logger.ErrorContext(r.Context(), `self-service enrollment failed`, slog.Any(`error`, err))
+		writeJSON(w, status, errorResponse{Error: `CA request failed`})
+		return
+	}
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set(`Content-Type`, `application/json`)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
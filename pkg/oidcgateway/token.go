@@ -0,0 +1,271 @@
+package oidcgateway
+
+import (
+	"context"
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hlfans/ca-sdk/internal/jose"
+)
+
+const (
+	discoveryPath = `/.well-known/openid-configuration`
+
+	defaultLeeway             = time.Minute
+	defaultMinRefreshInterval = time.Minute
+	maxJWKSSize               = 1 << 20
+)
+
+var ErrInvalidToken = errors.New(`invalid ID token`)
+
+type VerifierOpt func(v *TokenVerifier) error
+
+// WithJWKSURL sets URL of issuer key set. By default it is taken from OpenID provider discovery document
+func WithJWKSURL(url string) VerifierOpt {
+	return func(v *TokenVerifier) error {
+		v.jwksURL = url
+		return nil
+	}
+}
+
+// WithVerifierHTTPClient sets client used for discovery and key set requests
+func WithVerifierHTTPClient(httpClient *http.Client) VerifierOpt {
+	return func(v *TokenVerifier) error {
+		v.httpClient = httpClient
+		return nil
+	}
+}
+
+// WithLeeway sets allowed clock skew for exp, nbf and iat claims. Default is 1 minute
+func WithLeeway(leeway time.Duration) VerifierOpt {
+	return func(v *TokenVerifier) error {
+		v.leeway = leeway
+		return nil
+	}
+}
+
+// WithMinRefreshInterval limits how often key set is refetched when token is signed with unknown key. Default is 1 minute
+func WithMinRefreshInterval(interval time.Duration) VerifierOpt {
+	return func(v *TokenVerifier) error {
+		v.minRefresh = interval
+		return nil
+	}
+}
+
+// WithVerifierClock overrides current time used for token validity checks
+func WithVerifierClock(now func() time.Time) VerifierOpt {
+	return func(v *TokenVerifier) error {
+		v.now = now
+		return nil
+	}
+}
+
+// TokenVerifier validates OIDC ID tokens signed with RS256, ES256 or ES384 keys of issuer
+type TokenVerifier struct {
+	issuer     string
+	audience   string
+	jwksURL    string
+	httpClient *http.Client
+	leeway     time.Duration
+	minRefresh time.Duration
+	now        func() time.Time
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// NewVerifier creates verifier of tokens issued by issuer for audience (client id) and fetches issuer key set
+func NewVerifier(ctx context.Context, issuer, audience string, opts ...VerifierOpt) (*TokenVerifier, error) {
+	if issuer == `` || audience == `` {
+		return nil, fmt.Errorf(`issuer and audience are required`)
+	}
+	v := &TokenVerifier{
+		issuer:     issuer,
+		audience:   audience,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		leeway:     defaultLeeway,
+		minRefresh: defaultMinRefreshInterval,
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		if err := opt(v); err != nil {
+			return nil, fmt.Errorf(`apply verifier option: %w`, err)
+		}
+	}
+
+	if v.jwksURL == `` {
+		var discovery struct {
+			Issuer  string `json:"issuer"`
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := v.getJSON(ctx, strings.TrimSuffix(issuer, `/`)+discoveryPath, &discovery); err != nil {
+			return nil, fmt.Errorf(`discover OpenID provider: %w`, err)
+		}
+		if discovery.Issuer != issuer || discovery.JWKSURI == `` {
+			return nil, fmt.Errorf(`discovery document of %s has issuer %q and jwks_uri %q`, issuer, discovery.Issuer, discovery.JWKSURI)
+		}
+		v.jwksURL = discovery.JWKSURI
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err := v.refresh(ctx); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Verify checks signature, issuer, audience and validity period of token and returns its claims
+func (v *TokenVerifier) Verify(ctx context.Context, token string) (Claims, error) {
+	parts := strings.Split(token, `.`)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf(`%w: token must have 3 parts`, ErrInvalidToken)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf(`%w: header: %s`, ErrInvalidToken, err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf(`%w: decode signature: %s`, ErrInvalidToken, err)
+	}
+
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err = jose.Verify(header.Alg, key, []byte(parts[0]+`.`+parts[1]), sig); err != nil {
+		return nil, fmt.Errorf(`%w: %s`, ErrInvalidToken, err)
+	}
+
+	var claims Claims
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf(`%w: claims: %s`, ErrInvalidToken, err)
+	}
+	if err = v.checkClaims(claims); err != nil {
+		return nil, fmt.Errorf(`%w: %s`, ErrInvalidToken, err)
+	}
+	return claims, nil
+}
+
+func (v *TokenVerifier) checkClaims(claims Claims) error {
+	if iss := claims.String(`iss`); iss != v.issuer {
+		return fmt.Errorf(`unexpected issuer %q`, iss)
+	}
+	audienceOK := false
+	for _, aud := range claims.Strings(`aud`) {
+		audienceOK = audienceOK || aud == v.audience
+	}
+	if !audienceOK {
+		return fmt.Errorf(`token is not issued for %s`, v.audience)
+	}
+	if claims.String(`sub`) == `` {
+		return fmt.Errorf(`sub claim is empty`)
+	}
+
+	now := v.now()
+	exp, ok := claims.Time(`exp`)
+	if !ok {
+		return fmt.Errorf(`exp claim is missing`)
+	}
+	if now.After(exp.Add(v.leeway)) {
+		return fmt.Errorf(`token expired at %s`, exp.UTC().Format(time.RFC3339))
+	}
+	if nbf, ok := claims.Time(`nbf`); ok && now.Add(v.leeway).Before(nbf) {
+		return fmt.Errorf(`token is not valid before %s`, nbf.UTC().Format(time.RFC3339))
+	}
+	if iat, ok := claims.Time(`iat`); ok && now.Add(v.leeway).Before(iat) {
+		return fmt.Errorf(`token is issued in the future`)
+	}
+	return nil
+}
+
+// key returns issuer key by id, key set is refetched once if key is unknown, for example after key rotation
+func (v *TokenVerifier) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if key, ok := v.keys[kid]; ok {
+		return key, nil
+	}
+	if v.now().Sub(v.fetchedAt) >= v.minRefresh {
+		if err := v.refresh(ctx); err != nil {
+			return nil, err
+		}
+		if key, ok := v.keys[kid]; ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf(`%w: unknown signing key %q`, ErrInvalidToken, kid)
+}
+
+// refresh fetches key set, must be called with v.mu held
+func (v *TokenVerifier) refresh(ctx context.Context) error {
+	var set struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := v.getJSON(ctx, v.jwksURL, &set); err != nil {
+		return fmt.Errorf(`fetch key set: %w`, err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, raw := range set.Keys {
+		var meta struct {
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+		}
+		if err := json.Unmarshal(raw, &meta); err != nil || meta.Use != `` && meta.Use != `sig` {
+			continue
+		}
+		// keys of unsupported types are skipped, issuer may publish them for other clients
+		if key, err := jose.ParseJWK(raw); err == nil {
+			keys[meta.Kid] = key
+		}
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf(`key set %s has no supported signing keys`, v.jwksURL)
+	}
+	v.keys, v.fetchedAt = keys, v.now()
+	return nil
+}
+
+func (v *TokenVerifier) getJSON(ctx context.Context, url string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := v.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf(`%s responded with status %d`, url, resp.StatusCode)
+	}
+	if err = json.NewDecoder(io.LimitReader(resp.Body, maxJWKSSize)).Decode(out); err != nil {
+		return fmt.Errorf(`decode %s: %w`, url, err)
+	}
+	return nil
+}
+
+func decodeSegment(segment string, out interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(strings.NewReader(string(raw)))
+	dec.UseNumber()
+	return dec.Decode(out)
+}
@@ -0,0 +1,177 @@
+package operations
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/hlfans/ca-sdk/pkg/config"
+)
+
+const (
+	endpointHealthz = `%s/healthz`
+	endpointMetrics = `%s/metrics`
+	endpointLogSpec = `%s/logspec`
+	endpointVersion = `%s/version`
+)
+
+type HttpOpt func(c *httpClient) error
+
+// WithRawConfig sets operations service config. Its TLS config is used unless WithHTTPClient is applied
+func WithRawConfig(conf *config.OperationsConfig) HttpOpt {
+	return func(c *httpClient) error {
+		c.config = conf
+		return nil
+	}
+}
+
+// WithCAConfig uses operations section of CA config
+func WithCAConfig(conf *config.CAConfig) HttpOpt {
+	return WithRawConfig(&conf.Operations)
+}
+
+func WithHTTPClient(client *http.Client) HttpOpt {
+	return func(c *httpClient) error {
+		c.client = client
+		return nil
+	}
+}
+
+type httpClient struct {
+	config *config.OperationsConfig
+	client *http.Client
+}
+
+func NewHttp(opts ...HttpOpt) (Client, error) {
+	var cli httpClient
+
+	for _, opt := range opts {
+		if err := opt(&cli); err != nil {
+			return nil, fmt.Errorf(`apply operations.Client option: %w`, err)
+		}
+	}
+
+	if cli.config == nil || cli.config.Host == `` {
+		return nil, fmt.Errorf(`config is empty`)
+	}
+
+	if cli.client == nil {
+		cli.client = http.DefaultClient
+		if cli.config.Tls.Enabled {
+			tlsConfig, err := cli.config.Tls.ClientConfig()
+			if err != nil {
+				return nil, fmt.Errorf(`build TLS config: %w`, err)
+			}
+			cli.client = &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+		}
+	}
+
+	return &cli, nil
+}
+
+func (c *httpClient) Health(ctx context.Context) (*HealthStatus, error) {
+	var status HealthStatus
+	if err := c.call(ctx, http.MethodGet, endpointHealthz, nil, &status, http.StatusOK, http.StatusServiceUnavailable); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+func (c *httpClient) Metrics(ctx context.Context) ([]MetricFamily, error) {
+	body, err := c.request(ctx, http.MethodGet, endpointMetrics, nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	families, err := ParseMetrics(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf(`parse metrics: %w`, err)
+	}
+	return families, nil
+}
+
+func (c *httpClient) LogSpec(ctx context.Context) (string, error) {
+	var spec logSpec
+	if err := c.call(ctx, http.MethodGet, endpointLogSpec, nil, &spec, http.StatusOK); err != nil {
+		return ``, err
+	}
+	return spec.Spec, nil
+}
+
+func (c *httpClient) SetLogSpec(ctx context.Context, spec string) error {
+	reqBytes, err := json.Marshal(logSpec{Spec: spec})
+	if err != nil {
+		return fmt.Errorf(`marshal request: %w`, err)
+	}
+	_, err = c.request(ctx, http.MethodPut, endpointLogSpec, reqBytes, http.StatusNoContent, http.StatusOK)
+	return err
+}
+
+func (c *httpClient) Version(ctx context.Context) (*Version, error) {
+	var version Version
+	if err := c.call(ctx, http.MethodGet, endpointVersion, nil, &version, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// call performs request and unmarshals JSON response to out
+func (c *httpClient) call(ctx context.Context, method, endpoint string, body []byte, out interface{}, expected ...int) error {
+	respBody, err := c.request(ctx, method, endpoint, body, expected...)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf(`unmarshal response: %w`, err)
+	}
+	return nil
+}
+
+func (c *httpClient) request(ctx context.Context, method, endpoint string, body []byte, expected ...int) ([]byte, error) {
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf(endpoint, c.config.Host), reqBody)
+	if err != nil {
+		return nil, fmt.Errorf(`create request: %w`, err)
+	}
+	if body != nil {
+		req.Header.Set(`Content-Type`, `application/json`)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf(`do request: %w`, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf(`read response body: %w`, err)
+	}
+
+	for _, status := range expected {
+		if resp.StatusCode == status {
+			return respBody, nil
+		}
+	}
+
+	var errResp errorResponse
+	if json.Unmarshal(respBody, &errResp) == nil && errResp.Error != `` {
+		return nil, ErrUnexpectedHTTPStatus{Status: resp.StatusCode, Message: errResp.Error}
+	}
+	return nil, ErrUnexpectedHTTPStatus{Status: resp.StatusCode, Message: string(respBody)}
+}
+
+type ErrUnexpectedHTTPStatus struct {
+	Status  int
+	Message string
+}
+
+func (err ErrUnexpectedHTTPStatus) Error() string {
+	return fmt.Sprintf("unexpected HTTP status code: %d: %s", err.Status, err.Message)
+}
@@ -0,0 +1,53 @@
+// Package operations is the client of Fabric CA operations service, which serves health checks, metrics and
+// logging specification separately from REST API.
+package operations
+
+import (
+	"context"
+	"time"
+)
+
+type Client interface {
+	// Health returns result of CA health checks. Unhealthy CA is not an error, see HealthStatus.Healthy
+	Health(ctx context.Context) (*HealthStatus, error)
+	// Metrics returns metrics exposed in Prometheus text format
+	Metrics(ctx context.Context) ([]MetricFamily, error)
+	// LogSpec returns current logging specification, for example `info` or `debug:cfssl=warn`
+	LogSpec(ctx context.Context) (string, error)
+	// SetLogSpec changes logging specification at runtime
+	SetLogSpec(ctx context.Context, spec string) error
+	// Version returns version of CA
+	Version(ctx context.Context) (*Version, error)
+}
+
+const healthStatusOK = `OK`
+
+type (
+	HealthStatus struct {
+		Status       string        `json:"status"`
+		Time         time.Time     `json:"time"`
+		FailedChecks []FailedCheck `json:"failed_checks,omitempty"`
+	}
+
+	FailedCheck struct {
+		Component string `json:"component"`
+		Reason    string `json:"reason"`
+	}
+
+	Version struct {
+		CommitSHA string `json:"CommitSHA"`
+		Version   string `json:"Version"`
+	}
+
+	logSpec struct {
+		Spec string `json:"spec"`
+	}
+
+	errorResponse struct {
+		Error string `json:"Error"`
+	}
+)
+
+func (h *HealthStatus) Healthy() bool {
+	return h.Status == healthStatusOK && len(h.FailedChecks) == 0
+}
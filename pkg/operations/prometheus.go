@@ -0,0 +1,195 @@
+package operations
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type MetricType string
+
+const (
+	MetricTypeCounter   MetricType = `counter`
+	MetricTypeGauge     MetricType = `gauge`
+	MetricTypeHistogram MetricType = `histogram`
+	MetricTypeSummary   MetricType = `summary`
+	MetricTypeUntyped   MetricType = `untyped`
+)
+
+type (
+	// MetricFamily groups samples of the same metric. Histogram and summary families include
+	// their _bucket, _sum and _count samples
+	MetricFamily struct {
+		Name    string
+		Help    string
+		Type    MetricType
+		Samples []Sample
+	}
+
+	Sample struct {
+		// Name is the sample name, which differs from family name for _bucket, _sum and _count samples
+		Name   string
+		Labels map[string]string
+		Value  float64
+		// Timestamp in milliseconds, zero if not exposed
+		Timestamp int64
+	}
+)
+
+// Find returns family by name
+func Find(families []MetricFamily, name string) (*MetricFamily, bool) {
+	for i := range families {
+		if families[i].Name == name {
+			return &families[i], true
+		}
+	}
+	return nil, false
+}
+
+// ParseMetrics parses Prometheus text exposition format
+func ParseMetrics(r io.Reader) ([]MetricFamily, error) {
+	var (
+		families []MetricFamily
+		index    = map[string]int{}
+	)
+
+	family := func(name string) *MetricFamily {
+		if i, ok := index[name]; ok {
+			return &families[i]
+		}
+		index[name] = len(families)
+		families = append(families, MetricFamily{Name: name, Type: MetricTypeUntyped})
+		return &families[len(families)-1]
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == `` {
+			continue
+		}
+
+		if strings.HasPrefix(line, `#`) {
+			fields := strings.SplitN(strings.TrimSpace(line[1:]), ` `, 3)
+			if len(fields) < 3 {
+				continue
+			}
+			switch fields[0] {
+			case `HELP`:
+				family(fields[1]).Help = unescapeHelp(fields[2])
+			case `TYPE`:
+				family(fields[1]).Type = MetricType(fields[2])
+			}
+			continue
+		}
+
+		sample, err := parseSample(line)
+		if err != nil {
+			return nil, fmt.Errorf(`line %d: %w`, lineNo, err)
+		}
+		f := family(familyName(sample.Name, index, families))
+		f.Samples = append(f.Samples, sample)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf(`read metrics: %w`, err)
+	}
+	return families, nil
+}
+
+// familyName maps histogram and summary sample names to declared family name
+func familyName(sample string, index map[string]int, families []MetricFamily) string {
+	for _, suffix := range []string{`_bucket`, `_sum`, `_count`} {
+		base, ok := strings.CutSuffix(sample, suffix)
+		if !ok {
+			continue
+		}
+		if i, ok := index[base]; ok && (families[i].Type == MetricTypeHistogram || families[i].Type == MetricTypeSummary) {
+			return base
+		}
+	}
+	return sample
+}
+
+func parseSample(line string) (Sample, error) {
+	sample := Sample{Labels: map[string]string{}}
+
+	nameEnd := strings.IndexAny(line, "{ \t")
+	if nameEnd <= 0 {
+		return sample, fmt.Errorf(`invalid sample %q`, line)
+	}
+	sample.Name, line = line[:nameEnd], line[nameEnd:]
+
+	if strings.HasPrefix(line, `{`) {
+		rest, err := parseLabels(line[1:], sample.Labels)
+		if err != nil {
+			return sample, err
+		}
+		line = rest
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) < 1 || len(fields) > 2 {
+		return sample, fmt.Errorf(`invalid value of sample %s`, sample.Name)
+	}
+
+	var err error
+	if sample.Value, err = strconv.ParseFloat(fields[0], 64); err != nil {
+		return sample, fmt.Errorf(`parse value of sample %s: %w`, sample.Name, err)
+	}
+	if len(fields) == 2 {
+		if sample.Timestamp, err = strconv.ParseInt(fields[1], 10, 64); err != nil {
+			return sample, fmt.Errorf(`parse timestamp of sample %s: %w`, sample.Name, err)
+		}
+	}
+	return sample, nil
+}
+
+// parseLabels parses `name="value",...}` and returns rest of line after closing brace
+func parseLabels(s string, labels map[string]string) (string, error) {
+	for {
+		s = strings.TrimLeft(s, ` ,`)
+		if strings.HasPrefix(s, `}`) {
+			return s[1:], nil
+		}
+
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 || len(s) < eq+2 || s[eq+1] != '"' {
+			return ``, fmt.Errorf(`invalid labels`)
+		}
+		name := strings.TrimSpace(s[:eq])
+		s = s[eq+2:]
+
+		var value strings.Builder
+		closed := false
+		for i := 0; i < len(s); i++ {
+			switch c := s[i]; {
+			case c == '\\' && i+1 < len(s):
+				i++
+				switch s[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(s[i])
+				}
+			case c == '"':
+				s, closed = s[i+1:], true
+			default:
+				value.WriteByte(c)
+			}
+			if closed {
+				break
+			}
+		}
+		if !closed {
+			return ``, fmt.Errorf(`unterminated value of label %s`, name)
+		}
+		labels[name] = value.String()
+	}
+}
+
+func unescapeHelp(s string) string {
+	return strings.NewReplacer(`\\`, `\`, `\n`, "\n").Replace(s)
+}
@@ -0,0 +1,90 @@
+// Package registrar checks registration requests against Fabric CA delegation rules on client side, so missing
+// registrar capabilities are reported before the request is sent instead of opaque CA errors.
+package registrar
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/hlfans/ca-sdk/pkg/abac"
+	"github.com/hlfans/ca-sdk/pkg/client"
+	"github.com/hlfans/ca-sdk/pkg/crypto"
+	"github.com/hlfans/ca-sdk/pkg/entity"
+	"github.com/hlfans/ca-sdk/pkg/request"
+)
+
+// Registrar describes capabilities of identity which registers other identities
+type Registrar struct {
+	EnrollmentID string
+	// Affiliation limits affiliations of registered identities to this affiliation subtree. Empty value is root
+	Affiliation string
+	Attrs       []entity.IdentityAttribute
+}
+
+// FromIdentity builds registrar from identity returned by Client.IdentityGet
+func FromIdentity(identity *entity.Identity) *Registrar {
+	return &Registrar{EnrollmentID: identity.Id, Affiliation: identity.Affiliation, Attrs: identity.Attrs}
+}
+
+// FromCertificate builds registrar from ECert attributes. Only attributes registered with `ecert` flag are
+// available in certificate, so Lookup is more reliable
+func FromCertificate(cert *x509.Certificate) (*Registrar, error) {
+	identity, err := abac.FromCertificate(cert)
+	if err != nil {
+		return nil, err
+	}
+	return &Registrar{EnrollmentID: identity.EnrollmentID, Affiliation: identity.Affiliation, Attrs: identity.Attrs}, nil
+}
+
+// Lookup gets registrar of signer with IdentityGet on self. Client must act as signer
+func Lookup(ctx context.Context, cli client.Client, signer crypto.Signer) (*Registrar, error) {
+	block, _ := pem.Decode(signer.Certificate())
+	if block == nil {
+		return nil, fmt.Errorf(`failed to decode signer certificate`)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf(`parse signer certificate: %w`, err)
+	}
+
+	self, err := FromCertificate(cert)
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := cli.IdentityGet(ctx, self.EnrollmentID)
+	if err != nil {
+		return nil, fmt.Errorf(`get registrar identity: %w`, err)
+	}
+	return FromIdentity(identity), nil
+}
+
+func (r *Registrar) attr(name string) (string, bool) {
+	for _, a := range r.Attrs {
+		if a.Name == name {
+			return a.Value, true
+		}
+	}
+	return ``, false
+}
+
+// checkedClient runs preflight before every Register
+type checkedClient struct {
+	client.Client
+	registrar *Registrar
+}
+
+// NewCheckedClient wraps client, so Register fails with *PreflightError without sending request
+// if registration violates delegation rules
+func NewCheckedClient(cli client.Client, registrar *Registrar) client.Client {
+	return &checkedClient{Client: cli, registrar: registrar}
+}
+
+func (c *checkedClient) Register(ctx context.Context, req request.Registration) (string, error) {
+	if err := c.registrar.Check(req); err != nil {
+		return ``, err
+	}
+	return c.Client.Register(ctx, req)
+}
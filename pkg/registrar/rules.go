@@ -0,0 +1,183 @@
+package registrar
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hlfans/ca-sdk/pkg/request"
+)
+
+const (
+	defaultIdentityType = request.IdentityTypeClient
+	wildcard            = `*`
+)
+
+var (
+	// ErrPreflight is matched by errors.Is against *PreflightError
+	ErrPreflight = errors.New(`registration preflight failed`)
+
+	// autoAttributes are set by CA on enrollment and can't be registered
+	autoAttributes = map[string]bool{request.AttrEnrollmentID: true, request.AttrType: true, request.AttrAffiliation: true}
+
+	// booleanAttributes may be granted only by registrar which has them itself
+	booleanAttributes = map[string]bool{request.AttrRevoker: true, request.AttrGenCRL: true, request.AttrIntermediateCA: true, request.AttrAffiliationMgr: true}
+)
+
+// Violation describes single delegation rule broken by registration
+type Violation struct {
+	// Field is registration field or attribute name
+	Field  string
+	Reason string
+}
+
+func (v Violation) String() string {
+	return v.Field + `: ` + v.Reason
+}
+
+// PreflightError holds all violations of registration
+type PreflightError struct {
+	Name       string
+	Violations []Violation
+}
+
+func (err *PreflightError) Error() string {
+	reasons := make([]string, len(err.Violations))
+	for i, v := range err.Violations {
+		reasons[i] = v.String()
+	}
+	return fmt.Sprintf(`registration of %s violates delegation rules: %s`, err.Name, strings.Join(reasons, `; `))
+}
+
+func (err *PreflightError) Is(target error) bool {
+	return target == ErrPreflight
+}
+
+// Check verifies registration against delegation rules of Fabric CA and returns *PreflightError with every violation
+func (r *Registrar) Check(req request.Registration) error {
+	var violations []Violation
+	violate := func(field, format string, args ...interface{}) {
+		violations = append(violations, Violation{Field: field, Reason: fmt.Sprintf(format, args...)})
+	}
+
+	roles, isRegistrar := r.attr(request.AttrRegistrarRoles)
+	if !isRegistrar || roles == `` {
+		violate(request.AttrRegistrarRoles, `%s is not a registrar`, r.EnrollmentID)
+	}
+
+	identityType := req.Type
+	if identityType == `` {
+		identityType = string(defaultIdentityType)
+	}
+	if isRegistrar && !containsItem(roles, identityType) {
+		violate(`type`, `registrar may register only types %q, not %q`, roles, identityType)
+	}
+
+	if !r.coversAffiliation(req.Affiliation) {
+		violate(`affiliation`, `affiliation %q is outside of registrar affiliation %q`, req.Affiliation, r.Affiliation)
+	}
+
+	// registrars may be registered only with roles registrar may delegate, Roles are delegable when DelegateRoles is unset
+	delegable, delegateSet := r.attr(request.AttrRegistrarDelegateRoles)
+	delegableAttr := request.AttrRegistrarDelegateRoles
+	if !delegateSet {
+		delegable, delegableAttr = roles, request.AttrRegistrarRoles
+	}
+
+	allowedAttrs, _ := r.attr(request.AttrRegistrarAttributes)
+	requested := make(map[string]string, len(req.Attrs))
+	for _, a := range req.Attrs {
+		requested[a.Name] = a.Value
+	}
+
+	for _, a := range req.Attrs {
+		if autoAttributes[a.Name] {
+			violate(a.Name, `attribute is reserved and set by CA`)
+			continue
+		}
+		if !matchesAny(allowedAttrs, a.Name) {
+			violate(a.Name, `registrar may register only attributes %q`, allowedAttrs)
+		}
+
+		switch {
+		case a.Name == request.AttrRegistrarRoles:
+			for _, role := range splitList(a.Value) {
+				if !containsItem(delegable, role) {
+					violate(a.Name, `role %q is not in registrar %s %q`, role, delegableAttr, delegable)
+				}
+			}
+		case a.Name == request.AttrRegistrarDelegateRoles:
+			delegated, hasRoles := requested[request.AttrRegistrarRoles]
+			for _, role := range splitList(a.Value) {
+				if !containsItem(delegable, role) {
+					violate(a.Name, `role %q is not in registrar %s %q`, role, delegableAttr, delegable)
+				} else if hasRoles && !containsItem(delegated, role) {
+					violate(a.Name, `role %q is not in registered %s %q`, role, request.AttrRegistrarRoles, delegated)
+				}
+			}
+		case a.Name == request.AttrRegistrarAttributes:
+			for _, name := range splitList(a.Value) {
+				if !matchesAny(allowedAttrs, name) {
+					violate(a.Name, `attribute %q is not in registrar attributes %q`, name, allowedAttrs)
+				}
+			}
+		case booleanAttributes[a.Name]:
+			value, err := strconv.ParseBool(a.Value)
+			if err != nil {
+				violate(a.Name, `value %q is not boolean`, a.Value)
+				continue
+			}
+			if own, _ := r.attr(a.Name); value && own != `true` {
+				violate(a.Name, `registrar doesn't have %s itself`, a.Name)
+			}
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PreflightError{Name: req.Name, Violations: violations}
+	}
+	return nil
+}
+
+// coversAffiliation reports whether affiliation belongs to registrar affiliation subtree.
+// Empty affiliation of registration defaults to registrar affiliation
+func (r *Registrar) coversAffiliation(affiliation string) bool {
+	if r.Affiliation == `` || affiliation == `` || affiliation == r.Affiliation {
+		return true
+	}
+	return strings.HasPrefix(affiliation, r.Affiliation+`.`)
+}
+
+func splitList(value string) []string {
+	var out []string
+	for _, item := range strings.Split(value, `,`) {
+		if item = strings.TrimSpace(item); item != `` {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// containsItem reports whether comma separated list contains item or wildcard
+func containsItem(list, item string) bool {
+	for _, v := range splitList(list) {
+		if v == item || v == wildcard {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAny reports whether name matches any of comma separated patterns, where pattern `a.b.*` matches `a.b.c`
+func matchesAny(patterns, name string) bool {
+	for _, p := range splitList(patterns) {
+		if p == wildcard || p == name {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(p, wildcard); ok && strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
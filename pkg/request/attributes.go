@@ -0,0 +1,157 @@
+package request
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// IdentityType is the type of registered identity. Types match NodeOUs of Fabric MSP
+type IdentityType string
+
+const (
+	IdentityTypeClient  IdentityType = `client`
+	IdentityTypePeer    IdentityType = `peer`
+	IdentityTypeOrderer IdentityType = `orderer`
+	IdentityTypeAdmin   IdentityType = `admin`
+	IdentityTypeUser    IdentityType = `user`
+)
+
+// Reserved attributes, which are interpreted by Fabric CA
+const (
+	// AttrRegistrarRoles lists identity types which identity may register
+	AttrRegistrarRoles = `hf.Registrar.Roles`
+	// AttrRegistrarDelegateRoles lists identity types which identity may allow registered registrars to register
+	AttrRegistrarDelegateRoles = `hf.Registrar.DelegateRoles`
+	// AttrRegistrarAttributes lists attributes which identity may register, `a.b.*` matches all `a.b.` attributes
+	AttrRegistrarAttributes = `hf.Registrar.Attributes`
+	// AttrRevoker allows identity to revoke certificates and identities
+	AttrRevoker = `hf.Revoker`
+	// AttrGenCRL allows identity to generate CRL
+	AttrGenCRL = `hf.GenCRL`
+	// AttrIntermediateCA allows identity to enroll as intermediate CA
+	AttrIntermediateCA = `hf.IntermediateCA`
+	// AttrAffiliationMgr allows identity to manage affiliations
+	AttrAffiliationMgr = `hf.AffiliationMgr`
+
+	// AttrEnrollmentID, AttrType and AttrAffiliation are added to ECert by CA and can't be registered
+	AttrEnrollmentID = `hf.EnrollmentID`
+	AttrType         = `hf.Type`
+	AttrAffiliation  = `hf.Affiliation`
+
+	reservedPrefix = `hf.`
+	wildcard       = `*`
+)
+
+var (
+	identityTypes = map[IdentityType]bool{
+		IdentityTypeClient: true, IdentityTypePeer: true, IdentityTypeOrderer: true, IdentityTypeAdmin: true, IdentityTypeUser: true,
+	}
+
+	registrableAttributes = map[string]bool{
+		AttrRegistrarRoles: true, AttrRegistrarDelegateRoles: true, AttrRegistrarAttributes: true,
+		AttrRevoker: true, AttrGenCRL: true, AttrIntermediateCA: true, AttrAffiliationMgr: true,
+	}
+
+	booleanAttributes = map[string]bool{
+		AttrRevoker: true, AttrGenCRL: true, AttrIntermediateCA: true, AttrAffiliationMgr: true,
+	}
+
+	roleAttributes = map[string]bool{AttrRegistrarRoles: true, AttrRegistrarDelegateRoles: true}
+)
+
+// Valid reports whether type is one of built-in types. CA accepts custom types too
+func (t IdentityType) Valid() bool {
+	return identityTypes[t]
+}
+
+// validIdentityType checks only syntax of type, because CA accepts identity types other than built-in ones
+func validIdentityType(t IdentityType) bool {
+	return strings.TrimSpace(string(t)) != `` && !strings.Contains(string(t), `,`)
+}
+
+// RegistrarRoles allows identity to register identities of listed types, `*` allows any type
+func RegistrarRoles(roles ...IdentityType) (Attribute, error) {
+	return rolesAttribute(AttrRegistrarRoles, roles)
+}
+
+// DelegateRoles allows identity to grant listed roles to registrars it registers
+func DelegateRoles(roles ...IdentityType) (Attribute, error) {
+	return rolesAttribute(AttrRegistrarDelegateRoles, roles)
+}
+
+// RegistrarAttributes allows identity to register listed attributes
+func RegistrarAttributes(names ...string) (Attribute, error) {
+	if len(names) == 0 {
+		return Attribute{}, fmt.Errorf(`%s: at least one attribute is required`, AttrRegistrarAttributes)
+	}
+	for _, name := range names {
+		if name == `` || strings.ContainsAny(name, `, `) {
+			return Attribute{}, fmt.Errorf(`%s: invalid attribute name %q`, AttrRegistrarAttributes, name)
+		}
+	}
+	return Attribute{Name: AttrRegistrarAttributes, Value: strings.Join(names, `,`)}, nil
+}
+
+func Revoker(allowed bool) Attribute {
+	return Attribute{Name: AttrRevoker, Value: strconv.FormatBool(allowed)}
+}
+
+func GenCRL(allowed bool) Attribute {
+	return Attribute{Name: AttrGenCRL, Value: strconv.FormatBool(allowed)}
+}
+
+func IntermediateCA(allowed bool) Attribute {
+	return Attribute{Name: AttrIntermediateCA, Value: strconv.FormatBool(allowed)}
+}
+
+func AffiliationMgr(allowed bool) Attribute {
+	return Attribute{Name: AttrAffiliationMgr, Value: strconv.FormatBool(allowed)}
+}
+
+func rolesAttribute(name string, roles []IdentityType) (Attribute, error) {
+	if len(roles) == 0 {
+		return Attribute{}, fmt.Errorf(`%s: at least one role is required`, name)
+	}
+	values := make([]string, len(roles))
+	for i, role := range roles {
+		if !validIdentityType(role) {
+			return Attribute{}, fmt.Errorf(`%s: invalid identity type %q`, name, role)
+		}
+		values[i] = string(role)
+	}
+	return Attribute{Name: name, Value: strings.Join(values, `,`)}, nil
+}
+
+// validateAttribute checks name and value of reserved attribute
+func validateAttribute(a Attribute) error {
+	if a.Name == `` {
+		return fmt.Errorf(`attribute name is empty`)
+	}
+	if !strings.HasPrefix(a.Name, reservedPrefix) {
+		return nil
+	}
+
+	switch {
+	case a.Name == AttrEnrollmentID || a.Name == AttrType || a.Name == AttrAffiliation:
+		return fmt.Errorf(`%s is set by CA and can't be registered`, a.Name)
+	case !registrableAttributes[a.Name]:
+		return fmt.Errorf(`unknown reserved attribute %s`, a.Name)
+	case booleanAttributes[a.Name]:
+		if _, err := strconv.ParseBool(a.Value); err != nil {
+			return fmt.Errorf(`%s: value %q is not boolean`, a.Name, a.Value)
+		}
+	case roleAttributes[a.Name]:
+		// CA accepts identity types other than built-in ones, so only list syntax is checked
+		for _, role := range strings.Split(a.Value, `,`) {
+			if strings.TrimSpace(role) == `` {
+				return fmt.Errorf(`%s: value %q contains empty role`, a.Name, a.Value)
+			}
+		}
+	case a.Name == AttrRegistrarAttributes:
+		if strings.TrimSpace(a.Value) == `` {
+			return fmt.Errorf(`%s: value is empty`, a.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+)
+
+// RegistrationBuilder builds Registration with typed identity type and reserved attributes
+type RegistrationBuilder struct {
+	reg  Registration
+	errs []error
+}
+
+func NewRegistration(name string, identityType IdentityType) *RegistrationBuilder {
+	b := &RegistrationBuilder{reg: Registration{Name: name, Type: string(identityType)}}
+	if !validIdentityType(identityType) {
+		b.errs = append(b.errs, fmt.Errorf(`invalid identity type %q`, identityType))
+	}
+	return b
+}
+
+func (b *RegistrationBuilder) WithSecret(secret string) *RegistrationBuilder {
+	b.reg.Secret = secret
+	return b
+}
+
+func (b *RegistrationBuilder) WithAffiliation(affiliation string) *RegistrationBuilder {
+	b.reg.Affiliation = affiliation
+	return b
+}
+
+// WithMaxEnrollments limits number of enrollments, -1 means unlimited
+func (b *RegistrationBuilder) WithMaxEnrollments(n int) *RegistrationBuilder {
+	b.reg.MaxEnrollments = n
+	return b
+}
+
+func (b *RegistrationBuilder) WithCAName(caName string) *RegistrationBuilder {
+	b.reg.CAName = caName
+	return b
+}
+
+// WithAttribute adds custom attribute, ecert defines whether attribute is added to ECert by default
+func (b *RegistrationBuilder) WithAttribute(name, value string, ecert bool) *RegistrationBuilder {
+	b.reg.Attrs = append(b.reg.Attrs, Attribute{Name: name, Value: value, ECert: ecert})
+	return b
+}
+
+func (b *RegistrationBuilder) WithRegistrarRoles(roles ...IdentityType) *RegistrationBuilder {
+	return b.add(RegistrarRoles(roles...))
+}
+
+func (b *RegistrationBuilder) WithDelegateRoles(roles ...IdentityType) *RegistrationBuilder {
+	return b.add(DelegateRoles(roles...))
+}
+
+func (b *RegistrationBuilder) WithRegistrarAttributes(names ...string) *RegistrationBuilder {
+	return b.add(RegistrarAttributes(names...))
+}
+
+func (b *RegistrationBuilder) WithRevoker(allowed bool) *RegistrationBuilder {
+	return b.add(Revoker(allowed), nil)
+}
+
+func (b *RegistrationBuilder) WithGenCRL(allowed bool) *RegistrationBuilder {
+	return b.add(GenCRL(allowed), nil)
+}
+
+func (b *RegistrationBuilder) WithIntermediateCA(allowed bool) *RegistrationBuilder {
+	return b.add(IntermediateCA(allowed), nil)
+}
+
+func (b *RegistrationBuilder) WithAffiliationMgr(allowed bool) *RegistrationBuilder {
+	return b.add(AffiliationMgr(allowed), nil)
+}
+
+func (b *RegistrationBuilder) add(attr Attribute, err error) *RegistrationBuilder {
+	if err != nil {
+		b.errs = append(b.errs, err)
+		return b
+	}
+	b.reg.Attrs = append(b.reg.Attrs, attr)
+	return b
+}
+
+// Build returns validated registration
+func (b *RegistrationBuilder) Build() (Registration, error) {
+	if err := errors.Join(b.errs...); err != nil {
+		return Registration{}, fmt.Errorf(`build registration: %w`, err)
+	}
+	if err := b.reg.Validate(); err != nil {
+		return Registration{}, err
+	}
+	return b.reg, nil
+}
@@ -1,5 +1,7 @@
 package request
 
+import "time"
+
 type (
 	// Registration holds all data needed for new registration of new user in Certificate Authority
 	Registration struct {
@@ -111,6 +113,19 @@ type (
 		GenCRL bool `def:"false" skip:"true" json:"gencrl,omitempty"`
 	}
 
+	// GenCRLRequest is a request to generate CRL. Zero times are not used as filters.
+	// A GenCRLRequest can only be performed by a user with the "hf.GenCRL" attribute.
+	GenCRLRequest struct {
+		// CAName is the name of the CA to connect to
+		CAName string `json:"caname,omitempty"`
+		// RevokedAfter and RevokedBefore limit certificates included to CRL by revocation time
+		RevokedAfter  time.Time `json:"revokedafter"`
+		RevokedBefore time.Time `json:"revokedbefore"`
+		// ExpireAfter and ExpireBefore limit certificates included to CRL by expiration time
+		ExpireAfter  time.Time `json:"expireafter"`
+		ExpireBefore time.Time `json:"expirebefore"`
+	}
+
 	AddAffiliationRequest struct {
 		Name string `json:"name"`
 	}
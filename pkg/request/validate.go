@@ -0,0 +1,44 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Validate checks registration before it is sent to CA: name is required, reserved attributes must be spelled
+// correctly and have valid values, attributes must not repeat and affiliation must not contain empty parts
+func (r Registration) Validate() error {
+	var errs []error
+
+	if r.Name == `` {
+		errs = append(errs, fmt.Errorf(`name is empty`))
+	}
+	if r.MaxEnrollments < -1 {
+		errs = append(errs, fmt.Errorf(`max enrollments must be -1 (unlimited) or greater`))
+	}
+	if r.Affiliation != `` {
+		for _, part := range strings.Split(r.Affiliation, `.`) {
+			if part == `` {
+				errs = append(errs, fmt.Errorf(`affiliation %q contains empty part`, r.Affiliation))
+				break
+			}
+		}
+	}
+
+	seen := make(map[string]bool, len(r.Attrs))
+	for _, a := range r.Attrs {
+		if seen[a.Name] {
+			errs = append(errs, fmt.Errorf(`attribute %s is defined twice`, a.Name))
+		}
+		seen[a.Name] = true
+		if err := validateAttribute(a); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf(`invalid registration: %w`, err)
+	}
+	return nil
+}
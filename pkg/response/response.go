@@ -49,7 +49,13 @@ type (
 
 	Revoke struct {
 		RevokedCerts []entity.RevokedCert
-		CRL          []byte
+		// CRL is PEM encoded CRL, it is returned if revocation request has GenCRL flag
+		CRL []byte
+	}
+
+	GenCRL struct {
+		// CRL is PEM encoded CRL
+		CRL []byte
 	}
 
 	AffiliationList struct {
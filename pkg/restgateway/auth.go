@@ -0,0 +1,68 @@
+package restgateway
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hlfans/ca-sdk/pkg/abac"
+)
+
+var (
+	// ErrNoCredentials is returned by authenticator when request has no credentials of its kind,
+	// so the next authenticator is tried
+	ErrNoCredentials = errors.New(`no credentials`)
+	// ErrUnauthorized is returned when credentials are present but invalid
+	ErrUnauthorized = errors.New(`unauthorized`)
+)
+
+// Authenticator identifies caller of gateway request. Policies and quotas are applied to returned identity
+type Authenticator interface {
+	Authenticate(r *http.Request) (*abac.Identity, error)
+}
+
+type AuthenticatorFunc func(r *http.Request) (*abac.Identity, error)
+
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (*abac.Identity, error) {
+	return f(r)
+}
+
+// APIKeys authenticates callers by `Authorization: Bearer <key>` or `X-API-Key: <key>` header.
+// Keys are kept only as SHA-256 hashes
+func APIKeys(keys map[string]*abac.Identity) Authenticator {
+	hashed := make(map[[sha256.Size]byte]*abac.Identity, len(keys))
+	for key, identity := range keys {
+		hashed[sha256.Sum256([]byte(key))] = identity
+	}
+	return AuthenticatorFunc(func(r *http.Request) (*abac.Identity, error) {
+		key := r.Header.Get(`X-API-Key`)
+		if scheme, token, ok := strings.Cut(r.Header.Get(`Authorization`), ` `); ok && strings.EqualFold(scheme, `Bearer`) {
+			key = token
+		}
+		if key == `` {
+			return nil, ErrNoCredentials
+		}
+		identity, ok := hashed[sha256.Sum256([]byte(key))]
+		if !ok {
+			return nil, fmt.Errorf(`%w: unknown API key`, ErrUnauthorized)
+		}
+		return identity, nil
+	})
+}
+
+// TLSClientCert authenticates callers by TLS client certificate verified by server TLS config
+// (tls.RequireAndVerifyClientCert or tls.VerifyClientCertIfGiven). Identity is read from ECert attributes
+func TLSClientCert() Authenticator {
+	return AuthenticatorFunc(func(r *http.Request) (*abac.Identity, error) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			return nil, ErrNoCredentials
+		}
+		identity, err := abac.FromCertificate(r.TLS.VerifiedChains[0][0])
+		if err != nil {
+			return nil, fmt.Errorf(`%w: %s`, ErrUnauthorized, err)
+		}
+		return identity, nil
+	})
+}
@@ -0,0 +1,206 @@
+// Package restgateway exposes simplified JSON API over Client for teams which can't use Go SDK. Gateway holds
+// registrar identity, so callers don't deal with Fabric CA authorization tokens. Callers are authenticated
+// by API keys or TLS client certificates, every operation is guarded by abac policy and per-caller quota.
+package restgateway
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hlfans/ca-sdk/pkg/abac"
+	"github.com/hlfans/ca-sdk/pkg/client"
+	"github.com/hlfans/ca-sdk/pkg/registrar"
+)
+
+var (
+	// ErrForbidden is returned when caller isn't allowed to perform operation
+	ErrForbidden = errors.New(`forbidden`)
+
+	errBadRequest         = errors.New(`bad request`)
+	errNotFound           = errors.New(`not found`)
+	errQuotaExceeded      = errors.New(`quota exceeded`)
+	errEnrollmentRejected = errors.New(`enrollment rejected`)
+)
+
+type Opt func(g *Gateway) error
+
+// WithAuthenticators sets authenticators tried in order. Default is TLSClientCert
+func WithAuthenticators(authenticators ...Authenticator) Opt {
+	return func(g *Gateway) error {
+		g.authenticators = authenticators
+		return nil
+	}
+}
+
+// WithPolicy allows operation to callers satisfying policy, nil policy allows operation to any authenticated caller.
+// Operations without policy are denied
+func WithPolicy(op client.Operation, policy *abac.Policy) Opt {
+	return func(g *Gateway) error {
+		g.policies[op] = policy
+		return nil
+	}
+}
+
+// WithQuota limits requests of every caller to operation
+func WithQuota(op client.Operation, quota Quota) Opt {
+	return func(g *Gateway) error {
+		if quota.Requests < 1 || quota.Per <= 0 {
+			return fmt.Errorf(`quota of %s must allow at least one request per positive period`, op)
+		}
+		g.quotas.limits[op] = quota
+		return nil
+	}
+}
+
+// WithAffiliationScope limits callers to identities of their own affiliation subtree: registration,
+// identity lookups, certificate listing and revocation by enrollment id. Revocation by serial is denied,
+// because owner of certificate can't be checked. Callers without affiliation are not limited
+func WithAffiliationScope() Opt {
+	return func(g *Gateway) error {
+		g.affiliationScope = true
+		return nil
+	}
+}
+
+func WithLogger(logger *slog.Logger) Opt {
+	return func(g *Gateway) error {
+		g.logger = logger
+		return nil
+	}
+}
+
+// WithClock overrides current time used by quotas
+func WithClock(now func() time.Time) Opt {
+	return func(g *Gateway) error {
+		g.quotas.now = now
+		return nil
+	}
+}
+
+// Gateway serves JSON API over Client
+type Gateway struct {
+	cli              client.Client
+	authenticators   []Authenticator
+	policies         map[client.Operation]*abac.Policy
+	quotas           *quotas
+	affiliationScope bool
+	logger           *slog.Logger
+	chainPEM         []byte
+}
+
+// New creates gateway. cli must act as registrar identity, wrap it with registrar.NewCheckedClient to report
+// delegation rule violations as bad requests
+func New(ctx context.Context, cli client.Client, opts ...Opt) (*Gateway, error) {
+	g := &Gateway{
+		cli:            cli,
+		authenticators: []Authenticator{TLSClientCert()},
+		policies:       map[client.Operation]*abac.Policy{},
+		quotas:         &quotas{limits: map[client.Operation]Quota{}, now: time.Now, windows: map[quotaKey]*quotaWindow{}},
+		logger:         slog.Default(),
+	}
+	for _, opt := range opts {
+		if err := opt(g); err != nil {
+			return nil, fmt.Errorf(`apply gateway option: %w`, err)
+		}
+	}
+
+	info, err := cli.CAInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf(`get CA info: %w`, err)
+	}
+	if g.chainPEM, err = base64.StdEncoding.DecodeString(info.CAChain); err != nil {
+		return nil, fmt.Errorf(`decode CA chain: %w`, err)
+	}
+	return g, nil
+}
+
+// authorize authenticates caller and applies policy and quota of operation
+func (g *Gateway) authorize(w http.ResponseWriter, r *http.Request, op client.Operation) (*abac.Identity, error) {
+	var caller *abac.Identity
+	for _, a := range g.authenticators {
+		identity, err := a.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		caller = identity
+		break
+	}
+	if caller == nil {
+		return nil, ErrUnauthorized
+	}
+
+	policy, ok := g.policies[op]
+	if !ok {
+		return nil, fmt.Errorf(`%w: operation %s is disabled`, ErrForbidden, op)
+	}
+	if policy != nil {
+		if err := policy.Authorize(caller); err != nil {
+			return nil, fmt.Errorf(`%w: %s`, ErrForbidden, err)
+		}
+	}
+
+	if wait, ok := g.quotas.take(caller.EnrollmentID, op); !ok {
+		w.Header().Set(`Retry-After`, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		return nil, errQuotaExceeded
+	}
+	return caller, nil
+}
+
+// inScope reports whether affiliation is in affiliation subtree of caller
+func (g *Gateway) inScope(caller *abac.Identity, affiliation string) bool {
+	if !g.affiliationScope || caller.Affiliation == `` {
+		return true
+	}
+	return affiliation == caller.Affiliation || strings.HasPrefix(affiliation, caller.Affiliation+`.`)
+}
+
+// checkScope checks that identity is in affiliation subtree of caller
+func (g *Gateway) checkScope(ctx context.Context, caller *abac.Identity, name string) error {
+	if !g.affiliationScope || caller.Affiliation == `` {
+		return nil
+	}
+	identity, err := g.cli.IdentityGet(ctx, name)
+	if err != nil {
+		return err
+	}
+	if !g.inScope(caller, identity.Affiliation) {
+		// the same error as for missing identity, so callers can't probe other affiliations
+		return fmt.Errorf(`%w: identity %s`, errNotFound, name)
+	}
+	return nil
+}
+
+// status maps error of gateway or CA to HTTP status
+func status(err error) int {
+	switch {
+	case errors.Is(err, ErrUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrForbidden), errors.Is(err, client.ErrAuthorizationFailure),
+		errors.Is(err, client.ErrUnauthorizedRegistrar), errors.Is(err, client.ErrRevoked),
+		errors.Is(err, client.ErrMaxEnrollmentsReached):
+		return http.StatusForbidden
+	case errors.Is(err, errQuotaExceeded):
+		return http.StatusTooManyRequests
+	case errors.Is(err, errNotFound), errors.Is(err, client.ErrIdentityNotFound), errors.Is(err, client.ErrCertificateNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, client.ErrAlreadyRegistered):
+		return http.StatusConflict
+	case errors.Is(err, errBadRequest), errors.Is(err, registrar.ErrPreflight), errors.Is(err, client.ErrBadRequest),
+		errors.Is(err, client.ErrAffiliationNotFound):
+		return http.StatusBadRequest
+	case errors.Is(err, errEnrollmentRejected):
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusBadGateway
+}
@@ -0,0 +1,363 @@
+package restgateway
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hlfans/ca-sdk/pkg/abac"
+	"github.com/hlfans/ca-sdk/pkg/client"
+	"github.com/hlfans/ca-sdk/pkg/entity"
+	"github.com/hlfans/ca-sdk/pkg/request"
+)
+
+const (
+	// OpenAPIPath serves OpenAPI document of gateway, it doesn't require authentication
+	OpenAPIPath = `/v1/openapi.json`
+
+	maxRequestSize = 64 << 10
+)
+
+type (
+	RegisterResponse struct {
+		// Secret is enrollment secret of registered identity
+		Secret string `json:"secret"`
+	}
+
+	EnrollRequest struct {
+		EnrollmentID string `json:"enrollment_id"`
+		Secret       string `json:"secret"`
+		// CSR is PEM encoded certificate request, private key never leaves caller
+		CSR string `json:"csr"`
+		// Profile is Fabric CA signing profile, for example tls
+		Profile string `json:"profile,omitempty"`
+	}
+
+	EnrollResponse struct {
+		// Certificate is PEM encoded issued certificate
+		Certificate string `json:"certificate"`
+		// Chain is PEM encoded CA chain
+		Chain string `json:"chain"`
+	}
+
+	RevokeResponse struct {
+		// CRL is PEM encoded CRL, returned if gencrl is set
+		CRL string `json:"crl,omitempty"`
+	}
+
+	IdentityList struct {
+		Identities []entity.Identity `json:"identities"`
+	}
+
+	Certificate struct {
+		Serial    string    `json:"serial"`
+		AKI       string    `json:"aki"`
+		Subject   string    `json:"subject"`
+		NotBefore time.Time `json:"not_before"`
+		NotAfter  time.Time `json:"not_after"`
+		PEM       string    `json:"pem"`
+	}
+
+	CertificateList struct {
+		Certificates []Certificate `json:"certificates"`
+	}
+
+	Error struct {
+		Error string `json:"error"`
+	}
+)
+
+type param struct {
+	name, in, description, typ string
+}
+
+// route describes gateway operation, the same table serves requests and produces OpenAPI document
+type route struct {
+	method, path string
+	op           client.Operation
+	summary      string
+	params       []param
+	request      reflect.Type
+	response     reflect.Type
+	status       int
+	handle       func(r *http.Request, caller *abac.Identity) (interface{}, error)
+}
+
+func (g *Gateway) routes() []route {
+	return []route{{
+		method: http.MethodPost, path: `/v1/identities`, op: client.OperationRegister,
+		summary: `Register identity`, status: http.StatusCreated,
+		request: reflect.TypeOf(request.Registration{}), response: reflect.TypeOf(RegisterResponse{}),
+		handle: g.register,
+	}, {
+		method: http.MethodGet, path: `/v1/identities`, op: client.OperationIdentityList,
+		summary: `List identities`, status: http.StatusOK,
+		response: reflect.TypeOf(IdentityList{}),
+		handle:   g.identityList,
+	}, {
+		method: http.MethodGet, path: `/v1/identities/{id}`, op: client.OperationIdentityGet,
+		summary: `Get identity`, status: http.StatusOK,
+		params:   []param{{`id`, `path`, `Enrollment id`, `string`}},
+		response: reflect.TypeOf(entity.Identity{}),
+		handle:   g.identityGet,
+	}, {
+		method: http.MethodPost, path: `/v1/enroll`, op: client.OperationEnroll,
+		summary: `Enroll identity with certificate request`, status: http.StatusCreated,
+		request: reflect.TypeOf(EnrollRequest{}), response: reflect.TypeOf(EnrollResponse{}),
+		handle: g.enroll,
+	}, {
+		method: http.MethodPost, path: `/v1/revoke`, op: client.OperationRevoke,
+		summary: `Revoke certificate or all certificates of identity`, status: http.StatusOK,
+		request: reflect.TypeOf(request.RevocationRequest{}), response: reflect.TypeOf(RevokeResponse{}),
+		handle: g.revoke,
+	}, {
+		method: http.MethodGet, path: `/v1/certificates`, op: client.OperationCertificateList,
+		summary: `List certificates`, status: http.StatusOK,
+		params: []param{
+			{`id`, `query`, `Enrollment id of certificates owner`, `string`},
+			{`revoked`, `query`, `Only revoked (true) or not revoked (false) certificates`, `boolean`},
+			{`expired`, `query`, `Only expired (true) or not expired (false) certificates`, `boolean`},
+		},
+		response: reflect.TypeOf(CertificateList{}),
+		handle:   g.certificateList,
+	}}
+}
+
+// Handler returns HTTP handler of gateway API and OpenAPI document
+func (g *Gateway) Handler() http.Handler {
+	mux := http.NewServeMux()
+	for _, rt := range g.routes() {
+		mux.HandleFunc(rt.method+` `+rt.path, g.serve(rt))
+	}
+	mux.HandleFunc(`GET `+OpenAPIPath, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, g.OpenAPI())
+	})
+	return mux
+}
+
+func (g *Gateway) serve(rt route) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		caller, err := g.authorize(w, r, rt.op)
+		if err != nil {
+			g.writeError(w, r, rt.op, err)
+			return
+		}
+		result, err := rt.handle(r, caller)
+		if err != nil {
+			g.writeError(w, r, rt.op, err)
+			return
+		}
+		if rt.method != http.MethodGet {
+			g.logger.InfoContext(r.Context(), `gateway operation`, slog.String(`operation`, string(rt.op)),
+				slog.String(`caller`, caller.EnrollmentID))
+		}
+		writeJSON(w, rt.status, result)
+	}
+}
+
+func (g *Gateway) register(r *http.Request, caller *abac.Identity) (interface{}, error) {
+	var req request.Registration
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	if err := req.Validate(); err != nil {
+		return nil, fmt.Errorf(`%w: %s`, errBadRequest, err)
+	}
+	for _, a := range req.Attrs {
+		// privileged registrations are left to CA administrators
+		if strings.HasPrefix(a.Name, `hf.`) {
+			return nil, fmt.Errorf(`%w: attribute %s can't be registered through gateway`, ErrForbidden, a.Name)
+		}
+	}
+	if req.Affiliation == `` && g.affiliationScope {
+		req.Affiliation = caller.Affiliation
+	}
+	if !g.inScope(caller, req.Affiliation) {
+		return nil, fmt.Errorf(`%w: affiliation %s is out of caller scope`, ErrForbidden, req.Affiliation)
+	}
+
+	secret, err := g.cli.Register(r.Context(), req)
+	if err != nil {
+		return nil, err
+	}
+	return RegisterResponse{Secret: secret}, nil
+}
+
+func (g *Gateway) identityList(r *http.Request, caller *abac.Identity) (interface{}, error) {
+	identities, err := g.cli.IdentityList(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	list := IdentityList{Identities: []entity.Identity{}}
+	for _, identity := range identities {
+		if g.inScope(caller, identity.Affiliation) {
+			list.Identities = append(list.Identities, identity)
+		}
+	}
+	return list, nil
+}
+
+func (g *Gateway) identityGet(r *http.Request, caller *abac.Identity) (interface{}, error) {
+	identity, err := g.cli.IdentityGet(r.Context(), r.PathValue(`id`))
+	if err != nil {
+		return nil, err
+	}
+	if !g.inScope(caller, identity.Affiliation) {
+		return nil, fmt.Errorf(`%w: identity %s`, errNotFound, identity.Id)
+	}
+	return identity, nil
+}
+
+func (g *Gateway) enroll(r *http.Request, _ *abac.Identity) (interface{}, error) {
+	var req EnrollRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	if req.EnrollmentID == `` || req.Secret == `` {
+		return nil, fmt.Errorf(`%w: enrollment_id and secret are required`, errBadRequest)
+	}
+	block, _ := pem.Decode([]byte(req.CSR))
+	if block == nil || block.Type != `CERTIFICATE REQUEST` {
+		return nil, fmt.Errorf(`%w: csr must be PEM encoded certificate request`, errBadRequest)
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err == nil {
+		err = csr.CheckSignature()
+	}
+	if err != nil {
+		return nil, fmt.Errorf(`%w: csr: %s`, errBadRequest, err)
+	}
+
+	cert, _, err := g.cli.Enroll(r.Context(), req.EnrollmentID, req.Secret, csr,
+		client.WithEnrollProfile(client.EnrollProfile(req.Profile)))
+	if errors.Is(err, client.ErrAuthenticationFailure) {
+		// caller is authenticated by gateway, so CA rejected enrollment secret
+		return nil, fmt.Errorf(`%w: %s`, errEnrollmentRejected, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return EnrollResponse{
+		Certificate: string(pem.EncodeToMemory(&pem.Block{Type: `CERTIFICATE`, Bytes: cert.Raw})),
+		Chain:       string(g.chainPEM),
+	}, nil
+}
+
+func (g *Gateway) revoke(r *http.Request, caller *abac.Identity) (interface{}, error) {
+	var req request.RevocationRequest
+	if err := decode(r, &req); err != nil {
+		return nil, err
+	}
+	switch {
+	case req.Name != ``:
+		if err := g.checkScope(r.Context(), caller, req.Name); err != nil {
+			return nil, err
+		}
+	case req.Serial != `` && req.AKI != ``:
+		if g.affiliationScope && caller.Affiliation != `` {
+			return nil, fmt.Errorf(`%w: revocation by serial is not allowed in affiliation scope`, ErrForbidden)
+		}
+	default:
+		return nil, fmt.Errorf(`%w: either id or serial and aki are required`, errBadRequest)
+	}
+
+	crl, err := g.cli.Revoke(r.Context(), req)
+	if err != nil {
+		return nil, err
+	}
+	var resp RevokeResponse
+	if crl != nil {
+		der, err := asn1.Marshal(*crl)
+		if err != nil {
+			return nil, fmt.Errorf(`encode CRL: %w`, err)
+		}
+		resp.CRL = string(pem.EncodeToMemory(&pem.Block{Type: `X509 CRL`, Bytes: der}))
+	}
+	return resp, nil
+}
+
+func (g *Gateway) certificateList(r *http.Request, caller *abac.Identity) (interface{}, error) {
+	query := r.URL.Query()
+	var opts []client.CertificateListOpt
+
+	id := query.Get(`id`)
+	if id != `` {
+		if err := g.checkScope(r.Context(), caller, id); err != nil {
+			return nil, err
+		}
+		opts = append(opts, client.WithEnrollId(id))
+	} else if g.affiliationScope && caller.Affiliation != `` {
+		return nil, fmt.Errorf(`%w: id is required in affiliation scope`, errBadRequest)
+	}
+	for name, filters := range map[string][2]client.CertificateListOpt{
+		`revoked`: {client.WithRevoked(), client.WithNotRevoked()},
+		`expired`: {client.WithExpired(), client.WithNotExpired()},
+	} {
+		if v := query.Get(name); v != `` {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf(`%w: %s must be boolean`, errBadRequest, name)
+			}
+			if b {
+				opts = append(opts, filters[0])
+			} else {
+				opts = append(opts, filters[1])
+			}
+		}
+	}
+
+	certs, err := g.cli.CertificateList(r.Context(), opts...)
+	if err != nil {
+		return nil, err
+	}
+	list := CertificateList{Certificates: make([]Certificate, len(certs))}
+	for i, cert := range certs {
+		list.Certificates[i] = Certificate{
+			Serial:    fmt.Sprintf(`%x`, cert.SerialNumber),
+			AKI:       fmt.Sprintf(`%x`, cert.AuthorityKeyId),
+			Subject:   cert.Subject.String(),
+			NotBefore: cert.NotBefore,
+			NotAfter:  cert.NotAfter,
+			PEM:       string(pem.EncodeToMemory(&pem.Block{Type: `CERTIFICATE`, Bytes: cert.Raw})),
+		}
+	}
+	return list, nil
+}
+
+func decode(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxRequestSize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf(`%w: decode request: %s`, errBadRequest, err)
+	}
+	return nil
+}
+
+func (g *Gateway) writeError(w http.ResponseWriter, r *http.Request, op client.Operation, err error) {
+	code := status(err)
+	if code == http.StatusUnauthorized {
+		w.Header().Set(`WWW-Authenticate`, `Bearer`)
+	}
+	if code >= http.StatusInternalServerError {
+		g.logger.ErrorContext(r.Context(), `gateway operation failed`, slog.String(`operation`, string(op)), slog.Any(`error`, err))
+		writeJSON(w, code, Error{Error: `CA request failed`})
+		return
+	}
+	writeJSON(w, code, Error{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set(`Content-Type`, `application/json`)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
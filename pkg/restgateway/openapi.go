@@ -0,0 +1,141 @@
+package restgateway
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// openAPIVersion is 3.1, because mutualTLS security scheme isn't defined in 3.0
+const openAPIVersion = `3.1.0`
+
+// OpenAPI returns OpenAPI document of gateway. Schemas are generated from request and response types
+func (g *Gateway) OpenAPI() map[string]interface{} {
+	schemas := map[string]interface{}{}
+	errorRef := schemaRef(reflect.TypeOf(Error{}), schemas)
+
+	paths := map[string]map[string]interface{}{}
+	for _, rt := range g.routes() {
+		responses := map[string]interface{}{
+			strconv.Itoa(rt.status): map[string]interface{}{
+				`description`: http.StatusText(rt.status),
+				`content`:     jsonContent(schemaRef(rt.response, schemas)),
+			},
+		}
+		for _, code := range []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden,
+			http.StatusNotFound, http.StatusTooManyRequests, http.StatusBadGateway} {
+			responses[strconv.Itoa(code)] = map[string]interface{}{
+				`description`: http.StatusText(code),
+				`content`:     jsonContent(errorRef),
+			}
+		}
+
+		operation := map[string]interface{}{
+			`operationId`: lowerFirst(string(rt.op)),
+			`summary`:     rt.summary,
+			`responses`:   responses,
+		}
+		if len(rt.params) > 0 {
+			params := make([]interface{}, len(rt.params))
+			for i, p := range rt.params {
+				params[i] = map[string]interface{}{
+					`name`:        p.name,
+					`in`:          p.in,
+					`description`: p.description,
+					`required`:    p.in == `path`,
+					`schema`:      map[string]interface{}{`type`: p.typ},
+				}
+			}
+			operation[`parameters`] = params
+		}
+		if rt.request != nil {
+			operation[`requestBody`] = map[string]interface{}{
+				`required`: true,
+				`content`:  jsonContent(schemaRef(rt.request, schemas)),
+			}
+		}
+
+		if paths[rt.path] == nil {
+			paths[rt.path] = map[string]interface{}{}
+		}
+		paths[rt.path][strings.ToLower(rt.method)] = operation
+	}
+
+	return map[string]interface{}{
+		`openapi`: openAPIVersion,
+		`info`: map[string]interface{}{
+			`title`:   `Fabric CA gateway`,
+			`version`: `1`,
+		},
+		`paths`: paths,
+		`components`: map[string]interface{}{
+			`schemas`: schemas,
+			`securitySchemes`: map[string]interface{}{
+				`apiKey`:       map[string]interface{}{`type`: `http`, `scheme`: `bearer`},
+				`apiKeyHeader`: map[string]interface{}{`type`: `apiKey`, `in`: `header`, `name`: `X-API-Key`},
+				`mutualTLS`:    map[string]interface{}{`type`: `mutualTLS`},
+			},
+		},
+		`security`: []interface{}{
+			map[string]interface{}{`apiKey`: []string{}},
+			map[string]interface{}{`apiKeyHeader`: []string{}},
+			map[string]interface{}{`mutualTLS`: []string{}},
+		},
+	}
+}
+
+func jsonContent(schema interface{}) map[string]interface{} {
+	return map[string]interface{}{`application/json`: map[string]interface{}{`schema`: schema}}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaRef returns schema of type, named structs are added to schemas and referenced
+func schemaRef(t reflect.Type, schemas map[string]interface{}) interface{} {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{`type`: `string`, `format`: `date-time`}
+	case t.Kind() == reflect.Ptr:
+		return schemaRef(t.Elem(), schemas)
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		return map[string]interface{}{`type`: `string`, `contentEncoding`: `base64`}
+	case t.Kind() == reflect.Slice:
+		return map[string]interface{}{`type`: `array`, `items`: schemaRef(t.Elem(), schemas)}
+	case t.Kind() == reflect.Bool:
+		return map[string]interface{}{`type`: `boolean`}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return map[string]interface{}{`type`: `integer`}
+	case t.Kind() == reflect.String:
+		return map[string]interface{}{`type`: `string`}
+	case t.Kind() != reflect.Struct:
+		return map[string]interface{}{}
+	}
+
+	if _, ok := schemas[t.Name()]; !ok {
+		// placeholder breaks recursion of self-referencing types
+		schemas[t.Name()] = nil
+		properties := map[string]interface{}{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get(`json`), `,`)
+			if !field.IsExported() || name == `-` {
+				continue
+			}
+			if name == `` {
+				name = field.Name
+			}
+			properties[name] = schemaRef(field.Type, schemas)
+		}
+		schemas[t.Name()] = map[string]interface{}{`type`: `object`, `properties`: properties}
+	}
+	return map[string]interface{}{`$ref`: `#/components/schemas/` + t.Name()}
+}
+
+func lowerFirst(s string) string {
+	if s == `` {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
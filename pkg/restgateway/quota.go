@@ -0,0 +1,62 @@
+package restgateway
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hlfans/ca-sdk/pkg/client"
+)
+
+// Quota limits number of requests of one caller to one operation within fixed window
+type Quota struct {
+	Requests int
+	Per      time.Duration
+}
+
+type quotaKey struct {
+	caller string
+	op     client.Operation
+}
+
+type quotaWindow struct {
+	start time.Time
+	count int
+}
+
+type quotas struct {
+	limits map[client.Operation]Quota
+	now    func() time.Time
+
+	mu      sync.Mutex
+	windows map[quotaKey]*quotaWindow
+}
+
+// take counts request of caller and returns time to wait when quota is exhausted
+func (q *quotas) take(caller string, op client.Operation) (time.Duration, bool) {
+	limit, ok := q.limits[op]
+	if !ok {
+		return 0, true
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := q.now()
+	key := quotaKey{caller: caller, op: op}
+	w, ok := q.windows[key]
+	if !ok || now.Sub(w.start) >= limit.Per {
+		// drop expired windows of other callers, so map doesn't grow with callers seen once
+		for k, other := range q.windows {
+			if now.Sub(other.start) >= q.limits[k.op].Per {
+				delete(q.windows, k)
+			}
+		}
+		w = &quotaWindow{start: now}
+		q.windows[key] = w
+	}
+	if w.count >= limit.Requests {
+		return w.start.Add(limit.Per).Sub(now), false
+	}
+	w.count++
+	return 0, true
+}
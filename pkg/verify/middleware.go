@@ -0,0 +1,41 @@
+package verify
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/hlfans/ca-sdk/pkg/auth"
+	"github.com/hlfans/ca-sdk/pkg/client"
+)
+
+type resultKey struct{}
+
+// ResultFromContext returns verification result of TLS client certificate
+func ResultFromContext(ctx context.Context) (*Result, bool) {
+	result, ok := ctx.Value(resultKey{}).(*Result)
+	return result, ok
+}
+
+// Middleware verifies TLS client certificate of every request. Requests without valid certificate are rejected
+// with Fabric CA style error response, result is available for next handler with ResultFromContext
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+			auth.WriteError(w, http.StatusUnauthorized, client.CodeAuthenticationFailure, `No client certificate`)
+			return
+		}
+
+		result, err := v.Verify(r.Context(), r.TLS.PeerCertificates[0], r.TLS.PeerCertificates[1:]...)
+		if err != nil {
+			auth.WriteError(w, http.StatusServiceUnavailable, client.CodeUnknown, `Certificate verification failed: `+err.Error())
+			return
+		}
+		if !result.Valid() {
+			auth.WriteError(w, http.StatusUnauthorized, client.CodeAuthenticationFailure,
+				`Client certificate is `+string(result.Status))
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), resultKey{}, result)))
+	})
+}
@@ -0,0 +1,275 @@
+// Package verify checks that certificates chain to the CA and are not revoked according to CA CRL
+package verify
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hlfans/ca-sdk/pkg/client"
+	"github.com/hlfans/ca-sdk/pkg/request"
+)
+
+const defaultCRLMaxAge = 5 * time.Minute
+
+// Status is the outcome of certificate verification
+type Status string
+
+const (
+	StatusValid         Status = `valid`
+	StatusExpired       Status = `expired`
+	StatusNotYetValid   Status = `not_yet_valid`
+	StatusRevoked       Status = `revoked`
+	StatusUnknownIssuer Status = `unknown_issuer`
+	// StatusInvalid is returned for certificates with wrong usage, constraints or signature
+	StatusInvalid Status = `invalid`
+)
+
+// Result describes verified certificate
+type Result struct {
+	Status Status
+	// Chain is the verified chain from certificate to root, it is set unless issuer is unknown or certificate is invalid
+	Chain []*x509.Certificate
+	// RevokedAt and RevocationReason are set for revoked certificates. Reason is RFC 5280 CRLReason code,
+	// Fabric CA doesn't put reason to CRL, so it is usually 0 (unspecified)
+	RevokedAt        time.Time
+	RevocationReason int
+	// Err explains why certificate is not valid
+	Err error
+}
+
+func (r *Result) Valid() bool {
+	return r.Status == StatusValid
+}
+
+// CRLSource returns current CRL of CA
+type CRLSource func(ctx context.Context) (*x509.RevocationList, error)
+
+// CRLFromClient returns source, which generates CRL with GenCRL. Client identity must have hf.GenCRL attribute
+func CRLFromClient(cli client.Client, req request.GenCRLRequest) CRLSource {
+	return func(ctx context.Context) (*x509.RevocationList, error) {
+		return cli.GenCRL(ctx, req)
+	}
+}
+
+type Opt func(v *Verifier) error
+
+// WithCAChain adds PEM encoded CA chain to trust pool, self-signed certificates become roots
+func WithCAChain(chainPEM []byte) Opt {
+	return func(v *Verifier) error {
+		return v.addChain(chainPEM)
+	}
+}
+
+// WithCRLSource sets CRL source. Without CRL source revocation isn't checked
+func WithCRLSource(source CRLSource) Opt {
+	return func(v *Verifier) error {
+		v.crlSource = source
+		return nil
+	}
+}
+
+// WithCRLMaxAge sets how long CRL is cached. CRL is also refreshed after its NextUpdate. Default is 5m
+func WithCRLMaxAge(maxAge time.Duration) Opt {
+	return func(v *Verifier) error {
+		v.crlMaxAge = maxAge
+		return nil
+	}
+}
+
+// WithKeyUsages sets required extended key usages. Default is any
+func WithKeyUsages(usages ...x509.ExtKeyUsage) Opt {
+	return func(v *Verifier) error {
+		v.keyUsages = usages
+		return nil
+	}
+}
+
+// WithClock overrides current time used for validity checks
+func WithClock(now func() time.Time) Opt {
+	return func(v *Verifier) error {
+		v.now = now
+		return nil
+	}
+}
+
+type revocation struct {
+	at     time.Time
+	reason int
+}
+
+// Verifier verifies certificates against CA chain and cached CRL
+type Verifier struct {
+	roots         *x509.CertPool
+	intermediates *x509.CertPool
+	keyUsages     []x509.ExtKeyUsage
+	now           func() time.Time
+
+	crlSource CRLSource
+	crlMaxAge time.Duration
+
+	mu        sync.Mutex
+	crl       *x509.RevocationList
+	fetchedAt time.Time
+	revoked   map[string]revocation
+}
+
+// New creates verifier. If cli isn't nil, trust pool is built from its CAInfo chain
+// and CRL is generated by cli unless WithCRLSource is used
+func New(ctx context.Context, cli client.Client, opts ...Opt) (*Verifier, error) {
+	v := &Verifier{
+		roots:         x509.NewCertPool(),
+		intermediates: x509.NewCertPool(),
+		keyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		now:           time.Now,
+		crlMaxAge:     defaultCRLMaxAge,
+	}
+
+	if cli != nil {
+		info, err := cli.CAInfo(ctx)
+		if err != nil {
+			return nil, fmt.Errorf(`get CA info: %w`, err)
+		}
+		chainPEM, err := base64.StdEncoding.DecodeString(info.CAChain)
+		if err != nil {
+			return nil, fmt.Errorf(`decode CA chain: %w`, err)
+		}
+		if err = v.addChain(chainPEM); err != nil {
+			return nil, err
+		}
+		v.crlSource = CRLFromClient(cli, request.GenCRLRequest{CAName: info.CAName})
+	}
+
+	for _, opt := range opts {
+		if err := opt(v); err != nil {
+			return nil, fmt.Errorf(`apply verifier option: %w`, err)
+		}
+	}
+	return v, nil
+}
+
+// Verify verifies certificate. Intermediates are used for chain building in addition to CA chain.
+// Error is returned only if verification couldn't be completed, for example CRL is unavailable
+func (v *Verifier) Verify(ctx context.Context, cert *x509.Certificate, intermediates ...*x509.Certificate) (*Result, error) {
+	now := v.now()
+	pool := v.intermediates
+	if len(intermediates) > 0 {
+		pool = v.intermediates.Clone()
+		for _, c := range intermediates {
+			pool.AddCert(c)
+		}
+	}
+
+	chains, err := cert.Verify(x509.VerifyOptions{
+		Roots:         v.roots,
+		Intermediates: pool,
+		CurrentTime:   now,
+		KeyUsages:     v.keyUsages,
+	})
+	if err != nil {
+		return v.failure(cert, now, err), nil
+	}
+
+	result := &Result{Status: StatusValid, Chain: chains[0]}
+	if v.crlSource == nil {
+		return result, nil
+	}
+
+	revoked, err := v.revocations(ctx, result.Chain)
+	if err != nil {
+		return nil, err
+	}
+	if r, ok := revoked[string(cert.SerialNumber.Bytes())]; ok {
+		result.Status, result.RevokedAt, result.RevocationReason = StatusRevoked, r.at, r.reason
+		result.Err = fmt.Errorf(`certificate %x revoked at %s`, cert.SerialNumber, r.at.Format(time.RFC3339))
+	}
+	return result, nil
+}
+
+// Refresh drops cached CRL, next verification fetches it again
+func (v *Verifier) Refresh() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.crl, v.revoked = nil, nil
+}
+
+func (v *Verifier) failure(cert *x509.Certificate, now time.Time, err error) *Result {
+	var (
+		invalidErr x509.CertificateInvalidError
+		unknownErr x509.UnknownAuthorityError
+		status     = StatusInvalid
+	)
+	switch {
+	case errors.As(err, &unknownErr):
+		status = StatusUnknownIssuer
+	case errors.As(err, &invalidErr) && invalidErr.Reason == x509.Expired:
+		status = StatusExpired
+		if now.Before(cert.NotBefore) {
+			status = StatusNotYetValid
+		}
+	}
+	return &Result{Status: status, Err: err}
+}
+
+// revocations returns revoked serials from cached CRL, refreshing it if needed
+func (v *Verifier) revocations(ctx context.Context, chain []*x509.Certificate) (map[string]revocation, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	now := v.now()
+	if v.crl != nil && now.Sub(v.fetchedAt) < v.crlMaxAge &&
+		(v.crl.NextUpdate.IsZero() || now.Before(v.crl.NextUpdate)) {
+		return v.revoked, nil
+	}
+
+	crl, err := v.crlSource(ctx)
+	if err != nil {
+		return nil, fmt.Errorf(`get CRL: %w`, err)
+	}
+
+	// CRL must be signed by certificate issuer
+	issuer := chain[len(chain)-1]
+	if len(chain) > 1 {
+		issuer = chain[1]
+	}
+	if err = crl.CheckSignatureFrom(issuer); err != nil {
+		return nil, fmt.Errorf(`check CRL signature: %w`, err)
+	}
+
+	revoked := make(map[string]revocation, len(crl.RevokedCertificateEntries))
+	for _, e := range crl.RevokedCertificateEntries {
+		revoked[string(e.SerialNumber.Bytes())] = revocation{at: e.RevocationTime, reason: e.ReasonCode}
+	}
+	v.crl, v.revoked, v.fetchedAt = crl, revoked, now
+	return revoked, nil
+}
+
+func (v *Verifier) addChain(chainPEM []byte) error {
+	found := false
+	for rest := chainPEM; ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return fmt.Errorf(`parse CA certificate: %w`, err)
+		}
+		if bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil {
+			v.roots.AddCert(cert)
+		} else {
+			v.intermediates.AddCert(cert)
+		}
+		found = true
+	}
+	if !found {
+		return fmt.Errorf(`no certificates found in CA chain`)
+	}
+	return nil
+}
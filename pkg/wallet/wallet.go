@@ -0,0 +1,173 @@
+// Package wallet stores enrolled identities in the file wallet format of Fabric SDKs and Fabric Gateway:
+// one `<label>.id` JSON file per identity.
+package wallet
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	fileExt = `.id`
+
+	typeX509    = `X.509`
+	versionX509 = 1
+)
+
+var ErrNotFound = errors.New(`identity not found in wallet`)
+
+// Identity is X.509 identity of wallet
+type Identity struct {
+	MSPID string
+	// Certificate and PrivateKey are PEM encoded, private key is PKCS#8
+	Certificate []byte
+	PrivateKey  []byte
+}
+
+// NewIdentity creates identity from certificate and private key returned by Client.Enroll
+func NewIdentity(mspID string, cert *x509.Certificate, key interface{}) (*Identity, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf(`marshal private key: %w`, err)
+	}
+	return &Identity{
+		MSPID:       mspID,
+		Certificate: pem.EncodeToMemory(&pem.Block{Type: `CERTIFICATE`, Bytes: cert.Raw}),
+		PrivateKey:  pem.EncodeToMemory(&pem.Block{Type: `PRIVATE KEY`, Bytes: der}),
+	}, nil
+}
+
+type Wallet interface {
+	Put(label string, identity *Identity) error
+	Get(label string) (*Identity, error)
+	List() ([]string, error)
+	Remove(label string) error
+}
+
+type fileIdentity struct {
+	Credentials struct {
+		Certificate string `json:"certificate"`
+		PrivateKey  string `json:"privateKey"`
+	} `json:"credentials"`
+	MSPID   string `json:"mspId"`
+	Type    string `json:"type"`
+	Version int    `json:"version"`
+}
+
+// FileWallet keeps identities in directory
+type FileWallet struct {
+	dir string
+}
+
+// NewFileWallet opens wallet directory, creating it if needed
+func NewFileWallet(dir string) (*FileWallet, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf(`create wallet directory: %w`, err)
+	}
+	return &FileWallet{dir: dir}, nil
+}
+
+// Put writes identity atomically, existing identity with the same label is replaced
+func (w *FileWallet) Put(label string, identity *Identity) error {
+	path, err := w.path(label)
+	if err != nil {
+		return err
+	}
+
+	var f fileIdentity
+	f.Credentials.Certificate = string(identity.Certificate)
+	f.Credentials.PrivateKey = string(identity.PrivateKey)
+	f.MSPID, f.Type, f.Version = identity.MSPID, typeX509, versionX509
+	content, err := json.Marshal(f)
+	if err != nil {
+		return fmt.Errorf(`marshal identity: %w`, err)
+	}
+
+	tmp, err := os.CreateTemp(w.dir, `.`+label+`-*`)
+	if err != nil {
+		return fmt.Errorf(`create identity file: %w`, err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err = tmp.Write(content); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf(`write identity file: %w`, err)
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf(`write identity file: %w`, err)
+	}
+	return nil
+}
+
+func (w *FileWallet) Get(label string) (*Identity, error) {
+	path, err := w.path(label)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf(`%w: %s`, ErrNotFound, label)
+	} else if err != nil {
+		return nil, fmt.Errorf(`read identity file: %w`, err)
+	}
+
+	var f fileIdentity
+	if err = json.Unmarshal(content, &f); err != nil {
+		return nil, fmt.Errorf(`parse identity %s: %w`, label, err)
+	}
+	if f.Type != typeX509 {
+		return nil, fmt.Errorf(`identity %s has unsupported type %s`, label, f.Type)
+	}
+	return &Identity{
+		MSPID:       f.MSPID,
+		Certificate: []byte(f.Credentials.Certificate),
+		PrivateKey:  []byte(f.Credentials.PrivateKey),
+	}, nil
+}
+
+// List returns sorted labels of identities
+func (w *FileWallet) List() ([]string, error) {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return nil, fmt.Errorf(`read wallet directory: %w`, err)
+	}
+	var labels []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), fileExt) {
+			labels = append(labels, strings.TrimSuffix(e.Name(), fileExt))
+		}
+	}
+	sort.Strings(labels)
+	return labels, nil
+}
+
+func (w *FileWallet) Remove(label string) error {
+	path, err := w.path(label)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(path); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf(`%w: %s`, ErrNotFound, label)
+	} else if err != nil {
+		return fmt.Errorf(`remove identity file: %w`, err)
+	}
+	return nil
+}
+
+func (w *FileWallet) path(label string) (string, error) {
+	if label == `` || strings.ContainsAny(label, `/\`) || strings.HasPrefix(label, `.`) {
+		return ``, fmt.Errorf(`invalid wallet label %q`, label)
+	}
+	return filepath.Join(w.dir, label+fileExt), nil
+}
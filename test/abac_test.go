@@ -0,0 +1,143 @@
+package test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hlfans/ca-sdk/pkg/abac"
+	"github.com/hlfans/ca-sdk/pkg/auth"
+	"github.com/hlfans/ca-sdk/pkg/client"
+	"github.com/hlfans/ca-sdk/pkg/config"
+	"github.com/hlfans/ca-sdk/pkg/request"
+	"github.com/hlfans/ca-sdk/pkg/response"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+)
+
+type ABACSuite struct {
+	suite.Suite
+}
+
+func (s *ABACSuite) TestPolicies(t provider.T) {
+	ca := newFakeCA()
+	defer ca.Close()
+	ctx := context.Background()
+	admin := ca.adminClient()
+
+	_, err := admin.Register(ctx, request.Registration{
+		Name: `auditor1`, Type: `admin`, Secret: `pw`, Affiliation: `org1.department1`,
+		Attrs: []request.Attribute{
+			{Name: `role`, Value: `auditor`, ECert: true},
+			{Name: `hf.Registrar.Roles`, Value: `peer,client`, ECert: true},
+			{Name: `hidden`, Value: `x`},
+		},
+	})
+	t.Require().NoError(err)
+	signer := ca.enroll(`auditor1`, `pw`)
+	block, _ := pem.Decode(signer.Certificate())
+	cert, err := x509.ParseCertificate(block.Bytes)
+	t.Require().NoError(err)
+
+	t.WithNewStep("Extract identity", func(sCtx provider.StepCtx) {
+		identity, err := abac.FromCertificate(cert)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(`auditor1`, identity.EnrollmentID)
+		sCtx.Require().Equal(`admin`, identity.Type)
+		sCtx.Require().Equal(`org1.department1`, identity.Affiliation)
+		role, ok := identity.Attr(`role`)
+		sCtx.Require().True(ok)
+		sCtx.Require().Equal(`auditor`, role)
+		_, ok = identity.Attr(`hidden`)
+		sCtx.Require().False(ok)
+	})
+
+	t.WithNewStep("Evaluate policies", func(sCtx provider.StepCtx) {
+		identity, _ := abac.FromCertificate(cert)
+		for expr, allowed := range map[string]bool{
+			`hf.Type == "admin" && role in ["auditor", "operator"]`:                      true,
+			`hf.Type == "admin" && role in ["operator"]`:                                 false,
+			`hf.Registrar.Roles has "peer"`:                                              true,
+			`!(hf.Affiliation == "org2") || missing`:                                     true,
+			`hf.Revoker`:                                                                 false,
+			`hf.Type != "admin" || (role == "auditor" && hf.EnrollmentID == "auditor1")`: true,
+		} {
+			policy, err := abac.Compile(expr)
+			sCtx.Require().NoError(err, expr)
+			sCtx.Require().Equal(allowed, policy.Allowed(identity), expr)
+		}
+
+		for _, expr := range []string{`role ==`, `"admin"`, `role in ["a"`, `(role == "a"`, `role == "a" &&`} {
+			_, err := abac.Compile(expr)
+			sCtx.Require().Error(err, expr)
+		}
+	})
+
+	t.WithNewStep("HTTP middleware", func(sCtx provider.StepCtx) {
+		verifier, err := auth.NewVerifier(newTestSuite(), auth.WithCAChain(ca.chainPEM()))
+		sCtx.Require().NoError(err)
+
+		srv := httptest.NewServer(verifier.Middleware(abac.Middleware(abac.MustCompile(`role == "auditor"`),
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				result, _ := json.Marshal(response.CertificateList{})
+				_ = json.NewEncoder(w).Encode(response.Response{Success: true, Result: result})
+			}))))
+		defer srv.Close()
+
+		for signer, allowed := range map[string]bool{`auditor1`: true, fakeAdminName: false} {
+			secret := `pw`
+			if signer == fakeAdminName {
+				secret = fakeAdminSecret
+			}
+			cli, err := client.NewHttp(client.WithRawConfig(&config.CAConfig{Host: srv.URL}),
+				client.WithIdentity(ca.enroll(signer, secret)))
+			sCtx.Require().NoError(err)
+			_, err = cli.CertificateList(ctx)
+			if allowed {
+				sCtx.Require().NoError(err)
+			} else {
+				var statusErr client.ErrUnexpectedHTTPStatus
+				sCtx.Require().ErrorAs(err, &statusErr)
+				sCtx.Require().Equal(http.StatusForbidden, statusErr.Status)
+			}
+		}
+	})
+}
+
+func (s *ABACSuite) TestTLSClientCertificate(t provider.T) {
+	ca := newFakeCA()
+	defer ca.Close()
+	_, err := ca.adminClient().Register(context.Background(), request.Registration{
+		Name: `auditor1`, Type: `client`, Secret: `pw`, Attrs: []request.Attribute{{Name: `role`, Value: `auditor`, ECert: true}},
+	})
+	t.Require().NoError(err)
+	block, _ := pem.Decode(ca.enroll(`auditor1`, `pw`).Certificate())
+	cert, err := x509.ParseCertificate(block.Bytes)
+	t.Require().NoError(err)
+
+	handler := abac.Middleware(abac.MustCompile(`role == "auditor"`), http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	serve := func(state *tls.ConnectionState) int {
+		r := httptest.NewRequest(http.MethodGet, `/`, nil)
+		r.TLS = state
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// certificate presented with tls.RequestClientCert isn't verified, its attributes can't be trusted
+	t.Require().Equal(http.StatusUnauthorized, serve(&tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}))
+	t.Require().Equal(http.StatusNoContent, serve(&tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert, ca.rootCert}},
+	}))
+}
+
+func TestABAC(t *testing.T) {
+	suite.RunSuite(t, new(ABACSuite))
+}
@@ -0,0 +1,275 @@
+package test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hlfans/ca-sdk/pkg/acmeserver"
+	"github.com/hlfans/ca-sdk/pkg/request"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+	"golang.org/x/crypto/acme"
+)
+
+type ACMESuite struct {
+	suite.Suite
+}
+
+// newACMEClient creates ACME client with fresh account key for server
+func newACMEClient(t provider.T, srv *httptest.Server) *acme.Client {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	t.Require().NoError(err)
+	return &acme.Client{Key: key, DirectoryURL: srv.URL + `/directory`, HTTPClient: srv.Client()}
+}
+
+// newACMECSR creates DER encoded CSR for DNS names with fresh key, the first name is common name
+func newACMECSR(t provider.StepCtx, names ...string) ([]byte, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	t.Require().NoError(err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: names[0]}, DNSNames: names}, key)
+	t.Require().NoError(err)
+	return der, key
+}
+
+func (s *ACMESuite) TestHTTP01(t provider.T) {
+	ca := newFakeCA()
+	defer ca.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// http-01 responder, challenge responses are put here by test
+	var responses sync.Map
+	responder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := responses.Load(r.URL.Path)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(body.(string)))
+	}))
+	defer responder.Close()
+	_, portStr, err := net.SplitHostPort(responder.Listener.Addr().String())
+	t.Require().NoError(err)
+	port, err := strconv.Atoi(portStr)
+	t.Require().NoError(err)
+
+	// challenged domains resolve to responder
+	resolver := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, responder.Listener.Addr().String())
+		},
+	}}
+	server, err := acmeserver.New(ctx, ca.adminClient(),
+		acmeserver.WithHTTP01Port(port), acmeserver.WithHTTPClient(resolver))
+	t.Require().NoError(err)
+	srv := httptest.NewTLSServer(server.Handler())
+	defer srv.Close()
+
+	cli := newACMEClient(t, srv)
+
+	t.WithNewStep("Account is registered once per key", func(sCtx provider.StepCtx) {
+		acc, err := cli.Register(ctx, &acme.Account{Contact: []string{`mailto:ops@example.com`}}, acme.AcceptTOS)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(acme.StatusValid, acc.Status)
+		sCtx.Require().NotEmpty(acc.URI)
+
+		_, err = cli.Register(ctx, &acme.Account{}, acme.AcceptTOS)
+		sCtx.Require().ErrorIs(err, acme.ErrAccountAlreadyExists)
+
+		_, err = newACMEClient(t, srv).GetReg(ctx, ``)
+		sCtx.Require().ErrorIs(err, acme.ErrNoAccount)
+	})
+
+	t.WithNewStep("Certificate is issued after http-01 validation", func(sCtx provider.StepCtx) {
+		order, err := cli.AuthorizeOrder(ctx, acme.DomainIDs(`node.example.test`))
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(acme.StatusPending, order.Status)
+		sCtx.Require().Len(order.AuthzURLs, 1)
+
+		authz, err := cli.GetAuthorization(ctx, order.AuthzURLs[0])
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(`node.example.test`, authz.Identifier.Value)
+		sCtx.Require().Len(authz.Challenges, 1)
+		chal := authz.Challenges[0]
+		sCtx.Require().Equal(`http-01`, chal.Type)
+
+		keyAuth, err := cli.HTTP01ChallengeResponse(chal.Token)
+		sCtx.Require().NoError(err)
+		responses.Store(cli.HTTP01ChallengePath(chal.Token), keyAuth)
+
+		_, err = cli.Accept(ctx, chal)
+		sCtx.Require().NoError(err)
+		_, err = cli.WaitAuthorization(ctx, authz.URI)
+		sCtx.Require().NoError(err)
+		order, err = cli.WaitOrder(ctx, order.URI)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(acme.StatusReady, order.Status)
+
+		csr, key := newACMECSR(sCtx, `node.example.test`)
+		der, certURL, err := cli.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+		sCtx.Require().NoError(err)
+		sCtx.Require().NotEmpty(certURL)
+		sCtx.Require().Len(der, 2)
+
+		cert, err := x509.ParseCertificate(der[0])
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal([]string{`node.example.test`}, cert.DNSNames)
+		sCtx.Require().Contains(cert.ExtKeyUsage, x509.ExtKeyUsageServerAuth)
+		sCtx.Require().True(key.PublicKey.Equal(cert.PublicKey))
+		sCtx.Require().Equal(ca.rootCert.Raw, der[1])
+	})
+
+	t.WithNewStep("Order must be ready and CSR must match its identifiers", func(sCtx provider.StepCtx) {
+		order, err := cli.AuthorizeOrder(ctx, acme.DomainIDs(`node.example.test`))
+		sCtx.Require().NoError(err)
+		csr, _ := newACMECSR(sCtx, `node.example.test`)
+		_, _, err = cli.CreateOrderCert(ctx, order.FinalizeURL, csr, false)
+		var acmeErr *acme.Error
+		sCtx.Require().ErrorAs(err, &acmeErr)
+		sCtx.Require().Equal(`urn:ietf:params:acme:error:orderNotReady`, acmeErr.ProblemType)
+
+		authz, err := cli.GetAuthorization(ctx, order.AuthzURLs[0])
+		sCtx.Require().NoError(err)
+		keyAuth, err := cli.HTTP01ChallengeResponse(authz.Challenges[0].Token)
+		sCtx.Require().NoError(err)
+		responses.Store(cli.HTTP01ChallengePath(authz.Challenges[0].Token), keyAuth)
+		_, err = cli.Accept(ctx, authz.Challenges[0])
+		sCtx.Require().NoError(err)
+		_, err = cli.WaitOrder(ctx, order.URI)
+		sCtx.Require().NoError(err)
+
+		csr, _ = newACMECSR(sCtx, `node.example.test`, `example.com`)
+		_, _, err = cli.CreateOrderCert(ctx, order.FinalizeURL, csr, false)
+		sCtx.Require().ErrorAs(err, &acmeErr)
+		sCtx.Require().Equal(`urn:ietf:params:acme:error:badCSR`, acmeErr.ProblemType)
+
+		// common name is enrollment id, so it must be set
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		sCtx.Require().NoError(err)
+		csr, err = x509.CreateCertificateRequest(rand.Reader,
+			&x509.CertificateRequest{DNSNames: []string{`node.example.test`}}, key)
+		sCtx.Require().NoError(err)
+		_, _, err = cli.CreateOrderCert(ctx, order.FinalizeURL, csr, false)
+		sCtx.Require().ErrorAs(err, &acmeErr)
+		sCtx.Require().Equal(`urn:ietf:params:acme:error:badCSR`, acmeErr.ProblemType)
+
+		// identity of domain was registered by the first order and is enrolled again
+		csr, _ = newACMECSR(sCtx, `node.example.test`)
+		der, _, err := cli.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+		sCtx.Require().NoError(err)
+		cert, err := x509.ParseCertificate(der[0])
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(`node.example.test`, cert.Subject.CommonName)
+	})
+
+	t.WithNewStep("Identifiers other than public domain names are rejected", func(sCtx provider.StepCtx) {
+		for _, name := range []string{`attacker.example#.victim.com`, `127.0.0.1`, `::1`, `localhost`,
+			`app.localhost`, `intranet`, `-bad.example.com`, `*.example.com`, `a..example.com`} {
+			_, err := cli.AuthorizeOrder(ctx, acme.DomainIDs(name))
+			var acmeErr *acme.Error
+			sCtx.Require().ErrorAs(err, &acmeErr, name)
+			sCtx.Require().Equal(`urn:ietf:params:acme:error:rejectedIdentifier`, acmeErr.ProblemType, name)
+		}
+	})
+
+	t.WithNewStep("Wrong key authorization invalidates order", func(sCtx provider.StepCtx) {
+		order, err := cli.AuthorizeOrder(ctx, acme.DomainIDs(`node.example.test`))
+		sCtx.Require().NoError(err)
+		authz, err := cli.GetAuthorization(ctx, order.AuthzURLs[0])
+		sCtx.Require().NoError(err)
+		chal := authz.Challenges[0]
+		responses.Store(cli.HTTP01ChallengePath(chal.Token), chal.Token+`.wrong`)
+
+		_, err = cli.Accept(ctx, chal)
+		sCtx.Require().NoError(err)
+		_, err = cli.WaitAuthorization(ctx, authz.URI)
+		sCtx.Require().Error(err)
+
+		order, err = cli.GetOrder(ctx, order.URI)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(acme.StatusInvalid, order.Status)
+	})
+}
+
+func (s *ACMESuite) TestExternalAccountBinding(t provider.T) {
+	ca := newFakeCA()
+	defer ca.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	hmacKey := []byte(`0123456789abcdef0123456789abcdef`)
+	admin := ca.adminClient()
+	_, err := admin.Register(ctx, request.Registration{Name: `orderer0.internal.example.com`, Type: `orderer`})
+	t.Require().NoError(err)
+	server, err := acmeserver.New(ctx, admin,
+		acmeserver.WithExternalAccountRequired(),
+		acmeserver.WithExternalAccount(`kid-1`, hmacKey, `*.internal.example.com`))
+	t.Require().NoError(err)
+	srv := httptest.NewTLSServer(server.Handler())
+	defer srv.Close()
+
+	t.WithNewStep("Directory requires external account", func(sCtx provider.StepCtx) {
+		dir, err := newACMEClient(t, srv).Discover(ctx)
+		sCtx.Require().NoError(err)
+		sCtx.Require().True(dir.ExternalAccountRequired)
+
+		_, err = newACMEClient(t, srv).Register(ctx, &acme.Account{}, acme.AcceptTOS)
+		var acmeErr *acme.Error
+		sCtx.Require().ErrorAs(err, &acmeErr)
+		sCtx.Require().Equal(`urn:ietf:params:acme:error:externalAccountRequired`, acmeErr.ProblemType)
+	})
+
+	t.WithNewStep("Binding with wrong key is rejected", func(sCtx provider.StepCtx) {
+		_, err := newACMEClient(t, srv).Register(ctx, &acme.Account{ExternalAccountBinding: &acme.ExternalAccountBinding{
+			KID: `kid-1`, Key: []byte(`wrong`),
+		}}, acme.AcceptTOS)
+		sCtx.Require().Error(err)
+	})
+
+	t.WithNewStep("Pre-authorized domains don't need challenge", func(sCtx provider.StepCtx) {
+		cli := newACMEClient(t, srv)
+		_, err := cli.Register(ctx, &acme.Account{ExternalAccountBinding: &acme.ExternalAccountBinding{
+			KID: `kid-1`, Key: hmacKey,
+		}}, acme.AcceptTOS)
+		sCtx.Require().NoError(err)
+
+		order, err := cli.AuthorizeOrder(ctx, acme.DomainIDs(`peer0.internal.example.com`, `*.internal.example.com`))
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(acme.StatusReady, order.Status)
+
+		csr, _ := newACMECSR(sCtx, `peer0.internal.example.com`, `*.internal.example.com`)
+		der, _, err := cli.CreateOrderCert(ctx, order.FinalizeURL, csr, false)
+		sCtx.Require().NoError(err)
+		cert, err := x509.ParseCertificate(der[0])
+		sCtx.Require().NoError(err)
+		sCtx.Require().ElementsMatch([]string{`peer0.internal.example.com`, `*.internal.example.com`}, cert.DNSNames)
+
+		_, err = cli.AuthorizeOrder(ctx, acme.DomainIDs(`*.example.com`))
+		sCtx.Require().Error(err)
+
+		// identity registered for other purpose isn't taken over
+		order, err = cli.AuthorizeOrder(ctx, acme.DomainIDs(`orderer0.internal.example.com`))
+		sCtx.Require().NoError(err)
+		csr, _ = newACMECSR(sCtx, `orderer0.internal.example.com`)
+		_, _, err = cli.CreateOrderCert(ctx, order.FinalizeURL, csr, false)
+		var orderErr *acme.OrderError
+		sCtx.Require().ErrorAs(err, &orderErr)
+		sCtx.Require().Equal(acme.StatusInvalid, orderErr.Status)
+	})
+}
+
+func TestACME(t *testing.T) {
+	suite.RunSuite(t, new(ACMESuite))
+}
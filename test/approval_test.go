@@ -0,0 +1,283 @@
+package test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hlfans/ca-sdk/pkg/abac"
+	"github.com/hlfans/ca-sdk/pkg/approval"
+	"github.com/hlfans/ca-sdk/pkg/client"
+	cacrypto "github.com/hlfans/ca-sdk/pkg/crypto"
+	"github.com/hlfans/ca-sdk/pkg/request"
+	"github.com/hlfans/ca-sdk/pkg/verify"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+)
+
+type ApprovalSuite struct {
+	suite.Suite
+}
+
+func (s *ApprovalSuite) TestApproval(t provider.T) {
+	ca := newFakeCA()
+	defer ca.Close()
+	ctx := context.Background()
+	admin := ca.adminClient()
+
+	register := func(name string, approver bool) {
+		reg := request.Registration{Name: name, Type: `client`, Secret: name + `pw`}
+		if approver {
+			reg.Attrs = []request.Attribute{{Name: `approver`, Value: `true`, ECert: true}}
+		}
+		_, err := admin.Register(ctx, reg)
+		t.Require().NoError(err)
+	}
+	for _, name := range []string{`alice`, `bob`, `carol`} {
+		register(name, true)
+	}
+	register(`dave`, false)
+	register(`mallory`, false)
+	alice, bob := ca.enroll(`alice`, `alicepw`), ca.enroll(`bob`, `bobpw`)
+	carol, dave := ca.enroll(`carol`, `carolpw`), ca.enroll(`dave`, `davepw`)
+	ca.enroll(`mallory`, `mallorypw`)
+
+	dir := t.TempDir()
+	// CRL isn't cached, so revoked approvers are noticed immediately
+	verifier, err := verify.New(ctx, admin, verify.WithCRLMaxAge(0))
+	t.Require().NoError(err)
+	queue, err := approval.New(ctx, admin, dir,
+		approval.WithQuorum(2),
+		approval.WithVerifier(verifier),
+		approval.WithApproverPolicy(abac.MustCompile(`approver == "true"`)))
+	t.Require().NoError(err)
+
+	var revokeID string
+	t.WithNewStep("Operation is executed after quorum of distinct approvers", func(sCtx provider.StepCtx) {
+		req, err := queue.Propose(ctx, alice,
+			approval.RevokeAction(request.RevocationRequest{Name: `mallory`, Reason: `keycompromise`}), `leaked key`)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(approval.StatusPending, req.Status)
+		sCtx.Require().Equal(`alice`, req.Proposer.EnrollmentID)
+		revokeID = req.ID
+
+		_, err = queue.Execute(ctx, revokeID)
+		sCtx.Require().ErrorIs(err, approval.ErrQuorumNotReached)
+		_, err = queue.Approve(ctx, revokeID, alice)
+		sCtx.Require().ErrorIs(err, approval.ErrDuplicateApprover)
+		_, err = queue.Approve(ctx, revokeID, dave)
+		sCtx.Require().ErrorIs(err, approval.ErrUnauthorized)
+
+		_, err = queue.Approve(ctx, revokeID, bob)
+		sCtx.Require().NoError(err)
+		_, err = queue.Approve(ctx, revokeID, bob)
+		sCtx.Require().ErrorIs(err, approval.ErrDuplicateApprover)
+		_, err = queue.Execute(ctx, revokeID)
+		sCtx.Require().ErrorIs(err, approval.ErrQuorumNotReached)
+
+		// approval signed elsewhere and submitted by another process
+		req, err = queue.Get(revokeID)
+		sCtx.Require().NoError(err)
+		sig, err := approval.SignApproval(req, carol)
+		sCtx.Require().NoError(err)
+		req, err = queue.AddApproval(ctx, revokeID, sig)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Len(req.Approvals, 2)
+
+		req, err = queue.Execute(ctx, revokeID)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(approval.StatusExecuted, req.Status)
+		sCtx.Require().Empty(req.Result.Error)
+
+		certs, err := admin.CertificateList(ctx, client.WithEnrollId(`mallory`), client.WithNotRevoked())
+		sCtx.Require().NoError(err)
+		sCtx.Require().Empty(certs)
+
+		_, err = queue.Execute(ctx, revokeID)
+		sCtx.Require().ErrorIs(err, approval.ErrNotPending)
+		_, err = queue.Approve(ctx, revokeID, carol)
+		sCtx.Require().ErrorIs(err, approval.ErrNotPending)
+	})
+
+	t.WithNewStep("Tampered requests and moved approvals are rejected", func(sCtx provider.StepCtx) {
+		req, err := queue.Propose(ctx, alice, approval.AffiliationDeleteAction(`org1.department1`, false), ``)
+		sCtx.Require().NoError(err)
+
+		// approval of another request doesn't match proposal
+		executed, err := queue.Get(revokeID)
+		sCtx.Require().NoError(err)
+		_, err = queue.AddApproval(ctx, req.ID, executed.Approvals[0])
+		sCtx.Require().ErrorIs(err, approval.ErrInvalidSignature)
+
+		_, err = queue.Approve(ctx, req.ID, bob)
+		sCtx.Require().NoError(err)
+		_, err = queue.Approve(ctx, req.ID, carol)
+		sCtx.Require().NoError(err)
+
+		path := filepath.Join(dir, req.ID, `request.json`)
+		content, err := os.ReadFile(path)
+		sCtx.Require().NoError(err)
+		var stored map[string]interface{}
+		sCtx.Require().NoError(json.Unmarshal(content, &stored))
+		stored[`proposal`].(map[string]interface{})[`action`].(map[string]interface{})[`affiliation`] = `org2`
+		content, err = json.Marshal(stored)
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(os.WriteFile(path, content, 0o600))
+
+		_, err = queue.Execute(ctx, req.ID)
+		sCtx.Require().ErrorIs(err, approval.ErrInvalidSignature)
+		req, err = queue.Get(req.ID)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(approval.StatusPending, req.Status)
+	})
+
+	t.WithNewStep("Copied approval files are not counted", func(sCtx provider.StepCtx) {
+		dir := t.TempDir()
+		queue, err := approval.New(ctx, admin, dir, approval.WithQuorum(2), approval.WithVerifier(verifier))
+		sCtx.Require().NoError(err)
+		req, err := queue.Propose(ctx, alice,
+			approval.RevokeAction(request.RevocationRequest{Name: `dave`, Reason: `superseded`}), ``)
+		sCtx.Require().NoError(err)
+		_, err = queue.Approve(ctx, req.ID, bob)
+		sCtx.Require().NoError(err)
+
+		files, err := filepath.Glob(filepath.Join(dir, req.ID, `approval-*.json`))
+		sCtx.Require().NoError(err)
+		sCtx.Require().Len(files, 1)
+		content, err := os.ReadFile(files[0])
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(os.WriteFile(filepath.Join(dir, req.ID, `approval-copy.json`), content, 0o600))
+
+		req, err = queue.Get(req.ID)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Len(req.Approvals, 1)
+		_, err = queue.Execute(ctx, req.ID)
+		sCtx.Require().ErrorIs(err, approval.ErrQuorumNotReached)
+	})
+
+	t.WithNewStep("Approvals of revoked identities are not counted", func(sCtx provider.StepCtx) {
+		req, err := queue.Propose(ctx, alice, approval.AffiliationDeleteAction(`org2`, true), ``)
+		sCtx.Require().NoError(err)
+		_, err = queue.Approve(ctx, req.ID, bob)
+		sCtx.Require().NoError(err)
+		_, err = queue.Approve(ctx, req.ID, carol)
+		sCtx.Require().NoError(err)
+
+		_, err = admin.Revoke(ctx, request.RevocationRequest{Name: `carol`, Reason: `affiliationchange`})
+		sCtx.Require().NoError(err)
+		_, err = queue.Execute(ctx, req.ID)
+		sCtx.Require().ErrorIs(err, approval.ErrQuorumNotReached)
+	})
+
+	t.WithNewStep("Failed operation is recorded", func(sCtx provider.StepCtx) {
+		queue, err := approval.New(ctx, admin, t.TempDir(), approval.WithVerifier(verifier))
+		sCtx.Require().NoError(err)
+		req, err := queue.Propose(ctx, alice, approval.AffiliationDeleteAction(`org1`, true), ``)
+		sCtx.Require().NoError(err)
+		_, err = queue.Approve(ctx, req.ID, bob)
+		sCtx.Require().NoError(err)
+
+		// fake CA doesn't delete affiliations
+		req, err = queue.Execute(ctx, req.ID)
+		sCtx.Require().Error(err)
+		sCtx.Require().Equal(approval.StatusFailed, req.Status)
+		sCtx.Require().NotEmpty(req.Result.Error)
+		_, err = queue.Execute(ctx, req.ID)
+		sCtx.Require().ErrorIs(err, approval.ErrNotPending)
+	})
+
+	t.WithNewStep("Request is cancelled by proposer or approver", func(sCtx provider.StepCtx) {
+		req, err := queue.Propose(ctx, alice,
+			approval.RevokeAction(request.RevocationRequest{Name: `dave`, Reason: `superseded`}), ``)
+		sCtx.Require().NoError(err)
+
+		_, err = queue.Cancel(ctx, req.ID, dave)
+		sCtx.Require().ErrorIs(err, approval.ErrUnauthorized)
+		req, err = queue.Cancel(ctx, req.ID, bob)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(approval.StatusCancelled, req.Status)
+		sCtx.Require().Equal(`bob`, req.Cancellation.EnrollmentID)
+
+		_, err = queue.Cancel(ctx, req.ID, alice)
+		sCtx.Require().ErrorIs(err, approval.ErrNotPending)
+		_, err = queue.Approve(ctx, req.ID, bob)
+		sCtx.Require().ErrorIs(err, approval.ErrNotPending)
+	})
+
+	t.WithNewStep("Identity enrolled with proposer key doesn't approve", func(sCtx provider.StepCtx) {
+		register(`erin`, true)
+		register(`erin2`, true)
+		key, err := cacrypto.NewPrivateKey()
+		sCtx.Require().NoError(err)
+		enrollWithKey := func(name string) cacrypto.Signer {
+			cert, _, err := ca.newClient(nil).Enroll(ctx, name, name+`pw`, newCSR(name), client.WithEnrollPrivateKey(key))
+			sCtx.Require().NoError(err)
+			signer, err := cacrypto.NewSigner(cert, key)
+			sCtx.Require().NoError(err)
+			return signer
+		}
+		erin, erin2 := enrollWithKey(`erin`), enrollWithKey(`erin2`)
+
+		dir := t.TempDir()
+		queue, err := approval.New(ctx, admin, dir, approval.WithVerifier(verifier),
+			approval.WithApproverPolicy(abac.MustCompile(`approver == "true"`)))
+		sCtx.Require().NoError(err)
+		req, err := queue.Propose(ctx, erin,
+			approval.RevokeAction(request.RevocationRequest{Name: `dave`, Reason: `superseded`}), ``)
+		sCtx.Require().NoError(err)
+		_, err = queue.Approve(ctx, req.ID, erin2)
+		sCtx.Require().ErrorIs(err, approval.ErrDuplicateApprover)
+
+		// approval written to directory by another process isn't counted either
+		sig, err := approval.SignApproval(req, erin2)
+		sCtx.Require().NoError(err)
+		content, err := json.Marshal(sig)
+		sCtx.Require().NoError(err)
+		sum := sha256.Sum256([]byte(`erin2`))
+		path := filepath.Join(dir, req.ID, `approval-`+hex.EncodeToString(sum[:8])+`.json`)
+		sCtx.Require().NoError(os.WriteFile(path, content, 0o600))
+		req, err = queue.Get(req.ID)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Len(req.Approvals, 1)
+		_, err = queue.Execute(ctx, req.ID)
+		sCtx.Require().ErrorIs(err, approval.ErrQuorumNotReached)
+
+		_, err = queue.Approve(ctx, req.ID, bob)
+		sCtx.Require().NoError(err)
+		_, err = queue.Execute(ctx, req.ID)
+		sCtx.Require().NoError(err)
+	})
+
+	t.WithNewStep("Requests expire after TTL", func(sCtx provider.StepCtx) {
+		later, err := approval.New(ctx, admin, dir, approval.WithVerifier(verifier),
+			approval.WithClock(func() time.Time { return time.Now().Add(25 * time.Hour) }))
+		sCtx.Require().NoError(err)
+
+		pending, err := queue.List(approval.StatusPending)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Len(pending, 2)
+		expired, err := later.List(approval.StatusExpired)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Len(expired, 2)
+		_, err = later.Execute(ctx, expired[0].ID)
+		sCtx.Require().ErrorIs(err, approval.ErrNotPending)
+
+		all, err := later.List()
+		sCtx.Require().NoError(err)
+		sCtx.Require().Len(all, 4)
+		sCtx.Require().Equal(revokeID, all[0].ID)
+		sCtx.Require().Equal(approval.StatusExecuted, all[0].Status)
+
+		_, err = later.Get(`not-an-id`)
+		sCtx.Require().ErrorIs(err, approval.ErrNotFound)
+	})
+}
+
+func TestApproval(t *testing.T) {
+	suite.RunSuite(t, new(ApprovalSuite))
+}
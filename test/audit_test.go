@@ -0,0 +1,179 @@
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hlfans/ca-sdk/pkg/audit"
+	"github.com/hlfans/ca-sdk/pkg/client"
+	"github.com/hlfans/ca-sdk/pkg/request"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+)
+
+type AuditSuite struct {
+	suite.Suite
+}
+
+func readAuditLines(t provider.StepCtx, path string) []string {
+	raw, err := os.ReadFile(path)
+	t.Require().NoError(err)
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines
+}
+
+func (s *AuditSuite) TestAuditLog(t provider.T) {
+	ca := newFakeCA()
+	defer ca.Close()
+	ctx := context.Background()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	t.Require().NoError(err)
+	path := filepath.Join(t.TempDir(), `audit.jsonl`)
+	sink, err := audit.NewFileSink(path)
+	t.Require().NoError(err)
+	log, err := audit.New(key, sink)
+	t.Require().NoError(err)
+
+	admin := ca.newClient(ca.enroll(fakeAdminName, fakeAdminSecret), client.WithAuditHook(log))
+	user := ca.newClient(nil, client.WithAuditHook(log))
+
+	t.WithNewStep("Administrative operations are logged with redacted secrets", func(sCtx provider.StepCtx) {
+		_, err := admin.Register(ctx, request.Registration{Name: `auditee`, Secret: `topsecret`, Type: `client`})
+		sCtx.Require().NoError(err)
+		_, err = admin.Register(ctx, request.Registration{Name: `auditee`, Secret: `topsecret`, Type: `client`})
+		sCtx.Require().ErrorIs(err, client.ErrAlreadyRegistered)
+		_, err = admin.IdentityList(ctx)
+		sCtx.Require().NoError(err)
+		_, _, err = user.Enroll(ctx, `auditee`, `topsecret`, newCSR(`auditee`))
+		sCtx.Require().NoError(err)
+		_, err = admin.Revoke(ctx, request.RevocationRequest{Name: `auditee`, Reason: `keycompromise`})
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(admin.AffiliationCreate(ctx, `org3`))
+		_, _, _ = admin.AffiliationDelete(ctx, `org3`, client.WithForce())
+
+		lines := readAuditLines(sCtx, path)
+		sCtx.Require().Len(lines, 6)
+		sCtx.Require().NotContains(strings.Join(lines, "\n"), `topsecret`)
+
+		var entries []audit.Entry
+		for _, line := range lines {
+			var entry audit.Entry
+			sCtx.Require().NoError(json.Unmarshal([]byte(line), &entry))
+			entries = append(entries, entry)
+		}
+		sCtx.Require().Equal(client.OperationRegister, entries[0].Operation)
+		sCtx.Require().Equal(fakeAdminName, entries[0].Caller)
+		sCtx.Require().Contains(string(entries[0].Request), `"id":"auditee"`)
+		sCtx.Require().NotEmpty(entries[1].Codes)
+		sCtx.Require().Equal(client.OperationEnroll, entries[2].Operation)
+		sCtx.Require().Equal(`auditee`, entries[2].Caller)
+		sCtx.Require().Equal(client.OperationRevoke, entries[3].Operation)
+		sCtx.Require().Contains(entries[5].URL, `force=true`)
+		for i, entry := range entries {
+			sCtx.Require().Equal(uint64(i+1), entry.Seq)
+			if i > 0 {
+				sCtx.Require().Equal(entries[i-1].Hash, entry.PrevHash)
+			}
+		}
+
+		f, err := os.Open(path)
+		sCtx.Require().NoError(err)
+		defer func() { _ = f.Close() }()
+		last, err := audit.Verify(f, key.Public())
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(uint64(6), last.Seq)
+	})
+
+	t.WithNewStep("Chain continues after restart", func(sCtx provider.StepCtx) {
+		sCtx.Require().NoError(sink.Close())
+		sink, err = audit.NewFileSink(path)
+		sCtx.Require().NoError(err)
+		defer func() { _ = sink.Close() }()
+		log, err := audit.New(key, sink)
+		sCtx.Require().NoError(err)
+
+		admin := ca.newClient(ca.enroll(fakeAdminName, fakeAdminSecret), client.WithAuditHook(log))
+		sCtx.Require().NoError(admin.AffiliationCreate(ctx, `org4`))
+
+		last, err := audit.Verify(strings.NewReader(strings.Join(readAuditLines(sCtx, path), "\n")), key.Public())
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(uint64(7), last.Seq)
+	})
+
+	t.WithNewStep("Tampering is detected", func(sCtx provider.StepCtx) {
+		lines := readAuditLines(sCtx, path)
+		verify := func(lines []string, opts ...audit.VerifyOpt) error {
+			_, err := audit.Verify(strings.NewReader(strings.Join(lines, "\n")), key.Public(), opts...)
+			return err
+		}
+
+		modified := append([]string{}, lines...)
+		modified[3] = strings.Replace(modified[3], `keycompromise`, `superseded`, 1)
+		err := verify(modified)
+		sCtx.Require().ErrorIs(err, audit.ErrModified)
+		var verr *audit.VerificationError
+		sCtx.Require().ErrorAs(err, &verr)
+		sCtx.Require().Equal(4, verr.Line)
+
+		removed := append(append([]string{}, lines[:2]...), lines[3:]...)
+		sCtx.Require().ErrorIs(verify(removed), audit.ErrGap)
+
+		// attacker recomputes hash, but can't sign it
+		var entry audit.Entry
+		sCtx.Require().NoError(json.Unmarshal([]byte(lines[1]), &entry))
+		entry.Caller = `someone`
+		unsigned := entry
+		unsigned.Hash, unsigned.Signature = ``, nil
+		b, _ := json.Marshal(unsigned)
+		sum := sha256.Sum256(b)
+		entry.Hash = hex.EncodeToString(sum[:])
+		rewritten, _ := json.Marshal(entry)
+		forged := append([]string{}, lines...)
+		forged[1] = string(rewritten)
+		sCtx.Require().ErrorIs(verify(forged), audit.ErrSignature)
+
+		otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		sCtx.Require().NoError(err)
+		_, err = audit.Verify(strings.NewReader(strings.Join(lines, "\n")), otherKey.Public())
+		sCtx.Require().ErrorIs(err, audit.ErrSignature)
+
+		// rotated log is verified from the last entry of previous file
+		sCtx.Require().NoError(json.Unmarshal([]byte(lines[2]), &entry))
+		sCtx.Require().NoError(verify(lines[3:], audit.WithAnchor(entry.Seq, entry.Hash)))
+		sCtx.Require().ErrorIs(verify(lines[3:]), audit.ErrGap)
+	})
+
+	t.WithNewStep("Hook errors don't fail operations", func(sCtx provider.StepCtx) {
+		var events []client.AuditEvent
+		admin := ca.newClient(ca.enroll(fakeAdminName, fakeAdminSecret),
+			client.WithAuditHook(client.AuditHookFunc(func(_ context.Context, event client.AuditEvent) error {
+				events = append(events, event)
+				return errors.New(`sink unavailable`)
+			})))
+		sCtx.Require().NoError(admin.AffiliationCreate(ctx, `org5`))
+		sCtx.Require().Len(events, 1)
+		sCtx.Require().Equal(http.StatusCreated, events[0].Status)
+	})
+}
+
+func TestAudit(t *testing.T) {
+	suite.RunSuite(t, new(AuditSuite))
+}
@@ -0,0 +1,124 @@
+package test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hlfans/ca-sdk/pkg/auth"
+	"github.com/hlfans/ca-sdk/pkg/client"
+	"github.com/hlfans/ca-sdk/pkg/config"
+	"github.com/hlfans/ca-sdk/pkg/crypto"
+	ecdsasuite "github.com/hlfans/ca-sdk/pkg/crypto/ecdsa"
+	"github.com/hlfans/ca-sdk/pkg/response"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+)
+
+type AuthSuite struct {
+	suite.Suite
+}
+
+func newTestSuite() crypto.Suite {
+	s, err := ecdsasuite.New(ecdsasuite.DefaultOpts)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func (s *AuthSuite) TestMiddleware(t provider.T) {
+	ca := newFakeCA()
+	defer ca.Close()
+
+	verifier, err := auth.NewVerifier(newTestSuite(), auth.WithCAChain(ca.chainPEM()))
+	t.Require().NoError(err)
+
+	var caller string
+	srv := httptest.NewServer(verifier.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cert, _ := auth.CertificateFromContext(r.Context())
+		caller = cert.Subject.CommonName
+		result, _ := json.Marshal(response.CertificateList{})
+		_ = json.NewEncoder(w).Encode(response.Response{Success: true, Result: result})
+	})))
+	defer srv.Close()
+
+	newClient := func(signer crypto.Signer) client.Client {
+		cli, err := client.NewHttp(client.WithRawConfig(&config.CAConfig{Host: srv.URL}), client.WithIdentity(signer))
+		t.Require().NoError(err)
+		return cli
+	}
+
+	t.WithNewStep("Token of CA issued identity is accepted", func(sCtx provider.StepCtx) {
+		_, err := newClient(ca.enroll(fakeAdminName, fakeAdminSecret)).CertificateList(context.Background())
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(fakeAdminName, caller)
+	})
+
+	t.WithNewStep("Token of untrusted identity is rejected", func(sCtx provider.StepCtx) {
+		_, err := newClient(newSelfSignedSigner(`intruder`)).CertificateList(context.Background())
+		sCtx.Require().ErrorIs(err, client.ErrAuthenticationFailure)
+	})
+}
+
+func (s *AuthSuite) TestVerifyToken(t provider.T) {
+	ca := newFakeCA()
+	defer ca.Close()
+
+	signer := ca.enroll(fakeAdminName, fakeAdminSecret)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.rootCert)
+
+	certEncoded := base64.StdEncoding.EncodeToString(signer.Certificate())
+	body := []byte(`{"id":"user1"}`)
+	digest := sha256.Sum256([]byte(auth.Payload(http.MethodPost, `/api/v1/register`, body, certEncoded)))
+	sig, err := signer.Sign(rand.Reader, digest[:], nil)
+	t.Require().NoError(err)
+	token := certEncoded + `.` + base64.StdEncoding.EncodeToString(sig)
+
+	t.WithNewStep("Valid token", func(sCtx provider.StepCtx) {
+		cert, err := auth.VerifyToken(newTestSuite(), roots, http.MethodPost, `/api/v1/register`, body, token)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(fakeAdminName, cert.Subject.CommonName)
+	})
+
+	t.WithNewStep("Tampered body", func(sCtx provider.StepCtx) {
+		_, err := auth.VerifyToken(newTestSuite(), roots, http.MethodPost, `/api/v1/register`, []byte(`{"id":"user2"}`), token)
+		sCtx.Require().ErrorIs(err, auth.ErrInvalidSignature)
+	})
+
+	t.WithNewStep("High S signature", func(sCtx provider.StepCtx) {
+		var parsed struct{ R, S *big.Int }
+		_, err := asn1.Unmarshal(sig, &parsed)
+		sCtx.Require().NoError(err)
+
+		block, _ := pem.Decode(signer.Certificate())
+		cert, _ := x509.ParseCertificate(block.Bytes)
+		parsed.S.Sub(cert.PublicKey.(*ecdsa.PublicKey).Params().N, parsed.S)
+		highS, err := asn1.Marshal(parsed)
+		sCtx.Require().NoError(err)
+
+		_, err = auth.VerifyToken(newTestSuite(), roots, http.MethodPost, `/api/v1/register`, body,
+			certEncoded+`.`+base64.StdEncoding.EncodeToString(highS))
+		sCtx.Require().ErrorIs(err, auth.ErrInvalidSignature)
+	})
+
+	t.WithNewStep("Malformed token", func(sCtx provider.StepCtx) {
+		_, err := auth.VerifyToken(newTestSuite(), roots, http.MethodGet, `/`, nil, `not-a-token`)
+		sCtx.Require().ErrorIs(err, auth.ErrMalformedToken)
+	})
+}
+
+func TestAuth(t *testing.T) {
+	suite.RunSuite(t, new(AuthSuite))
+}
@@ -0,0 +1,69 @@
+package test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hlfans/ca-sdk/pkg/bootstrap"
+	"github.com/hlfans/ca-sdk/pkg/config"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+)
+
+type BootstrapSuite struct {
+	suite.Suite
+}
+
+func (s *BootstrapSuite) TestIdempotentBootstrap(t provider.T) {
+	ca := newFakeCA()
+	defer ca.Close()
+
+	dir := t.TempDir()
+	spec := bootstrap.OrgSpec{
+		Domain:       `org1.example.com`,
+		Admin:        bootstrap.Credentials{Name: fakeAdminName, Secret: fakeAdminSecret},
+		Affiliations: []string{`org1.department2`},
+		Affiliation:  `org1`,
+		Peers:        []bootstrap.NodeSpec{{Name: `peer0`}, {Name: `peer1`}},
+		Orderers:     []bootstrap.NodeSpec{{Name: `orderer0`, Hosts: []string{`orderer.local`}}},
+		Users:        []bootstrap.UserSpec{{Name: `org1admin`, Admin: true}, {Name: `user1`}},
+	}
+
+	b, err := bootstrap.New(&config.CAConfig{Host: ca.URL})
+	t.Require().NoError(err)
+
+	t.WithNewStep("First run registers and enrolls everything", func(sCtx provider.StepCtx) {
+		res, err := b.Bootstrap(context.Background(), spec, dir)
+		sCtx.Require().NoError(err)
+		sCtx.Require().ElementsMatch([]string{`peer0`, `peer1`, `orderer0`, `org1admin`, `user1`}, res.Registered)
+		sCtx.Require().Equal([]string{`org1.department2`}, res.CreatedAffiliations)
+		sCtx.Require().Len(res.Enrolled, 9)
+
+		for _, path := range []string{
+			`msp/cacerts/ca.pem`,
+			`msp/config.yaml`,
+			`registrar/msp/signcerts/cert.pem`,
+			`peers/peer0.org1.example.com/msp/keystore/priv_sk`,
+			`peers/peer1.org1.example.com/tls/server.crt`,
+			`orderers/orderer0.org1.example.com/tls/server.key`,
+			`users/user1@org1.example.com/msp/signcerts/cert.pem`,
+		} {
+			_, err := os.Stat(filepath.Join(dir, path))
+			sCtx.Require().NoError(err, path)
+		}
+	})
+
+	t.WithNewStep("Second run skips existing results", func(sCtx provider.StepCtx) {
+		res, err := b.Bootstrap(context.Background(), spec, dir)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Empty(res.Registered)
+		sCtx.Require().Empty(res.Enrolled)
+		sCtx.Require().Empty(res.CreatedAffiliations)
+	})
+}
+
+func TestBootstrap(t *testing.T) {
+	suite.RunSuite(t, new(BootstrapSuite))
+}
@@ -0,0 +1,149 @@
+package test
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hlfans/ca-sdk/pkg/crldist"
+	"github.com/hlfans/ca-sdk/pkg/request"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+)
+
+type CRLDistSuite struct {
+	suite.Suite
+}
+
+func (s *CRLDistSuite) TestServer(t provider.T) {
+	ca := newFakeCA()
+	defer ca.Close()
+	ctx := context.Background()
+	admin := ca.adminClient()
+
+	_, err := admin.Register(ctx, request.Registration{Name: `user1`, Type: `client`, Secret: `user1pw`})
+	t.Require().NoError(err)
+	cert, _, err := ca.newClient(nil).Enroll(ctx, `user1`, `user1pw`, newCSR(`user1`))
+	t.Require().NoError(err)
+
+	server, err := crldist.New(ctx, admin, nil)
+	t.Require().NoError(err)
+	httpServer := httptest.NewServer(server.Handler())
+	defer httpServer.Close()
+
+	events, unsubscribe := server.Subscribe(4)
+	defer unsubscribe()
+
+	get := func(path string, header ...string) (*http.Response, []byte) {
+		req, err := http.NewRequest(http.MethodGet, httpServer.URL+path, nil)
+		t.Require().NoError(err)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		resp, err := http.DefaultClient.Do(req)
+		t.Require().NoError(err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		t.Require().NoError(err)
+		return resp, body
+	}
+
+	t.WithNewStep("Nothing is served before first generation", func(sCtx provider.StepCtx) {
+		resp, _ := get(`/` + fakeCAName + `/crl.der`)
+		sCtx.Require().Equal(http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.WithNewStep("Empty first generation doesn't notify", func(sCtx provider.StepCtx) {
+		sCtx.Require().NoError(server.Refresh(ctx))
+		gen, ok := server.Latest(fakeCAName)
+		sCtx.Require().True(ok)
+		sCtx.Require().Equal(uint64(1), gen.Seq)
+		sCtx.Require().Len(events, 0)
+	})
+
+	t.WithNewStep("Newly revoked serial is pushed to subscribers", func(sCtx provider.StepCtx) {
+		_, err := admin.Revoke(ctx, request.RevocationRequest{
+			Serial: fmt.Sprintf(`%x`, cert.SerialNumber), AKI: fmt.Sprintf(`%x`, cert.AuthorityKeyId), Reason: `keycompromise`,
+		})
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(server.Refresh(ctx))
+
+		sCtx.Require().Len(events, 1)
+		event := <-events
+		sCtx.Require().Equal(fakeCAName, event.CAName)
+		sCtx.Require().Equal(uint64(2), event.Generation.Seq)
+		sCtx.Require().Len(event.Generation.Delta.Added, 1)
+		sCtx.Require().Equal(cert.SerialNumber, event.Generation.Delta.Added[0].SerialNumber)
+
+		for i := 0; i < 3; i++ {
+			sCtx.Require().NoError(server.Refresh(ctx))
+		}
+		sCtx.Require().Len(events, 0, `unchanged CRL doesn't notify`)
+		gen, ok := server.Latest(fakeCAName)
+		sCtx.Require().True(ok)
+		sCtx.Require().Equal(uint64(2), gen.Seq, `unchanged CRL doesn't add generation`)
+		sCtx.Require().Len(gen.Delta.Added, 1)
+		sCtx.Require().Len(server.History(fakeCAName), 2)
+	})
+
+	t.WithNewStep("CRL is served as DER and PEM with validators", func(sCtx provider.StepCtx) {
+		resp, body := get(`/` + fakeCAName + `/crl.der`)
+		sCtx.Require().Equal(http.StatusOK, resp.StatusCode)
+		sCtx.Require().Equal(`application/pkix-crl`, resp.Header.Get(`Content-Type`))
+		sCtx.Require().Contains(resp.Header.Get(`Cache-Control`), `max-age=`)
+		crl, err := x509.ParseRevocationList(body)
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(crl.CheckSignatureFrom(ca.rootCert))
+		sCtx.Require().Len(crl.RevokedCertificateEntries, 1)
+
+		etag := resp.Header.Get(`ETag`)
+		sCtx.Require().NotEmpty(etag)
+		resp, _ = get(`/`+fakeCAName+`/crl.der`, `If-None-Match`, etag)
+		sCtx.Require().Equal(http.StatusNotModified, resp.StatusCode)
+
+		resp, body = get(`/` + fakeCAName + `/crl.pem`)
+		sCtx.Require().Equal(http.StatusOK, resp.StatusCode)
+		sCtx.Require().NotEqual(etag, resp.Header.Get(`ETag`))
+		block, _ := pem.Decode(body)
+		sCtx.Require().NotNil(block)
+		sCtx.Require().Equal(`X509 CRL`, block.Type)
+	})
+
+	t.WithNewStep("History and deltas are available", func(sCtx provider.StepCtx) {
+		resp, body := get(`/` + fakeCAName + `/history`)
+		sCtx.Require().Equal(http.StatusOK, resp.StatusCode)
+		var history []struct {
+			Seq     uint64 `json:"seq"`
+			Revoked int    `json:"revoked"`
+		}
+		sCtx.Require().NoError(json.Unmarshal(body, &history))
+		sCtx.Require().Len(history, 2)
+		sCtx.Require().Equal(1, history[1].Revoked)
+
+		resp, body = get(`/` + fakeCAName + `/delta?since=1`)
+		sCtx.Require().Equal(http.StatusOK, resp.StatusCode)
+		var delta struct {
+			Added []struct {
+				Serial string `json:"serial"`
+				Reason int    `json:"reason"`
+			} `json:"added"`
+		}
+		sCtx.Require().NoError(json.Unmarshal(body, &delta))
+		sCtx.Require().Len(delta.Added, 1)
+		sCtx.Require().Equal(fmt.Sprintf(`%x`, cert.SerialNumber), delta.Added[0].Serial)
+		sCtx.Require().Equal(1, delta.Added[0].Reason)
+
+		resp, _ = get(`/` + fakeCAName + `/delta?since=99`)
+		sCtx.Require().Equal(http.StatusGone, resp.StatusCode)
+	})
+}
+
+func TestCRLDist(t *testing.T) {
+	suite.RunSuite(t, new(CRLDistSuite))
+}
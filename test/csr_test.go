@@ -0,0 +1,152 @@
+package test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hlfans/ca-sdk/pkg/client"
+	"github.com/hlfans/ca-sdk/pkg/config"
+	cacrypto "github.com/hlfans/ca-sdk/pkg/crypto"
+	"github.com/hlfans/ca-sdk/pkg/csr"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+	"gopkg.in/yaml.v3"
+)
+
+const csrConfigYaml = `
+host: http://localhost:7054
+csr:
+  names:
+    - C: US
+      ST: North Carolina
+      O: Hyperledger
+      OU: Fabric
+  hosts:
+    - peer0.org1.example.com
+    - 10.0.0.1
+    - admin@org1.example.com
+    - spiffe://org1.example.com/peer0
+  keyrequest:
+    algo: ecdsa
+    size: 384
+`
+
+type CSRSuite struct {
+	suite.Suite
+}
+
+func (s *CSRSuite) TestBuilder(t provider.T) {
+	var conf config.CAConfig
+	t.Require().NoError(yaml.Unmarshal([]byte(csrConfigYaml), &conf))
+
+	builder, err := csr.NewBuilder(conf.CSR)
+	t.Require().NoError(err)
+
+	t.WithNewStep("Template follows csr section", func(sCtx provider.StepCtx) {
+		req, key, err := builder.Build(`peer0`)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(`peer0`, req.Subject.CommonName)
+		sCtx.Require().Equal([]string{`US`}, req.Subject.Country)
+		sCtx.Require().Equal([]string{`North Carolina`}, req.Subject.Province)
+		sCtx.Require().Equal([]string{`Hyperledger`}, req.Subject.Organization)
+		sCtx.Require().Equal([]string{`Fabric`}, req.Subject.OrganizationalUnit)
+		sCtx.Require().Equal([]string{`peer0.org1.example.com`}, req.DNSNames)
+		sCtx.Require().Len(req.IPAddresses, 1)
+		sCtx.Require().Equal(`10.0.0.1`, req.IPAddresses[0].String())
+		sCtx.Require().Equal([]string{`admin@org1.example.com`}, req.EmailAddresses)
+		sCtx.Require().Len(req.URIs, 1)
+		sCtx.Require().Equal(`spiffe://org1.example.com/peer0`, req.URIs[0].String())
+		sCtx.Require().Equal(x509.ECDSAWithSHA384, req.SignatureAlgorithm)
+
+		ecKey, ok := key.(*ecdsa.PrivateKey)
+		sCtx.Require().True(ok)
+		sCtx.Require().Equal(elliptic.P384(), ecKey.Curve)
+	})
+
+	t.WithNewStep("P-521 key is signed with SHA-512", func(sCtx provider.StepCtx) {
+		b, err := csr.NewBuilder(config.CSRConfig{KeyRequest: config.KeyRequest{Algo: `ecdsa`, Size: 521}})
+		sCtx.Require().NoError(err)
+		req, key, err := b.Build(`peer0`)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(x509.ECDSAWithSHA512, req.SignatureAlgorithm)
+
+		ecKey, ok := key.(*ecdsa.PrivateKey)
+		sCtx.Require().True(ok)
+		sCtx.Require().Equal(elliptic.P521(), ecKey.Curve)
+		der, err := x509.CreateCertificateRequest(rand.Reader, req, ecKey)
+		sCtx.Require().NoError(err)
+		signed, err := x509.ParseCertificateRequest(der)
+		sCtx.Require().NoError(err)
+		sCtx.Require().NoError(signed.CheckSignature())
+	})
+
+	t.WithNewStep("Unsupported key request is rejected", func(sCtx provider.StepCtx) {
+		_, err := csr.NewBuilder(config.CSRConfig{KeyRequest: config.KeyRequest{Algo: `rsa`, Size: 2048}})
+		sCtx.Require().ErrorIs(err, csr.ErrUnsupportedKeyRequest)
+	})
+
+	t.WithNewStep("CA section adds basic constraints", func(sCtx provider.StepCtx) {
+		b, err := csr.NewBuilder(config.CSRConfig{CA: &config.CSRCAConfig{PathLenZero: true}})
+		sCtx.Require().NoError(err)
+		req, err := b.Template(`ica`)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Len(req.ExtraExtensions, 1)
+		sCtx.Require().True(req.ExtraExtensions[0].Id.Equal(csr.OIDBasicConstraints))
+	})
+
+	t.WithNewStep("Enrolled certificate contains requested names", func(sCtx provider.StepCtx) {
+		ca := newFakeCA()
+		defer ca.Close()
+
+		req, key, err := builder.Build(fakeAdminName)
+		sCtx.Require().NoError(err)
+		cert, _, err := ca.newClient(nil).Enroll(context.Background(), fakeAdminName, fakeAdminSecret, req,
+			client.WithEnrollPrivateKey(key))
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(req.DNSNames, cert.DNSNames)
+		sCtx.Require().Equal(req.EmailAddresses, cert.EmailAddresses)
+		sCtx.Require().Equal(req.URIs[0].String(), cert.URIs[0].String())
+		sCtx.Require().Equal(key.(*ecdsa.PrivateKey).Public(), cert.PublicKey)
+	})
+
+	t.WithNewStep("Enroll builds CSR from YAML config", func(sCtx provider.StepCtx) {
+		ca := newFakeCA()
+		defer ca.Close()
+		ctx := context.Background()
+
+		path := filepath.Join(t.TempDir(), `fabric-ca-client-config.yaml`)
+		content := strings.Replace(csrConfigYaml, `http://localhost:7054`, ca.URL, 1)
+		sCtx.Require().NoError(os.WriteFile(path, []byte(content), 0o600))
+		cli, err := client.NewHttp(client.WithYamlConfig(path))
+		sCtx.Require().NoError(err)
+
+		cert, key, err := cli.Enroll(ctx, fakeAdminName, fakeAdminSecret, nil)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(fakeAdminName, cert.Subject.CommonName)
+		sCtx.Require().Equal([]string{`peer0.org1.example.com`}, cert.DNSNames)
+		ecKey, ok := key.(*ecdsa.PrivateKey)
+		sCtx.Require().True(ok)
+		sCtx.Require().Equal(elliptic.P384(), ecKey.Curve)
+		sCtx.Require().Equal(ecKey.Public(), cert.PublicKey)
+
+		signer, err := cacrypto.NewSigner(cert, key)
+		sCtx.Require().NoError(err)
+		cli, err = client.NewHttp(client.WithYamlConfig(path), client.WithIdentity(signer))
+		sCtx.Require().NoError(err)
+		cert, key, err = cli.Reenroll(ctx, &x509.CertificateRequest{})
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(fakeAdminName, cert.Subject.CommonName)
+		sCtx.Require().Equal(elliptic.P384(), key.(*ecdsa.PrivateKey).Curve)
+	})
+}
+
+func TestCSR(t *testing.T) {
+	suite.RunSuite(t, new(CSRSuite))
+}
@@ -0,0 +1,78 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hlfans/ca-sdk/pkg/client"
+	"github.com/hlfans/ca-sdk/pkg/request"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+)
+
+type ErrorsSuite struct {
+	suite.Suite
+}
+
+func (s *ErrorsSuite) TestTypedErrors(t provider.T) {
+	ca := newFakeCA()
+	defer ca.Close()
+	ctx := context.Background()
+	admin := ca.adminClient()
+
+	t.WithNewStep("Authentication failure", func(sCtx provider.StepCtx) {
+		_, _, err := ca.newClient(nil).Enroll(ctx, fakeAdminName, `wrong`, newCSR(fakeAdminName))
+		sCtx.Require().ErrorIs(err, client.ErrAuthenticationFailure)
+		sCtx.Require().True(client.IsPermanent(err))
+
+		var respErr client.ResponseError
+		sCtx.Require().True(errors.As(err, &respErr))
+		sCtx.Require().Equal(http.StatusUnauthorized, respErr.Status)
+		sCtx.Require().True(respErr.HasCode(client.CodeAuthenticationFailure))
+	})
+
+	t.WithNewStep("Identity not found", func(sCtx provider.StepCtx) {
+		_, err := admin.IdentityGet(ctx, `missing`)
+		sCtx.Require().ErrorIs(err, client.ErrIdentityNotFound)
+	})
+
+	t.WithNewStep("Already registered", func(sCtx provider.StepCtx) {
+		_, err := admin.Register(ctx, request.Registration{Name: fakeAdminName, Type: `client`})
+		sCtx.Require().ErrorIs(err, client.ErrAlreadyRegistered)
+		sCtx.Require().False(errors.Is(err, client.ErrIdentityNotFound))
+	})
+
+	t.WithNewStep("Maximum enrollments reached", func(sCtx provider.StepCtx) {
+		_, err := admin.Register(ctx, request.Registration{Name: `once`, Type: `client`, Secret: `pw`, MaxEnrollments: 1})
+		sCtx.Require().NoError(err)
+		_, _, err = admin.Enroll(ctx, `once`, `pw`, newCSR(`once`))
+		sCtx.Require().NoError(err)
+		_, _, err = admin.Enroll(ctx, `once`, `pw`, newCSR(`once`))
+		sCtx.Require().ErrorIs(err, client.ErrMaxEnrollmentsReached)
+	})
+
+	t.WithNewStep("Affiliation already exists", func(sCtx provider.StepCtx) {
+		err := admin.AffiliationCreate(ctx, `org1`)
+		sCtx.Require().ErrorIs(err, client.ErrAffiliationExists)
+	})
+}
+
+func (s *ErrorsSuite) TestRetryableStatus(t provider.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(`<html>upstream unavailable</html>`))
+	}))
+	defer srv.Close()
+
+	_, err := (&fakeCA{Server: srv}).newClient(nil).CAInfo(context.Background())
+	var statusErr client.ErrUnexpectedHTTPStatus
+	t.Require().True(errors.As(err, &statusErr))
+	t.Require().True(client.IsRetryable(err))
+}
+
+func TestErrors(t *testing.T) {
+	suite.RunSuite(t, new(ErrorsSuite))
+}
@@ -0,0 +1,183 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hlfans/ca-sdk/pkg/client"
+	"github.com/hlfans/ca-sdk/pkg/crypto"
+	"github.com/hlfans/ca-sdk/pkg/est"
+	"github.com/hlfans/ca-sdk/pkg/request"
+	"github.com/hlfans/ca-sdk/pkg/verify"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+)
+
+type ESTSuite struct {
+	suite.Suite
+}
+
+func (s *ESTSuite) TestServer(t provider.T) {
+	ca := newFakeCA()
+	defer ca.Close()
+	ctx := context.Background()
+	admin := ca.adminClient()
+
+	_, err := admin.Register(ctx, request.Registration{Name: `device1`, Type: `client`, Secret: `device1pw`})
+	t.Require().NoError(err)
+
+	verifier, err := verify.New(ctx, admin)
+	t.Require().NoError(err)
+	oidECPublicKey := asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+
+	// device keys are known to test only, EST server reenrolls with identity client of device
+	deviceKeys := map[string]interface{}{}
+	lookup := func(_ context.Context, cert *x509.Certificate) (*est.Credentials, error) {
+		signer, err := crypto.NewSigner(cert, deviceKeys[cert.Subject.CommonName])
+		if err != nil {
+			return nil, err
+		}
+		return &est.Credentials{EnrollmentID: cert.Subject.CommonName, Client: ca.newClient(signer)}, nil
+	}
+
+	server, err := est.New(ctx, ca.newClient(nil),
+		est.WithAuthenticators(est.TLSClientAuth(verifier, lookup), est.BasicAuth()),
+		est.WithLabel(`tls`, client.EnrollProfileTls),
+		est.WithCSRAttrs(oidECPublicKey))
+	t.Require().NoError(err)
+
+	httpServer := httptest.NewUnstartedServer(server.Handler())
+	httpServer.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	httpServer.StartTLS()
+	defer httpServer.Close()
+
+	newCSRBody := func(cn string) ([]byte, *ecdsa.PrivateKey) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		t.Require().NoError(err)
+		der, err := x509.CreateCertificateRequest(rand.Reader, newCSR(cn), key)
+		t.Require().NoError(err)
+		return []byte(base64.StdEncoding.EncodeToString(der)), key
+	}
+
+	call := func(method, path string, body []byte, basic []string, certs ...tls.Certificate) (int, http.Header, []byte) {
+		transport := httpServer.Client().Transport.(*http.Transport).Clone()
+		transport.TLSClientConfig.Certificates = certs
+		req, err := http.NewRequest(method, httpServer.URL+est.PathPrefix+path, bytes.NewReader(body))
+		t.Require().NoError(err)
+		req.Header.Set(`Content-Type`, `application/pkcs10`)
+		if len(basic) == 2 {
+			req.SetBasicAuth(basic[0], basic[1])
+		}
+		resp, err := (&http.Client{Transport: transport}).Do(req)
+		t.Require().NoError(err)
+		defer resp.Body.Close()
+		out, err := io.ReadAll(resp.Body)
+		t.Require().NoError(err)
+		return resp.StatusCode, resp.Header, out
+	}
+
+	parseBundle := func(sCtx provider.StepCtx, body []byte) []*x509.Certificate {
+		der, err := base64.StdEncoding.DecodeString(string(body))
+		sCtx.Require().NoError(err)
+		certs, err := est.ParseCertsOnly(der)
+		sCtx.Require().NoError(err)
+		return certs
+	}
+
+	t.WithNewStep("CA certificates are served as PKCS#7", func(sCtx provider.StepCtx) {
+		status, header, body := call(http.MethodGet, `/cacerts`, nil, nil)
+		sCtx.Require().Equal(http.StatusOK, status)
+		sCtx.Require().Contains(header.Get(`Content-Type`), `application/pkcs7-mime`)
+		certs := parseBundle(sCtx, body)
+		sCtx.Require().Len(certs, 1)
+		sCtx.Require().Equal(ca.rootCert.Raw, certs[0].Raw)
+
+		status, _, _ = call(http.MethodGet, `/unknown/cacerts`, nil, nil)
+		sCtx.Require().Equal(http.StatusNotFound, status)
+	})
+
+	t.WithNewStep("CSR attributes are served", func(sCtx provider.StepCtx) {
+		status, header, body := call(http.MethodGet, `/csrattrs`, nil, nil)
+		sCtx.Require().Equal(http.StatusOK, status)
+		sCtx.Require().Equal(`application/csrattrs`, header.Get(`Content-Type`))
+		der, err := base64.StdEncoding.DecodeString(string(body))
+		sCtx.Require().NoError(err)
+		var oids []asn1.ObjectIdentifier
+		_, err = asn1.Unmarshal(der, &oids)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal([]asn1.ObjectIdentifier{oidECPublicKey}, oids)
+	})
+
+	t.WithNewStep("Enrollment requires credentials", func(sCtx provider.StepCtx) {
+		body, _ := newCSRBody(`device1`)
+		status, header, _ := call(http.MethodPost, `/simpleenroll`, body, nil)
+		sCtx.Require().Equal(http.StatusUnauthorized, status)
+		sCtx.Require().Contains(header.Get(`WWW-Authenticate`), `Basic`)
+
+		status, _, _ = call(http.MethodPost, `/simpleenroll`, body, []string{`device1`, `wrong`})
+		sCtx.Require().Equal(http.StatusUnauthorized, status)
+
+		status, _, _ = call(http.MethodPost, `/simpleenroll`, []byte(`not a csr`), []string{`device1`, `device1pw`})
+		sCtx.Require().Equal(http.StatusBadRequest, status)
+	})
+
+	var deviceCert tls.Certificate
+	t.WithNewStep("Enrollment with HTTP Basic", func(sCtx provider.StepCtx) {
+		body, key := newCSRBody(`device1`)
+		status, _, out := call(http.MethodPost, `/simpleenroll`, body, []string{`device1`, `device1pw`})
+		sCtx.Require().Equal(http.StatusOK, status, string(out))
+		certs := parseBundle(sCtx, out)
+		sCtx.Require().Len(certs, 1)
+		sCtx.Require().Equal(&key.PublicKey, certs[0].PublicKey)
+		sCtx.Require().NoError(certs[0].CheckSignatureFrom(ca.rootCert))
+
+		deviceKeys[`device1`] = key
+		deviceCert = tls.Certificate{Certificate: [][]byte{certs[0].Raw}, PrivateKey: key}
+	})
+
+	t.WithNewStep("Label selects profile", func(sCtx provider.StepCtx) {
+		body, _ := newCSRBody(`device1`)
+		status, _, out := call(http.MethodPost, `/tls/simpleenroll`, body, []string{`device1`, `device1pw`})
+		sCtx.Require().Equal(http.StatusOK, status, string(out))
+		certs := parseBundle(sCtx, out)
+		sCtx.Require().Contains(certs[0].ExtKeyUsage, x509.ExtKeyUsageServerAuth)
+	})
+
+	t.WithNewStep("Reenrollment with TLS client certificate", func(sCtx provider.StepCtx) {
+		body, key := newCSRBody(`device1`)
+		status, _, out := call(http.MethodPost, `/simplereenroll`, body, nil, deviceCert)
+		sCtx.Require().Equal(http.StatusOK, status, string(out))
+		certs := parseBundle(sCtx, out)
+		sCtx.Require().Equal(`device1`, certs[0].Subject.CommonName)
+		sCtx.Require().Equal(&key.PublicKey, certs[0].PublicKey)
+
+		body, _ = newCSRBody(`device2`)
+		status, _, _ = call(http.MethodPost, `/simplereenroll`, body, nil, deviceCert)
+		sCtx.Require().Equal(http.StatusBadRequest, status)
+	})
+
+	t.WithNewStep("Revoked client certificate is rejected", func(sCtx provider.StepCtx) {
+		_, err := admin.Revoke(ctx, request.RevocationRequest{Name: `device1`})
+		sCtx.Require().NoError(err)
+		verifier.Refresh()
+
+		body, _ := newCSRBody(`device1`)
+		status, _, _ := call(http.MethodPost, `/simplereenroll`, body, nil, deviceCert)
+		sCtx.Require().Equal(http.StatusUnauthorized, status)
+	})
+}
+
+func TestEST(t *testing.T) {
+	suite.RunSuite(t, new(ESTSuite))
+}
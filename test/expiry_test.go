@@ -0,0 +1,214 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hlfans/ca-sdk/pkg/bulk"
+	"github.com/hlfans/ca-sdk/pkg/expiry"
+	"github.com/hlfans/ca-sdk/pkg/operations"
+	"github.com/hlfans/ca-sdk/pkg/request"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+)
+
+type ExpirySuite struct {
+	suite.Suite
+}
+
+func (s *ExpirySuite) TestInventory(t provider.T) {
+	ctx := context.Background()
+	ca1, ca2 := newFakeCA(), newFakeCA()
+	defer ca1.Close()
+	defer ca2.Close()
+	admin1, admin2 := ca1.adminClient(), ca2.adminClient()
+
+	engine, err := bulk.New(admin1)
+	t.Require().NoError(err)
+	report, err := engine.Run(ctx, []bulk.Item{
+		{Name: `peer0`, Secret: `peer0pw`, Type: `peer`, Affiliation: `org1`, Profile: `tls`},
+		{Name: `user1`, Secret: `user1pw`, Affiliation: `org1.department1`},
+		{Name: `user2`, Secret: `user2pw`, Affiliation: `org1`},
+	})
+	t.Require().NoError(err)
+	t.Require().Equal(3, report.Succeeded)
+	_, err = admin1.Revoke(ctx, request.RevocationRequest{Name: `user2`})
+	t.Require().NoError(err)
+
+	engine, err = bulk.New(admin2)
+	t.Require().NoError(err)
+	_, err = engine.Run(ctx, []bulk.Item{{Name: `orderer0`, Secret: `orderer0pw`, Type: `orderer`, Affiliation: `org2`}})
+	t.Require().NoError(err)
+
+	// certificates of fake CA are valid for 12 hours
+	now := time.Now().Add(11 * time.Hour)
+	inventory, err := expiry.New([]expiry.Source{{Name: `ca1`, Client: admin1}, {Name: `ca2`, Client: admin2}},
+		expiry.WithBuckets(2*time.Hour, 30*time.Minute, 48*time.Hour),
+		expiry.WithClock(func() time.Time { return now }))
+	t.Require().NoError(err)
+
+	t.WithNewStep("Active certificates are collected with identity details", func(sCtx provider.StepCtx) {
+		sCtx.Require().NoError(inventory.Refresh(ctx))
+		snap := inventory.Snapshot()
+		sCtx.Require().Empty(snap.Errors)
+
+		byName := map[string]expiry.Certificate{}
+		for _, c := range snap.Certificates {
+			byName[c.CA+`/`+c.EnrollmentID] = c
+		}
+		// bootstrap admins are enrolled by adminClient, revoked user2 isn't listed
+		sCtx.Require().Len(byName, 5)
+		sCtx.Require().NotContains(byName, `ca1/user2`)
+		sCtx.Require().Equal(`tls`, byName[`ca1/peer0`].Profile)
+		sCtx.Require().Equal(`default`, byName[`ca1/user1`].Profile)
+		sCtx.Require().Equal(`org1.department1`, byName[`ca1/user1`].Affiliation)
+		sCtx.Require().Equal(`orderer`, byName[`ca2/orderer0`].Type)
+
+		for i := 1; i < len(snap.Certificates); i++ {
+			sCtx.Require().False(snap.Certificates[i].NotAfter.Before(snap.Certificates[i-1].NotAfter))
+		}
+		sCtx.Require().Len(snap.Expiring(2*time.Hour), 5)
+		sCtx.Require().Empty(snap.Expiring(30 * time.Minute))
+	})
+
+	t.WithNewStep("Expiry is exposed as Prometheus gauges", func(sCtx provider.StepCtx) {
+		srv := httptest.NewServer(inventory.Handler())
+		defer srv.Close()
+		resp, err := http.Get(srv.URL)
+		sCtx.Require().NoError(err)
+		defer func() { _ = resp.Body.Close() }()
+		sCtx.Require().Contains(resp.Header.Get(`Content-Type`), `text/plain`)
+
+		families, err := operations.ParseMetrics(resp.Body)
+		sCtx.Require().NoError(err)
+
+		seconds, ok := operations.Find(families, `fabric_ca_certificate_expiry_seconds`)
+		sCtx.Require().True(ok)
+		sCtx.Require().Equal(operations.MetricTypeGauge, seconds.Type)
+		sCtx.Require().Len(seconds.Samples, 5)
+		for _, sample := range seconds.Samples {
+			if sample.Labels[`enrollment_id`] == `peer0` {
+				sCtx.Require().Equal(map[string]string{`ca`: `ca1`, `enrollment_id`: `peer0`, `affiliation`: ``,
+					`profile`: `tls`}, sample.Labels)
+				sCtx.Require().InDelta(time.Hour.Seconds(), sample.Value, 120)
+			}
+		}
+
+		expiring, ok := operations.Find(families, `fabric_ca_certificates_expiring`)
+		sCtx.Require().True(ok)
+		values := map[string]float64{}
+		for _, sample := range expiring.Samples {
+			values[sample.Labels[`within`]] += sample.Value
+		}
+		sCtx.Require().Equal(map[string]float64{`30m0s`: 0, `2h0m0s`: 5, `2d`: 5}, values)
+
+		counts, ok := operations.Find(families, `fabric_ca_certificates`)
+		sCtx.Require().True(ok)
+		var total float64
+		for _, sample := range counts.Samples {
+			total += sample.Value
+		}
+		sCtx.Require().Equal(float64(5), total)
+
+		up, ok := operations.Find(families, `fabric_ca_certificate_inventory_up`)
+		sCtx.Require().True(ok)
+		sCtx.Require().Len(up.Samples, 2)
+		sCtx.Require().Equal(float64(1), up.Samples[0].Value)
+	})
+
+	t.WithNewStep("Failed CA is reported down and keeps previous certificates", func(sCtx provider.StepCtx) {
+		ca2.Close()
+		sCtx.Require().Error(inventory.Refresh(ctx))
+
+		snap := inventory.Snapshot()
+		sCtx.Require().Contains(snap.Errors, `ca2`)
+		sCtx.Require().Len(snap.Certificates, 5)
+
+		var metrics bytes.Buffer
+		sCtx.Require().NoError(inventory.WriteMetrics(&metrics))
+		families, err := operations.ParseMetrics(&metrics)
+		sCtx.Require().NoError(err)
+		up, _ := operations.Find(families, `fabric_ca_certificate_inventory_up`)
+		for _, sample := range up.Samples {
+			sCtx.Require().Equal(sample.Labels[`ca`] == `ca1`, sample.Value == 1)
+		}
+	})
+
+	t.WithNewStep("Expiry report is rendered in JSON, CSV and Markdown", func(sCtx provider.StepCtx) {
+		report := expiry.NewReport(inventory.Snapshot(), 2*time.Hour)
+		sCtx.Require().Len(report.Entries, 5)
+		sCtx.Require().Equal(`2h0m0s`, report.Within)
+		sCtx.Require().Equal(0, report.Entries[0].DaysLeft)
+
+		var out bytes.Buffer
+		sCtx.Require().NoError(report.Write(&out, expiry.FormatJSON))
+		var doc struct {
+			Entries []map[string]interface{} `json:"entries"`
+			Errors  map[string]string        `json:"errors"`
+		}
+		sCtx.Require().NoError(json.Unmarshal(out.Bytes(), &doc))
+		sCtx.Require().Len(doc.Entries, 5)
+		sCtx.Require().Contains(doc.Entries[0], `enrollment_id`)
+		sCtx.Require().Contains(doc.Errors, `ca2`)
+
+		out.Reset()
+		sCtx.Require().NoError(report.Write(&out, expiry.FormatCSV))
+		records, err := csv.NewReader(&out).ReadAll()
+		sCtx.Require().NoError(err)
+		sCtx.Require().Len(records, 6)
+		sCtx.Require().Equal(`enrollment_id`, records[0][1])
+
+		format, err := expiry.ParseFormat(`md`)
+		sCtx.Require().NoError(err)
+		out.Reset()
+		sCtx.Require().NoError(report.Write(&out, format))
+		markdown := out.String()
+		sCtx.Require().Contains(markdown, `| ca | enrollment_id |`)
+		// TLS certificates don't embed attributes, so type and affiliation are unknown
+		sCtx.Require().Contains(markdown, `| ca1 | peer0 |  |  | tls |`)
+		sCtx.Require().Equal(5+2, strings.Count(markdown, "|\n"))
+		sCtx.Require().Contains(markdown, `- ca2: `)
+
+		_, err = expiry.ParseFormat(`xml`)
+		sCtx.Require().Error(err)
+	})
+}
+
+func (s *ExpirySuite) TestRenewedIdentity(t provider.T) {
+	ca := newFakeCA()
+	defer ca.Close()
+	admin := ca.adminClient()
+	// admin is enrolled again, the first certificate is superseded but still active
+	ca.enroll(fakeAdminName, fakeAdminSecret)
+
+	now := time.Now().Add(11 * time.Hour)
+	inventory, err := expiry.New([]expiry.Source{{Name: `ca1`, Client: admin}},
+		expiry.WithBuckets(2*time.Hour), expiry.WithClock(func() time.Time { return now }))
+	t.Require().NoError(err)
+	t.Require().NoError(inventory.Refresh(context.Background()))
+
+	var metrics bytes.Buffer
+	t.Require().NoError(inventory.WriteMetrics(&metrics))
+	families, err := operations.ParseMetrics(&metrics)
+	t.Require().NoError(err)
+
+	counts, _ := operations.Find(families, `fabric_ca_certificates`)
+	t.Require().Len(counts.Samples, 1)
+	t.Require().Equal(float64(2), counts.Samples[0].Value)
+	seconds, _ := operations.Find(families, `fabric_ca_certificate_expiry_seconds`)
+	t.Require().Len(seconds.Samples, 1)
+	expiring, _ := operations.Find(families, `fabric_ca_certificates_expiring`)
+	t.Require().Len(expiring.Samples, 1)
+	t.Require().Equal(float64(1), expiring.Samples[0].Value, `only the latest certificate of identity is bucketed`)
+}
+
+func TestExpiry(t *testing.T) {
+	suite.RunSuite(t, new(ExpirySuite))
+}
@@ -0,0 +1,198 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hlfans/ca-sdk/pkg/client"
+	"github.com/hlfans/ca-sdk/pkg/config"
+	"github.com/hlfans/ca-sdk/pkg/crypto"
+	"github.com/hlfans/ca-sdk/pkg/request"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+)
+
+type FailoverSuite struct {
+	suite.Suite
+}
+
+func (s *FailoverSuite) TestRoundRobin(t provider.T) {
+	ca1, ca2 := newFakeCA(), newFakeCA()
+	defer ca1.Close()
+	defer ca2.Close()
+
+	cli, err := client.NewHttp(client.WithRawConfig(&config.CAConfig{
+		Endpoints: []config.EndpointConfig{{Host: ca1.URL}, {Host: ca2.URL}},
+	}))
+	t.Require().NoError(err)
+
+	for i := 0; i < 4; i++ {
+		_, err = cli.CAInfo(context.Background())
+		t.Require().NoError(err)
+	}
+	t.Require().Equal(2, ca1.requestCount())
+	t.Require().Equal(2, ca2.requestCount())
+}
+
+func (s *FailoverSuite) TestPassiveEjection(t provider.T) {
+	ca := newFakeCA()
+	defer ca.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	conf := &config.CAConfig{
+		Endpoints: []config.EndpointConfig{{Host: down.URL}, {Host: ca.URL}},
+		Failover:  config.FailoverConfig{MaxFailures: 1, EjectDuration: time.Minute},
+	}
+	pool, err := client.NewEndpointPool(conf, nil)
+	t.Require().NoError(err)
+
+	cli, err := client.NewHttp(client.WithRawConfig(conf), client.WithEndpointPool(pool), client.WithRetry(testRetryPolicy))
+	t.Require().NoError(err)
+
+	for i := 0; i < 4; i++ {
+		_, err = cli.CAInfo(context.Background())
+		t.Require().NoError(err)
+	}
+	t.Require().Equal(4, ca.requestCount())
+
+	status := pool.Status()
+	t.Require().False(status[0].Healthy)
+	t.Require().True(status[1].Healthy)
+}
+
+func (s *FailoverSuite) TestPriority(t provider.T) {
+	primary, secondary := newFakeCA(), newFakeCA()
+	defer secondary.Close()
+
+	conf := &config.CAConfig{
+		Endpoints: []config.EndpointConfig{{Host: secondary.URL, Priority: 1}, {Host: primary.URL}},
+		Failover:  config.FailoverConfig{Selection: client.SelectionPriority, MaxFailures: 1},
+	}
+	cli, err := client.NewHttp(client.WithRawConfig(conf), client.WithRetry(testRetryPolicy))
+	t.Require().NoError(err)
+
+	for i := 0; i < 3; i++ {
+		_, err = cli.CAInfo(context.Background())
+		t.Require().NoError(err)
+	}
+	t.Require().Equal(3, primary.requestCount())
+	t.Require().Equal(0, secondary.requestCount())
+
+	primary.Close()
+	for i := 0; i < 3; i++ {
+		_, err = cli.CAInfo(context.Background())
+		t.Require().NoError(err)
+	}
+	t.Require().Equal(3, secondary.requestCount())
+}
+
+func (s *FailoverSuite) TestActiveHealthCheck(t provider.T) {
+	ca1, ca2 := newFakeCA(), newFakeCA()
+	defer ca1.Close()
+	defer ca2.Close()
+
+	var healthy atomic.Bool
+	health := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer health.Close()
+
+	pool, err := client.NewEndpointPool(&config.CAConfig{
+		Endpoints: []config.EndpointConfig{{Host: ca1.URL, HealthURL: health.URL + `/healthz`}, {Host: ca2.URL}},
+	}, nil)
+	t.Require().NoError(err)
+
+	pool.CheckHealth(context.Background())
+	t.Require().False(pool.Status()[0].Healthy)
+	t.Require().True(pool.Status()[1].Healthy)
+
+	healthy.Store(true)
+	pool.CheckHealth(context.Background())
+	t.Require().True(pool.Status()[0].Healthy)
+}
+
+func (s *FailoverSuite) TestStickyEndpoint(t provider.T) {
+	ca1, ca2 := newFakeCA(), newFakeCA()
+	defer ca1.Close()
+	defer ca2.Close()
+
+	conf := &config.CAConfig{Endpoints: []config.EndpointConfig{{Host: ca1.URL}, {Host: ca2.URL}}}
+	anonymous, err := client.NewHttp(client.WithRawConfig(conf))
+	t.Require().NoError(err)
+
+	// replicas don't share state, so sequence succeeds only if it is routed to single replica
+	ctx := client.WithStickyEndpoint(context.Background())
+	cert, key, err := anonymous.Enroll(ctx, fakeAdminName, fakeAdminSecret, newCSR(fakeAdminName))
+	t.Require().NoError(err)
+	signer, err := crypto.NewSigner(cert, key)
+	t.Require().NoError(err)
+
+	admin, err := client.NewHttp(client.WithRawConfig(conf), client.WithIdentity(signer))
+	t.Require().NoError(err)
+	for _, name := range []string{`user1`, `user2`, `user3`} {
+		_, err = admin.Register(ctx, request.Registration{Name: name, Type: `client`})
+		t.Require().NoError(err)
+	}
+}
+
+func (s *FailoverSuite) TestApplicationErrors(t provider.T) {
+	var status atomic.Int32
+	status.Store(http.StatusInternalServerError)
+	ca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(int(status.Load()))
+		if status.Load() == http.StatusInternalServerError {
+			_, _ = w.Write([]byte(`{"success":false,"result":null,"errors":[{"code":0,"message":"invalid request"}]}`))
+		}
+	}))
+	defer ca.Close()
+
+	pool, err := client.NewEndpointPool(&config.CAConfig{
+		Endpoints: []config.EndpointConfig{{Host: ca.URL}},
+		Failover:  config.FailoverConfig{MaxFailures: 1, EjectDuration: time.Minute},
+	}, nil)
+	t.Require().NoError(err)
+	cli, err := client.NewHttp(client.WithRawConfig(&config.CAConfig{}), client.WithEndpointPool(pool))
+	t.Require().NoError(err)
+
+	_, err = cli.CAInfo(context.Background())
+	t.Require().Error(err)
+	t.Require().True(pool.Status()[0].Healthy)
+
+	status.Store(http.StatusServiceUnavailable)
+	_, err = cli.CAInfo(context.Background())
+	t.Require().Error(err)
+	t.Require().False(pool.Status()[0].Healthy)
+}
+
+func (s *FailoverSuite) TestEndpointBasePath(t provider.T) {
+	ca := newFakeCA()
+	defer ca.Close()
+	target, err := url.Parse(ca.URL)
+	t.Require().NoError(err)
+	ingress := httptest.NewServer(http.StripPrefix(`/org1-ca`, httputil.NewSingleHostReverseProxy(target)))
+	defer ingress.Close()
+
+	cli, err := client.NewHttp(client.WithRawConfig(&config.CAConfig{
+		Endpoints: []config.EndpointConfig{{Host: ingress.URL + `/org1-ca/`}},
+	}))
+	t.Require().NoError(err)
+
+	_, err = cli.CAInfo(context.Background())
+	t.Require().NoError(err)
+	_, _, err = cli.Enroll(context.Background(), fakeAdminName, fakeAdminSecret, newCSR(fakeAdminName))
+	t.Require().NoError(err)
+	t.Require().Equal(2, ca.requestCount())
+}
+
+func TestFailover(t *testing.T) {
+	suite.RunSuite(t, new(FailoverSuite))
+}
@@ -0,0 +1,700 @@
+package test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/cfssl/signer"
+	"github.com/hlfans/ca-sdk/pkg/client"
+	"github.com/hlfans/ca-sdk/pkg/config"
+	"github.com/hlfans/ca-sdk/pkg/crypto"
+	"github.com/hlfans/ca-sdk/pkg/entity"
+	"github.com/hlfans/ca-sdk/pkg/request"
+	"github.com/hlfans/ca-sdk/pkg/response"
+)
+
+const (
+	fakeCAName        = `fake-ca`
+	fakeAdminName     = `admin`
+	fakeAdminSecret   = `adminpw`
+	fakeCodeAuthN     = 20
+	fakeCodeNotFound  = 63
+	fakeCodeAuthZ     = 71
+	fakeCodeRegistred = 74
+)
+
+// fakeCA is in-memory stand-in for Fabric CA REST API used by tests which can't rely on docker
+type fakeCA struct {
+	*httptest.Server
+
+	mu           sync.Mutex
+	rootKey      *ecdsa.PrivateKey
+	rootCert     *x509.Certificate
+	identities   map[string]*fakeIdentity
+	affiliations map[string]struct{}
+	issued       []*x509.Certificate
+	revoked      map[string]fakeRevocation
+	crlNumber    int64
+	serial       int64
+	requests     int
+}
+
+type fakeIdentity struct {
+	entity.Identity
+	secret      string
+	enrollments int
+	revoked     bool
+}
+
+type fakeRevocation struct {
+	at     time.Time
+	reason int
+}
+
+// fakeRevocationReasons are reasons accepted by Fabric CA, see ocsp.RevocationReasonCode
+var fakeRevocationReasons = map[string]int{
+	`unspecified`: 0, `keycompromise`: 1, `cacompromise`: 2, `affiliationchange`: 3, `superseded`: 4,
+	`cessationofoperation`: 5, `certificatehold`: 6, `removefromcrl`: 8, `privilegewithdrawn`: 9, `aacompromise`: 10,
+}
+
+func newFakeCA() *fakeCA {
+	ca := &fakeCA{
+		identities:   map[string]*fakeIdentity{},
+		affiliations: map[string]struct{}{},
+		revoked:      map[string]fakeRevocation{},
+		serial:       1,
+	}
+
+	var err error
+	if ca.rootKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		panic(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: fakeCAName, Organization: []string{`Hyperledger`}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		SubjectKeyId:          []byte{1, 2, 3, 4},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &ca.rootKey.PublicKey, ca.rootKey)
+	if err != nil {
+		panic(err)
+	}
+	if ca.rootCert, err = x509.ParseCertificate(der); err != nil {
+		panic(err)
+	}
+
+	ca.identities[fakeAdminName] = &fakeIdentity{
+		Identity: entity.Identity{Id: fakeAdminName, Type: `client`, MaxEnrollments: -1, Attrs: []entity.IdentityAttribute{
+			{Name: `hf.Registrar.Roles`, Value: `*`}, {Name: `hf.Revoker`, Value: `true`},
+			{Name: `hf.GenCRL`, Value: `true`},
+		}},
+		secret: fakeAdminSecret,
+	}
+	for _, a := range []string{`org1`, `org1.department1`, `org2`} {
+		ca.affiliations[a] = struct{}{}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(`GET /api/v1/cainfo`, ca.handleCAInfo)
+	mux.HandleFunc(`POST /api/v1/enroll`, ca.handleEnroll)
+	mux.HandleFunc(`POST /api/v1/reenroll`, ca.authenticated(ca.handleReenroll))
+	mux.HandleFunc(`POST /api/v1/register`, ca.authenticated(ca.handleRegister))
+	mux.HandleFunc(`GET /api/v1/identities`, ca.authenticated(ca.handleIdentityList))
+	mux.HandleFunc(`GET /api/v1/identities/{id}`, ca.authenticated(ca.handleIdentityGet))
+	mux.HandleFunc(`GET /api/v1/affiliations`, ca.authenticated(ca.handleAffiliationList))
+	mux.HandleFunc(`POST /api/v1/affiliations`, ca.authenticated(ca.handleAffiliationCreate))
+	mux.HandleFunc(`GET /api/v1/certificates`, ca.authenticated(ca.handleCertificateList))
+	mux.HandleFunc(`POST /api/v1/revoke`, ca.authenticated(ca.handleRevoke))
+	mux.HandleFunc(`POST /api/v1/gencrl`, ca.authenticated(ca.handleGenCRL))
+
+	ca.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ca.mu.Lock()
+		ca.requests++
+		ca.mu.Unlock()
+		mux.ServeHTTP(w, r)
+	}))
+	return ca
+}
+
+func (ca *fakeCA) requestCount() int {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	return ca.requests
+}
+
+func (ca *fakeCA) chainPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: `CERTIFICATE`, Bytes: ca.rootCert.Raw})
+}
+
+func (ca *fakeCA) writeResult(w http.ResponseWriter, status int, result interface{}) {
+	raw, _ := json.Marshal(result)
+	w.Header().Set(`Content-Type`, `application/json`)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(response.Response{Success: true, Result: raw, Errors: []response.Message{}, Messages: []response.Message{}})
+}
+
+func (ca *fakeCA) writeError(w http.ResponseWriter, status, code int, format string, args ...interface{}) {
+	w.Header().Set(`Content-Type`, `application/json`)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(response.Response{
+		Success:  false,
+		Result:   json.RawMessage(`null`),
+		Errors:   []response.Message{{Code: code, Message: fmt.Sprintf(format, args...)}},
+		Messages: []response.Message{},
+	})
+}
+
+func (ca *fakeCA) handleCAInfo(w http.ResponseWriter, _ *http.Request) {
+	ca.writeResult(w, http.StatusOK, response.CAInfo{
+		CAName:  fakeCAName,
+		CAChain: base64.StdEncoding.EncodeToString(ca.chainPEM()),
+		Version: `1.5.0`,
+	})
+}
+
+func (ca *fakeCA) handleEnroll(w http.ResponseWriter, r *http.Request) {
+	name, secret, ok := r.BasicAuth()
+	if !ok {
+		ca.writeError(w, http.StatusUnauthorized, fakeCodeAuthN, `Authentication failure`)
+		return
+	}
+
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	identity, ok := ca.identities[name]
+	if !ok || identity.secret != secret || identity.revoked {
+		ca.writeError(w, http.StatusUnauthorized, fakeCodeAuthN, `Authentication failure`)
+		return
+	}
+	if identity.MaxEnrollments > 0 && identity.enrollments >= identity.MaxEnrollments {
+		ca.writeError(w, http.StatusUnauthorized, fakeCodeAuthN,
+			`The identity %s has already enrolled %d times, it has reached its maximum enrollment of %d`,
+			name, identity.enrollments, identity.MaxEnrollments)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		ca.writeError(w, http.StatusBadRequest, 3, `read body: %s`, err)
+		return
+	}
+	signReq, csr, err := parseSignRequest(body)
+	if err != nil {
+		ca.writeError(w, http.StatusBadRequest, 5, `%s`, err)
+		return
+	}
+
+	if csr.Subject.CommonName != name {
+		ca.writeError(w, http.StatusBadRequest, 5, `The CSR subject common name must equal the enrollment ID`)
+		return
+	}
+	if signReq.Profile == `ca` && identity.attr(request.AttrIntermediateCA) != `true` {
+		ca.writeError(w, http.StatusUnauthorized, fakeCodeAuthZ,
+			`Authorization failure: identity '%s' is not allowed to enroll an intermediate CA`, name)
+		return
+	}
+
+	cert, err := ca.issue(identity, csr, signReq.Profile)
+	if err != nil {
+		ca.writeError(w, http.StatusInternalServerError, 0, `Certificate signing failure: %s`, err)
+		return
+	}
+	identity.enrollments++
+
+	ca.writeResult(w, http.StatusCreated, response.Enrollment{
+		Cert: base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: `CERTIFICATE`, Bytes: cert.Raw})),
+		ServerInfo: response.CAInfo{
+			CAName:  fakeCAName,
+			CAChain: base64.StdEncoding.EncodeToString(ca.chainPEM()),
+		},
+	})
+}
+
+func (ca *fakeCA) handleReenroll(w http.ResponseWriter, _ *http.Request, caller *fakeIdentity, body []byte) {
+	signReq, csr, err := parseSignRequest(body)
+	if err != nil {
+		ca.writeError(w, http.StatusBadRequest, 5, `%s`, err)
+		return
+	}
+	if caller.revoked {
+		ca.writeError(w, http.StatusUnauthorized, fakeCodeAuthN, `Authentication failure`)
+		return
+	}
+
+	cert, err := ca.issue(caller, csr, signReq.Profile)
+	if err != nil {
+		ca.writeError(w, http.StatusInternalServerError, 0, `Certificate signing failure: %s`, err)
+		return
+	}
+	ca.writeResult(w, http.StatusCreated, response.Enrollment{
+		Cert: base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: `CERTIFICATE`, Bytes: cert.Raw})),
+		ServerInfo: response.CAInfo{
+			CAName:  fakeCAName,
+			CAChain: base64.StdEncoding.EncodeToString(ca.chainPEM()),
+		},
+	})
+}
+
+func parseSignRequest(body []byte) (*signer.SignRequest, *x509.CertificateRequest, error) {
+	var signReq signer.SignRequest
+	if err := json.Unmarshal(body, &signReq); err != nil {
+		return nil, nil, fmt.Errorf(`invalid request body: %s`, err)
+	}
+	block, _ := pem.Decode([]byte(signReq.Request))
+	if block == nil {
+		return nil, nil, fmt.Errorf(`invalid CSR`)
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf(`invalid CSR: %v`, err)
+	}
+	if err = csr.CheckSignature(); err != nil {
+		return nil, nil, fmt.Errorf(`invalid CSR signature: %v`, err)
+	}
+	return &signReq, csr, nil
+}
+
+// issue signs CSR, must be called with ca.mu held
+func (ca *fakeCA) issue(identity *fakeIdentity, csr *x509.CertificateRequest, profile string) (*x509.Certificate, error) {
+	ca.serial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(ca.serial),
+		Subject: pkix.Name{
+			CommonName:         csr.Subject.CommonName,
+			OrganizationalUnit: []string{identity.Type},
+		},
+		NotBefore:      time.Now().Add(-time.Minute),
+		NotAfter:       time.Now().Add(12 * time.Hour),
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		DNSNames:       csr.DNSNames,
+		IPAddresses:    csr.IPAddresses,
+		EmailAddresses: csr.EmailAddresses,
+		URIs:           csr.URIs,
+		AuthorityKeyId: ca.rootCert.SubjectKeyId,
+	}
+	switch profile {
+	case `ca`:
+		// like ca profile of Fabric CA, copy basic constraints requested in CSR
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+		template.BasicConstraintsValid, template.IsCA = true, true
+		template.MaxPathLenZero = true
+		for _, ext := range csr.Extensions {
+			if ext.Id.Equal(asn1.ObjectIdentifier{2, 5, 29, 19}) {
+				var constraints struct {
+					IsCA       bool `asn1:"optional"`
+					MaxPathLen int  `asn1:"optional,default:-1"`
+				}
+				if _, err := asn1.Unmarshal(ext.Value, &constraints); err == nil && constraints.MaxPathLen > 0 {
+					template.MaxPathLen = constraints.MaxPathLen
+				}
+			}
+		}
+	case `ocsp`:
+		// custom profile of delegated OCSP responder
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning}
+	case `tls`:
+		template.KeyUsage |= x509.KeyUsageKeyEncipherment | x509.KeyUsageKeyAgreement
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	default:
+		// like Fabric CA, embed hf.* and ecert attributes to ECert
+		attrs := map[string]string{
+			`hf.EnrollmentID`: identity.Id,
+			`hf.Type`:         identity.Type,
+			`hf.Affiliation`:  identity.Affiliation,
+		}
+		for _, a := range identity.Attrs {
+			if a.ECert {
+				attrs[a.Name] = a.Value
+			}
+		}
+		value, _ := json.Marshal(map[string]interface{}{`attrs`: attrs})
+		template.ExtraExtensions = []pkix.Extension{{Id: asn1.ObjectIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 1}, Value: value}}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.rootCert, csr.PublicKey, ca.rootKey)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	ca.issued = append(ca.issued, cert)
+	return cert, nil
+}
+
+type fakeHandler func(w http.ResponseWriter, r *http.Request, caller *fakeIdentity, body []byte)
+
+// authenticated checks Fabric CA authorization token `base64(cert).base64(signature)`
+func (ca *fakeCA) authenticated(next fakeHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			ca.writeError(w, http.StatusBadRequest, 3, `read body: %s`, err)
+			return
+		}
+
+		parts := strings.Split(r.Header.Get(`Authorization`), `.`)
+		if len(parts) != 2 {
+			ca.writeError(w, http.StatusUnauthorized, 2, `No authorization header`)
+			return
+		}
+		certPEM, err := base64.StdEncoding.DecodeString(parts[0])
+		if err != nil {
+			ca.writeError(w, http.StatusUnauthorized, 6, `invalid token`)
+			return
+		}
+		sig, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			ca.writeError(w, http.StatusUnauthorized, 6, `invalid token`)
+			return
+		}
+		block, _ := pem.Decode(certPEM)
+		if block == nil {
+			ca.writeError(w, http.StatusUnauthorized, 6, `invalid token certificate`)
+			return
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil || cert.CheckSignatureFrom(ca.rootCert) != nil {
+			ca.writeError(w, http.StatusUnauthorized, 6, `untrusted token certificate`)
+			return
+		}
+
+		payload := strings.Join([]string{
+			r.Method,
+			base64.URLEncoding.EncodeToString([]byte(r.URL.Path)),
+			base64.StdEncoding.EncodeToString(body),
+			parts[0],
+		}, `.`)
+		digest := sha256.Sum256([]byte(payload))
+		pub, ok := cert.PublicKey.(*ecdsa.PublicKey)
+		if !ok || !ecdsa.VerifyASN1(pub, digest[:], sig) {
+			ca.writeError(w, http.StatusUnauthorized, 6, `invalid token signature`)
+			return
+		}
+
+		ca.mu.Lock()
+		defer ca.mu.Unlock()
+		caller, ok := ca.identities[cert.Subject.CommonName]
+		if !ok {
+			ca.writeError(w, http.StatusUnauthorized, fakeCodeAuthN, `Authentication failure`)
+			return
+		}
+		next(w, r, caller, body)
+	}
+}
+
+func (ca *fakeCA) handleRegister(w http.ResponseWriter, _ *http.Request, caller *fakeIdentity, body []byte) {
+	if caller.attr(`hf.Registrar.Roles`) == `` {
+		ca.writeError(w, http.StatusUnauthorized, fakeCodeAuthZ, `Authorization failure`)
+		return
+	}
+
+	var req request.Registration
+	if err := json.Unmarshal(body, &req); err != nil {
+		ca.writeError(w, http.StatusBadRequest, 5, `invalid request body: %s`, err)
+		return
+	}
+	if _, ok := ca.identities[req.Name]; ok {
+		ca.writeError(w, http.StatusForbidden, fakeCodeRegistred, `Registration of '%s' failed: Identity '%s' is already registered`, req.Name, req.Name)
+		return
+	}
+	if _, ok := ca.affiliations[req.Affiliation]; !ok && req.Affiliation != `` {
+		ca.writeError(w, http.StatusBadRequest, 0, `Registration of '%s' failed in affiliation validation: affiliation '%s' not found`, req.Name, req.Affiliation)
+		return
+	}
+
+	if req.Secret == `` {
+		req.Secret = fmt.Sprintf(`secret-%d`, len(ca.identities))
+	}
+	identity := &fakeIdentity{
+		Identity: entity.Identity{Id: req.Name, Type: req.Type, MaxEnrollments: req.MaxEnrollments, Affiliation: req.Affiliation},
+		secret:   req.Secret,
+	}
+	for _, a := range req.Attrs {
+		identity.Attrs = append(identity.Attrs, entity.IdentityAttribute{Name: a.Name, Value: a.Value, ECert: a.ECert})
+	}
+	ca.identities[req.Name] = identity
+
+	ca.writeResult(w, http.StatusCreated, response.Registration{Secret: req.Secret})
+}
+
+func (ca *fakeCA) handleIdentityList(w http.ResponseWriter, _ *http.Request, _ *fakeIdentity, _ []byte) {
+	var list response.IdentityList
+	for _, identity := range ca.identities {
+		list.Identities = append(list.Identities, identity.Identity)
+	}
+	sort.Slice(list.Identities, func(i, j int) bool { return list.Identities[i].Id < list.Identities[j].Id })
+	ca.writeResult(w, http.StatusOK, list)
+}
+
+func (ca *fakeCA) handleIdentityGet(w http.ResponseWriter, r *http.Request, _ *fakeIdentity, _ []byte) {
+	identity, ok := ca.identities[r.PathValue(`id`)]
+	if !ok {
+		ca.writeError(w, http.StatusNotFound, fakeCodeNotFound, `Failed to get User: sql: no rows in result set`)
+		return
+	}
+	ca.writeResult(w, http.StatusOK, identity.Identity)
+}
+
+func (ca *fakeCA) handleAffiliationList(w http.ResponseWriter, _ *http.Request, _ *fakeIdentity, _ []byte) {
+	names := make([]string, 0, len(ca.affiliations))
+	for name := range ca.affiliations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// build tree from flat dotted names
+	var build func(prefix string) []entity.Affiliation
+	build = func(prefix string) []entity.Affiliation {
+		var out []entity.Affiliation
+		for _, name := range names {
+			if !strings.HasPrefix(name, prefix) || strings.Contains(name[len(prefix):], `.`) {
+				continue
+			}
+			out = append(out, entity.Affiliation{Name: name, Affiliations: build(name + `.`)})
+		}
+		return out
+	}
+	ca.writeResult(w, http.StatusOK, response.AffiliationList{Affiliations: build(``), CAName: fakeCAName})
+}
+
+func (ca *fakeCA) handleAffiliationCreate(w http.ResponseWriter, r *http.Request, _ *fakeIdentity, body []byte) {
+	var req request.AddAffiliationRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		ca.writeError(w, http.StatusBadRequest, 5, `invalid request body: %s`, err)
+		return
+	}
+	if _, ok := ca.affiliations[req.Name]; ok {
+		ca.writeError(w, http.StatusBadRequest, 0, `Affiliation '%s' already exists`, req.Name)
+		return
+	}
+	parts := strings.Split(req.Name, `.`)
+	for i := 1; i < len(parts); i++ {
+		parent := strings.Join(parts[:i], `.`)
+		if _, ok := ca.affiliations[parent]; !ok {
+			if r.URL.Query().Get(`force`) != `true` {
+				ca.writeError(w, http.StatusBadRequest, 0, `Parent affiliation '%s' does not exist`, parent)
+				return
+			}
+			ca.affiliations[parent] = struct{}{}
+		}
+	}
+	ca.affiliations[req.Name] = struct{}{}
+	ca.writeResult(w, http.StatusCreated, response.AffiliationCreate{Name: req.Name, CAName: fakeCAName})
+}
+
+func (ca *fakeCA) handleCertificateList(w http.ResponseWriter, r *http.Request, _ *fakeIdentity, _ []byte) {
+	query := r.URL.Query()
+	id := query.Get(`id`)
+	list := response.CertificateList{CAName: fakeCAName}
+	for _, cert := range ca.issued {
+		if id != `` && cert.Subject.CommonName != id {
+			continue
+		}
+		_, revoked := ca.revoked[fmt.Sprintf(`%x`, cert.SerialNumber)]
+		expired := time.Now().After(cert.NotAfter)
+		if query.Get(`revoked`) == `true` && !revoked || query.Get(`notrevoked`) == `true` && revoked ||
+			query.Get(`expired`) == `true` && !expired || query.Get(`notexpired`) == `true` && expired {
+			continue
+		}
+		list.Certs = append(list.Certs, response.CertificateListPEM{
+			PEM: string(pem.EncodeToMemory(&pem.Block{Type: `CERTIFICATE`, Bytes: cert.Raw})),
+		})
+	}
+	ca.writeResult(w, http.StatusOK, list)
+}
+
+func (ca *fakeCA) handleRevoke(w http.ResponseWriter, _ *http.Request, caller *fakeIdentity, body []byte) {
+	if caller.attr(`hf.Revoker`) != `true` {
+		ca.writeError(w, http.StatusUnauthorized, fakeCodeAuthZ, `Authorization failure`)
+		return
+	}
+	var req request.RevocationRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		ca.writeError(w, http.StatusBadRequest, 5, `invalid request body: %s`, err)
+		return
+	}
+	reason, ok := fakeRevocationReasons[strings.ToLower(req.Reason)]
+	if req.Reason == `` {
+		reason, ok = 0, true
+	}
+	if !ok {
+		ca.writeError(w, http.StatusBadRequest, 5, `Invalid reason: %s`, req.Reason)
+		return
+	}
+
+	var result response.Revoke
+	for _, cert := range ca.issued {
+		serial := fmt.Sprintf(`%x`, cert.SerialNumber)
+		aki := fmt.Sprintf(`%x`, cert.AuthorityKeyId)
+		if req.Name != `` && cert.Subject.CommonName != req.Name ||
+			req.Name == `` && (!strings.EqualFold(strings.TrimLeft(req.Serial, `0`), serial) || !strings.EqualFold(req.AKI, aki)) {
+			continue
+		}
+		if _, ok := ca.revoked[serial]; ok {
+			continue
+		}
+		ca.revoked[serial] = fakeRevocation{at: time.Now().Truncate(time.Second), reason: reason}
+		result.RevokedCerts = append(result.RevokedCerts, entity.RevokedCert{Serial: serial, AKI: aki})
+	}
+	if req.Name != `` {
+		identity, ok := ca.identities[req.Name]
+		if !ok {
+			ca.writeError(w, http.StatusNotFound, fakeCodeNotFound, `Failed to get user: %s`, req.Name)
+			return
+		}
+		identity.revoked = true
+	} else if len(result.RevokedCerts) == 0 {
+		ca.writeError(w, http.StatusNotFound, 49, `Certificate with serial %s and AKI %s was not found`, req.Serial, req.AKI)
+		return
+	}
+
+	if req.GenCRL {
+		crl, err := ca.genCRL()
+		if err != nil {
+			ca.writeError(w, http.StatusInternalServerError, 0, `Failed to generate CRL: %s`, err)
+			return
+		}
+		result.CRL = crl
+	}
+	ca.writeResult(w, http.StatusOK, result)
+}
+
+func (ca *fakeCA) handleGenCRL(w http.ResponseWriter, _ *http.Request, caller *fakeIdentity, _ []byte) {
+	if caller.attr(`hf.GenCRL`) != `true` {
+		ca.writeError(w, http.StatusUnauthorized, fakeCodeAuthZ, `Authorization failure`)
+		return
+	}
+	crl, err := ca.genCRL()
+	if err != nil {
+		ca.writeError(w, http.StatusInternalServerError, 0, `Failed to generate CRL: %s`, err)
+		return
+	}
+	ca.writeResult(w, http.StatusOK, response.GenCRL{CRL: crl})
+}
+
+// genCRL returns PEM encoded CRL of revoked not expired certificates, must be called with ca.mu held
+func (ca *fakeCA) genCRL() ([]byte, error) {
+	ca.crlNumber++
+	template := &x509.RevocationList{
+		Number:     big.NewInt(ca.crlNumber),
+		ThisUpdate: time.Now().Add(-time.Minute),
+		NextUpdate: time.Now().Add(24 * time.Hour),
+	}
+	for _, cert := range ca.issued {
+		if r, ok := ca.revoked[fmt.Sprintf(`%x`, cert.SerialNumber)]; ok && time.Now().Before(cert.NotAfter) {
+			template.RevokedCertificateEntries = append(template.RevokedCertificateEntries, x509.RevocationListEntry{
+				SerialNumber: cert.SerialNumber, RevocationTime: r.at, ReasonCode: r.reason,
+			})
+		}
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, template, ca.rootCert, ca.rootKey)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: `X509 CRL`, Bytes: der}), nil
+}
+
+func (i *fakeIdentity) attr(name string) string {
+	for _, a := range i.Attrs {
+		if a.Name == name {
+			return a.Value
+		}
+	}
+	return ``
+}
+
+func newCSR(cn string) *x509.CertificateRequest {
+	return &x509.CertificateRequest{Subject: pkix.Name{CommonName: cn}}
+}
+
+// newSelfSignedSigner returns identity which is not issued by fake CA
+func newSelfSignedSigner(cn string) crypto.Signer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		panic(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(err)
+	}
+	signer, err := crypto.NewSigner(cert, key)
+	if err != nil {
+		panic(err)
+	}
+	return signer
+}
+
+// parseSignerCert returns certificate of signer
+func parseSignerCert(signer crypto.Signer) (*x509.Certificate, error) {
+	block, _ := pem.Decode(signer.Certificate())
+	if block == nil {
+		return nil, fmt.Errorf(`signer certificate is not PEM encoded`)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// newClient creates client of fake CA acting as signer, signer may be nil
+func (ca *fakeCA) newClient(signer crypto.Signer, opts ...client.HttpOpt) client.Client {
+	opts = append([]client.HttpOpt{client.WithRawConfig(&config.CAConfig{Host: ca.URL})}, opts...)
+	if signer != nil {
+		opts = append(opts, client.WithIdentity(signer))
+	}
+	cli, err := client.NewHttp(opts...)
+	if err != nil {
+		panic(err)
+	}
+	return cli
+}
+
+// enroll returns signer of identity enrolled on fake CA
+func (ca *fakeCA) enroll(name, secret string) crypto.Signer {
+	cert, key, err := ca.newClient(nil).Enroll(context.Background(), name, secret, newCSR(name))
+	if err != nil {
+		panic(err)
+	}
+	signer, err := crypto.NewSigner(cert, key)
+	if err != nil {
+		panic(err)
+	}
+	return signer
+}
+
+// adminClient returns client acting as CA bootstrap admin
+func (ca *fakeCA) adminClient(opts ...client.HttpOpt) client.Client {
+	return ca.newClient(ca.enroll(fakeAdminName, fakeAdminSecret), opts...)
+}
@@ -0,0 +1,77 @@
+package test
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hlfans/ca-sdk/pkg/client"
+	"github.com/hlfans/ca-sdk/pkg/intermediate"
+	"github.com/hlfans/ca-sdk/pkg/request"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+)
+
+type IntermediateSuite struct {
+	suite.Suite
+}
+
+func (s *IntermediateSuite) TestEnroll(t provider.T) {
+	ca := newFakeCA()
+	defer ca.Close()
+	ctx := context.Background()
+	admin := ca.adminClient()
+
+	reg, err := request.NewRegistration(`ica`, request.IdentityTypeClient).
+		WithSecret(`icapw`).WithIntermediateCA(true).Build()
+	t.Require().NoError(err)
+	_, err = admin.Register(ctx, reg)
+	t.Require().NoError(err)
+	_, err = admin.Register(ctx, request.Registration{Name: `plain`, Type: `client`, Secret: `plainpw`})
+	t.Require().NoError(err)
+
+	t.WithNewStep("Identity without hf.IntermediateCA is rejected", func(sCtx provider.StepCtx) {
+		_, err := intermediate.Enroll(ctx, admin, `plain`, `plainpw`)
+		sCtx.Require().ErrorIs(err, client.ErrAuthorizationFailure)
+	})
+
+	t.WithNewStep("CA certificate is enrolled and written", func(sCtx provider.StepCtx) {
+		bundle, err := intermediate.Enroll(ctx, admin, `ica`, `icapw`,
+			intermediate.WithPathLength(1), intermediate.WithHosts(`ica.example.com`))
+		sCtx.Require().NoError(err)
+		sCtx.Require().True(bundle.Cert.IsCA)
+		sCtx.Require().Equal(1, bundle.Cert.MaxPathLen)
+		sCtx.Require().Len(bundle.Chain, 2)
+
+		home := t.TempDir()
+		sCtx.Require().NoError(bundle.Write(home))
+
+		certPEM, err := os.ReadFile(filepath.Join(home, `ca-cert.pem`))
+		sCtx.Require().NoError(err)
+		block, _ := pem.Decode(certPEM)
+		sCtx.Require().NotNil(block)
+		sCtx.Require().Equal(bundle.Cert.Raw, block.Bytes)
+
+		chainPEM, err := os.ReadFile(filepath.Join(home, `ca-chain.pem`))
+		sCtx.Require().NoError(err)
+		var chain []*x509.Certificate
+		for block, rest := pem.Decode(chainPEM); block != nil; block, rest = pem.Decode(rest) {
+			cert, err := x509.ParseCertificate(block.Bytes)
+			sCtx.Require().NoError(err)
+			chain = append(chain, cert)
+		}
+		sCtx.Require().Len(chain, 2)
+		sCtx.Require().Equal(ca.rootCert.Raw, chain[1].Raw)
+
+		keys, err := filepath.Glob(filepath.Join(home, `msp`, `keystore`, `*_sk`))
+		sCtx.Require().NoError(err)
+		sCtx.Require().Len(keys, 1)
+	})
+}
+
+func TestIntermediate(t *testing.T) {
+	suite.RunSuite(t, new(IntermediateSuite))
+}
@@ -0,0 +1,55 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"log/slog"
+	"testing"
+
+	"github.com/hlfans/ca-sdk/pkg/client"
+	"github.com/hlfans/ca-sdk/pkg/request"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+)
+
+type LoggingSuite struct {
+	suite.Suite
+}
+
+func (s *LoggingSuite) TestWireDumpRedaction(t provider.T) {
+	ca := newFakeCA()
+	defer ca.Close()
+	ctx := context.Background()
+
+	buf := new(bytes.Buffer)
+	logger := slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	signer := ca.enroll(fakeAdminName, fakeAdminSecret)
+	cli := ca.newClient(signer, client.WithLogger(logger), client.WithWireDump())
+
+	_, _, err := cli.Enroll(ctx, fakeAdminName, fakeAdminSecret, newCSR(fakeAdminName))
+	t.Require().NoError(err)
+	_, err = cli.Register(ctx, request.Registration{Name: `user1`, Type: `client`, Secret: `top-secret-value`})
+	t.Require().NoError(err)
+	_, _, err = cli.Enroll(ctx, fakeAdminName, `wrong-password`, newCSR(fakeAdminName))
+	t.Require().Error(err)
+
+	out := buf.String()
+	t.Require().Contains(out, `"operation":"Register"`)
+	t.Require().Contains(out, `"ca_codes":[20]`)
+	t.Require().Contains(out, `<redacted>`)
+	for _, secret := range []string{
+		fakeAdminSecret,
+		`top-secret-value`,
+		`wrong-password`,
+		base64.StdEncoding.EncodeToString([]byte(fakeAdminName + `:` + fakeAdminSecret)),
+		base64.StdEncoding.EncodeToString(signer.Certificate()),
+	} {
+		t.Require().NotContains(out, secret)
+	}
+}
+
+func TestLogging(t *testing.T) {
+	suite.RunSuite(t, new(LoggingSuite))
+}
@@ -0,0 +1,143 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hlfans/ca-sdk/pkg/ocspresponder"
+	"github.com/hlfans/ca-sdk/pkg/request"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+	"golang.org/x/crypto/ocsp"
+)
+
+type OCSPSuite struct {
+	suite.Suite
+}
+
+func (s *OCSPSuite) TestResponder(t provider.T) {
+	ca := newFakeCA()
+	defer ca.Close()
+	ctx := context.Background()
+	admin := ca.adminClient()
+
+	enroll := func(name string) *x509.Certificate {
+		_, err := admin.Register(ctx, request.Registration{Name: name, Type: `client`, Secret: name + `pw`})
+		t.Require().NoError(err)
+		cert, _, err := ca.newClient(nil).Enroll(ctx, name, name+`pw`, newCSR(name))
+		t.Require().NoError(err)
+		return cert
+	}
+	good, revoked := enroll(`good`), enroll(`revoked`)
+	_, err := admin.Revoke(ctx, request.RevocationRequest{
+		Serial: fmt.Sprintf(`%x`, revoked.SerialNumber), AKI: fmt.Sprintf(`%x`, revoked.AuthorityKeyId), Reason: `superseded`,
+	})
+	t.Require().NoError(err)
+
+	_, err = admin.Register(ctx, request.Registration{Name: `ocsp`, Type: `client`, Secret: `ocsppw`})
+	t.Require().NoError(err)
+	signer, err := ocspresponder.EnrollResponder(ctx, ca.newClient(nil), `ocsp`, `ocsppw`)
+	t.Require().NoError(err)
+
+	responder, err := ocspresponder.New(ctx, admin, signer)
+	t.Require().NoError(err)
+	server := httptest.NewServer(responder)
+	defer server.Close()
+
+	query := func(cert *x509.Certificate, post bool) *ocsp.Response {
+		req, err := ocsp.CreateRequest(cert, ca.rootCert, &ocsp.RequestOptions{Hash: crypto.SHA256})
+		t.Require().NoError(err)
+
+		var resp *http.Response
+		if post {
+			resp, err = http.Post(server.URL, `application/ocsp-request`, bytes.NewReader(req))
+		} else {
+			resp, err = http.Get(server.URL + `/` + base64.StdEncoding.EncodeToString(req))
+		}
+		t.Require().NoError(err)
+		defer resp.Body.Close()
+		t.Require().Equal(`application/ocsp-response`, resp.Header.Get(`Content-Type`))
+
+		body, err := io.ReadAll(resp.Body)
+		t.Require().NoError(err)
+		parsed, err := ocsp.ParseResponseForCert(body, cert, ca.rootCert)
+		t.Require().NoError(err)
+		return parsed
+	}
+
+	t.WithNewStep("Responder without state asks to try later", func(sCtx provider.StepCtx) {
+		req, err := ocsp.CreateRequest(good, ca.rootCert, nil)
+		sCtx.Require().NoError(err)
+		resp, err := http.Post(server.URL, `application/ocsp-request`, bytes.NewReader(req))
+		sCtx.Require().NoError(err)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		sCtx.Require().Equal(ocsp.TryLaterErrorResponse, body)
+	})
+
+	t.WithNewStep("Statuses are served over GET and POST", func(sCtx provider.StepCtx) {
+		sCtx.Require().NoError(responder.Refresh(ctx))
+
+		resp := query(good, false)
+		sCtx.Require().Equal(ocsp.Good, resp.Status)
+		sCtx.Require().Equal(`ocsp`, resp.Certificate.Subject.CommonName, `response is signed by delegated responder`)
+
+		resp = query(revoked, true)
+		sCtx.Require().Equal(ocsp.Revoked, resp.Status)
+		sCtx.Require().Equal(ocsp.Superseded, resp.RevocationReason)
+		sCtx.Require().False(resp.RevokedAt.IsZero())
+	})
+
+	t.WithNewStep("Serials never issued by CA are unknown", func(sCtx provider.StepCtx) {
+		forged := *good
+		forged.SerialNumber = new(big.Int).Add(good.SerialNumber, big.NewInt(1000))
+		sCtx.Require().Equal(ocsp.Unknown, query(&forged, true).Status)
+		sCtx.Require().Equal(ocsp.Unknown, responder.Status(forged.SerialNumber))
+	})
+
+	t.WithNewStep("Revocation is visible after refresh", func(sCtx provider.StepCtx) {
+		_, err := admin.Revoke(ctx, request.RevocationRequest{Name: `good`})
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(ocsp.Good, query(good, true).Status)
+
+		sCtx.Require().NoError(responder.Refresh(ctx))
+		sCtx.Require().Equal(ocsp.Revoked, query(good, false).Status)
+	})
+
+	t.WithNewStep("Malformed requests and foreign issuers are rejected", func(sCtx provider.StepCtx) {
+		resp, err := http.Post(server.URL, `application/ocsp-request`, bytes.NewReader([]byte(`garbage`)))
+		sCtx.Require().NoError(err)
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		sCtx.Require().Equal(ocsp.MalformedRequestErrorResponse, body)
+
+		foreign := newSelfSignedSigner(`other-ca`)
+		foreignCert, err := parseSignerCert(foreign)
+		sCtx.Require().NoError(err)
+		req, err := ocsp.CreateRequest(good, foreignCert, nil)
+		sCtx.Require().NoError(err)
+		resp, err = http.Post(server.URL, `application/ocsp-request`, bytes.NewReader(req))
+		sCtx.Require().NoError(err)
+		body, _ = io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		sCtx.Require().Equal(ocsp.UnauthorizedErrorResponse, body)
+	})
+
+	t.WithNewStep("Responder certificate must allow OCSP signing", func(sCtx provider.StepCtx) {
+		_, err := ocspresponder.New(ctx, admin, ca.enroll(fakeAdminName, fakeAdminSecret))
+		sCtx.Require().Error(err)
+	})
+}
+
+func TestOCSP(t *testing.T) {
+	suite.RunSuite(t, new(OCSPSuite))
+}
@@ -0,0 +1,257 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hlfans/ca-sdk/pkg/oidcgateway"
+	"github.com/hlfans/ca-sdk/pkg/request"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+)
+
+const testIssuerAudience = `fabric-enroll`
+
+// testIssuer is local stand-in of OpenID provider publishing discovery document and ES256 key set
+type testIssuer struct {
+	*httptest.Server
+
+	mu   sync.Mutex
+	keys map[string]*ecdsa.PrivateKey
+}
+
+func newTestIssuer() *testIssuer {
+	iss := &testIssuer{keys: map[string]*ecdsa.PrivateKey{}}
+	iss.rotate(`key-1`)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(`GET /.well-known/openid-configuration`, func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{`issuer`: iss.URL, `jwks_uri`: iss.URL + `/jwks`})
+	})
+	mux.HandleFunc(`GET /jwks`, func(w http.ResponseWriter, _ *http.Request) {
+		iss.mu.Lock()
+		defer iss.mu.Unlock()
+		keys := []map[string]string{}
+		for kid, key := range iss.keys {
+			keys = append(keys, map[string]string{
+				`kty`: `EC`, `crv`: `P-256`, `kid`: kid, `use`: `sig`, `alg`: `ES256`,
+				`x`: base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+				`y`: base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+			})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{`keys`: keys})
+	})
+	iss.Server = httptest.NewServer(mux)
+	return iss
+}
+
+// rotate adds signing key
+func (iss *testIssuer) rotate(kid string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	iss.mu.Lock()
+	iss.keys[kid] = key
+	iss.mu.Unlock()
+}
+
+// token returns ID token for sub valid for an hour, extra claims override defaults
+func (iss *testIssuer) token(kid, sub string, extra map[string]interface{}) string {
+	now := time.Now()
+	claims := map[string]interface{}{
+		`iss`: iss.URL, `aud`: testIssuerAudience, `sub`: sub, `iat`: now.Unix(), `exp`: now.Add(time.Hour).Unix(),
+	}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	return iss.sign(kid, claims)
+}
+
+func (iss *testIssuer) sign(kid string, claims map[string]interface{}) string {
+	iss.mu.Lock()
+	key := iss.keys[kid]
+	iss.mu.Unlock()
+
+	header, _ := json.Marshal(map[string]string{`alg`: `ES256`, `kid`: kid, `typ`: `JWT`})
+	payload, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(header) + `.` + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(input))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	sig := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	return input + `.` + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+type OIDCGatewaySuite struct {
+	suite.Suite
+}
+
+func (s *OIDCGatewaySuite) TestEnroll(t provider.T) {
+	ca := newFakeCA()
+	defer ca.Close()
+	issuer := newTestIssuer()
+	defer issuer.Close()
+	ctx := context.Background()
+	admin := ca.adminClient()
+
+	verifier, err := oidcgateway.NewVerifier(ctx, issuer.URL, testIssuerAudience, oidcgateway.WithMinRefreshInterval(0))
+	t.Require().NoError(err)
+	gateway, err := oidcgateway.New(admin, verifier,
+		oidcgateway.WithSecretKey(bytes.Repeat([]byte{7}, 32)),
+		oidcgateway.WithMapper(oidcgateway.ClaimMapping{
+			NameClaim:        `email`,
+			Type:             request.IdentityTypeUser,
+			Affiliation:      `org1`,
+			AffiliationClaim: `department`,
+			Attrs:            map[string]string{`groups`: `groups`, `app.level`: `profile.level`},
+			Required:         map[string]string{`email_verified`: `true`},
+		}.Mapper()))
+	t.Require().NoError(err)
+	srv := httptest.NewServer(gateway.Handler())
+	defer srv.Close()
+
+	enroll := func(token, cn string) (int, map[string]interface{}) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		t.Require().NoError(err)
+		der, err := x509.CreateCertificateRequest(rand.Reader, newCSR(cn), key)
+		t.Require().NoError(err)
+		body, _ := json.Marshal(map[string]string{
+			`csr`: string(pem.EncodeToMemory(&pem.Block{Type: `CERTIFICATE REQUEST`, Bytes: der})),
+		})
+		req, err := http.NewRequest(http.MethodPost, srv.URL+`/enroll`, bytes.NewReader(body))
+		t.Require().NoError(err)
+		if token != `` {
+			req.Header.Set(`Authorization`, `Bearer `+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		t.Require().NoError(err)
+		defer resp.Body.Close()
+		out := map[string]interface{}{}
+		t.Require().NoError(json.NewDecoder(resp.Body).Decode(&out))
+		return resp.StatusCode, out
+	}
+	aliceClaims := map[string]interface{}{
+		`email`: `alice@example.com`, `email_verified`: true, `department`: `org1.department1`,
+		`groups`: []string{`dev`, `ops`}, `profile`: map[string]interface{}{`level`: 3},
+	}
+
+	t.WithNewStep("Missing identity is registered and enrolled", func(sCtx provider.StepCtx) {
+		status, out := enroll(issuer.token(`key-1`, `alice-sub`, aliceClaims), `alice@example.com`)
+		sCtx.Require().Equal(http.StatusCreated, status, out)
+		sCtx.Require().Equal(`alice@example.com`, out[`enrollment_id`])
+		sCtx.Require().Equal(true, out[`registered`])
+
+		block, _ := pem.Decode([]byte(out[`certificate`].(string)))
+		sCtx.Require().NotNil(block)
+		cert, err := x509.ParseCertificate(block.Bytes)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(`alice@example.com`, cert.Subject.CommonName)
+
+		identity, err := admin.IdentityGet(ctx, `alice@example.com`)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(`user`, identity.Type)
+		sCtx.Require().Equal(`org1.department1`, identity.Affiliation)
+		attrs := map[string]string{}
+		for _, a := range identity.Attrs {
+			attrs[a.Name] = a.Value
+		}
+		sCtx.Require().Equal(map[string]string{`groups`: `dev,ops`, `app.level`: `3`}, attrs)
+	})
+
+	t.WithNewStep("Known identity is enrolled again", func(sCtx provider.StepCtx) {
+		status, out := enroll(issuer.token(`key-1`, `alice-sub`, aliceClaims), `alice@example.com`)
+		sCtx.Require().Equal(http.StatusCreated, status, out)
+		sCtx.Require().Equal(false, out[`registered`])
+	})
+
+	t.WithNewStep("Rotated issuer key is fetched", func(sCtx provider.StepCtx) {
+		issuer.rotate(`key-2`)
+		status, out := enroll(issuer.token(`key-2`, `alice-sub`, aliceClaims), `alice@example.com`)
+		sCtx.Require().Equal(http.StatusCreated, status, out)
+	})
+
+	t.WithNewStep("Invalid tokens are rejected", func(sCtx provider.StepCtx) {
+		status, _ := enroll(``, `alice@example.com`)
+		sCtx.Require().Equal(http.StatusUnauthorized, status)
+
+		expired := issuer.token(`key-1`, `alice-sub`, map[string]interface{}{
+			`email`: `alice@example.com`, `email_verified`: true, `exp`: time.Now().Add(-time.Hour).Unix(),
+		})
+		status, _ = enroll(expired, `alice@example.com`)
+		sCtx.Require().Equal(http.StatusUnauthorized, status)
+
+		otherAudience := issuer.token(`key-1`, `alice-sub`, map[string]interface{}{
+			`email`: `alice@example.com`, `email_verified`: true, `aud`: []string{`other`},
+		})
+		status, _ = enroll(otherAudience, `alice@example.com`)
+		sCtx.Require().Equal(http.StatusUnauthorized, status)
+
+		other := newTestIssuer()
+		defer other.Close()
+		forged := other.sign(`key-1`, map[string]interface{}{
+			`iss`: issuer.URL, `aud`: testIssuerAudience, `sub`: `alice-sub`, `email`: `alice@example.com`,
+			`email_verified`: true, `exp`: time.Now().Add(time.Hour).Unix(),
+		})
+		status, out := enroll(forged, `alice@example.com`)
+		sCtx.Require().Equal(http.StatusUnauthorized, status)
+		sCtx.Require().Contains(out[`error`], `invalid signature`)
+	})
+
+	t.WithNewStep("Claims and CSR are checked", func(sCtx provider.StepCtx) {
+		unverified := issuer.token(`key-1`, `bob-sub`, map[string]interface{}{`email`: `bob@example.com`})
+		status, _ := enroll(unverified, `bob@example.com`)
+		sCtx.Require().Equal(http.StatusForbidden, status)
+
+		status, _ = enroll(issuer.token(`key-1`, `alice-sub`, aliceClaims), `admin`)
+		sCtx.Require().Equal(http.StatusBadRequest, status)
+	})
+
+	t.WithNewStep("Identity registered without gateway isn't enrolled", func(sCtx provider.StepCtx) {
+		_, err := admin.Register(ctx, request.Registration{Name: `carol@example.com`, Type: `user`, Secret: `carolpw`})
+		sCtx.Require().NoError(err)
+		token := issuer.token(`key-1`, `carol-sub`, map[string]interface{}{`email`: `carol@example.com`, `email_verified`: true})
+		status, _ := enroll(token, `carol@example.com`)
+		sCtx.Require().Equal(http.StatusForbidden, status)
+	})
+}
+
+func (s *OIDCGatewaySuite) TestPrivilegedAttributes(t provider.T) {
+	ca := newFakeCA()
+	defer ca.Close()
+	issuer := newTestIssuer()
+	defer issuer.Close()
+	ctx := context.Background()
+
+	verifier, err := oidcgateway.NewVerifier(ctx, issuer.URL, testIssuerAudience)
+	t.Require().NoError(err)
+	gateway, err := oidcgateway.New(ca.adminClient(), verifier, oidcgateway.WithMapper(oidcgateway.ClaimMapping{
+		Attrs: map[string]string{`hf.Registrar.Roles`: `roles`},
+	}.Mapper()))
+	t.Require().NoError(err)
+
+	_, err = gateway.Enroll(ctx, issuer.token(`key-1`, `mallory`, map[string]interface{}{`roles`: `*`}), newCSR(`mallory`))
+	t.Require().ErrorIs(err, oidcgateway.ErrForbidden)
+
+	_, err = ca.adminClient().IdentityGet(ctx, `mallory`)
+	t.Require().Error(err)
+}
+
+func TestOIDCGateway(t *testing.T) {
+	suite.RunSuite(t, new(OIDCGatewaySuite))
+}
@@ -0,0 +1,118 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hlfans/ca-sdk/pkg/config"
+	"github.com/hlfans/ca-sdk/pkg/operations"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+)
+
+const fakeMetrics = `# HELP api_request_count Number of requests made to an API
+# TYPE api_request_count counter
+api_request_count{api_name="cainfo",ca_name="ca",code="200"} 12
+api_request_count{api_name="enroll",ca_name="ca",code="201"} 3
+# HELP api_request_duration Time taken in seconds for the request to an API to be completed.
+# TYPE api_request_duration histogram
+api_request_duration_bucket{api_name="enroll",le="0.005"} 1
+api_request_duration_bucket{api_name="enroll",le="+Inf"} 3
+api_request_duration_sum{api_name="enroll"} 0.12
+api_request_duration_count{api_name="enroll"} 3
+# TYPE go_goroutines gauge
+go_goroutines 42 1700000000000
+`
+
+type OperationsSuite struct {
+	suite.Suite
+}
+
+func (s *OperationsSuite) TestOperationsClient(t provider.T) {
+	spec := `info`
+	healthy := false
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(`GET /healthz`, func(w http.ResponseWriter, _ *http.Request) {
+		if healthy {
+			_, _ = w.Write([]byte(`{"status":"OK","time":"2024-01-01T00:00:00Z"}`))
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(`{"status":"Service Unavailable","time":"2024-01-01T00:00:00Z",` +
+			`"failed_checks":[{"component":"db","reason":"connection refused"}]}`))
+	})
+	mux.HandleFunc(`GET /metrics`, func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(fakeMetrics))
+	})
+	mux.HandleFunc(`GET /logspec`, func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{`spec`: spec})
+	})
+	mux.HandleFunc(`PUT /logspec`, func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req[`spec`] == `invalid:` {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"Error":"invalid logging specification"}`))
+			return
+		}
+		spec = req[`spec`]
+		w.WriteHeader(http.StatusNoContent)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	cli, err := operations.NewHttp(operations.WithCAConfig(&config.CAConfig{Operations: config.OperationsConfig{Host: srv.URL}}))
+	t.Require().NoError(err)
+	ctx := context.Background()
+
+	t.WithNewStep("Health", func(sCtx provider.StepCtx) {
+		status, err := cli.Health(ctx)
+		sCtx.Require().NoError(err)
+		sCtx.Require().False(status.Healthy())
+		sCtx.Require().Equal([]operations.FailedCheck{{Component: `db`, Reason: `connection refused`}}, status.FailedChecks)
+
+		healthy = true
+		status, err = cli.Health(ctx)
+		sCtx.Require().NoError(err)
+		sCtx.Require().True(status.Healthy())
+	})
+
+	t.WithNewStep("Metrics", func(sCtx provider.StepCtx) {
+		families, err := cli.Metrics(ctx)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Len(families, 3)
+
+		counter, ok := operations.Find(families, `api_request_count`)
+		sCtx.Require().True(ok)
+		sCtx.Require().Equal(operations.MetricTypeCounter, counter.Type)
+		sCtx.Require().Equal(`enroll`, counter.Samples[1].Labels[`api_name`])
+		sCtx.Require().EqualValues(3, counter.Samples[1].Value)
+
+		histogram, ok := operations.Find(families, `api_request_duration`)
+		sCtx.Require().True(ok)
+		sCtx.Require().Len(histogram.Samples, 4)
+		sCtx.Require().Equal(`+Inf`, histogram.Samples[1].Labels[`le`])
+
+		gauge, ok := operations.Find(families, `go_goroutines`)
+		sCtx.Require().True(ok)
+		sCtx.Require().EqualValues(1700000000000, gauge.Samples[0].Timestamp)
+	})
+
+	t.WithNewStep("Log spec", func(sCtx provider.StepCtx) {
+		sCtx.Require().NoError(cli.SetLogSpec(ctx, `debug`))
+		current, err := cli.LogSpec(ctx)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(`debug`, current)
+		err = cli.SetLogSpec(ctx, `invalid:`)
+		sCtx.Require().Error(err)
+		sCtx.Require().Contains(err.Error(), `invalid logging specification`)
+	})
+}
+
+func TestOperations(t *testing.T) {
+	suite.RunSuite(t, new(OperationsSuite))
+}
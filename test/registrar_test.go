@@ -0,0 +1,122 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hlfans/ca-sdk/pkg/entity"
+	"github.com/hlfans/ca-sdk/pkg/registrar"
+	"github.com/hlfans/ca-sdk/pkg/request"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+)
+
+type RegistrarSuite struct {
+	suite.Suite
+}
+
+func (s *RegistrarSuite) TestPreflight(t provider.T) {
+	ca := newFakeCA()
+	defer ca.Close()
+	ctx := context.Background()
+
+	_, err := ca.adminClient().Register(ctx, request.Registration{
+		Name: `reg1`, Type: `client`, Secret: `pw`, Affiliation: `org1`,
+		Attrs: []request.Attribute{
+			{Name: request.AttrRegistrarRoles, Value: `client,peer`},
+			{Name: request.AttrRegistrarAttributes, Value: `role,app.*,hf.Registrar.Roles`},
+		},
+	})
+	t.Require().NoError(err)
+
+	signer := ca.enroll(`reg1`, `pw`)
+	cli := ca.newClient(signer)
+	reg, err := registrar.Lookup(ctx, cli, signer)
+	t.Require().NoError(err)
+	t.Require().Equal(`org1`, reg.Affiliation)
+
+	t.WithNewStep("Allowed registration", func(sCtx provider.StepCtx) {
+		sCtx.Require().NoError(reg.Check(request.Registration{
+			Name: `peer0`, Type: `peer`, Affiliation: `org1.department1`,
+			Attrs: []request.Attribute{{Name: `app.tier`, Value: `gold`}, {Name: request.AttrRegistrarRoles, Value: `client`}},
+		}))
+	})
+
+	t.WithNewStep("Every violation is reported", func(sCtx provider.StepCtx) {
+		err := reg.Check(request.Registration{
+			Name: `orderer0`, Type: `orderer`, Affiliation: `org2`,
+			Attrs: []request.Attribute{
+				{Name: `hf.Type`, Value: `admin`},
+				{Name: `secret.level`, Value: `1`},
+				{Name: request.AttrRegistrarRoles, Value: `admin`},
+				{Name: request.AttrRevoker, Value: `yes`},
+			},
+		})
+		sCtx.Require().ErrorIs(err, registrar.ErrPreflight)
+
+		var preflightErr *registrar.PreflightError
+		sCtx.Require().True(errors.As(err, &preflightErr))
+		fields := make([]string, len(preflightErr.Violations))
+		for i, v := range preflightErr.Violations {
+			fields[i] = v.Field
+		}
+		sCtx.Require().Equal([]string{`type`, `affiliation`, `hf.Type`, `secret.level`, `hf.Registrar.Roles`,
+			`hf.Revoker`, `hf.Revoker`}, fields)
+	})
+
+	t.WithNewStep("Checked client doesn't send invalid registration", func(sCtx provider.StepCtx) {
+		checked := registrar.NewCheckedClient(cli, reg)
+		before := ca.requestCount()
+		_, err := checked.Register(ctx, request.Registration{Name: `admin2`, Type: `admin`})
+		sCtx.Require().ErrorIs(err, registrar.ErrPreflight)
+		sCtx.Require().Equal(before, ca.requestCount())
+
+		_, err = checked.Register(ctx, request.Registration{Name: `user1`, Type: `client`, Affiliation: `org1`})
+		sCtx.Require().NoError(err)
+	})
+}
+
+func (s *RegistrarSuite) TestDelegateRoles(t provider.T) {
+	reg := &registrar.Registrar{EnrollmentID: `reg2`, Attrs: []entity.IdentityAttribute{
+		{Name: request.AttrRegistrarRoles, Value: `client,peer,orderer`},
+		{Name: request.AttrRegistrarDelegateRoles, Value: `client`},
+		{Name: request.AttrRegistrarAttributes, Value: `hf.Registrar.*`},
+	}}
+
+	t.WithNewStep("Roles of registered registrar are limited by DelegateRoles", func(sCtx provider.StepCtx) {
+		sCtx.Require().NoError(reg.Check(request.Registration{
+			Name: `peer0`, Type: `peer`, Attrs: []request.Attribute{{Name: request.AttrRegistrarRoles, Value: `client`}},
+		}))
+
+		err := reg.Check(request.Registration{
+			Name: `peer1`, Type: `peer`, Attrs: []request.Attribute{
+				{Name: request.AttrRegistrarRoles, Value: `client,peer`},
+				{Name: request.AttrRegistrarDelegateRoles, Value: `peer`},
+			},
+		})
+		var preflightErr *registrar.PreflightError
+		sCtx.Require().True(errors.As(err, &preflightErr))
+		sCtx.Require().Equal([]registrar.Violation{
+			{Field: request.AttrRegistrarRoles, Reason: `role "peer" is not in registrar hf.Registrar.DelegateRoles "client"`},
+			{Field: request.AttrRegistrarDelegateRoles, Reason: `role "peer" is not in registrar hf.Registrar.DelegateRoles "client"`},
+		}, preflightErr.Violations)
+	})
+
+	t.WithNewStep("Roles are delegable without DelegateRoles", func(sCtx provider.StepCtx) {
+		reg := &registrar.Registrar{EnrollmentID: `reg3`, Attrs: []entity.IdentityAttribute{
+			{Name: request.AttrRegistrarRoles, Value: `client,peer,orderer`},
+			{Name: request.AttrRegistrarAttributes, Value: `hf.Registrar.*`},
+		}}
+		sCtx.Require().NoError(reg.Check(request.Registration{
+			Name: `peer1`, Type: `peer`, Attrs: []request.Attribute{
+				{Name: request.AttrRegistrarRoles, Value: `client,peer`},
+				{Name: request.AttrRegistrarDelegateRoles, Value: `peer`},
+			},
+		}))
+	})
+}
+
+func TestRegistrar(t *testing.T) {
+	suite.RunSuite(t, new(RegistrarSuite))
+}
@@ -0,0 +1,94 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hlfans/ca-sdk/pkg/request"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+)
+
+type RequestSuite struct {
+	suite.Suite
+}
+
+func (s *RequestSuite) TestRegistrationBuilder(t provider.T) {
+	t.WithNewStep("Valid registrar", func(sCtx provider.StepCtx) {
+		reg, err := request.NewRegistration(`registrar1`, request.IdentityTypeAdmin).
+			WithAffiliation(`org1.department1`).
+			WithRegistrarRoles(request.IdentityTypeClient, request.IdentityTypePeer).
+			WithDelegateRoles(request.IdentityTypeClient).
+			WithRegistrarAttributes(`role`, `app.*`).
+			WithRevoker(true).
+			WithAttribute(`role`, `operator`, true).
+			Build()
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(`admin`, reg.Type)
+		sCtx.Require().Equal(request.Attribute{Name: `hf.Registrar.Roles`, Value: `client,peer`}, reg.Attrs[0])
+		sCtx.Require().Equal(request.Attribute{Name: `hf.Revoker`, Value: `true`}, reg.Attrs[3])
+	})
+
+	t.WithNewStep("Invalid values are rejected", func(sCtx provider.StepCtx) {
+		_, err := request.NewRegistration(`user1`, `client,admin`).
+			WithRegistrarRoles(`peer,orderer`).
+			WithDelegateRoles(``).
+			Build()
+		sCtx.Require().Error(err)
+		sCtx.Require().Contains(err.Error(), `invalid identity type "client,admin"`)
+		sCtx.Require().Contains(err.Error(), `hf.Registrar.Roles: invalid identity type "peer,orderer"`)
+		sCtx.Require().Contains(err.Error(), `hf.Registrar.DelegateRoles: invalid identity type ""`)
+	})
+
+	t.WithNewStep("Custom identity types are built", func(sCtx provider.StepCtx) {
+		reg, err := request.NewRegistration(`auditor1`, `auditor`).
+			WithRegistrarRoles(request.IdentityTypeClient, `auditor`).
+			WithDelegateRoles(`*`).
+			Build()
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(`auditor`, reg.Type)
+		sCtx.Require().Equal([]request.Attribute{
+			{Name: `hf.Registrar.Roles`, Value: `client,auditor`},
+			{Name: `hf.Registrar.DelegateRoles`, Value: `*`},
+		}, reg.Attrs)
+	})
+
+	t.WithNewStep("Validation pass before sending", func(sCtx provider.StepCtx) {
+		ca := newFakeCA()
+		defer ca.Close()
+		admin := ca.adminClient()
+		before := ca.requestCount()
+
+		_, err := admin.Register(context.Background(), request.Registration{
+			Name: `user1`, Type: `client`, Affiliation: `org1..department1`,
+			Attrs: []request.Attribute{{Name: `hf.Registrar.Role`, Value: `client`}, {Name: `hf.Revoker`, Value: `yes`}},
+		})
+		sCtx.Require().Error(err)
+		sCtx.Require().Contains(err.Error(), `unknown reserved attribute hf.Registrar.Role`)
+		sCtx.Require().Contains(err.Error(), `hf.Revoker: value "yes" is not boolean`)
+		sCtx.Require().Contains(err.Error(), `contains empty part`)
+		sCtx.Require().Equal(before, ca.requestCount())
+
+		err = request.Registration{
+			Name: `user1`, Type: `client`,
+			Attrs: []request.Attribute{{Name: `hf.Registrar.Roles`, Value: `client,,peer`}},
+		}.Validate()
+		sCtx.Require().Error(err)
+		sCtx.Require().Contains(err.Error(), `contains empty role`)
+	})
+
+	t.WithNewStep("Custom identity types are accepted as registrar roles", func(sCtx provider.StepCtx) {
+		err := request.Registration{
+			Name: `auditor1`, Type: `auditor`,
+			Attrs: []request.Attribute{
+				{Name: `hf.Registrar.Roles`, Value: `client, auditor`},
+				{Name: `hf.Registrar.DelegateRoles`, Value: `*`},
+			},
+		}.Validate()
+		sCtx.Require().NoError(err)
+	})
+}
+
+func TestRequest(t *testing.T) {
+	suite.RunSuite(t, new(RequestSuite))
+}
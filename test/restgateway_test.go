@@ -0,0 +1,303 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hlfans/ca-sdk/pkg/abac"
+	"github.com/hlfans/ca-sdk/pkg/client"
+	"github.com/hlfans/ca-sdk/pkg/entity"
+	"github.com/hlfans/ca-sdk/pkg/request"
+	"github.com/hlfans/ca-sdk/pkg/restgateway"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+)
+
+type RESTGatewaySuite struct {
+	suite.Suite
+}
+
+// gatewayCall sends JSON request to gateway with API key and decodes JSON response to out
+func gatewayCall(t provider.StepCtx, srv *httptest.Server, key, method, path string, body, out interface{}) (int, http.Header) {
+	var reader *bytes.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		t.Require().NoError(err)
+		reader = bytes.NewReader(raw)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequest(method, srv.URL+path, reader)
+	t.Require().NoError(err)
+	if key != `` {
+		req.Header.Set(`Authorization`, `Bearer `+key)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	t.Require().NoError(err)
+	defer resp.Body.Close()
+	if out != nil {
+		t.Require().NoError(json.NewDecoder(resp.Body).Decode(out))
+	}
+	return resp.StatusCode, resp.Header
+}
+
+func newPEMCSR(t provider.StepCtx, cn string) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	t.Require().NoError(err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, newCSR(cn), key)
+	t.Require().NoError(err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: `CERTIFICATE REQUEST`, Bytes: der}))
+}
+
+func (s *RESTGatewaySuite) TestAPI(t provider.T) {
+	ca := newFakeCA()
+	defer ca.Close()
+	ctx := context.Background()
+
+	var (
+		mu  sync.Mutex
+		now = time.Now()
+	)
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+
+	role := func(name, value string) *abac.Identity {
+		return &abac.Identity{EnrollmentID: name, Attrs: []entity.IdentityAttribute{{Name: `role`, Value: value}}}
+	}
+	gateway, err := restgateway.New(ctx, ca.adminClient(),
+		restgateway.WithAuthenticators(restgateway.APIKeys(map[string]*abac.Identity{
+			`operator-key`: role(`python-service`, `operator`),
+			`viewer-key`:   role(`dashboard`, `viewer`),
+			`security-key`: role(`security-bot`, `security`),
+		})),
+		restgateway.WithPolicy(client.OperationRegister, abac.MustCompile(`role == "operator"`)),
+		restgateway.WithPolicy(client.OperationEnroll, nil),
+		restgateway.WithPolicy(client.OperationRevoke, abac.MustCompile(`role == "security"`)),
+		restgateway.WithPolicy(client.OperationIdentityGet, nil),
+		restgateway.WithPolicy(client.OperationCertificateList, abac.MustCompile(`role in ["viewer", "security"]`)),
+		restgateway.WithQuota(client.OperationEnroll, restgateway.Quota{Requests: 2, Per: time.Minute}),
+		restgateway.WithClock(clock))
+	t.Require().NoError(err)
+	srv := httptest.NewServer(gateway.Handler())
+	defer srv.Close()
+
+	t.WithNewStep("OpenAPI document describes operations", func(sCtx provider.StepCtx) {
+		var doc struct {
+			OpenAPI    string                                       `json:"openapi"`
+			Paths      map[string]map[string]map[string]interface{} `json:"paths"`
+			Components struct {
+				Schemas map[string]struct {
+					Properties map[string]interface{} `json:"properties"`
+				} `json:"schemas"`
+				SecuritySchemes map[string]map[string]string `json:"securitySchemes"`
+			} `json:"components"`
+		}
+		status, _ := gatewayCall(sCtx, srv, ``, http.MethodGet, restgateway.OpenAPIPath, nil, &doc)
+		sCtx.Require().Equal(http.StatusOK, status)
+		sCtx.Require().Equal(`3.1.0`, doc.OpenAPI)
+		sCtx.Require().Equal(map[string]string{`type`: `apiKey`, `in`: `header`, `name`: `X-API-Key`},
+			doc.Components.SecuritySchemes[`apiKeyHeader`])
+		sCtx.Require().Equal(`mutualTLS`, doc.Components.SecuritySchemes[`mutualTLS`][`type`])
+		sCtx.Require().Equal(`register`, doc.Paths[`/v1/identities`][`post`][`operationId`])
+		sCtx.Require().Contains(doc.Paths[`/v1/identities`], `get`)
+		sCtx.Require().Contains(doc.Paths[`/v1/enroll`], `post`)
+		sCtx.Require().Contains(doc.Paths[`/v1/revoke`], `post`)
+		sCtx.Require().Contains(doc.Paths[`/v1/certificates`], `get`)
+		sCtx.Require().Contains(doc.Components.Schemas[`Registration`].Properties, `max_enrollments`)
+		sCtx.Require().Contains(doc.Components.Schemas[`EnrollRequest`].Properties, `csr`)
+		sCtx.Require().Contains(doc.Components.Schemas[`IdentityAttribute`].Properties, `ecert`)
+	})
+
+	t.WithNewStep("Callers are authenticated and authorized", func(sCtx provider.StepCtx) {
+		status, header := gatewayCall(sCtx, srv, ``, http.MethodGet, `/v1/certificates`, nil, nil)
+		sCtx.Require().Equal(http.StatusUnauthorized, status)
+		sCtx.Require().Equal(`Bearer`, header.Get(`WWW-Authenticate`))
+
+		status, _ = gatewayCall(sCtx, srv, `wrong-key`, http.MethodGet, `/v1/certificates`, nil, nil)
+		sCtx.Require().Equal(http.StatusUnauthorized, status)
+
+		// apiKeyHeader scheme of OpenAPI document
+		req, err := http.NewRequest(http.MethodGet, srv.URL+`/v1/certificates`, nil)
+		sCtx.Require().NoError(err)
+		req.Header.Set(`X-API-Key`, `viewer-key`)
+		resp, err := http.DefaultClient.Do(req)
+		sCtx.Require().NoError(err)
+		_ = resp.Body.Close()
+		sCtx.Require().Equal(http.StatusOK, resp.StatusCode)
+
+		var apiErr restgateway.Error
+		status, _ = gatewayCall(sCtx, srv, `viewer-key`, http.MethodPost, `/v1/identities`,
+			request.Registration{Name: `svc1`, Type: `client`}, &apiErr)
+		sCtx.Require().Equal(http.StatusForbidden, status)
+		sCtx.Require().Contains(apiErr.Error, `role == "operator"`)
+
+		// operation without policy is disabled
+		status, _ = gatewayCall(sCtx, srv, `operator-key`, http.MethodGet, `/v1/identities`, nil, nil)
+		sCtx.Require().Equal(http.StatusForbidden, status)
+	})
+
+	var secret string
+	t.WithNewStep("Identity is registered and enrolled with CSR", func(sCtx provider.StepCtx) {
+		var registered restgateway.RegisterResponse
+		status, _ := gatewayCall(sCtx, srv, `operator-key`, http.MethodPost, `/v1/identities`,
+			request.Registration{Name: `svc1`, Type: `client`, Affiliation: `org1`}, &registered)
+		sCtx.Require().Equal(http.StatusCreated, status)
+		sCtx.Require().NotEmpty(registered.Secret)
+		secret = registered.Secret
+
+		status, _ = gatewayCall(sCtx, srv, `operator-key`, http.MethodPost, `/v1/identities`,
+			request.Registration{Name: `svc1`, Type: `client`}, nil)
+		sCtx.Require().Equal(http.StatusConflict, status)
+
+		status, _ = gatewayCall(sCtx, srv, `operator-key`, http.MethodPost, `/v1/identities`,
+			request.Registration{Name: `svc2`, Type: `client`, Attrs: []request.Attribute{{Name: `hf.Revoker`, Value: `true`}}}, nil)
+		sCtx.Require().Equal(http.StatusForbidden, status)
+
+		var identity entity.Identity
+		status, _ = gatewayCall(sCtx, srv, `viewer-key`, http.MethodGet, `/v1/identities/svc1`, nil, &identity)
+		sCtx.Require().Equal(http.StatusOK, status)
+		sCtx.Require().Equal(`org1`, identity.Affiliation)
+
+		var enrolled restgateway.EnrollResponse
+		status, _ = gatewayCall(sCtx, srv, `operator-key`, http.MethodPost, `/v1/enroll`, restgateway.EnrollRequest{
+			EnrollmentID: `svc1`, Secret: secret, CSR: newPEMCSR(sCtx, `svc1`),
+		}, &enrolled)
+		sCtx.Require().Equal(http.StatusCreated, status)
+		block, _ := pem.Decode([]byte(enrolled.Certificate))
+		sCtx.Require().NotNil(block)
+		cert, err := x509.ParseCertificate(block.Bytes)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(`svc1`, cert.Subject.CommonName)
+		sCtx.Require().Equal(string(ca.chainPEM()), enrolled.Chain)
+
+		status, _ = gatewayCall(sCtx, srv, `operator-key`, http.MethodPost, `/v1/enroll`, restgateway.EnrollRequest{
+			EnrollmentID: `svc1`, Secret: `wrong`, CSR: newPEMCSR(sCtx, `svc1`),
+		}, nil)
+		sCtx.Require().Equal(http.StatusUnprocessableEntity, status)
+	})
+
+	t.WithNewStep("Quota limits requests of caller", func(sCtx provider.StepCtx) {
+		// two enrollments of operator are already counted in current window
+		status, header := gatewayCall(sCtx, srv, `operator-key`, http.MethodPost, `/v1/enroll`, restgateway.EnrollRequest{
+			EnrollmentID: `svc1`, Secret: secret, CSR: newPEMCSR(sCtx, `svc1`),
+		}, nil)
+		sCtx.Require().Equal(http.StatusTooManyRequests, status)
+		sCtx.Require().Equal(`60`, header.Get(`Retry-After`))
+
+		// quota is per caller
+		status, _ = gatewayCall(sCtx, srv, `viewer-key`, http.MethodPost, `/v1/enroll`, restgateway.EnrollRequest{
+			EnrollmentID: `svc1`, Secret: secret, CSR: newPEMCSR(sCtx, `svc1`),
+		}, nil)
+		sCtx.Require().Equal(http.StatusCreated, status)
+
+		mu.Lock()
+		now = now.Add(time.Minute)
+		mu.Unlock()
+		status, _ = gatewayCall(sCtx, srv, `operator-key`, http.MethodPost, `/v1/enroll`, restgateway.EnrollRequest{
+			EnrollmentID: `svc1`, Secret: secret, CSR: newPEMCSR(sCtx, `svc1`),
+		}, nil)
+		sCtx.Require().Equal(http.StatusCreated, status)
+	})
+
+	t.WithNewStep("Identity is revoked and certificates are listed", func(sCtx provider.StepCtx) {
+		var list restgateway.CertificateList
+		status, _ := gatewayCall(sCtx, srv, `viewer-key`, http.MethodGet, `/v1/certificates?id=svc1&revoked=false`, nil, &list)
+		sCtx.Require().Equal(http.StatusOK, status)
+		sCtx.Require().Len(list.Certificates, 3)
+
+		status, _ = gatewayCall(sCtx, srv, `operator-key`, http.MethodPost, `/v1/revoke`, request.RevocationRequest{Name: `svc1`}, nil)
+		sCtx.Require().Equal(http.StatusForbidden, status)
+
+		status, _ = gatewayCall(sCtx, srv, `security-key`, http.MethodPost, `/v1/revoke`, request.RevocationRequest{}, nil)
+		sCtx.Require().Equal(http.StatusBadRequest, status)
+
+		var revoked restgateway.RevokeResponse
+		status, _ = gatewayCall(sCtx, srv, `security-key`, http.MethodPost, `/v1/revoke`,
+			request.RevocationRequest{Name: `svc1`, Reason: `keycompromise`, GenCRL: true}, &revoked)
+		sCtx.Require().Equal(http.StatusOK, status)
+		block, _ := pem.Decode([]byte(revoked.CRL))
+		sCtx.Require().NotNil(block)
+		crl, err := x509.ParseRevocationList(block.Bytes)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Len(crl.RevokedCertificateEntries, 3)
+
+		status, _ = gatewayCall(sCtx, srv, `security-key`, http.MethodGet, `/v1/certificates?id=svc1&revoked=true`, nil, &list)
+		sCtx.Require().Equal(http.StatusOK, status)
+		sCtx.Require().Len(list.Certificates, 3)
+
+		status, _ = gatewayCall(sCtx, srv, `security-key`, http.MethodGet, `/v1/certificates?revoked=maybe`, nil, nil)
+		sCtx.Require().Equal(http.StatusBadRequest, status)
+	})
+}
+
+func (s *RESTGatewaySuite) TestAffiliationScope(t provider.T) {
+	ca := newFakeCA()
+	defer ca.Close()
+	ctx := context.Background()
+	admin := ca.adminClient()
+
+	for name, affiliation := range map[string]string{`org1-user`: `org1.department1`, `org2-user`: `org2`} {
+		_, err := admin.Register(ctx, request.Registration{Name: name, Type: `client`, Affiliation: affiliation})
+		t.Require().NoError(err)
+	}
+
+	gateway, err := restgateway.New(ctx, admin,
+		restgateway.WithAuthenticators(restgateway.APIKeys(map[string]*abac.Identity{
+			`org1-key`: {EnrollmentID: `org1-app`, Affiliation: `org1`},
+		})),
+		restgateway.WithPolicy(client.OperationRegister, nil),
+		restgateway.WithPolicy(client.OperationIdentityList, nil),
+		restgateway.WithPolicy(client.OperationIdentityGet, nil),
+		restgateway.WithPolicy(client.OperationRevoke, nil),
+		restgateway.WithAffiliationScope())
+	t.Require().NoError(err)
+	srv := httptest.NewServer(gateway.Handler())
+	defer srv.Close()
+
+	t.WithNewStep("Identities of other affiliations are hidden", func(sCtx provider.StepCtx) {
+		var list restgateway.IdentityList
+		status, _ := gatewayCall(sCtx, srv, `org1-key`, http.MethodGet, `/v1/identities`, nil, &list)
+		sCtx.Require().Equal(http.StatusOK, status)
+		sCtx.Require().Len(list.Identities, 1)
+		sCtx.Require().Equal(`org1-user`, list.Identities[0].Id)
+
+		status, _ = gatewayCall(sCtx, srv, `org1-key`, http.MethodGet, `/v1/identities/org2-user`, nil, nil)
+		sCtx.Require().Equal(http.StatusNotFound, status)
+		status, _ = gatewayCall(sCtx, srv, `org1-key`, http.MethodPost, `/v1/revoke`, request.RevocationRequest{Name: `org2-user`}, nil)
+		sCtx.Require().Equal(http.StatusNotFound, status)
+		status, _ = gatewayCall(sCtx, srv, `org1-key`, http.MethodPost, `/v1/revoke`,
+			request.RevocationRequest{Serial: `01`, AKI: `01020304`}, nil)
+		sCtx.Require().Equal(http.StatusForbidden, status)
+	})
+
+	t.WithNewStep("Registrations are limited to caller affiliation", func(sCtx provider.StepCtx) {
+		status, _ := gatewayCall(sCtx, srv, `org1-key`, http.MethodPost, `/v1/identities`,
+			request.Registration{Name: `other`, Type: `client`, Affiliation: `org2`}, nil)
+		sCtx.Require().Equal(http.StatusForbidden, status)
+
+		status, _ = gatewayCall(sCtx, srv, `org1-key`, http.MethodPost, `/v1/identities`,
+			request.Registration{Name: `scoped`, Type: `client`}, nil)
+		sCtx.Require().Equal(http.StatusCreated, status)
+		identity, err := admin.IdentityGet(ctx, `scoped`)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(`org1`, identity.Affiliation)
+	})
+}
+
+func TestRESTGateway(t *testing.T) {
+	suite.RunSuite(t, new(RESTGatewaySuite))
+}
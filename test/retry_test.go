@@ -0,0 +1,123 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hlfans/ca-sdk/pkg/client"
+	"github.com/hlfans/ca-sdk/pkg/config"
+	"github.com/hlfans/ca-sdk/pkg/request"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+)
+
+type RetrySuite struct {
+	suite.Suite
+}
+
+var testRetryPolicy = client.RetryPolicy{
+	MaxAttempts:       3,
+	InitialBackoff:    time.Millisecond,
+	MaxBackoff:        10 * time.Millisecond,
+	Multiplier:        2,
+	RetryableStatuses: []int{http.StatusServiceUnavailable},
+}
+
+// flakyServer responds with 503 on first `failures` requests and then proxies to fake CA
+func flakyServer(ca *fakeCA, failures int32, retryAfter string) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			if retryAfter != `` {
+				w.Header().Set(`Retry-After`, retryAfter)
+			}
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		ca.Config.Handler.ServeHTTP(w, r)
+	}))
+	return srv, &calls
+}
+
+func (s *RetrySuite) TestIdempotentRetry(t provider.T) {
+	ca := newFakeCA()
+	defer ca.Close()
+	srv, calls := flakyServer(ca, 2, ``)
+	defer srv.Close()
+
+	cli, err := client.NewHttp(client.WithRawConfig(&config.CAConfig{Host: srv.URL}), client.WithRetry(testRetryPolicy))
+	t.Require().NoError(err)
+
+	_, err = cli.CAInfo(context.Background())
+	t.Require().NoError(err)
+	t.Require().EqualValues(3, calls.Load())
+}
+
+func (s *RetrySuite) TestNonIdempotentNotRetriedOnStatus(t provider.T) {
+	ca := newFakeCA()
+	defer ca.Close()
+	srv, calls := flakyServer(ca, 2, ``)
+	defer srv.Close()
+
+	cli, err := client.NewHttp(client.WithRawConfig(&config.CAConfig{Host: srv.URL}), client.WithRetry(testRetryPolicy))
+	t.Require().NoError(err)
+
+	_, _, err = cli.Enroll(context.Background(), fakeAdminName, fakeAdminSecret, newCSR(fakeAdminName))
+	t.Require().Error(err)
+	t.Require().EqualValues(1, calls.Load())
+}
+
+func (s *RetrySuite) TestNonIdempotentRetriedBeforeSend(t provider.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	var dials atomic.Int32
+	httpClient := &http.Client{Transport: &countingTransport{RoundTripper: http.DefaultTransport, calls: &dials}}
+	cli, err := client.NewHttp(client.WithRawConfig(&config.CAConfig{Host: srv.URL}),
+		client.WithHTTPClient(httpClient), client.WithRetry(testRetryPolicy),
+		client.WithIdentity(newSelfSignedSigner(`admin`)))
+	t.Require().NoError(err)
+
+	_, err = cli.Register(context.Background(), request.Registration{Name: `user1`})
+	t.Require().Error(err)
+	t.Require().EqualValues(3, dials.Load())
+}
+
+func (s *RetrySuite) TestRetryAfterRespectsDeadline(t provider.T) {
+	ca := newFakeCA()
+	defer ca.Close()
+	srv, calls := flakyServer(ca, 2, `5`)
+	defer srv.Close()
+
+	policy := testRetryPolicy
+	policy.MaxBackoff = time.Minute
+	cli, err := client.NewHttp(client.WithRawConfig(&config.CAConfig{Host: srv.URL}), client.WithRetry(policy))
+	t.Require().NoError(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	started := time.Now()
+	_, err = cli.CAInfo(ctx)
+	t.Require().Error(err)
+	t.Require().Less(time.Since(started), time.Second)
+	t.Require().EqualValues(1, calls.Load())
+}
+
+type countingTransport struct {
+	http.RoundTripper
+	calls *atomic.Int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.calls.Add(1)
+	return t.RoundTripper.RoundTrip(req)
+}
+
+func TestRetry(t *testing.T) {
+	suite.RunSuite(t, new(RetrySuite))
+}
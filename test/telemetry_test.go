@@ -0,0 +1,102 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/hlfans/ca-sdk/pkg/client"
+	"github.com/hlfans/ca-sdk/pkg/config"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type TelemetrySuite struct {
+	suite.Suite
+}
+
+func (s *TelemetrySuite) TestSpansAndMetrics(t provider.T) {
+	ca := newFakeCA()
+	defer ca.Close()
+
+	var (
+		mu           sync.Mutex
+		traceparents []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		traceparents = append(traceparents, r.Header.Get(`traceparent`))
+		mu.Unlock()
+		ca.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	cli, err := client.NewHttp(client.WithRawConfig(&config.CAConfig{Host: srv.URL}),
+		client.WithTracerProvider(tp), client.WithMeterProvider(mp))
+	t.Require().NoError(err)
+
+	ctx := context.Background()
+	_, err = cli.CAInfo(ctx)
+	t.Require().NoError(err)
+	_, _, err = cli.Enroll(ctx, fakeAdminName, `wrong`, newCSR(fakeAdminName))
+	t.Require().ErrorIs(err, client.ErrAuthenticationFailure)
+
+	t.WithNewStep("Spans", func(sCtx provider.StepCtx) {
+		spans := exporter.GetSpans()
+		sCtx.Require().Len(spans, 2)
+		sCtx.Require().Equal(`fabric-ca CAInfo`, spans[0].Name)
+		sCtx.Require().Equal(codes.Error, spans[1].Status.Code)
+
+		attrs := attribute.NewSet(spans[1].Attributes...)
+		hash, ok := attrs.Value(`fabric_ca.enrollment_id.hash`)
+		sCtx.Require().True(ok)
+		sCtx.Require().NotEqual(fakeAdminName, hash.AsString())
+		codesAttr, ok := attrs.Value(`fabric_ca.error.codes`)
+		sCtx.Require().True(ok)
+		sCtx.Require().Equal([]int64{20}, codesAttr.AsInt64Slice())
+
+		sCtx.Require().Len(traceparents, 2)
+		sCtx.Require().Contains(traceparents[0], spans[0].SpanContext.TraceID().String())
+	})
+
+	t.WithNewStep("Metrics", func(sCtx provider.StepCtx) {
+		var rm metricdata.ResourceMetrics
+		sCtx.Require().NoError(reader.Collect(ctx, &rm))
+
+		metrics := map[string]metricdata.Aggregation{}
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				metrics[m.Name] = m.Data
+			}
+		}
+
+		requests := metrics[`fabric_ca.client.requests`].(metricdata.Sum[int64])
+		sCtx.Require().Len(requests.DataPoints, 2)
+
+		errs := metrics[`fabric_ca.client.errors`].(metricdata.Sum[int64])
+		sCtx.Require().Len(errs.DataPoints, 1)
+		code, ok := errs.DataPoints[0].Attributes.Value(`fabric_ca.error.code`)
+		sCtx.Require().True(ok)
+		sCtx.Require().EqualValues(20, code.AsInt64())
+
+		duration := metrics[`fabric_ca.client.duration`].(metricdata.Histogram[float64])
+		sCtx.Require().Len(duration.DataPoints, 2)
+	})
+}
+
+func TestTelemetry(t *testing.T) {
+	suite.RunSuite(t, new(TelemetrySuite))
+}
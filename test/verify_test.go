@@ -0,0 +1,167 @@
+package test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hlfans/ca-sdk/pkg/request"
+	"github.com/hlfans/ca-sdk/pkg/verify"
+	"github.com/ozontech/allure-go/pkg/framework/provider"
+	"github.com/ozontech/allure-go/pkg/framework/suite"
+)
+
+type VerifySuite struct {
+	suite.Suite
+}
+
+func (s *VerifySuite) TestVerify(t provider.T) {
+	ca := newFakeCA()
+	defer ca.Close()
+	ctx := context.Background()
+	admin := ca.adminClient()
+
+	now := time.Now()
+	verifier, err := verify.New(ctx, admin, verify.WithClock(func() time.Time { return now }))
+	t.Require().NoError(err)
+
+	enroll := func(name string) *x509.Certificate {
+		_, err := admin.Register(ctx, request.Registration{Name: name, Type: `client`, Secret: name + `pw`})
+		t.Require().NoError(err)
+		cert, _, err := ca.newClient(nil).Enroll(ctx, name, name+`pw`, newCSR(name))
+		t.Require().NoError(err)
+		return cert
+	}
+	user1, user2 := enroll(`user1`), enroll(`user2`)
+
+	t.WithNewStep("Enrolled certificate is valid", func(sCtx provider.StepCtx) {
+		result, err := verifier.Verify(ctx, user1)
+		sCtx.Require().NoError(err)
+		sCtx.Require().True(result.Valid())
+		sCtx.Require().Len(result.Chain, 2)
+		sCtx.Require().Equal(ca.rootCert.Raw, result.Chain[1].Raw)
+	})
+
+	t.WithNewStep("Revocation is reported after CRL cache expires", func(sCtx provider.StepCtx) {
+		_, err := admin.Revoke(ctx, request.RevocationRequest{
+			Serial: fmt.Sprintf(`%x`, user1.SerialNumber), AKI: fmt.Sprintf(`%x`, user1.AuthorityKeyId), Reason: `keycompromise`,
+		})
+		sCtx.Require().NoError(err)
+
+		result, err := verifier.Verify(ctx, user1)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(verify.StatusValid, result.Status, `cached CRL is used`)
+
+		now = now.Add(10 * time.Minute)
+		result, err = verifier.Verify(ctx, user1)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(verify.StatusRevoked, result.Status)
+		sCtx.Require().Equal(1, result.RevocationReason)
+		sCtx.Require().False(result.RevokedAt.IsZero())
+
+		result, err = verifier.Verify(ctx, user2)
+		sCtx.Require().NoError(err)
+		sCtx.Require().True(result.Valid())
+	})
+
+	t.WithNewStep("Revoke with GenCRL returns CRL", func(sCtx provider.StepCtx) {
+		crl, err := admin.Revoke(ctx, request.RevocationRequest{Name: `user2`, GenCRL: true})
+		sCtx.Require().NoError(err)
+		sCtx.Require().NotNil(crl)
+		sCtx.Require().Len(crl.TBSCertList.RevokedCertificates, 2)
+
+		verifier.Refresh()
+		result, err := verifier.Verify(ctx, user2)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(verify.StatusRevoked, result.Status)
+		sCtx.Require().Equal(0, result.RevocationReason)
+	})
+
+	t.WithNewStep("Validity period is checked", func(sCtx provider.StepCtx) {
+		v, err := verify.New(ctx, admin, verify.WithClock(func() time.Time { return time.Now().Add(13 * time.Hour) }))
+		sCtx.Require().NoError(err)
+		result, err := v.Verify(ctx, user1)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(verify.StatusExpired, result.Status)
+
+		v, err = verify.New(ctx, admin, verify.WithClock(func() time.Time { return time.Now().Add(-30 * time.Minute) }))
+		sCtx.Require().NoError(err)
+		result, err = v.Verify(ctx, user1)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(verify.StatusNotYetValid, result.Status)
+	})
+
+	t.WithNewStep("Foreign certificate has unknown issuer", func(sCtx provider.StepCtx) {
+		foreign, err := parseSignerCert(newSelfSignedSigner(`stranger`))
+		sCtx.Require().NoError(err)
+
+		result, err := verifier.Verify(ctx, foreign)
+		sCtx.Require().NoError(err)
+		sCtx.Require().Equal(verify.StatusUnknownIssuer, result.Status)
+		sCtx.Require().Error(result.Err)
+	})
+}
+
+func (s *VerifySuite) TestMiddleware(t provider.T) {
+	ca := newFakeCA()
+	defer ca.Close()
+	ctx := context.Background()
+	admin := ca.adminClient()
+
+	verifier, err := verify.New(ctx, admin)
+	t.Require().NoError(err)
+
+	server := httptest.NewUnstartedServer(verifier.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result, _ := verify.ResultFromContext(r.Context())
+		_, _ = io.WriteString(w, result.Chain[0].Subject.CommonName)
+	})))
+	server.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	_, err = admin.Register(ctx, request.Registration{Name: `peer0`, Type: `peer`, Secret: `peer0pw`})
+	t.Require().NoError(err)
+	cert, key, err := ca.newClient(nil).Enroll(ctx, `peer0`, `peer0pw`, newCSR(`peer0`))
+	t.Require().NoError(err)
+
+	call := func(certs ...tls.Certificate) (int, string) {
+		transport := server.Client().Transport.(*http.Transport).Clone()
+		transport.TLSClientConfig.Certificates = certs
+		resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+		t.Require().NoError(err)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	t.WithNewStep("Valid client certificate is accepted", func(sCtx provider.StepCtx) {
+		status, body := call(tls.Certificate{Certificate: [][]byte{cert.Raw}, PrivateKey: key})
+		sCtx.Require().Equal(http.StatusOK, status)
+		sCtx.Require().Equal(`peer0`, body)
+	})
+
+	t.WithNewStep("Missing certificate is rejected", func(sCtx provider.StepCtx) {
+		status, _ := call()
+		sCtx.Require().Equal(http.StatusUnauthorized, status)
+	})
+
+	t.WithNewStep("Revoked certificate is rejected", func(sCtx provider.StepCtx) {
+		_, err := admin.Revoke(ctx, request.RevocationRequest{Name: `peer0`})
+		sCtx.Require().NoError(err)
+		verifier.Refresh()
+
+		status, body := call(tls.Certificate{Certificate: [][]byte{cert.Raw}, PrivateKey: key})
+		sCtx.Require().Equal(http.StatusUnauthorized, status)
+		sCtx.Require().Contains(body, `revoked`)
+	})
+}
+
+func TestVerify(t *testing.T) {
+	suite.RunSuite(t, new(VerifySuite))
+}